@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Implements config/appyaml_env buildpack.
+// The appyaml_env buildpack sets the env_variables defined in app.yaml in the launch environment, and optionally in
+// the build environment, as App Engine does for deployed applications.
+package main
+
+import (
+	"sort"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/appyaml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+func main() {
+	gcp.Main(detectFn, buildFn)
+}
+
+func detectFn(ctx *gcp.Context) error {
+	if !ctx.FileExists(appyaml.Path(ctx.ApplicationRoot())) {
+		ctx.OptOut("app.yaml not found.")
+	}
+	return nil
+}
+
+func buildFn(ctx *gcp.Context) error {
+	vars, err := appyaml.EnvVariables(appyaml.Path(ctx.ApplicationRoot()))
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		ctx.Debugf("No env_variables defined in app.yaml.")
+		return nil
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	build := buildEnv(ctx)
+	l := ctx.Layer("appyaml_env")
+	for _, name := range names {
+		ctx.DefaultLaunchEnv(l, name, "%s", vars[name])
+		if build {
+			ctx.DefaultBuildEnv(l, name, "%s", vars[name])
+		}
+	}
+	if build {
+		ctx.Logf("Setting env_variables from app.yaml at build time and launch: %v", names)
+		ctx.WriteMetadata(l, nil, layers.Build, layers.Launch)
+		return nil
+	}
+	ctx.Logf("Setting env_variables from app.yaml at launch: %v (set %s=true to also set them at build time)", names, env.AppYAMLBuildEnv)
+	ctx.WriteMetadata(l, nil, layers.Launch)
+	return nil
+}
+
+// buildEnv returns true if the env_variables should also be set in the build environment.
+func buildEnv(ctx *gcp.Context) bool {
+	build, err := env.IsPresentAndTrue(env.AppYAMLBuildEnv)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.AppYAMLBuildEnv, err)
+		return false
+	}
+	return build
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		env   []string
+		want  int
+	}{
+		{
+			name: "app.yaml",
+			files: map[string]string{
+				"app.yaml": "env_variables:\n  A: b\n",
+			},
+			want: 0,
+		},
+		{
+			name: "app.yaml at custom path",
+			files: map[string]string{
+				"config/app.yaml": "env_variables:\n  A: b\n",
+			},
+			env:  []string{"GAE_APPLICATION_YAML_PATH=config/app.yaml"},
+			want: 0,
+		},
+		{
+			name:  "no app.yaml",
+			files: map[string]string{},
+			want:  100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gcp.TestDetect(t, detectFn, tc.name, tc.files, tc.env, tc.want)
+		})
+	}
+}
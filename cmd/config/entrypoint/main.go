@@ -18,17 +18,12 @@ package main
 
 import (
 	"os"
-	"regexp"
-	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 )
 
-var (
-	webRegexp = regexp.MustCompile(`(?m)^web:(.+)$`)
-)
-
 func main() {
 	gcp.Main(detectFn, buildFn)
 }
@@ -41,27 +36,11 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
-	entrypoint := os.Getenv(env.Entrypoint)
-	if entrypoint != "" {
-		ctx.Logf("Using entrypoint from %s: %s", env.Entrypoint, entrypoint)
-	} else {
-		b := ctx.ReadFile("Procfile")
-		var err error
-		entrypoint, err = procfileWebProcess(string(b))
-		if err != nil {
-			return err
-		}
-		ctx.Logf("Using entrypoint from Procfile: %s", entrypoint)
+	ep, err := entrypoint.Resolve(ctx, "")
+	if err != nil {
+		return err
 	}
 	// Use /bin/bash because lifecycle/launcher will assume the whole command is a single executable.
-	ctx.AddWebProcess([]string{"/bin/bash", "-c", entrypoint})
+	ctx.AddWebProcess([]string{"/bin/bash", "-c", ep.Command})
 	return nil
 }
-
-func procfileWebProcess(content string) (string, error) {
-	matches := webRegexp.FindStringSubmatch(content)
-	if len(matches) != 2 {
-		return "", gcp.UserErrorf("could not find web process in Procfile: %v", matches)
-	}
-	return strings.TrimSpace(matches[1]), nil
-}
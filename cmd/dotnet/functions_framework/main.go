@@ -17,8 +17,6 @@
 package main
 
 import (
-	"os"
-
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
@@ -33,10 +31,10 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
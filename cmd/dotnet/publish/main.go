@@ -25,6 +25,7 @@ import (
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/dotnet"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
@@ -103,22 +104,21 @@ func buildFn(ctx *gcp.Context) error {
 	ctx.Exec(cmd, gcp.WithEnv("DOTNET_CLI_TELEMETRY_OPTOUT=true"), gcp.WithUserAttribution)
 
 	// Infer the entrypoint in case an explicit override was not provided.
-	entrypoint := os.Getenv(env.Entrypoint)
-	if entrypoint == "" {
+	command := os.Getenv(env.Entrypoint)
+	if command == "" {
 		ep, err := getEntrypoint(ctx, "bin", proj)
 		if err != nil {
 			return fmt.Errorf("getting entrypoint: %w", err)
 		}
-		entrypoint = strings.Join(ep, " ")
-		ctx.DefaultBuildEnv(binLayer, env.Entrypoint, entrypoint)
+		command = strings.Join(ep, " ")
+		ctx.DefaultBuildEnv(binLayer, env.Entrypoint, command)
 	}
 	ctx.DefaultLaunchEnv(binLayer, "DOTNET_RUNNING_IN_CONTAINER", "true")
 	ctx.WriteMetadata(binLayer, nil, layers.Build, layers.Launch)
 
 	// Configure the entrypoint for production.
 	if !devmode.Enabled(ctx) {
-		ctx.AddWebProcess([]string{"/bin/bash", "-c", "exec " + entrypoint})
-		return nil
+		return entrypoint.AddProcesses(ctx, []string{"/bin/bash", "-c", "exec " + command})
 	}
 
 	// Configure the entrypoint and metadata for dev mode.
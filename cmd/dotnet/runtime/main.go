@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/dotnet"
@@ -64,6 +65,7 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return err
 	}
+	ctx.RecordRuntimeVersion("dotnet", version)
 
 	// Check the metadata in the cache layer to determine if we need to proceed.
 	var sdkMeta metadata
@@ -102,8 +104,9 @@ func buildFn(ctx *gcp.Context) error {
 	// With --keep-directory-symlink, the SDK will be unpacked into /runtime/sdk,
 	// which is symlinked to the SDK layer. This is needed because the dotnet CLI
 	// needs an sdk directory in the same directory as the dotnet executable.
-	command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --keep-directory-symlink --strip-components=1", archiveURL, rtl.Root)
-	ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+	if err := ctx.DownloadAndExtract(archiveURL, rtl.Root, "--keep-directory-symlink", "--strip-components=1"); err != nil {
+		return gcp.DownloadErrorf(err, "downloading .NET SDK v%s", version)
+	}
 
 	// Keep the SDK layer for launch in devmode because we use `dotnet watch`.
 	sdkMeta.Version = version
@@ -160,9 +163,12 @@ func runtimeVersion(ctx *gcp.Context) (string, error) {
 	}
 
 	// Use the latest LTS version.
-	command := fmt.Sprintf("curl --silent %s | tail -n 1", versionURL)
-	result := ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
-	version = result.Stdout
+	versions, err := ctx.DownloadString(versionURL)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSpace(versions), "\n")
+	version = strings.TrimSpace(lines[len(lines)-1])
 	ctx.Logf("Using the latest LTS version of .NET Core SDK: %s", version)
 	return version, nil
 }
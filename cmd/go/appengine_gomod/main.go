@@ -78,7 +78,7 @@ func mainPath(ctx *gcp.Context) string {
 	}
 
 	if pathFile := filepath.Join(ctx.ApplicationRoot(), stagerFileName); ctx.FileExists(pathFile) {
-		path := string(ctx.ReadFile(pathFile))
+		path := string(ctx.ReadFileNormalized(pathFile))
 		ctx.RemoveAll(pathFile)
 		return path
 	}
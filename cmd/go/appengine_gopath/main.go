@@ -71,7 +71,7 @@ func buildFn(ctx *gcp.Context) error {
 
 	var buildMainPath string
 	if ctx.FileExists(stagerGoPathMain) {
-		buildMainPath = filepath.Join(goPathSrc, strings.TrimSpace(string(ctx.ReadFile(stagerGoPathMain))))
+		buildMainPath = filepath.Join(goPathSrc, strings.TrimSpace(string(ctx.ReadFileNormalized(stagerGoPathMain))))
 		// Remove stager directory prior to copying to make sure we don't copy the stager directory to $GOPATH.
 		ctx.RemoveAll(stagerGoPath)
 		ctx.MkdirAll(buildMainPath, 0755)
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/golang"
@@ -77,8 +78,7 @@ func buildFn(ctx *gcp.Context) error {
 	// Configure the entrypoint for production.  Use the full path to save `skaffold debug`
 	// from fetching the remote container image (tens to hundreds of megabytes), which is slow.
 	if !devmode.Enabled(ctx) {
-		ctx.AddWebProcess([]string{outBin})
-		return nil
+		return entrypoint.AddProcesses(ctx, []string{outBin})
 	}
 
 	// Configure the entrypoint and metadata for dev mode.
@@ -18,7 +18,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -54,10 +53,10 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
@@ -67,11 +66,7 @@ func buildFn(ctx *gcp.Context) error {
 
 	ctx.SetFunctionsEnvVars(l)
 
-	fnTarget := os.Getenv(env.FunctionTarget)
-	// TODO(b/154846199): For compatibility with GCF; this will be removed later.
-	if fnTarget == "" {
-		fnTarget = os.Getenv(env.FunctionTargetLaunch)
-	}
+	fnTarget, _ := env.FunctionTargetResolved(nil)
 
 	// Move the function source code into a subdirectory in order to construct the app in the main application root.
 	ctx.RemoveAll(fnSourceDir)
@@ -102,7 +97,7 @@ func buildFn(ctx *gcp.Context) error {
 		}
 	}
 
-	ctx.AddWebProcess([]string{golang.OutBin})
+	ctx.AddWebProcessWithHealthCheck([]string{golang.OutBin}, gcp.PortHealthCheck)
 	return nil
 }
 
@@ -19,7 +19,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 
@@ -34,7 +33,7 @@ import (
 const (
 	// goVersionURL is a URL to a JSON file that contains the latest Go version names.
 	goVersionURL = "https://golang.org/dl/?mode=json"
-	goURL        = "https://dl.google.com/go/go%s.linux-amd64.tar.gz"
+	goURL        = "https://dl.google.com/go/go%s.%s-%s.tar.gz"
 	goLayer      = "go"
 )
 
@@ -61,6 +60,7 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return err
 	}
+	ctx.RecordRuntimeVersion("go", version)
 	grl := ctx.Layer(goLayer)
 	// Check metadata layer to see if correct version of Go is already installed.
 	var meta metadata
@@ -71,15 +71,17 @@ func buildFn(ctx *gcp.Context) error {
 		ctx.CacheMiss(goLayer)
 		ctx.ClearLayer(grl)
 
-		archiveURL := fmt.Sprintf(goURL, version)
-		if code := ctx.HTTPStatus(archiveURL); code != http.StatusOK {
-			return gcp.UserErrorf("Runtime version %s does not exist at %s (status %d). You can specify the version with %s.", version, archiveURL, code, env.RuntimeVersion)
+		p := ctx.Platform()
+		archiveURL, err := ctx.FindArtifactURL(fmt.Sprintf(goURL, version, p.OS, p.Arch))
+		if err != nil {
+			return gcp.UserErrorf("Runtime version %s does not exist: %v. You can specify the version with %s.", version, err, env.RuntimeVersion)
 		}
 
 		// Download and install Go in layer.
 		ctx.Logf("Installing Go v%s", version)
-		command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --strip-components=1", archiveURL, grl.Root)
-		ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+		if err := ctx.DownloadAndExtract(archiveURL, grl.Root, "--strip-components=1"); err != nil {
+			return gcp.DownloadErrorf(err, "downloading Go v%s", version)
+		}
 
 		meta.Version = version
 	}
@@ -118,8 +120,11 @@ type goReleases []struct {
 
 // latestGoVersion returns the latest version of Go
 func latestGoVersion(ctx *gcp.Context) (string, error) {
-	result := ctx.Exec([]string{"curl", "--silent", goVersionURL}, gcp.WithUserAttribution)
-	return parseVersionJSON(result.Stdout)
+	jsonStr, err := ctx.DownloadString(goVersionURL)
+	if err != nil {
+		return "", err
+	}
+	return parseVersionJSON(jsonStr)
 }
 
 func parseVersionJSON(jsonStr string) (string, error) {
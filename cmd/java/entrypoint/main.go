@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/java"
 )
@@ -38,7 +39,7 @@ func buildFn(ctx *gcp.Context) error {
 		return fmt.Errorf("finding executable jar: %w", err)
 	}
 
-	command := []string{"java", "-jar", executable}
+	command := java.Command("-jar", executable)
 
 	// Configure the entrypoint and metadata for dev mode.
 	if devmode.Enabled(ctx) {
@@ -53,6 +54,5 @@ func buildFn(ctx *gcp.Context) error {
 	}
 
 	// Configure the entrypoint for production.
-	ctx.AddWebProcess(command)
-	return nil
+	return entrypoint.AddProcesses(ctx, command)
 }
@@ -18,6 +18,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/java"
 )
@@ -38,6 +39,5 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return fmt.Errorf("extracting Main-Class from %s: %w", java.ManifestPath, err)
 	}
-	ctx.AddWebProcess([]string{"java", "-classpath", ".", main})
-	return nil
+	return entrypoint.AddProcesses(ctx, java.Command("-classpath", ".", main))
 }
@@ -18,9 +18,50 @@
 # launch the java command we are given. If it is not set, and we have a hint
 # from the environment of what the memory size is, then we set JAVA_TOOL_OPTIONS
 # to a value that should cause the JVM to use that memory size minus 80M.
-# The JVM reads command-line options from this environment variable.
+# Otherwise, if the container has a cgroup memory limit and the command does not
+# size the heap itself, for example with -Xmx in GOOGLE_JAVA_OPTS, we limit the
+# heap to a share of the container memory, leaving room for the rest of the JVM,
+# so that it is not killed for exceeding the limit.
+# The JVM reads command-line options from this environment variable, and options
+# on the command line take precedence over them.
+
+# default_max_ram_percentage is the share of the container memory used for the heap.
+default_max_ram_percentage=75
+cgroup_root="${X_GOOGLE_CGROUP_ROOT_DO_NOT_USE:-/sys/fs/cgroup}"
+
+# has_heap_flag returns success if any argument sets the maximum heap size.
+has_heap_flag() {
+  local arg
+  for arg in "$@"; do
+    case "${arg}" in
+      -Xmx*|-XX:MaxHeapSize=*|-XX:MaxRAM=*|-XX:MaxRAMPercentage=*|-XX:MaxRAMFraction=*) return 0 ;;
+    esac
+  done
+  return 1
+}
+
+# has_memory_limit returns success if the container memory is limited by cgroup v2 or v1.
+has_memory_limit() {
+  local limit
+  if [[ -r "${cgroup_root}/memory.max" ]]; then
+    limit="$(< "${cgroup_root}/memory.max")"
+    [[ "${limit}" =~ ^[0-9]+$ ]]
+    return
+  fi
+  if [[ -r "${cgroup_root}/memory/memory.limit_in_bytes" ]]; then
+    limit="$(< "${cgroup_root}/memory/memory.limit_in_bytes")"
+    # An unlimited cgroup v1 reports a value close to the maximum 64-bit integer.
+    [[ "${limit}" =~ ^[0-9]+$ ]] && (( ${#limit} < 19 ))
+    return
+  fi
+  return 1
+}
+
 if [[ -z "${JAVA_TOOL_OPTIONS+x}" && -n "${X_GOOGLE_MEMORY_HINT_DO_NOT_USE}" ]]
 then
   export JAVA_TOOL_OPTIONS="-XX:MaxRAM=$((${X_GOOGLE_MEMORY_HINT_DO_NOT_USE} - 80))m -XX:MaxRAMPercentage=100"
+elif [[ -z "${JAVA_TOOL_OPTIONS+x}" ]] && ! has_heap_flag "$@" && has_memory_limit
+then
+  export JAVA_TOOL_OPTIONS="-XX:MaxRAMPercentage=${default_max_ram_percentage}"
 fi
 exec "$@"
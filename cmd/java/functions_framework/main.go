@@ -18,26 +18,35 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/java"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/version"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
 const (
 	layerName                     = "functions-framework"
+	verifyTag                     = "function target verification"
 	javaFunctionInvokerURLBase    = "https://maven-central.storage-download.googleapis.com/maven2/com/google/cloud/functions/invoker/java-function-invoker/"
 	defaultFrameworkVersion       = "1.0.0-beta2"
 	functionsFrameworkMetadataURL = javaFunctionInvokerURLBase + "maven-metadata.xml"
 	functionsFrameworkURLTemplate = javaFunctionInvokerURLBase + "%[1]s/java-function-invoker-%[1]s.jar"
+	heartbeatInterval             = 30 * time.Second
+	// invokerJarPrefix is the prefix of the name of a Functions Framework invoker jar, followed by its version.
+	invokerJarPrefix = "java-function-invoker-"
 )
 
 // metadata represents metadata stored for the functions framework layer.
 type metadata struct {
 	Version string `toml:"version"`
+	// VerifiedHash is the hash of the target and classpath contents that last passed javap verification.
+	VerifiedHash string `toml:"verified_hash"`
 }
 
 func main() {
@@ -45,55 +54,131 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
 func buildFn(ctx *gcp.Context) error {
 	layer := ctx.Layer(layerName)
+	var meta metadata
+	ctx.ReadMetadata(layer, &meta)
 
-	if err := installFunctionsFramework(ctx, layer); err != nil {
+	cp, err := classpath(ctx)
+	if err != nil {
 		return err
 	}
 
-	classpath, err := classpath(ctx)
-	if err != nil {
+	frameworkJar := filepath.Join(layer.Root, "functions-framework.jar")
+	if jar, ok := dependencyFramework(ctx, cp); ok {
+		// Running the function's own copy of the framework avoids conflicting versions of its classes.
+		ctx.Logf("Using %s from the function's dependencies.", filepath.Base(jar))
+		ctx.RemoveAll(frameworkJar)
+		meta.Version = ""
+		frameworkJar = jar
+	} else if err := installFunctionsFramework(ctx, layer, &meta); err != nil {
 		return err
 	}
 
 	ctx.SetFunctionsEnvVars(layer)
 
+	if err := verifyTarget(ctx, cp, &meta); err != nil {
+		return err
+	}
+	ctx.WriteMetadata(layer, meta, layers.Launch, layers.Cache)
+
+	launcherSource := filepath.Join(ctx.BuildpackRoot(), "launch.sh")
+	launcherTarget := filepath.Join(layer.Root, "launch.sh")
+	createLauncher(ctx, launcherSource, launcherTarget)
+	// GOOGLE_JAVA_OPTS are passed on the command line, so they take precedence over the JAVA_TOOL_OPTIONS set by the launcher.
+	cmd := append([]string{launcherTarget}, java.Command("-jar", frameworkJar, "--classpath", cp.String())...)
+	ctx.AddWebProcessWithHealthCheck(cmd, gcp.PortHealthCheck)
+
+	return nil
+}
+
+// verifyTarget checks that the function target is in the classpath, skipping the check when neither the target
+// nor any file in the classpath has changed since the last successful verification.
+func verifyTarget(ctx *gcp.Context, cp classPath, meta *metadata) error {
+	target, _ := env.FunctionTargetResolved(nil)
+	classpath := cp.String()
+	files := append([]string{}, cp.jars...)
+	if cp.dependencyDir != "" {
+		files = append(files, ctx.Glob(filepath.Join(cp.dependencyDir, "*"))...)
+	}
+	// The jars are streamed through the hash, rather than read into memory, as dependencies can be large.
+	filesHash, err := cache.HashFiles(files...)
+	if err != nil {
+		return fmt.Errorf("hashing classpath files: %w", err)
+	}
+	hash, err := cache.Hash(ctx, cache.WithStrings(target, classpath, filesHash), cache.WithStrings(files...))
+	if err != nil {
+		return fmt.Errorf("computing classpath hash: %w", err)
+	}
+	if hash == meta.VerifiedHash {
+		ctx.CacheHit(verifyTag)
+		return nil
+	}
+	ctx.CacheMiss(verifyTag)
+
 	// Use javap to check that the class is indeed in the classpath we just determined.
-	// On success, it will output a description of the class and its public members, which we discard.
+	// On success, it will output a description of the class and its public members, which must mention the class.
 	// On failure it will output an error saying what's wrong (usually that the class doesn't exist).
 	// Success here doesn't guarantee that the function will execute. It might not implement one of the
 	// required interfaces, for example. But it eliminates the commonest problem of specifying the wrong target.
 	// We use an ExecUser* method so that the time taken by the javap command is counted as user time.
-	target := os.Getenv(env.FunctionTarget)
-	if result, err := ctx.ExecWithErr([]string{"javap", "-classpath", classpath, target}, gcp.WithUserAttribution); err != nil {
+	if result, err := ctx.ExecExpect([]string{"javap", "-classpath", classpath, target}, target, gcp.WithUserAttribution); err != nil {
 		// The javap error output will typically be "Error: class not found: foo.Bar".
 		return gcp.UserErrorf("build succeeded but did not produce the class %q specified as the function target: %s", target, result.Combined)
 	}
-
-	launcherSource := filepath.Join(ctx.BuildpackRoot(), "launch.sh")
-	launcherTarget := filepath.Join(layer.Root, "launch.sh")
-	createLauncher(ctx, launcherSource, launcherTarget)
-	ctx.AddWebProcess([]string{launcherTarget, "java", "-jar", filepath.Join(layer.Root, "functions-framework.jar"), "--classpath", classpath})
-
+	meta.VerifiedHash = hash
 	return nil
 }
 
 func createLauncher(ctx *gcp.Context, launcherSource, launcherTarget string) {
 	launcherContents := ctx.ReadFile(launcherSource)
-	ctx.WriteFile(launcherTarget, launcherContents, 0755)
+	ctx.WriteFileIfChanged(launcherTarget, launcherContents, 0755)
+}
+
+// classPath is the --classpath of a function: jar files, followed by a directory of dependency jars.
+type classPath struct {
+	// jars are the paths of jar files, in order.
+	jars []string
+	// dependencyDir is a directory all of whose jar files are in the classpath, or empty if there is none.
+	dependencyDir string
+}
+
+// add appends jars to the classpath, skipping those it already contains.
+func (c *classPath) add(jars ...string) {
+	for _, jar := range jars {
+		dup := false
+		for _, j := range c.jars {
+			if j == jar {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			c.jars = append(c.jars, jar)
+		}
+	}
+}
+
+// String returns the classpath in the colon-separated form understood by java and the Functions Framework.
+func (c classPath) String() string {
+	entries := append([]string{}, c.jars...)
+	if c.dependencyDir != "" {
+		// The Functions Framework understands "*" to mean every jar file in that directory.
+		entries = append(entries, c.dependencyDir+"/*")
+	}
+	return strings.Join(entries, ":")
 }
 
 // classpath determines what the --classpath argument should be. This tells the Functions Framework where to find
 // the classes of the function, including dependencies.
-func classpath(ctx *gcp.Context) (string, error) {
+func classpath(ctx *gcp.Context) (classPath, error) {
 	if ctx.FileExists("pom.xml") {
 		return mavenClasspath(ctx)
 	}
@@ -103,24 +188,32 @@ func classpath(ctx *gcp.Context) (string, error) {
 	jars := ctx.Glob("*.jar")
 	if len(jars) == 1 {
 		// Already-built jar file. It should be self-contained, which means that it can be the only thing given to --classpath.
-		return jars[0], nil
+		if bundled, err := java.BundlesDependencies(jars[0]); err != nil {
+			ctx.Warnf("Failed to inspect %s for bundled dependencies: %v", jars[0], err)
+		} else if !bundled {
+			ctx.Warnf("%s does not appear to bundle its dependencies, so the function will fail with ClassNotFoundException if it uses libraries other than the Functions Framework API. Deploy a shaded jar, for example built with the maven-shade-plugin, or deploy the pom.xml or build.gradle instead.", jars[0])
+		}
+		return classPath{jars: jars}, nil
 	}
 	if len(jars) > 1 {
-		return "", gcp.UserErrorf("function has no pom.xml and more than one jar file: %s", strings.Join(jars, ", "))
+		return classPath{}, gcp.UserErrorf("function has no pom.xml and more than one jar file: %s", strings.Join(jars, ", "))
 	}
 	// We have neither pom.xml nor a jar file. Show what files there are. If the user deployed the wrong directory, this may help them see the problem more easily.
 	description := "directory is empty"
 	if files := ctx.Glob("*"); len(files) > 0 {
 		description = fmt.Sprintf("directory has these entries: %s", strings.Join(files, ", "))
 	}
-	return "", gcp.UserErrorf("function has neither pom.xml nor already-built jar file; %s", description)
+	return classPath{}, gcp.UserErrorf("function has neither pom.xml nor already-built jar file; %s", description)
 }
 
 // mavenClasspath determines the --classpath when there is a pom.xml. This will consist of the jar file built
 // from the pom.xml itself, plus all jar files that are dependencies mentioned in the pom.xml.
-func mavenClasspath(ctx *gcp.Context) (string, error) {
+func mavenClasspath(ctx *gcp.Context) (classPath, error) {
 	// Copy the dependencies of the function (`<dependencies>` in pom.xml) into target/dependency.
-	ctx.Exec([]string{"mvn", "dependency:copy-dependencies"}, gcp.WithUserAttribution)
+	// This can be silent for minutes while dependencies are downloaded.
+	ctx.WithHeartbeat(heartbeatInterval, "Copying Maven dependencies", func() {
+		ctx.Exec([]string{"mvn", "dependency:copy-dependencies"}, gcp.WithUserAttribution)
+	})
 
 	// Extract the artifact/version coordinates from the user's pom.xml definitions.
 	// mvn help:evaluate is quite slow so we do it this way rather than calling it twice.
@@ -129,17 +222,16 @@ func mavenClasspath(ctx *gcp.Context) (string, error) {
 	groupArtifactVersion := execResult.Stdout
 	components := strings.Split(groupArtifactVersion, "/")
 	if len(components) != 2 {
-		return "", gcp.UserErrorf("could not parse query output into artifact/version: %s", groupArtifactVersion)
+		return classPath{}, gcp.UserErrorf("could not parse query output into artifact/version: %s", groupArtifactVersion)
 	}
 	artifact, version := components[0], components[1]
 	jarName := fmt.Sprintf("target/%s-%s.jar", artifact, version)
-	if !ctx.FileExists(jarName) {
-		return "", gcp.UserErrorf("expected output jar %s does not exist", jarName)
+	if err := ctx.RequireFiles(jarName); err != nil {
+		return classPath{}, err
 	}
 
-	// The Functions Framework understands "*" to mean every jar file in that directory.
-	// So this classpath consists of the just-built jar and all of the dependency jars.
-	return jarName + ":target/dependency/*", nil
+	// This classpath consists of the just-built jar and all of the dependency jars.
+	return classPath{jars: []string{jarName}, dependencyDir: "target/dependency"}, nil
 }
 
 // gradleClasspath determines the --classpath when there is a build.gradle. This will consist of the jar file built
@@ -147,7 +239,7 @@ func mavenClasspath(ctx *gcp.Context) (string, error) {
 // Unlike Maven, Gradle doesn't have a simple way to query the contents of the build.gradle. But we can execute
 // a script that includes the user's script and also defines some extra tasks for the query we need
 // and for dependency copying.
-func gradleClasspath(ctx *gcp.Context) (string, error) {
+func gradleClasspath(ctx *gcp.Context) (classPath, error) {
 	scriptSource := filepath.Join(ctx.BuildpackRoot(), "extra_tasks.gradle")
 	scriptText := ctx.ReadFile(scriptSource)
 	scriptTarget := "_javaFunctionExtraTasks.gradle"
@@ -159,22 +251,51 @@ func gradleClasspath(ctx *gcp.Context) (string, error) {
 	// Extract the name of the target jar.
 	execResult := ctx.Exec([]string{"gradle", "--build-file", scriptTarget, "--quiet", "_javaFunctionPrintJarTarget"}, gcp.WithUserAttribution)
 	jarName := strings.TrimSpace(execResult.Stdout)
-	if !ctx.FileExists(jarName) {
-		return "", gcp.UserErrorf("expected output jar %s does not exist", jarName)
+	if err := ctx.RequireFiles(jarName); err != nil {
+		return classPath{}, err
+	}
+
+	// This classpath consists of the just-built jar and all of the dependency jars.
+	return classPath{jars: []string{jarName}, dependencyDir: "_javaFunctionDependencies"}, nil
+}
+
+// dependencyFramework returns the Functions Framework invoker jar if the function already declares it as a dependency.
+// If several versions are found, the latest is used.
+func dependencyFramework(ctx *gcp.Context, cp classPath) (string, bool) {
+	if cp.dependencyDir == "" {
+		return "", false
 	}
+	jars := ctx.Glob(filepath.Join(cp.dependencyDir, invokerJarPrefix+"*.jar"))
+	if len(jars) == 0 {
+		return "", false
+	}
+	latest := jars[0]
+	for _, jar := range jars[1:] {
+		c, err := version.Compare(invokerVersion(jar), invokerVersion(latest))
+		if err != nil {
+			ctx.Debugf("Failed to compare the versions of %s and %s: %v", jar, latest, err)
+			continue
+		}
+		if c > 0 {
+			latest = jar
+		}
+	}
+	if len(jars) > 1 {
+		ctx.Warnf("Found multiple Functions Framework invoker jars in the function's dependencies, using %s: %s", filepath.Base(latest), strings.Join(jars, ", "))
+	}
+	return latest, true
+}
 
-	// The Functions Framework understands "*" to mean every jar file in that directory.
-	// So this classpath consists of the just-built jar and all of the dependency jars.
-	return fmt.Sprintf("%s:_javaFunctionDependencies/*", jarName), nil
+// invokerVersion returns the version in the name of an invoker jar, e.g. 1.0.1 for java-function-invoker-1.0.1.jar.
+func invokerVersion(jar string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(jar), invokerJarPrefix), ".jar")
 }
 
-func installFunctionsFramework(ctx *gcp.Context, layer *layers.Layer) error {
+func installFunctionsFramework(ctx *gcp.Context, layer *layers.Layer, meta *metadata) error {
 	frameworkVersion := defaultFrameworkVersion
 	// TODO(emcmanus): extract framework version from pom.xml if present
 
 	// Install functions-framework.
-	var meta metadata
-	ctx.ReadMetadata(layer, &meta)
 	if frameworkVersion == meta.Version {
 		ctx.CacheHit(layerName)
 	} else {
@@ -184,8 +305,6 @@ func installFunctionsFramework(ctx *gcp.Context, layer *layers.Layer) error {
 			return err
 		}
 		meta.Version = frameworkVersion
-
-		ctx.WriteMetadata(layer, meta, layers.Launch, layers.Cache)
 	}
 	return nil
 }
@@ -193,12 +312,8 @@ func installFunctionsFramework(ctx *gcp.Context, layer *layers.Layer) error {
 func installFramework(ctx *gcp.Context, layer *layers.Layer, version string) error {
 	url := fmt.Sprintf(functionsFrameworkURLTemplate, version)
 	ffName := filepath.Join(layer.Root, "functions-framework.jar")
-	result, err := ctx.ExecWithErr([]string{"curl", "--silent", "--fail", "--show-error", "--output", ffName, url})
-	// We use ExecWithErr rather than plain Exec because if it fails we want to exit with an error message better
-	// than "Failure: curl: (22) The requested URL returned error: 404".
-	// TODO(b/155874677): use plain Exec once it gives sufficient error messages.
-	if err != nil {
-		return gcp.InternalErrorf("fetching functions framework jar: %v\n%s", err, result.Stderr)
+	if err := ctx.Download(url, ffName); err != nil {
+		return gcp.DownloadErrorf(err, "fetching functions framework jar")
 	}
 	return nil
 }
@@ -15,9 +15,17 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/layers"
 )
 
 func TestDetect(t *testing.T) {
@@ -44,3 +52,213 @@ func TestDetect(t *testing.T) {
 		})
 	}
 }
+
+func TestInstallFramework(t *testing.T) {
+	dir, err := ioutil.TempDir("", "functions-framework-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	l := &layers.Layer{Root: dir}
+	ctx.SetDownloader(gcp.FakeDownloader{
+		fmt.Sprintf(functionsFrameworkURLTemplate, "1.0.0"): []byte("jar"),
+	})
+
+	if err := installFramework(ctx, l, "1.0.0"); err != nil {
+		t.Fatalf("installFramework() got error: %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "functions-framework.jar"))
+	if err != nil {
+		t.Fatalf("Failed to read functions framework jar: %v", err)
+	}
+	if string(got) != "jar" {
+		t.Errorf("installFramework() wrote %q, want %q", got, "jar")
+	}
+
+	if err := installFramework(ctx, l, "0.0.0"); err == nil {
+		t.Error("installFramework() with a missing version got nil error, want error")
+	}
+}
+
+func TestClassPath(t *testing.T) {
+	testCases := []struct {
+		name string
+		cp   classPath
+		add  []string
+		want string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "jar only",
+			cp:   classPath{jars: []string{"function.jar"}},
+			want: "function.jar",
+		},
+		{
+			name: "jar and dependencies",
+			cp:   classPath{jars: []string{"target/fn-1.0.jar"}, dependencyDir: "target/dependency"},
+			want: "target/fn-1.0.jar:target/dependency/*",
+		},
+		{
+			name: "added jars precede dependencies",
+			cp:   classPath{jars: []string{"target/fn-1.0.jar"}, dependencyDir: "target/dependency"},
+			add:  []string{"extra.jar", "target/fn-1.0.jar", "extra.jar"},
+			want: "target/fn-1.0.jar:extra.jar:target/dependency/*",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cp.add(tc.add...)
+			if got := tc.cp.String(); got != tc.want {
+				t.Errorf("classPath.String() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLaunchScriptMemory(t *testing.T) {
+	testCases := []struct {
+		name   string
+		cgroup map[string]string
+		env    []string
+		args   []string
+		want   string
+	}{
+		{
+			name: "no cgroup",
+			want: "unset",
+		},
+		{
+			name:   "cgroup v2 unlimited",
+			cgroup: map[string]string{"memory.max": "max\n"},
+			want:   "unset",
+		},
+		{
+			name:   "cgroup v2 limit",
+			cgroup: map[string]string{"memory.max": "536870912\n"},
+			want:   "-XX:MaxRAMPercentage=75",
+		},
+		{
+			name:   "cgroup v1 unlimited",
+			cgroup: map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712\n"},
+			want:   "unset",
+		},
+		{
+			name:   "cgroup v1 limit",
+			cgroup: map[string]string{"memory/memory.limit_in_bytes": "536870912\n"},
+			want:   "-XX:MaxRAMPercentage=75",
+		},
+		{
+			name:   "heap flag in command",
+			cgroup: map[string]string{"memory.max": "536870912\n"},
+			args:   []string{"java", "-Xmx256m", "-jar", "ff.jar"},
+			want:   "unset",
+		},
+		{
+			name:   "JAVA_TOOL_OPTIONS set",
+			cgroup: map[string]string{"memory.max": "536870912\n"},
+			env:    []string{"JAVA_TOOL_OPTIONS=-Xss1m"},
+			want:   "-Xss1m",
+		},
+		{
+			name:   "memory hint",
+			cgroup: map[string]string{"memory.max": "536870912\n"},
+			env:    []string{"X_GOOGLE_MEMORY_HINT_DO_NOT_USE=512"},
+			want:   "-XX:MaxRAM=432m -XX:MaxRAMPercentage=100",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "cgroup-")
+			if err != nil {
+				t.Fatalf("Creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			for name, content := range tc.cgroup {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Creating dir for %s: %v", name, err)
+				}
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Writing %s: %v", name, err)
+				}
+			}
+
+			args := append([]string{"launch.sh", "bash", "-c", `echo "${JAVA_TOOL_OPTIONS-unset}"`}, tc.args...)
+			cmd := exec.Command("bash", args...)
+			cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "X_GOOGLE_CGROUP_ROOT_DO_NOT_USE=" + root}, tc.env...)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("Running launch.sh: %v", err)
+			}
+			if got := strings.TrimSpace(string(out)); got != tc.want {
+				t.Errorf("JAVA_TOOL_OPTIONS = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDependencyFramework(t *testing.T) {
+	testCases := []struct {
+		name   string
+		files  []string
+		depDir string
+		want   string
+	}{
+		{
+			name:   "declared dependency",
+			files:  []string{"target/dependency/gson-2.8.6.jar", "target/dependency/java-function-invoker-1.0.1.jar"},
+			depDir: "target/dependency",
+			want:   "target/dependency/java-function-invoker-1.0.1.jar",
+		},
+		{
+			name:   "latest of several versions",
+			files:  []string{"target/dependency/java-function-invoker-1.9.0.jar", "target/dependency/java-function-invoker-1.10.0.jar"},
+			depDir: "target/dependency",
+			want:   "target/dependency/java-function-invoker-1.10.0.jar",
+		},
+		{
+			name:   "api only",
+			files:  []string{"target/dependency/functions-framework-api-1.0.1.jar"},
+			depDir: "target/dependency",
+		},
+		{
+			name:  "no dependency dir",
+			files: []string{"target/dependency/java-function-invoker-1.0.1.jar"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "functions-framework-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range tc.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir for %s: %v", f, err)
+				}
+				if err := ioutil.WriteFile(path, []byte("jar"), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", f, err)
+				}
+			}
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			depDir := ""
+			if tc.depDir != "" {
+				depDir = filepath.Join(dir, tc.depDir)
+			}
+
+			got, ok := dependencyFramework(ctx, classPath{dependencyDir: depDir})
+
+			if want := tc.want != ""; ok != want {
+				t.Fatalf("dependencyFramework() got ok=%t, want %t", ok, want)
+			}
+			if ok && got != filepath.Join(dir, tc.want) {
+				t.Errorf("dependencyFramework() = %q, want %q", got, filepath.Join(dir, tc.want))
+			}
+		})
+	}
+}
@@ -55,6 +55,7 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	ctx.RecordPackageManager("gradle")
 	var repoMeta java.RepoMetadata
 	gradleCachedRepo := ctx.Layer(cacheLayer)
 	ctx.ReadMetadata(gradleCachedRepo, &repoMeta)
@@ -112,8 +113,8 @@ func buildFn(ctx *gcp.Context) error {
 }
 
 func gradleInstalled(ctx *gcp.Context) bool {
-	result := ctx.Exec([]string{"bash", "-c", "command -v gradle || true"})
-	return result.Stdout != ""
+	_, err := ctx.ExecExpect([]string{"bash", "-c", "command -v gradle"}, "gradle")
+	return err == nil
 }
 
 type gradleVersion struct {
@@ -152,8 +153,9 @@ func installGradle(ctx *gcp.Context) (string, error) {
 	gradleZip := filepath.Join(tmpDir, "gradle.zip")
 	defer ctx.RemoveAll(gradleZip)
 
-	curl := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s --output %s", downloadURL, gradleZip)
-	ctx.Exec([]string{"bash", "-c", curl}, gcp.WithUserAttribution)
+	if err := ctx.Download(downloadURL, gradleZip); err != nil {
+		return "", gcp.DownloadErrorf(err, "downloading Gradle v%s", version)
+	}
 
 	unzip := fmt.Sprintf("unzip -q %s -d %s", gradleZip, tmpDir)
 	ctx.Exec([]string{"bash", "-c", unzip}, gcp.WithUserAttribution)
@@ -174,7 +176,10 @@ func fetchGradleVersion(ctx *gcp.Context) (string, string, error) {
 		return "", "", fmt.Errorf("Gradle latest version info does not exist at %s (status %d)", gradleVersionURL, code)
 	}
 
-	jsonStr := ctx.Exec([]string{"curl", "--silent", gradleVersionURL}, gcp.WithUserAttribution).Stdout
+	jsonStr, err := ctx.DownloadString(gradleVersionURL)
+	if err != nil {
+		return "", "", err
+	}
 	var gv gradleVersion
 	if err := json.Unmarshal([]byte(jsonStr), &gv); err != nil {
 		return "", "", fmt.Errorf("parsing JSON response from URL %q: %v", gradleVersionURL, err)
@@ -57,6 +57,7 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	ctx.RecordPackageManager("maven")
 	var repoMeta java.RepoMetadata
 	m2CachedRepo := ctx.Layer(m2Layer)
 	ctx.ReadMetadata(m2CachedRepo, &repoMeta)
@@ -142,8 +143,8 @@ func addJvmConfig(ctx *gcp.Context) {
 }
 
 func mvnInstalled(ctx *gcp.Context) bool {
-	result := ctx.Exec([]string{"bash", "-c", "command -v mvn || true"})
-	return result.Stdout != ""
+	_, err := ctx.ExecExpect([]string{"bash", "-c", "command -v mvn"}, "mvn")
+	return err == nil
 }
 
 // installMaven installs Maven and returns the path of the mvn binary
@@ -168,8 +169,9 @@ func installMaven(ctx *gcp.Context) (string, error) {
 	if code := ctx.HTTPStatus(archiveURL); code != http.StatusOK {
 		return "", gcp.UserErrorf("Maven version %s does not exist at %s (status %d).", mavenVersion, archiveURL, code)
 	}
-	command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --strip-components=1", archiveURL, mvnl.Root)
-	ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+	if err := ctx.DownloadAndExtract(archiveURL, mvnl.Root, "--strip-components=1"); err != nil {
+		return "", gcp.DownloadErrorf(err, "downloading Maven v%s", mavenVersion)
+	}
 
 	meta.Version = mavenVersion
 
@@ -21,9 +21,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/java"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/runtime"
 	"github.com/buildpack/libbuildpack/buildpackplan"
 	"github.com/buildpack/libbuildpack/layers"
@@ -32,6 +35,7 @@ import (
 const (
 	javaLayer             = "java"
 	javaVersionURL        = "https://api.adoptopenjdk.net/v3/assets/feature_releases/%s/ga?architecture=x64&heap_size=normal&image_type=jdk&jvm_impl=hotspot&os=linux&page=0&page_size=1&project=jdk&sort_order=DESC&vendor=adoptopenjdk"
+	availableReleasesURL  = "https://api.adoptopenjdk.net/v3/info/available_releases"
 	defaultFeatureVersion = "11"
 )
 
@@ -60,21 +64,18 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
-	featureVersion := defaultFeatureVersion
-	if v := os.Getenv(env.RuntimeVersion); v != "" {
-		featureVersion = v
-		ctx.Logf("Using requested runtime feature version: %s", featureVersion)
-	} else {
-		ctx.Logf("Using latest Java %s runtime version. You can specify a different version with %s: https://github.com/GoogleCloudPlatform/buildpacks#configuration", defaultFeatureVersion, env.RuntimeVersion)
-	}
+	featureVersion := requestedFeatureVersion(ctx)
 
 	releaseURL := fmt.Sprintf(javaVersionURL, featureVersion)
 	if code := ctx.HTTPStatus(releaseURL); code != http.StatusOK {
-		return gcp.UserErrorf("Java feature version %s does not exist at %s (status %d). You can specify the feature version with %s. See available feature runtime versions at https://api.adoptopenjdk.net/v3/info/available_releases", featureVersion, releaseURL, code, env.RuntimeVersion)
+		return gcp.UserErrorf("Java feature version %s does not exist at %s (status %d). You can specify the feature version with %s. %s", featureVersion, releaseURL, code, env.RuntimeVersion, availableVersions(ctx))
 	}
 
-	result := ctx.Exec([]string{"curl", "--silent", releaseURL}, gcp.WithUserAttribution)
-	release, err := parseVersionJSON(result.Stdout)
+	jsonStr, err := ctx.DownloadString(releaseURL)
+	if err != nil {
+		return gcp.DownloadErrorf(err, "fetching %s", releaseURL)
+	}
+	release, err := parseVersionJSON(jsonStr)
 	if err != nil {
 		return fmt.Errorf("parsing JSON returned by %s: %w", releaseURL, err)
 	}
@@ -83,12 +84,13 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return fmt.Errorf("extracting release returned by %s: %w", releaseURL, err)
 	}
+	ctx.RecordRuntimeVersion("java", version)
 
 	// Check the metadata in the cache layer to determine if we need to proceed.
 	var meta metadata
 	l := ctx.Layer(javaLayer)
 	ctx.ReadMetadata(l, &meta)
-	if version == meta.Version {
+	if version == meta.Version && !ctx.ClearCacheRequested() {
 		ctx.CacheHit(javaLayer)
 		return nil
 	}
@@ -97,9 +99,9 @@ func buildFn(ctx *gcp.Context) error {
 
 	// Download and install Java in layer.
 	ctx.Logf("Installing Java v%s", version)
-
-	command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --strip-components=1", archiveURL, l.Root)
-	ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+	if err := ctx.DownloadAndExtract(archiveURL, l.Root, "--strip-components=1"); err != nil {
+		return gcp.DownloadErrorf(err, "downloading Java v%s", version)
+	}
 
 	meta.Version = version
 	ctx.WriteMetadata(l, meta, layers.Build, layers.Cache, layers.Launch)
@@ -111,6 +113,72 @@ func buildFn(ctx *gcp.Context) error {
 	return nil
 }
 
+// requestedFeatureVersion returns the Java feature version to install: GOOGLE_RUNTIME_VERSION if set, or for functions
+// the version that pom.xml compiles for, or the default.
+func requestedFeatureVersion(ctx *gcp.Context) string {
+	if v := os.Getenv(env.RuntimeVersion); v != "" {
+		ctx.Logf("Using requested runtime feature version: %s", v)
+		return v
+	}
+	// Applications choose their JDK with GOOGLE_RUNTIME_VERSION, functions are deployed without one.
+	if os.Getenv(env.FunctionTarget) != "" {
+		if v := pomFeatureVersion(ctx); v != "" {
+			ctx.Logf("Using runtime feature version from pom.xml: %s", v)
+			return v
+		}
+	}
+	ctx.Logf("Using latest Java %s runtime version. You can specify a different version with %s: https://github.com/GoogleCloudPlatform/buildpacks#configuration", defaultFeatureVersion, env.RuntimeVersion)
+	return defaultFeatureVersion
+}
+
+// pomFeatureVersion returns the Java feature version that pom.xml compiles for, or an empty string if it does not
+// declare one newer than the default, which runs code compiled for older versions.
+func pomFeatureVersion(ctx *gcp.Context) string {
+	v, err := java.FeatureVersionFromPOM(ctx)
+	if err != nil {
+		// Maven reports problems with pom.xml itself.
+		ctx.Debugf("Ignoring the Java version in pom.xml: %v", err)
+		return ""
+	}
+	if v == "" {
+		return ""
+	}
+	n, err := strconv.Atoi(v)
+	if def, _ := strconv.Atoi(defaultFeatureVersion); err != nil || n <= def {
+		return ""
+	}
+	return v
+}
+
+// availableVersions describes the Java feature versions that can be installed, for error messages.
+func availableVersions(ctx *gcp.Context) string {
+	jsonStr, err := ctx.DownloadString(availableReleasesURL)
+	if err == nil {
+		if versions, err := parseAvailableReleases(jsonStr); err == nil {
+			return fmt.Sprintf("Available feature versions: %s.", strings.Join(versions, ", "))
+		}
+	}
+	return fmt.Sprintf("See available feature runtime versions at %s", availableReleasesURL)
+}
+
+// parseAvailableReleases returns the feature versions listed in the JSON returned by availableReleasesURL.
+func parseAvailableReleases(jsonStr string) ([]string, error) {
+	var releases struct {
+		AvailableReleases []int `json:"available_releases"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &releases); err != nil {
+		return nil, fmt.Errorf("parsing JSON response %q: %v", jsonStr, err)
+	}
+	if len(releases.AvailableReleases) == 0 {
+		return nil, fmt.Errorf("empty list of available releases")
+	}
+	var versions []string
+	for _, r := range releases.AvailableReleases {
+		versions = append(versions, strconv.Itoa(r))
+	}
+	return versions, nil
+}
+
 type binaryPkg struct {
 	Link string `json:"link"`
 }
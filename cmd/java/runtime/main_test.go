@@ -15,10 +15,15 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
 )
 
 func TestDetect(t *testing.T) {
@@ -328,3 +333,91 @@ func TestExtractReleaseFail(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAvailableReleases(t *testing.T) {
+	got, err := parseAvailableReleases(`{"available_lts_releases": [8, 11], "available_releases": [8, 9, 10, 11, 12, 13, 14], "most_recent_feature_release": 14}`)
+	if err != nil {
+		t.Fatalf("parseAvailableReleases() got error: %v", err)
+	}
+	want := []string{"8", "9", "10", "11", "12", "13", "14"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAvailableReleases() = %v, want %v", got, want)
+	}
+}
+
+func TestParseAvailableReleasesFail(t *testing.T) {
+	for _, s := range []string{"<html>Not Found</html>", `{"available_releases": []}`} {
+		if _, err := parseAvailableReleases(s); err == nil {
+			t.Errorf("parseAvailableReleases(%q) got nil error, want error", s)
+		}
+	}
+}
+
+func TestRequestedFeatureVersion(t *testing.T) {
+	pom := func(version string) string {
+		return "<project><properties><maven.compiler.release>" + version + "</maven.compiler.release></properties></project>"
+	}
+	testCases := []struct {
+		name string
+		pom  string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "no pom.xml",
+			env:  map[string]string{env.FunctionTarget: "HelloWorld"},
+			want: "11",
+		},
+		{
+			name: "application ignores pom.xml",
+			pom:  pom("17"),
+			want: "11",
+		},
+		{
+			name: "function uses pom.xml",
+			pom:  pom("17"),
+			env:  map[string]string{env.FunctionTarget: "HelloWorld"},
+			want: "17",
+		},
+		{
+			name: "function compiled for older version uses default",
+			pom:  pom("1.8"),
+			env:  map[string]string{env.FunctionTarget: "HelloWorld"},
+			want: "11",
+		},
+		{
+			name: "function with malformed pom.xml uses default",
+			pom:  "<project><properties>",
+			env:  map[string]string{env.FunctionTarget: "HelloWorld"},
+			want: "11",
+		},
+		{
+			name: "runtime version overrides pom.xml",
+			pom:  pom("17"),
+			env:  map[string]string{env.FunctionTarget: "HelloWorld", env.RuntimeVersion: "15"},
+			want: "15",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "java-runtime-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if tc.pom != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "pom.xml"), []byte(tc.pom), 0644); err != nil {
+					t.Fatalf("writing pom.xml: %v", err)
+				}
+			}
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			if got := requestedFeatureVersion(gcp.NewContextForTests(buildpack.Info{}, dir)); got != tc.want {
+				t.Errorf("requestedFeatureVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
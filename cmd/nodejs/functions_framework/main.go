@@ -37,24 +37,24 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
 func buildFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionSource); ok {
-		return gcp.UserErrorf("%s is not currently supported for Node.js buildpacks", env.FunctionSource)
-	}
-
-	// Function source code should be defined in the "main" field in package.json, index.js or function.js.
+	// Function source code should be defined in GOOGLE_FUNCTION_SOURCE, the "main" field in package.json, index.js or function.js.
 	// https://cloud.google.com/functions/docs/writing#structuring_source_code
 	fnFile := "function.js"
 	if ctx.FileExists("index.js") {
 		fnFile = "index.js"
 	}
+	fnSource, hasSource := os.LookupEnv(env.FunctionSource)
+	if hasSource && !ctx.FileExists(fnSource) {
+		return gcp.UserErrorf("%s specified file '%s' but it does not exist", env.FunctionSource, fnSource)
+	}
 
 	// Determine if the function has dependency on functions-framework.
 	hasFrameworkDependency := false
@@ -68,6 +68,9 @@ func buildFn(ctx *gcp.Context) error {
 			fnFile = pjs.Main
 		}
 	}
+	if hasSource {
+		fnFile = fnSource
+	}
 
 	if !ctx.FileExists(fnFile) {
 		return gcp.UserErrorf("%s does not exist", fnFile)
@@ -103,6 +106,10 @@ func buildFn(ctx *gcp.Context) error {
 		// NPM expects package.json and the lock file in the prefix directory.
 		ctx.Exec([]string{"cp", "-t", l.Root, pjs, pljs}, gcp.WithUserTimingAttribution)
 		ctx.Exec([]string{"npm", nodejs.NPMInstallCommand(ctx), "--quiet", "--production", "--prefix", l.Root}, gcp.WithUserAttribution)
+		// The layer is in the application image, so it must not include VCS metadata or npm debug logs.
+		if err := ctx.AssertLayerContents(l, ".git", "*.log"); err != nil {
+			return err
+		}
 	}
 
 	// Determine the path to the executable file to start functions-framework.
@@ -124,7 +131,7 @@ func buildFn(ctx *gcp.Context) error {
 
 	ctx.SetFunctionsEnvVars(l)
 
-	ctx.AddWebProcess([]string{"/bin/bash", "-c", ff})
+	ctx.AddWebProcessWithHealthCheck([]string{"/bin/bash", "-c", ff}, gcp.PortHealthCheck)
 	ctx.WriteMetadata(l, &meta, layers.Build, layers.Cache, layers.Launch)
 
 	return nil
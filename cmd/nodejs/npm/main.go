@@ -19,16 +19,21 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/nodejs"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
 const (
-	cacheTag = "prod dependencies"
+	cacheTag          = "prod dependencies"
+	ignoreScriptsFlag = "--ignore-scripts"
 )
 
 func main() {
@@ -43,16 +48,53 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	// npm installs node_modules in the application root.
+	ctx.RequirePlatform(gcp.WritableDir(ctx.ApplicationRoot()))
+	ctx.RecordPackageManager("npm")
+	if err := ctx.CheckLockfiles(nodejs.PackageLock, nodejs.YarnLock); err != nil {
+		return err
+	}
+	// package.json is only read for informational checks, npm reports problems with the file itself.
+	pjs, err := nodejs.ReadPackageJSON(ctx.ApplicationRoot())
+	if err != nil {
+		ctx.Debugf("Failed to read package.json, skipping dependency checks: %v", err)
+	} else {
+		ctx.RecordDependencyCount(len(pjs.Dependencies))
+	}
+
 	ml := ctx.Layer("npm")
 	nm := filepath.Join(ml.Root, "node_modules")
 	ctx.RemoveAll("node_modules")
+	if err := nodejs.RequireLockfile(ctx, nodejs.PackageLock); err != nil {
+		return err
+	}
 	nodejs.EnsurePackageLock(ctx)
 
 	nodeEnv := nodejs.NodeEnv()
-	cached, meta, err := nodejs.CheckCache(ctx, ml, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.PackageLock))
+	installEnv := nodejs.InstallNodeEnv()
+	opts := []cache.Option{cache.WithStrings(installEnv), cache.WithFiles("package.json", nodejs.PackageLock), nodejs.WithConfigFiles(ctx.ApplicationRoot())}
+	ignoreScripts := nodejs.IgnoreScripts(ctx)
+	if ignoreScripts {
+		opts = append(opts, cache.WithStrings(ignoreScriptsFlag))
+	}
+	installCmd := nodejs.NPMInstallCommand(ctx)
+	ciIgnoreScripts := installCmd == "ci" && nodejs.CIIgnoreScripts(ctx)
+	if ciIgnoreScripts {
+		opts = append(opts, cache.WithStrings("ci "+ignoreScriptsFlag))
+	}
+	ctx.LogEffectiveConfig(
+		gcp.EnvSetting("install command", env.NPMInstallCommand, "npm "+installCmd),
+		gcp.EnvSetting("NODE_ENV", "NODE_ENV", nodeEnv),
+		gcp.EnvSetting("production", env.NodeProduction, strconv.FormatBool(nodejs.Production(ctx))),
+		gcp.EnvSetting("ignore scripts", env.NodeIgnoreScripts, strconv.FormatBool(ignoreScripts)),
+		gcp.EnvSetting("frozen lockfile", env.NodeFrozen, strconv.FormatBool(nodejs.Frozen(ctx))),
+		gcp.EnvSetting("audit dependencies", env.AuditDependencies, strconv.FormatBool(audit.Enabled(ctx))),
+	)
+	cached, meta, err := nodejs.CheckCache(ctx, ml, opts...)
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
+	checkLockfile := nodejs.WatchLockfile(ctx, nodejs.PackageLock)
 	if cached {
 		ctx.CacheHit(cacheTag)
 		// Restore cached node_modules.
@@ -60,19 +102,42 @@ func buildFn(ctx *gcp.Context) error {
 
 		// Always run npm install to run preinstall/postinstall scripts.
 		// Otherwise it should be a no-op because the lockfile is unchanged.
-		ctx.Exec([]string{"npm", "install", "--quiet"}, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
+		// It stands in for the `npm ci` that populated the cache, so scripts skipped by that are skipped here too.
+		cmd := []string{"npm", "install", "--quiet"}
+		if ignoreScripts || ciIgnoreScripts {
+			cmd = append(cmd, ignoreScriptsFlag)
+		}
+		ctx.Exec(cmd, gcp.WithEnv("NODE_ENV="+installEnv), gcp.WithUserAttribution)
 	} else {
 		ctx.CacheMiss(cacheTag)
 		// Clear cached node_modules to ensure we don't end up with outdated dependencies after copying.
 		ctx.ClearLayer(ml)
+		if pjs != nil {
+			ctx.WarnNativeDependencies(nodejs.NativeDependencies(pjs)...)
+		}
 
-		ctx.Exec([]string{"npm", nodejs.NPMInstallCommand(ctx), "--quiet"}, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
+		cmd := []string{"npm", installCmd, "--quiet"}
+		if ignoreScripts || ciIgnoreScripts {
+			cmd = append(cmd, ignoreScriptsFlag)
+		}
+		ctx.Exec(cmd, gcp.WithEnv("NODE_ENV="+installEnv), gcp.WithUserAttribution)
 
 		// Ensure node_modules exists even if no dependencies were installed.
 		ctx.MkdirAll("node_modules", 0755)
 		ctx.Exec([]string{"cp", "--archive", "node_modules", nm}, gcp.WithUserTimingAttribution)
 	}
+	if err := checkLockfile(); err != nil {
+		return err
+	}
+	if err := nodejs.NPMAudit(ctx); err != nil {
+		return err
+	}
+
+	if ignoreScripts || ciIgnoreScripts {
+		nodejs.WarnSkippedScripts(ctx, "node_modules")
+	}
 
+	nodejs.RecordDependencies(ctx, "npm")
 	ctx.WriteMetadata(ml, &meta, layers.Build, layers.Cache)
 
 	el := ctx.Layer("env")
@@ -84,8 +149,7 @@ func buildFn(ctx *gcp.Context) error {
 	cmd := []string{"npm", "start"}
 
 	if !devmode.Enabled(ctx) {
-		ctx.AddWebProcess(cmd)
-		return nil
+		return entrypoint.AddProcesses(ctx, cmd)
 	}
 
 	// Configure the entrypoint and metadata for dev mode.
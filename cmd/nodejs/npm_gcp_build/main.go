@@ -54,10 +54,13 @@ func buildFn(ctx *gcp.Context) error {
 	l := ctx.Layer("npm")
 	nm := filepath.Join(l.Root, "node_modules")
 	ctx.RemoveAll("node_modules")
+	if err := nodejs.RequireLockfile(ctx, nodejs.PackageLock); err != nil {
+		return err
+	}
 	nodejs.EnsurePackageLock(ctx)
 
 	nodeEnv := nodejs.EnvDevelopment
-	cached, meta, err := nodejs.CheckCache(ctx, l, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.PackageLock))
+	cached, meta, err := nodejs.CheckCache(ctx, l, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.PackageLock), nodejs.WithConfigFiles(ctx.ApplicationRoot()))
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
@@ -69,13 +72,17 @@ func buildFn(ctx *gcp.Context) error {
 		ctx.CacheMiss(cacheTag)
 		// Clear cached node_modules to ensure we don't end up with outdated dependencies.
 		ctx.ClearLayer(l)
+		checkLockfile := nodejs.WatchLockfile(ctx, nodejs.PackageLock)
 		ctx.Exec([]string{"npm", nodejs.NPMInstallCommand(ctx), "--quiet"}, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
+		if err := checkLockfile(); err != nil {
+			return err
+		}
 		// Ensure node_modules exists even if no dependencies were installed.
 		ctx.MkdirAll("node_modules", 0755)
 		ctx.Exec([]string{"cp", "--archive", "node_modules", nm}, gcp.WithUserTimingAttribution)
 	}
 
-	ctx.Exec([]string{"npm", "run", "gcp-build"}, gcp.WithUserAttribution)
+	ctx.Exec([]string{"npm", "run", "gcp-build"}, gcp.WithUserAttribution, gcp.WithSandbox)
 	ctx.RemoveAll("node_modules")
 	ctx.WriteMetadata(l, &meta, layers.Cache)
 	return nil
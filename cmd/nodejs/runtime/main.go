@@ -18,8 +18,9 @@ package main
 
 import (
 	"fmt"
-	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
@@ -31,7 +32,9 @@ import (
 
 const (
 	nodeLayer = "node"
-	nodeURL   = "https://nodejs.org/dist/v%[1]s/node-v%[1]s-linux-x64.tar.xz"
+	nodeURL   = "https://nodejs.org/dist/v%[1]s/node-v%[1]s-%[2]s-%[3]s.tar.xz"
+	// nodeResolveURL responds with the latest Node.js version satisfying the semver range in its range parameter.
+	nodeResolveURL = "http://semver.io/node/resolve"
 )
 
 // metadata represents metadata stored for a runtime layer.
@@ -62,6 +65,7 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return err
 	}
+	ctx.RecordRuntimeVersion("nodejs", version)
 
 	// Check the metadata in the cache layer to determine if we need to proceed.
 	var meta metadata
@@ -75,15 +79,16 @@ func buildFn(ctx *gcp.Context) error {
 	ctx.CacheMiss(nodeLayer)
 	ctx.ClearLayer(nrl)
 
-	archiveURL := fmt.Sprintf(nodeURL, version)
-	if code := ctx.HTTPStatus(archiveURL); code != http.StatusOK {
-		return gcp.UserErrorf("Runtime version %s does not exist at %s (status %d). You can specify the version with %s.", version, archiveURL, code, env.RuntimeVersion)
+	archiveURL, err := ctx.FindArtifactURL(nodeArchiveURL(version, ctx.Platform()))
+	if err != nil {
+		return gcp.UserErrorf("Runtime version %s does not exist: %v. You can specify the version with %s.", version, err, env.RuntimeVersion)
 	}
 
 	// Download and install Node.js in layer.
 	ctx.Logf("Installing Node.js v%s", version)
-	command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xJ --directory %s --strip-components=1", archiveURL, nrl.Root)
-	ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+	if err := ctx.DownloadAndExtract(archiveURL, nrl.Root, "--strip-components=1"); err != nil {
+		return gcp.DownloadErrorf(err, "downloading Node.js v%s", version)
+	}
 
 	meta.Version = version
 	ctx.WriteMetadata(nrl, meta, layers.Build, layers.Cache, layers.Launch)
@@ -113,8 +118,22 @@ func runtimeVersion(ctx *gcp.Context) (string, error) {
 	}
 	// Use package.json and semver.io to determine best-fit Node.js version.
 	ctx.Logf("Resolving Node.js version based on semver %q", versionRange)
-	result := ctx.Exec([]string{"curl", "--silent", "--get", "--data-urlencode", fmt.Sprintf("range=%s", versionRange), "http://semver.io/node/resolve"}, gcp.WithUserAttribution)
-	version := result.Stdout
+	resolveURL := nodeResolveURL + "?" + url.Values{"range": []string{versionRange}}.Encode()
+	version, err := ctx.DownloadString(resolveURL)
+	if err != nil {
+		return "", err
+	}
+	version = strings.TrimSpace(version)
 	ctx.Logf("Using resolved runtime version from package.json: %s", version)
 	return version, nil
 }
+
+// nodeArchiveURL returns the Node.js archive URL for the given version and platform.
+// Node.js names the amd64 architecture x64; other architectures match Go naming.
+func nodeArchiveURL(version string, p gcp.Platform) string {
+	arch := p.Arch
+	if arch == "amd64" {
+		arch = "x64"
+	}
+	return fmt.Sprintf(nodeURL, version, p.OS, arch)
+}
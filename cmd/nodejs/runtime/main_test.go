@@ -55,3 +55,29 @@ func TestDetect(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeArchiveURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		platform gcp.Platform
+		want     string
+	}{
+		{
+			name:     "amd64 uses x64",
+			platform: gcp.Platform{OS: "linux", Arch: "amd64"},
+			want:     "https://nodejs.org/dist/v12.16.1/node-v12.16.1-linux-x64.tar.xz",
+		},
+		{
+			name:     "arm64",
+			platform: gcp.Platform{OS: "linux", Arch: "arm64"},
+			want:     "https://nodejs.org/dist/v12.16.1/node-v12.16.1-linux-arm64.tar.xz",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nodeArchiveURL("12.16.1", tc.platform); got != tc.want {
+				t.Errorf("nodeArchiveURL(12.16.1, %s) = %q, want %q", tc.platform, got, tc.want)
+			}
+		})
+	}
+}
@@ -14,15 +14,19 @@
 
 // Implements nodejs/yarn buildpack.
 // The npm buildpack installs dependencies using yarn and installs yarn itself if not present.
+// If yarn cannot be installed, dependencies are installed using npm unless GOOGLE_YARN_STRICT is set.
 package main
 
 import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/nodejs"
 	"github.com/buildpack/libbuildpack/buildpackplan"
@@ -30,8 +34,10 @@ import (
 )
 
 const (
-	cacheTag = "prod dependencies"
-	yarnURL  = "https://github.com/yarnpkg/yarn/releases/download/v%[1]s/yarn-v%[1]s.tar.gz"
+	cacheTag          = "prod dependencies"
+	ignoreScriptsFlag = "--ignore-scripts"
+	// yarnURL is the Yarn release archive, which is plain JavaScript and identical on every platform.
+	yarnURL = "https://github.com/yarnpkg/yarn/releases/download/v%[1]s/yarn-v%[1]s.tar.gz"
 )
 
 // metadata represents metadata stored for a yarn layer.
@@ -54,16 +60,62 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	// Yarn installs node_modules in the application root.
+	ctx.RequirePlatform(gcp.WritableDir(ctx.ApplicationRoot()))
+	// Validate package.json before installing anything, as Yarn reports a missing or malformed file unclearly.
+	pjs, err := nodejs.RequirePackageJSON(ctx.ApplicationRoot())
+	if err != nil {
+		return err
+	}
+	ctx.RecordDependencyCount(len(pjs.Dependencies))
+
+	useNPM := false
 	if err := installYarn(ctx); err != nil {
-		return fmt.Errorf("installing Yarn: %w", err)
+		if yarnStrict(ctx) {
+			return fmt.Errorf("installing Yarn: %w", err)
+		}
+		ctx.Warnf("Failed to install Yarn, falling back to npm (set %s=true to disable): %v", env.YarnStrict, err)
+		useNPM = true
+	}
+	if useNPM {
+		ctx.RecordPackageManager("npm")
+	} else {
+		ctx.RecordPackageManager("yarn")
+		if err := ctx.CheckLockfiles(nodejs.YarnLock, nodejs.PackageLock); err != nil {
+			return err
+		}
 	}
 
 	ml := ctx.Layer("yarn")
 	nm := filepath.Join(ml.Root, "node_modules")
 	ctx.RemoveAll("node_modules")
+	// Yarn follows symlinks in the application, such as those of workspace packages, and hangs on cycles.
+	if err := ctx.CheckForCircularSymlinks(ctx.ApplicationRoot()); err != nil {
+		return err
+	}
+
+	lockfile := nodejs.YarnLock
+	if useNPM {
+		lockfile = nodejs.PackageLock
+	}
+	if err := nodejs.RequireLockfile(ctx, lockfile); err != nil {
+		return err
+	}
+	if useNPM {
+		nodejs.EnsurePackageLock(ctx)
+	}
 
 	nodeEnv := nodejs.NodeEnv()
-	cached, meta, err := nodejs.CheckCache(ctx, ml, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.YarnLock))
+	installEnv := nodejs.InstallNodeEnv()
+	if !nodejs.Production(ctx) {
+		ctx.Logf("Installing devDependencies with NODE_ENV=%s because %s is false.", installEnv, env.NodeProduction)
+	}
+	opts := []cache.Option{cache.WithStrings(installEnv), cache.WithFiles("package.json", lockfile), nodejs.WithConfigFiles(ctx.ApplicationRoot())}
+	ignoreScripts := nodejs.IgnoreScripts(ctx)
+	if ignoreScripts {
+		opts = append(opts, cache.WithStrings(ignoreScriptsFlag))
+	}
+	cached, meta, err := nodejs.CheckCache(ctx, ml, opts...)
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
@@ -76,14 +128,39 @@ func buildFn(ctx *gcp.Context) error {
 		ctx.CacheMiss(cacheTag)
 		// Clear cached node_modules to ensure we don't end up with outdated dependencies.
 		ctx.ClearLayer(ml)
+		ctx.WarnNativeDependencies(nodejs.NativeDependencies(pjs)...)
+	}
+
+	// Always run the install command to run preinstall/postinstall scripts.
+	cmd := nodejs.YarnCommand(ctx, "install", "--non-interactive")
+	if useNPM {
+		// On a cache hit `npm install` is a no-op because the lockfile is unchanged.
+		cmd = []string{"npm", "install", "--quiet"}
+		if !cached {
+			cmd = []string{"npm", nodejs.NPMInstallCommand(ctx), "--quiet"}
+		}
+	} else {
+		if lf := nodejs.LockfileFlag(ctx); lf != "" {
+			cmd = append(cmd, lf)
+		}
+	}
+	if ignoreScripts {
+		cmd = append(cmd, ignoreScriptsFlag)
+	}
+	checkLockfile := nodejs.WatchLockfile(ctx, lockfile)
+	if result, err := ctx.ExecWithErr(cmd, gcp.WithEnv("NODE_ENV="+installEnv), gcp.WithUserAttribution); err != nil {
+		if useNPM {
+			return err
+		}
+		return nodejs.YarnInstallError(result, err)
+	}
+	if err := checkLockfile(); err != nil {
+		return err
 	}
 
-	// Always run yarn install to run preinstall/postinstall scripts.
-	cmd := []string{"yarn", "install", "--non-interactive"}
-	if lf := nodejs.LockfileFlag(ctx); lf != "" {
-		cmd = append(cmd, lf)
+	if ignoreScripts {
+		nodejs.WarnSkippedScripts(ctx, "node_modules")
 	}
-	ctx.Exec(cmd, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
 
 	if !cached {
 		// Ensure node_modules exists even if no dependencies were installed.
@@ -91,6 +168,7 @@ func buildFn(ctx *gcp.Context) error {
 		ctx.Exec([]string{"cp", "--archive", "node_modules", nm}, gcp.WithUserTimingAttribution)
 	}
 
+	nodejs.RecordDependencies(ctx, "yarn")
 	ctx.WriteMetadata(ml, &meta, layers.Build, layers.Cache)
 
 	el := ctx.Layer("env")
@@ -100,10 +178,12 @@ func buildFn(ctx *gcp.Context) error {
 
 	// Configure the entrypoint for production.
 	cmd = []string{"yarn", "run", "start"}
+	if useNPM {
+		cmd = []string{"npm", "start"}
+	}
 
 	if !devmode.Enabled(ctx) {
-		ctx.AddWebProcess(cmd)
-		return nil
+		return entrypoint.AddProcesses(ctx, cmd)
 	}
 
 	// Configure the entrypoint and metadata for dev mode.
@@ -116,17 +196,36 @@ func buildFn(ctx *gcp.Context) error {
 	return nil
 }
 
+// yarnStrict returns true if the build should fail rather than fall back to npm when Yarn cannot be installed.
+func yarnStrict(ctx *gcp.Context) bool {
+	strict, err := env.IsPresentAndTrue(env.YarnStrict)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.YarnStrict, err)
+		return false
+	}
+	return strict
+}
+
 func installYarn(ctx *gcp.Context) error {
+	if bin := os.Getenv(env.YarnBin); bin != "" {
+		// Fail now if the configured executable does not exist, rather than falling back to npm.
+		nodejs.YarnCommand(ctx)
+		ctx.Debugf("Using Yarn from %s=%s, skipping installation.", env.YarnBin, bin)
+		return nil
+	}
 	// Skip installation if yarn is already installed.
-	if result := ctx.Exec([]string{"bash", "-c", "command -v yarn || true"}); result.Stdout != "" {
+	if _, err := ctx.ExecExpect([]string{"bash", "-c", "command -v yarn"}, "yarn"); err == nil {
 		ctx.Debugf("Yarn is already installed, skipping installation.")
 		return nil
 	}
 
 	// Use semver.io to determine the latest available version of Yarn.
 	ctx.Logf("Finding latest stable version of Yarn.")
-	result := ctx.Exec([]string{"curl", "--silent", "--get", "http://semver.io/yarn/stable"}, gcp.WithUserAttribution)
-	version := result.Stdout
+	version, err := ctx.DownloadString("http://semver.io/yarn/stable")
+	if err != nil {
+		return err
+	}
+	version = strings.TrimSpace(version)
 	ctx.Logf("The latest stable version of Yarn is v%s", version)
 
 	yarnLayer := "yarn_install"
@@ -144,9 +243,15 @@ func installYarn(ctx *gcp.Context) error {
 
 		// Download and install yarn in layer.
 		ctx.Logf("Installing Yarn v%s", version)
-		archiveURL := fmt.Sprintf(yarnURL, version)
-		command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --strip-components=1", archiveURL, yrl.Root)
-		ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+		tmp := ctx.TempDir("", yarnLayer)
+		defer ctx.RemoveAll(tmp)
+		archive := filepath.Join(tmp, "yarn.tar.gz")
+		if err := ctx.Download(fmt.Sprintf(yarnURL, version), archive); err != nil {
+			return err
+		}
+		if _, err := ctx.ExecWithErr([]string{"tar", "xzf", archive, "--directory", yrl.Root, "--strip-components=1"}, gcp.WithUserAttribution); err != nil {
+			return err
+		}
 	}
 
 	// Store layer flags and metadata.
@@ -59,7 +59,7 @@ func buildFn(ctx *gcp.Context) error {
 	ctx.RemoveAll("node_modules")
 
 	nodeEnv := nodejs.EnvDevelopment
-	cached, meta, err := nodejs.CheckCache(ctx, l, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.YarnLock))
+	cached, meta, err := nodejs.CheckCache(ctx, l, cache.WithStrings(nodeEnv), cache.WithFiles("package.json", nodejs.YarnLock), nodejs.WithConfigFiles(ctx.ApplicationRoot()))
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
@@ -73,18 +73,20 @@ func buildFn(ctx *gcp.Context) error {
 		// Clear cached node_modules to ensure we don't end up with outdated dependencies.
 		ctx.ClearLayer(l)
 
-		cmd := []string{"yarn", "install", "--non-interactive"}
+		cmd := nodejs.YarnCommand(ctx, "install", "--non-interactive")
 		if lf := nodejs.LockfileFlag(ctx); lf != "" {
 			cmd = append(cmd, lf)
 		}
-		ctx.Exec(cmd, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
+		if result, err := ctx.ExecWithErr(cmd, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution); err != nil {
+			return nodejs.YarnInstallError(result, err)
+		}
 
 		// Ensure node_modules exists even if no dependencies were installed.
 		ctx.MkdirAll("node_modules", 0755)
 		ctx.Exec([]string{"cp", "--archive", "node_modules", nm}, gcp.WithUserTimingAttribution)
 	}
 
-	ctx.Exec([]string{"yarn", "run", "gcp-build"}, gcp.WithUserAttribution)
+	ctx.Exec(nodejs.YarnCommand(ctx, "run", "gcp-build"), gcp.WithUserAttribution, gcp.WithSandbox)
 	ctx.RemoveAll("node_modules")
 	ctx.WriteMetadata(l, &meta, layers.Cache)
 	return nil
@@ -18,7 +18,10 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/php"
 )
@@ -32,17 +35,36 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if !ctx.FileExists("composer.json") {
+	if ctx.FileExists("composer.json") {
+		return nil
+	}
+	projects, err := php.FindComposerProjects(ctx)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
 		ctx.OptOut("composer.json not found.")
 	}
 	return nil
 }
 
 func buildFn(ctx *gcp.Context) error {
-	_, err := php.ComposerInstall(ctx, cacheTag)
+	// Composer installs vendor in the project directory, inside the application root.
+	ctx.RequirePlatform(gcp.WritableDir(ctx.ApplicationRoot()))
+	dir, err := php.ComposerProject(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.RecordPackageManager("composer")
+	ctx.LogEffectiveConfig(
+		gcp.EnvSetting("project directory", env.Buildable, dir),
+		gcp.EnvSetting("audit dependencies", env.AuditDependencies, strconv.FormatBool(audit.Enabled(ctx))),
+	)
+	_, err = php.ComposerInstall(ctx, cacheTag, dir)
 	if err != nil {
 		return fmt.Errorf("composer install: %w", err)
 	}
+	php.RecordDependencies(ctx, dir)
 
-	return nil
+	return php.Audit(ctx, dir)
 }
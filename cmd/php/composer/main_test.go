@@ -34,6 +34,21 @@ func TestDetect(t *testing.T) {
 			},
 			want: 0,
 		},
+		{
+			name: "with nested composer.json",
+			files: map[string]string{
+				"api/index.php":     "",
+				"api/composer.json": "",
+			},
+			want: 0,
+		},
+		{
+			name: "with composer.json only in vendor",
+			files: map[string]string{
+				"vendor/foo/composer.json": "",
+			},
+			want: 100,
+		},
 		{
 			name: "without composer.json",
 			files: map[string]string{
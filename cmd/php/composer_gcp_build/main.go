@@ -18,7 +18,9 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/php"
 )
@@ -48,12 +50,36 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
-	_, err := php.ComposerInstall(ctx, cacheTag)
+	dev, err := env.IsPresentAndTrue(env.ComposerInstallDev)
 	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.ComposerInstallDev, err)
+	}
+	install, devFlag := php.ComposerInstall, "--no-dev"
+	if dev {
+		ctx.Logf("Installing dev dependencies for the gcp-build script because %s is set.", env.ComposerInstallDev)
+		install, devFlag = php.ComposerInstallDev, "--dev"
+	} else {
+		warnDevCommands(ctx)
+	}
+	// The gcp-build script is only run for the project in the application root, GOOGLE_BUILDABLE does not apply.
+	if _, err := install(ctx, cacheTag, "."); err != nil {
 		return fmt.Errorf("composer install: %w", err)
 	}
 
-	ctx.Exec([]string{"composer", "run-script", "--timeout=600", "--no-dev", "gcp-build"}, gcp.WithUserAttribution)
+	ctx.Exec(php.ComposerCommand(ctx, "run-script", "--timeout=600", devFlag, "gcp-build"), gcp.WithUserAttribution, gcp.WithSandbox)
 	ctx.RemoveAll(php.Vendor)
 	return nil
 }
+
+// warnDevCommands warns if the gcp-build script appears to use commands from require-dev packages, which are not
+// installed unless GOOGLE_COMPOSER_INSTALL_DEV is set.
+func warnDevCommands(ctx *gcp.Context) {
+	cjs, err := php.ReadComposerJSON(ctx.ApplicationRoot())
+	if err != nil {
+		ctx.Debugf("Failed to read composer.json, skipping dev dependencies check: %v", err)
+		return
+	}
+	if pkgs := php.DevDependencyCommands(cjs); len(pkgs) > 0 {
+		ctx.Warnf("The gcp-build script appears to use commands from require-dev packages %s, but dev dependencies are not installed. Set %s=true to install them for the gcp-build script.", strings.Join(pkgs, ", "), env.ComposerInstallDev)
+	}
+}
@@ -55,10 +55,10 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
@@ -83,7 +83,7 @@ func buildFn(ctx *gcp.Context) error {
 		}
 	}
 
-	ctx.AddWebProcess([]string{"/bin/bash", "-c", fmt.Sprintf("php -S 0.0.0.0:${PORT} %s", routerScript)})
+	ctx.AddWebProcessWithHealthCheck([]string{"/bin/bash", "-c", fmt.Sprintf("php -S 0.0.0.0:${PORT} %s", routerScript)}, gcp.PortHealthCheck)
 
 	l := ctx.Layer("functions-framework")
 	ctx.SetFunctionsEnvVars(l)
@@ -122,7 +122,7 @@ func handleNoComposerJSON(ctx *gcp.Context) error {
 		cvt := filepath.Join(ctx.BuildpackRoot(), "converter")
 		ctx.Exec([]string{"cp", filepath.Join(cvt, "composer.json"), filepath.Join(cvt, "composer.lock"), "."})
 
-		if _, err := php.ComposerInstall(ctx, cacheTag); err != nil {
+		if _, err := php.ComposerInstall(ctx, cacheTag, "."); err != nil {
 			return fmt.Errorf("composer install: %w", err)
 		}
 
@@ -22,12 +22,13 @@ import (
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/appengine"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
-	"github.com/blang/semver"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/version"
 )
 
 var (
 	versionRegexp = regexp.MustCompile(`(?m)^Version:\s+(.*)$`)
-	minVersion    = semver.MustParse("19.0.0")
+	minVersion    = "19.0.0"
 )
 
 func main() {
@@ -45,7 +46,7 @@ func buildFn(ctx *gcp.Context) error {
 
 func entrypoint(ctx *gcp.Context) (*appengine.Entrypoint, error) {
 	// Check installed gunicorn version and warn if version is lower than supported
-	result, err := ctx.ExecWithErr([]string{"python3", "-m", "pip", "show", "gunicorn"}, gcp.WithUserTimingAttribution)
+	result, err := ctx.ExecWithErr(python.PipCommand(ctx, "show", "gunicorn"), gcp.WithUserTimingAttribution)
 	if err != nil {
 		if result != nil && result.ExitCode == 1 {
 			return nil, fmt.Errorf("gunicorn not installed: %s", result.Combined)
@@ -59,13 +60,12 @@ func entrypoint(ctx *gcp.Context) (*appengine.Entrypoint, error) {
 	}
 
 	versionString := match[1]
-	version, verr := semver.ParseTolerant(versionString)
+	c, verr := version.Compare(versionString, minVersion)
 	if verr != nil {
 		return nil, fmt.Errorf("unable to parse gunicorn version string %q: %v", versionString, verr)
 	}
-
-	if version.LT(minVersion) {
-		ctx.Warnf("Installed gunicorn version %q is less than supported version %q.", version, minVersion)
+	if c < 0 {
+		ctx.Warnf("Installed gunicorn version %q is less than supported version %q.", versionString, minVersion)
 	}
 
 	return &appengine.Entrypoint{
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
@@ -43,10 +44,10 @@ func main() {
 }
 
 func detectFn(ctx *gcp.Context) error {
-	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+	if _, ok := env.FunctionTargetResolved(ctx); ok {
+		ctx.OptInEnvSet(env.FunctionTargetVar())
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
@@ -65,11 +66,21 @@ func buildFn(ctx *gcp.Context) error {
 		content := ctx.ReadFile("requirements.txt")
 		hasFrameworkDependency = containsFF(string(content))
 	}
+	if !hasFrameworkDependency {
+		// The framework may also be installed indirectly, as a dependency of another requirement.
+		if v, ok := installedFramework(ctx); ok {
+			ctx.Logf("functions-framework %s is already installed by requirements.txt.", v)
+			hasFrameworkDependency = true
+		}
+	}
 
 	// Install functions-framework.
 	l := ctx.Layer(layerName)
 	if hasFrameworkDependency {
 		ctx.Logf("Handling functions with dependency on functions-framework.")
+		if v, ok := os.LookupEnv(env.PythonFFVersion); ok {
+			ctx.Warnf("Ignoring %s=%s, using the functions-framework version declared in requirements.txt.", env.PythonFFVersion, v)
+		}
 		ctx.ClearLayer(l)
 
 		// With framework dependency, framework module is in pip buildpack, so only env vars are present in this layer.
@@ -82,7 +93,7 @@ func buildFn(ctx *gcp.Context) error {
 	}
 
 	ctx.SetFunctionsEnvVars(l)
-	ctx.AddWebProcess([]string{"functions-framework"})
+	ctx.AddWebProcessWithHealthCheck([]string{"functions-framework"}, gcp.PortHealthCheck)
 	return nil
 }
 
@@ -103,9 +114,31 @@ func containsFF(s string) bool {
 	return ffRegexp.MatchString(s) || eggRegexp.MatchString(s)
 }
 
+// installedFramework returns the version of functions-framework installed into PYTHONPATH by earlier buildpacks, if any.
+func installedFramework(ctx *gcp.Context) (string, bool) {
+	for _, dir := range filepath.SplitList(os.Getenv("PYTHONPATH")) {
+		if dir == "" {
+			continue
+		}
+		if infos := ctx.Glob(filepath.Join(dir, "functions_framework-*.dist-info")); len(infos) > 0 {
+			return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(infos[0]), "functions_framework-"), ".dist-info"), true
+		}
+	}
+	return "", false
+}
+
 func installFramework(ctx *gcp.Context, l *layers.Layer) error {
 	cvt := filepath.Join(ctx.BuildpackRoot(), "converter")
 	req := filepath.Join(cvt, "requirements.txt")
+	if v, ok := os.LookupEnv(env.PythonFFVersion); ok {
+		r, err := frameworkRequirement(v)
+		if err != nil {
+			return err
+		}
+		ctx.Logf("Installing %s from %s.", r, env.PythonFFVersion)
+		req = filepath.Join(ctx.TempDir("", layerName), "requirements.txt")
+		ctx.WriteFile(req, []byte(r+"\n"), 0644)
+	}
 	cached, meta, err := python.CheckCache(ctx, l, cache.WithFiles(req))
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
@@ -114,9 +147,16 @@ func installFramework(ctx *gcp.Context, l *layers.Layer) error {
 		ctx.CacheHit(layerName)
 	} else {
 		ctx.CacheMiss(layerName)
-		ctx.Exec([]string{"python3", "-m", "pip", "install", "--upgrade", "-t", l.Root, "-r", req}, gcp.WithUserAttribution)
+		ctx.Exec(python.PipCommand(ctx, "install", "--upgrade", "-t", l.Root, "-r", req), gcp.WithUserAttribution)
+		python.CompileDeterministic(ctx, l.Root)
 	}
 	ctx.PrependPathSharedEnv(l, "PYTHONPATH", l.Root)
 	ctx.WriteMetadata(l, &meta, layers.Build, layers.Cache, layers.Launch)
 	return nil
 }
+
+// frameworkRequirement returns the requirements.txt line that installs functions-framework constrained to version.
+// A bare version is pinned exactly; a version specifier list is used as is.
+func frameworkRequirement(version string) (string, error) {
+	return python.Requirement("functions-framework", version, env.PythonFFVersion)
+}
@@ -15,9 +15,13 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
 )
 
 func TestContainsFF(t *testing.T) {
@@ -62,7 +66,37 @@ func TestContainsFF(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			got := containsFF(tc.str)
 			if got != tc.want {
-				t.Errorf("containsFF() got %q, want %q", got, tc.want)
+				t.Errorf("containsFF() got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFrameworkRequirement(t *testing.T) {
+	testCases := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{version: "1.5.0", want: "functions-framework==1.5.0"},
+		{version: " 1.5.0 ", want: "functions-framework==1.5.0"},
+		{version: "==1.4.3", want: "functions-framework==1.4.3"},
+		{version: "~=1.4", want: "functions-framework~=1.4"},
+		{version: ">=1.4,<2", want: "functions-framework>=1.4,<2"},
+		{version: "1.5.0b1", want: "functions-framework==1.5.0b1"},
+		{version: "", wantErr: true},
+		{version: "latest", wantErr: true},
+		{version: "1.5.0\nflask", wantErr: true},
+		{version: "1.5.0 --index-url http://example.com", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			got, err := frameworkRequirement(tc.version)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("frameworkRequirement(%q) got error %v, want error %t", tc.version, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("frameworkRequirement(%q) = %q, want %q", tc.version, got, tc.want)
 			}
 		})
 	}
@@ -81,6 +115,11 @@ func TestDetect(t *testing.T) {
 			env:  []string{"GOOGLE_FUNCTION_TARGET=helloWorld"},
 			want: 0,
 		},
+		{
+			name: "with legacy entry point",
+			env:  []string{"ENTRY_POINT=helloWorld"},
+			want: 0,
+		},
 		{
 			name: "without target",
 			want: 100,
@@ -92,3 +131,75 @@ func TestDetect(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectReason(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  []string
+		want gcp.DetectReason
+	}{
+		{
+			name: "with target",
+			env:  []string{"GOOGLE_FUNCTION_TARGET=helloWorld"},
+			want: gcp.DetectReason{Criterion: gcp.CriterionEnv, Value: "GOOGLE_FUNCTION_TARGET", Message: "GOOGLE_FUNCTION_TARGET set"},
+		},
+		{
+			name: "with legacy target",
+			env:  []string{"FUNCTION_TARGET=helloWorld"},
+			want: gcp.DetectReason{Criterion: gcp.CriterionEnv, Value: "FUNCTION_TARGET", Message: "FUNCTION_TARGET set"},
+		},
+		{
+			name: "without target",
+			want: gcp.DetectReason{Criterion: gcp.CriterionEnv, Value: "GOOGLE_FUNCTION_TARGET", Message: "GOOGLE_FUNCTION_TARGET not set"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := gcp.RunDetectInProcess(t, detectFn, nil, tc.env).Reason; got != tc.want {
+				t.Errorf("detect reason = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInstalledFramework(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dirs        []string
+		wantVersion string
+		want        bool
+	}{
+		{
+			name:        "installed",
+			dirs:        []string{"pip/flask-1.1.2.dist-info", "pip/functions_framework-2.0.0.dist-info"},
+			wantVersion: "2.0.0",
+			want:        true,
+		},
+		{
+			name: "not installed",
+			dirs: []string{"pip/flask-1.1.2.dist-info"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "functions-framework-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, d := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", d, err)
+				}
+			}
+			os.Setenv("PYTHONPATH", filepath.Join(dir, "missing")+":"+filepath.Join(dir, "pip"))
+			defer os.Unsetenv("PYTHONPATH")
+
+			gotVersion, got := installedFramework(gcp.NewContextForTests(buildpack.Info{}, dir))
+
+			if got != tc.want || gotVersion != tc.wantVersion {
+				t.Errorf("installedFramework() = (%q, %t), want (%q, %t)", gotVersion, got, tc.wantVersion, tc.want)
+			}
+		})
+	}
+}
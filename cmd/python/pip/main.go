@@ -19,16 +19,24 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
 const (
-	layerName = "pip"
-	cacheName = "pipcache"
+	layerName      = "pip"
+	cacheName      = "pipcache"
+	wheelCacheName = "pipwheels"
+	// bytecodeCacheName is the layer that the bytecode of installed dependencies is cached in, so that it is reused
+	// when dependencies are reinstalled.
+	bytecodeCacheName = "pipbytecode"
 )
 
 // metadata represents metadata stored for a dependencies layer.
@@ -50,33 +58,84 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	ctx.RecordPackageManager("pip")
+	if err := ctx.CheckLockfiles("requirements.txt", "Pipfile.lock"); err != nil {
+		return err
+	}
+	if venvs, err := python.VirtualenvDirs(ctx.ApplicationRoot()); err != nil {
+		ctx.Debugf("Failed to look for virtualenvs in the application source: %v", err)
+	} else if len(venvs) > 0 {
+		ctx.Warnf("Ignoring virtualenv %s in the application source, dependencies are installed from requirements.txt into a separate layer. Remove it from the source to reduce the image size.", strings.Join(venvs, ", "))
+	}
 	l := ctx.Layer(layerName)
 	cl := ctx.Layer(cacheName)
 
-	cached, meta, err := python.CheckCache(ctx, l, cache.WithFiles("requirements.txt"))
+	target, err := python.InstallTarget(l)
+	if err != nil {
+		return err
+	}
+
+	findLinks := python.FindLinks(ctx)
+	ctx.LogEffectiveConfig(
+		gcp.EnvSetting("install target", env.PipTarget, target),
+		gcp.EnvSetting("find links", env.PipFindLinks, findLinks),
+		gcp.EnvSetting("audit dependencies", env.AuditDependencies, strconv.FormatBool(audit.Enabled(ctx))),
+	)
+	req, reqHash, err := python.RequirementsToInstall(ctx, "requirements.txt")
+	if err != nil {
+		return err
+	}
+	if req != "requirements.txt" {
+		defer ctx.RemoveAll(req)
+	}
+	cached, meta, err := python.CheckCache(ctx, l, reqHash, python.WithFindLinks(findLinks), cache.WithStrings(target))
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
 	if cached {
 		ctx.CacheHit(layerName)
-		return nil
+		python.RecordDependencies(ctx, l, target)
+		// Audit cached dependencies too, as vulnerabilities may have been disclosed since they were installed.
+		return python.Audit(ctx, target, "PIP_CACHE_DIR="+cl.Root)
 	}
 	ctx.CacheMiss(layerName)
+	if native, err := python.NativeRequirements(req); err != nil {
+		ctx.Debugf("Failed to check requirements for native packages: %v", err)
+	} else {
+		ctx.WarnNativeDependencies(native...)
+	}
+
+	// Reuse wheels built from source distributions by previous builds, such as those of native extensions.
+	wl := ctx.Layer(wheelCacheName)
+	wheels := python.WheelCacheDir(ctx, wl)
 
 	// Install modules in requirements.txt.
 	ctx.Logf("Running pip install.")
-	ctx.Exec([]string{"python3", "-m", "pip", "install", "--upgrade", "-r", "requirements.txt", "-t", l.Root}, gcp.WithEnv("PIP_CACHE_DIR="+cl.Root), gcp.WithUserAttribution)
+	if err := python.InstallRequirements(ctx, req, target, findLinks, "PIP_CACHE_DIR="+cl.Root, python.FindLinksEnv(wheels)); err != nil {
+		return err
+	}
+	python.SaveBuiltWheels(ctx, cl.Root, wheels)
+	python.PruneWheels(ctx, wheels, target)
 
-	ctx.PrependPathSharedEnv(l, "PYTHONPATH", l.Root)
+	bl := ctx.Layer(bytecodeCacheName)
+	python.CompileDeterministicCached(ctx, bl.Root, target)
+	ctx.PrependPathSharedEnv(l, "PYTHONPATH", target)
 
 	// Check for broken dependencies.
 	ctx.Logf("Checking for incompatible dependencies.")
-	checkDeps := ctx.Exec([]string{"python3", "-m", "pip", "check"}, gcp.WithEnv("PYTHONPATH="+l.Root+":"+os.Getenv("PYTHONPATH")), gcp.WithUserAttribution)
+	checkDeps := ctx.Exec(python.PipCommand(ctx, "check"), gcp.WithEnv("PYTHONPATH="+target+":"+os.Getenv("PYTHONPATH")), gcp.WithUserAttribution)
 	if checkDeps.ExitCode != 0 {
 		return fmt.Errorf("incompatible dependencies installed: %q", checkDeps.Stdout)
 	}
 
+	python.RecordDependencies(ctx, l, target)
+	// The layer is in the application image, so it must not include VCS metadata or logs from the install.
+	if err := ctx.AssertLayerContents(l, ".git", "*.log"); err != nil {
+		return err
+	}
 	ctx.WriteMetadata(l, &meta, layers.Build, layers.Cache, layers.Launch)
 	ctx.WriteMetadata(cl, nil, layers.Cache)
-	return nil
+	ctx.WriteMetadata(wl, nil, layers.Cache)
+	ctx.WriteMetadata(bl, nil, layers.Cache)
+	return python.Audit(ctx, target, "PIP_CACHE_DIR="+cl.Root)
 }
@@ -18,13 +18,14 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/runtime"
 	"github.com/buildpack/libbuildpack/buildpackplan"
 	"github.com/buildpack/libbuildpack/layers"
@@ -32,7 +33,6 @@ import (
 
 const (
 	pythonLayer = "python"
-	pythonURL   = "https://storage.googleapis.com/gcp-buildpacks/python/python-%s.tar.gz"
 	// TODO(b/148375706): Add mapping for stable/beta versions.
 	versionURL  = "https://storage.googleapis.com/gcp-buildpacks/python/latest.version"
 	versionFile = ".python-version"
@@ -40,7 +40,8 @@ const (
 
 // metadata represents metadata stored for a runtime layer.
 type metadata struct {
-	Version string `toml:"version"`
+	Version    string   `toml:"version"`
+	BuildTools []string `toml:"build_tools"`
 }
 
 func main() {
@@ -61,34 +62,39 @@ func buildFn(ctx *gcp.Context) error {
 	if err != nil {
 		return fmt.Errorf("determining runtime version: %w", err)
 	}
+	ctx.RecordRuntimeVersion("python", version)
+	if err := python.CheckRequiresPython(ctx, version); err != nil {
+		return err
+	}
+	tools, err := buildTools()
+	if err != nil {
+		return err
+	}
 	// Check the metadata in the cache layer to determine if we need to proceed.
 	var meta metadata
 	l := ctx.Layer(pythonLayer)
 	ctx.ReadMetadata(l, &meta)
-	if version == meta.Version {
+	if version == meta.Version && reflect.DeepEqual(tools, meta.BuildTools) && !ctx.ClearCacheRequested() {
 		ctx.CacheHit(pythonLayer)
 		return nil
 	}
 	ctx.CacheMiss(pythonLayer)
 	ctx.ClearLayer(l)
 
-	archiveURL := fmt.Sprintf(pythonURL, version)
-	if code := ctx.HTTPStatus(archiveURL); code != http.StatusOK {
-		return gcp.UserErrorf("Runtime version %s does not exist at %s (status %d). You can specify the version with %s.", version, archiveURL, code, env.RuntimeVersion)
-	}
-
 	ctx.Logf("Installing Python v%s", version)
-	command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s", archiveURL, l.Root)
-	ctx.Exec([]string{"bash", "-c", command})
+	if err := python.InstallRuntime(ctx, version, l.Root); err != nil {
+		return err
+	}
 
 	ctx.Logf("Upgrading pip to the latest version and installing build tools")
 	path := filepath.Join(l.Root, "bin/python3")
-	ctx.Exec([]string{path, "-m", "pip", "install", "--upgrade", "pip", "setuptools", "wheel"}, gcp.WithUserAttribution)
+	ctx.Exec(append([]string{path, "-m", "pip", "install", "--upgrade"}, tools...), gcp.WithUserAttribution)
 
 	// Force stdout/stderr streams to be unbuffered so that log messages appear immediately in the logs.
 	ctx.DefaultLaunchEnv(l, "PYTHONUNBUFFERED", "TRUE")
 
 	meta.Version = version
+	meta.BuildTools = tools
 	ctx.WriteMetadata(l, meta, layers.Build, layers.Cache, layers.Launch)
 
 	ctx.AddBuildpackPlan(buildpackplan.Plan{
@@ -99,21 +105,73 @@ func buildFn(ctx *gcp.Context) error {
 	return nil
 }
 
+// buildTools returns the requirements for the build tools installed with the runtime: pip, and setuptools and wheel
+// constrained by GOOGLE_SETUPTOOLS_VERSION and GOOGLE_WHEEL_VERSION if set.
+func buildTools() ([]string, error) {
+	tools := []string{"pip"}
+	for _, t := range []struct {
+		pkg    string
+		envVar string
+	}{
+		{pkg: "setuptools", envVar: env.SetuptoolsVersion},
+		{pkg: "wheel", envVar: env.WheelVersion},
+	} {
+		version := os.Getenv(t.envVar)
+		if version == "" {
+			tools = append(tools, t.pkg)
+			continue
+		}
+		req, err := python.Requirement(t.pkg, version, t.envVar)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, req)
+	}
+	return tools, nil
+}
+
+// runtimeVersion returns the Python version to install: the version pinned by GOOGLE_RUNTIME_VERSION or
+// .python-version, the latest release of the version declared by the runtime field of app.yaml, such as python39, or
+// the latest version.
 func runtimeVersion(ctx *gcp.Context) (string, error) {
-	if v := os.Getenv(env.RuntimeVersion); v != "" {
-		ctx.Logf("Using runtime version from %s: %s", env.RuntimeVersion, v)
-		return v, nil
+	resolver := runtime.Chain{
+		runtime.EnvVar(env.RuntimeVersion),
+		runtime.File(versionFile),
 	}
-	if ctx.FileExists(versionFile) {
-		raw := ctx.ReadFile(versionFile)
-		v := strings.TrimSpace(string(raw))
-		if v != "" {
-			ctx.Logf("Using runtime version from %s: %s", versionFile, v)
-			return v, nil
+	pinned, err := resolver.ResolveVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	hint, err := runtime.AppYAMLRuntime{Name: "python", Major: "3"}.ResolveVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if pinned != "" {
+		if hint != "" && !matchesHint(pinned, hint) {
+			// app.yaml only affects App Engine deployments, elsewhere it may be left over and the mismatch is harmless.
+			ctx.WarnfForTarget(gcp.TargetAppEngine, "Installing Python %s, which does not match Python %s declared by the runtime field of app.yaml.", pinned, hint)
+		}
+		return pinned, nil
+	}
+	if hint != "" {
+		v, err := python.LatestPatchVersion(ctx, hint)
+		if err != nil {
+			return "", err
 		}
-		return "", gcp.UserErrorf("%s exists but does not specify a version", versionFile)
+		ctx.Logf("Using the latest Python %s release: %s", hint, v)
+		return v, nil
+	}
+	v, err := runtime.Network(versionURL).ResolveVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		return "", gcp.InternalErrorf("unable to determine the latest Python version from %s", versionURL)
 	}
-	v := ctx.Exec([]string{"curl", "--silent", versionURL}).Stdout
-	ctx.Logf("Using latest runtime version: %s", v)
 	return v, nil
 }
+
+// matchesHint returns true if version v is the major and minor version hint or one of its releases.
+func matchesHint(v, hint string) bool {
+	return v == hint || strings.HasPrefix(v, hint+".")
+}
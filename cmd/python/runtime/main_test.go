@@ -15,8 +15,11 @@
 package main
 
 import (
+	"os"
+	"reflect"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 )
 
@@ -45,3 +48,68 @@ func TestDetect(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildTools(t *testing.T) {
+	testCases := []struct {
+		name       string
+		setuptools string
+		wheel      string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "unpinned",
+			want: []string{"pip", "setuptools", "wheel"},
+		},
+		{
+			name:       "setuptools version",
+			setuptools: "44.1.1",
+			want:       []string{"pip", "setuptools==44.1.1", "wheel"},
+		},
+		{
+			name:       "both specifiers",
+			setuptools: "<45",
+			wheel:      ">=0.34,<0.35",
+			want:       []string{"pip", "setuptools<45", "wheel>=0.34,<0.35"},
+		},
+		{
+			name:    "invalid",
+			wheel:   "latest",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(env.SetuptoolsVersion, tc.setuptools)
+			defer os.Unsetenv(env.SetuptoolsVersion)
+			os.Setenv(env.WheelVersion, tc.wheel)
+			defer os.Unsetenv(env.WheelVersion)
+
+			got, err := buildTools()
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("buildTools() got error %v, want error %t", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("buildTools() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchesHint(t *testing.T) {
+	testCases := []struct {
+		version string
+		hint    string
+		want    bool
+	}{
+		{version: "3.9.1", hint: "3.9", want: true},
+		{version: "3.9", hint: "3.9", want: true},
+		{version: "3.10.0", hint: "3.1"},
+		{version: "3.8.6", hint: "3.9"},
+	}
+	for _, tc := range testCases {
+		if got := matchesHint(tc.version, tc.hint); got != tc.want {
+			t.Errorf("matchesHint(%q, %q) = %t, want %t", tc.version, tc.hint, got, tc.want)
+		}
+	}
+}
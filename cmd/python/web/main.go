@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Implements python/web buildpack.
+// The web buildpack sets a default entrypoint for applications built with a known web framework, serving WSGI
+// applications with gunicorn and ASGI applications with uvicorn.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/entrypoint"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+const (
+	layerName = "server"
+	// workers is the default number of worker processes, overridable at launch with WEB_CONCURRENCY.
+	workers = "${WEB_CONCURRENCY:-$((2 * $(nproc) + 1))}"
+)
+
+func main() {
+	gcp.Main(detectFn, buildFn)
+}
+
+func detectFn(ctx *gcp.Context) error {
+	if os.Getenv(env.Entrypoint) != "" {
+		ctx.OptOut("custom entrypoint present")
+	}
+	if ctx.FileExists("Procfile") {
+		ctx.OptOut("Procfile present")
+	}
+	if !ctx.FileExists("requirements.txt") {
+		ctx.OptOut("requirements.txt not found")
+	}
+	fw, ok := python.DetectFramework(string(ctx.ReadFile("requirements.txt")))
+	if !ok {
+		ctx.OptOut("no web framework found in requirements.txt")
+	}
+	if _, ok := appTarget(ctx, fw); !ok {
+		ctx.OptOut("%s application module not found", fw.Name)
+	}
+	return nil
+}
+
+func buildFn(ctx *gcp.Context) error {
+	fw, _ := python.DetectFramework(string(ctx.ReadFile("requirements.txt")))
+	target, ok := appTarget(ctx, fw)
+	if !ok {
+		return gcp.UserErrorf("%s application module not found", fw.Name)
+	}
+	ctx.Logf("Detected %s application %s.", fw.Name, target)
+
+	server := serverPackage(fw)
+	if python.ContainsPackage(string(ctx.ReadFile("requirements.txt")), server) {
+		ctx.Debugf("%s present in requirements.txt, skipping installation.", server)
+	} else if err := installServer(ctx, server); err != nil {
+		return fmt.Errorf("installing %s: %w", server, err)
+	}
+
+	return entrypoint.AddProcesses(ctx, webCommand(fw, target))
+}
+
+// appTarget returns the module and variable of the application object, for example `main:app`.
+func appTarget(ctx *gcp.Context, fw python.Framework) (string, bool) {
+	if fw.Name == "django" {
+		m := ctx.Glob(filepath.Join("*", "wsgi.py"))
+		if len(m) == 0 {
+			return "", false
+		}
+		return filepath.Base(filepath.Dir(m[0])) + ".wsgi:application", true
+	}
+	for _, module := range []string{"main", "app"} {
+		if ctx.FileExists(module + ".py") {
+			return module + ":app", true
+		}
+	}
+	return "", false
+}
+
+// serverPackage returns the package of the server used to run applications built with fw.
+func serverPackage(fw python.Framework) string {
+	if fw.ASGI {
+		return "uvicorn"
+	}
+	return "gunicorn"
+}
+
+// webCommand returns the command to serve target. The number of workers defaults to twice the number of CPUs plus one.
+func webCommand(fw python.Framework, target string) []string {
+	cmd := fmt.Sprintf("exec python3 -m gunicorn --bind :$PORT --workers %s %s", workers, target)
+	if fw.ASGI {
+		cmd = fmt.Sprintf("exec python3 -m uvicorn --host 0.0.0.0 --port $PORT --workers %s %s", workers, target)
+	}
+	// Use /bin/bash to expand the port and the number of workers at launch.
+	return []string{"/bin/bash", "-c", cmd}
+}
+
+func installServer(ctx *gcp.Context, server string) error {
+	l := ctx.Layer(layerName)
+	cached, meta, err := python.CheckCache(ctx, l, cache.WithStrings(server))
+	if err != nil {
+		return fmt.Errorf("checking cache: %w", err)
+	}
+	if cached {
+		ctx.CacheHit(layerName)
+	} else {
+		ctx.CacheMiss(layerName)
+		ctx.Logf("Installing %s.", server)
+		ctx.Exec(python.PipCommand(ctx, "install", "--upgrade", server, "-t", l.Root), gcp.WithUserAttribution)
+		python.CompileDeterministic(ctx, l.Root)
+	}
+	ctx.PrependPathSharedEnv(l, "PYTHONPATH", l.Root)
+	ctx.WriteMetadata(l, meta, layers.Build, layers.Cache, layers.Launch)
+	return nil
+}
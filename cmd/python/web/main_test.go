@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		env   []string
+		want  int
+	}{
+		{
+			name: "flask app",
+			files: map[string]string{
+				"main.py":          "",
+				"requirements.txt": "flask\n",
+			},
+			want: 0,
+		},
+		{
+			name: "django project",
+			files: map[string]string{
+				"manage.py":        "",
+				"mysite/wsgi.py":   "",
+				"requirements.txt": "Django==3.1\n",
+			},
+			want: 0,
+		},
+		{
+			name: "django without wsgi module",
+			files: map[string]string{
+				"manage.py":        "",
+				"requirements.txt": "Django==3.1\n",
+			},
+			want: 100,
+		},
+		{
+			name: "no framework",
+			files: map[string]string{
+				"main.py":          "",
+				"requirements.txt": "requests\n",
+			},
+			want: 100,
+		},
+		{
+			name: "no app module",
+			files: map[string]string{
+				"server.py":        "",
+				"requirements.txt": "flask\n",
+			},
+			want: 100,
+		},
+		{
+			name: "no requirements",
+			files: map[string]string{
+				"main.py": "",
+			},
+			want: 100,
+		},
+		{
+			name: "procfile",
+			files: map[string]string{
+				"main.py":          "",
+				"Procfile":         "web: python3 main.py",
+				"requirements.txt": "flask\n",
+			},
+			want: 100,
+		},
+		{
+			name: "custom entrypoint",
+			files: map[string]string{
+				"main.py":          "",
+				"requirements.txt": "flask\n",
+			},
+			env:  []string{"GOOGLE_ENTRYPOINT=python3 main.py"},
+			want: 100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gcp.TestDetect(t, detectFn, tc.name, tc.files, tc.env, tc.want)
+		})
+	}
+}
+
+func TestWebCommand(t *testing.T) {
+	testCases := []struct {
+		name   string
+		fw     python.Framework
+		target string
+		want   []string
+	}{
+		{
+			name:   "wsgi",
+			fw:     python.Framework{Name: "flask"},
+			target: "main:app",
+			want:   []string{"/bin/bash", "-c", "exec python3 -m gunicorn --bind :$PORT --workers ${WEB_CONCURRENCY:-$((2 * $(nproc) + 1))} main:app"},
+		},
+		{
+			name:   "asgi",
+			fw:     python.Framework{Name: "fastapi", ASGI: true},
+			target: "app:app",
+			want:   []string{"/bin/bash", "-c", "exec python3 -m uvicorn --host 0.0.0.0 --port $PORT --workers ${WEB_CONCURRENCY:-$((2 * $(nproc) + 1))} app:app"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webCommand(tc.fw, tc.target); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("webCommand(%v, %q) = %q, want %q", tc.fw, tc.target, got, tc.want)
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/python"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
@@ -61,7 +62,7 @@ func buildFn(ctx *gcp.Context) error {
 	ctx.ReadMetadata(l, &meta)
 
 	// Check for up to date gunicorn version
-	raw := ctx.Exec([]string{"python3", "-m", "pip", "search", "gunicorn"}, gcp.WithUserAttribution).Stdout
+	raw := ctx.Exec(python.PipCommand(ctx, "search", "gunicorn"), gcp.WithUserAttribution).Stdout
 	match := versionRegexp.FindStringSubmatch(raw)
 	if len(match) < 2 || match[1] == "" {
 		return fmt.Errorf("pip search returned unexpected gunicorn version %q", raw)
@@ -82,7 +83,8 @@ func buildFn(ctx *gcp.Context) error {
 	}
 
 	ctx.Logf("Installing gunicorn.")
-	ctx.Exec([]string{"python3", "-m", "pip", "install", "--upgrade", "gunicorn", "-t", l.Root}, gcp.WithUserAttribution)
+	ctx.Exec(python.PipCommand(ctx, "install", "--upgrade", "gunicorn", "-t", l.Root), gcp.WithUserAttribution)
+	python.CompileDeterministic(ctx, l.Root)
 
 	ctx.PrependPathSharedEnv(l, "PYTHONPATH", l.Root)
 
@@ -19,9 +19,12 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/ruby"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
@@ -47,6 +50,7 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	ctx.RecordPackageManager("bundler")
 	var lockFile string
 	hasGemfile := ctx.FileExists("Gemfile")
 	hasGemsRB := ctx.FileExists("gems.rb")
@@ -64,12 +68,13 @@ func buildFn(ctx *gcp.Context) error {
 		}
 		lockFile = "gems.locked"
 	}
+	without := ruby.BundleWithout()
 
 	deps := ctx.Layer(layerName)
 	// This layer directory contains the files installed by bundler into the application .bundle directory
 	bundleOutput := filepath.Join(deps.Root, ".bundle")
 
-	cached, meta, err := checkCache(ctx, deps, cache.WithFiles(lockFile))
+	cached, meta, err := checkCache(ctx, deps, cache.WithFiles(lockFile), cache.WithStrings(without...))
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
@@ -85,7 +90,12 @@ func buildFn(ctx *gcp.Context) error {
 		ctx.RemoveAll(localGemsDir, localBinDir)
 		ctx.Exec([]string{"bundle", "config", "--local", "deployment", "true"}, gcp.WithUserAttribution)
 		ctx.Exec([]string{"bundle", "config", "--local", "frozen", "true"}, gcp.WithUserAttribution)
-		ctx.Exec([]string{"bundle", "config", "--local", "without", "development test"}, gcp.WithUserAttribution)
+		if len(without) > 0 {
+			ctx.Logf("Excluding Gemfile groups: %s (set %s to override).", strings.Join(without, ", "), env.BundleWithout)
+			ctx.Exec([]string{"bundle", "config", "--local", "without", strings.Join(without, " ")}, gcp.WithUserAttribution)
+		} else {
+			ctx.Exec([]string{"bundle", "config", "--local", "--delete", "without"}, gcp.WithUserAttribution)
+		}
 		ctx.Exec([]string{"bundle", "config", "--local", "path", localGemsDir}, gcp.WithUserAttribution)
 		ctx.Exec([]string{"bundle", "install"}, gcp.WithUserAttribution)
 
@@ -36,15 +36,16 @@ func main() {
 
 func detectFn(ctx *gcp.Context) error {
 	if _, ok := os.LookupEnv(env.FunctionTarget); ok {
-		ctx.OptIn("%s set", env.FunctionTarget)
+		ctx.OptInEnvSet(env.FunctionTarget)
 	}
 	// TODO(b/154846199): For compatibility with GCF; this will be removed later.
+	// The legacy aliases of the function target are only honored outside of the google stack.
 	if os.Getenv("CNB_STACK_ID") != "google" {
-		if _, ok := os.LookupEnv(env.FunctionTargetLaunch); ok {
-			ctx.OptIn("%s set", env.FunctionTargetLaunch)
+		if _, ok := env.FunctionTargetResolved(ctx); ok {
+			ctx.OptInEnvSet(env.FunctionTargetVar())
 		}
 	}
-	ctx.OptOut("%s not set", env.FunctionTarget)
+	ctx.OptOutEnvNotSet(env.FunctionTarget)
 	return nil
 }
 
@@ -67,7 +68,7 @@ func buildFn(ctx *gcp.Context) error {
 		return gcp.UserErrorf("unable to execute functions-framework; please ensure the functions_framework gem is in your Gemfile")
 	}
 
-	ctx.AddWebProcess([]string{"bundle", "exec", "functions-framework"})
+	ctx.AddWebProcessWithHealthCheck([]string{"bundle", "exec", "functions-framework"}, gcp.PortHealthCheck)
 
 	return nil
 }
@@ -45,6 +45,18 @@ func TestDetect(t *testing.T) {
 			stack: "google",
 			want:  100,
 		},
+		{
+			name:  "with entry point and signature type GCF",
+			env:   []string{"ENTRY_POINT=helloWorld", "FUNCTION_SIGNATURE_TYPE=http"},
+			stack: "google.ruby",
+			want:  0,
+		},
+		{
+			name:  "with entry point only",
+			env:   []string{"ENTRY_POINT=helloWorld"},
+			stack: "google.ruby",
+			want:  100,
+		},
 		{
 			name: "without target",
 			want: 100,
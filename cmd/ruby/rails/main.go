@@ -17,6 +17,7 @@
 package main
 
 import (
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 )
 
@@ -28,6 +29,13 @@ func detectFn(ctx *gcp.Context) error {
 	if !ctx.FileExists("bin", "rails") {
 		ctx.OptOut("bin/rails not found.")
 	}
+	skip, err := env.IsPresentAndTrue(env.RailsSkipAssetPrecompile)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.RailsSkipAssetPrecompile, err)
+	}
+	if skip {
+		ctx.OptOut("%s set.", env.RailsSkipAssetPrecompile)
+	}
 	if !needsRailsAssetPrecompile(ctx) {
 		ctx.OptOut("Rails assets do not need precompilation.")
 	}
@@ -60,7 +68,7 @@ func buildFn(ctx *gcp.Context) error {
 	ctx.Logf("Running Rails asset precompilation")
 
 	// It is common practise in Ruby asset precompilation to ignore non-zero exit codes.
-	result, err := ctx.ExecWithErr([]string{"bundle", "exec", "bin/rails", "assets:precompile"}, gcp.WithEnv("RAILS_ENV=production"), gcp.WithUserAttribution)
+	result, err := ctx.ExecWithErr([]string{"bundle", "exec", "bin/rails", "assets:precompile"}, gcp.WithEnv("RAILS_ENV=production"), gcp.WithUserAttribution, gcp.WithSandbox)
 	if err != nil && result != nil && result.ExitCode != 0 {
 		ctx.Logf("WARNING: Asset precompilation returned non-zero exit code %d. Ignoring.", result.ExitCode)
 		return nil
@@ -24,6 +24,7 @@ func TestDetect(t *testing.T) {
 	testCases := []struct {
 		name  string
 		files map[string]string
+		env   []string
 		want  int
 	}{
 		{
@@ -34,6 +35,24 @@ func TestDetect(t *testing.T) {
 			},
 			want: 0,
 		},
+		{
+			name: "skip asset precompile",
+			files: map[string]string{
+				"bin/rails":   "",
+				"app/assets/": "",
+			},
+			env:  []string{"GOOGLE_RAILS_SKIP_ASSET_PRECOMPILE=true"},
+			want: 100,
+		},
+		{
+			name: "skip asset precompile false",
+			files: map[string]string{
+				"bin/rails":   "",
+				"app/assets/": "",
+			},
+			env:  []string{"GOOGLE_RAILS_SKIP_ASSET_PRECOMPILE=false"},
+			want: 0,
+		},
 		{
 			name: "no asset precompile because no assets dir",
 			files: map[string]string{
@@ -76,7 +95,7 @@ func TestDetect(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			gcp.TestDetect(t, detectFn, tc.name, tc.files, []string{}, tc.want)
+			gcp.TestDetect(t, detectFn, tc.name, tc.files, tc.env, tc.want)
 		})
 	}
 }
@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Implements utils/apt buildpack.
+// The apt buildpack installs system packages declared in an Aptfile into a layer.
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+const (
+	aptfile  = "Aptfile"
+	aptLayer = "apt"
+)
+
+// goarchMultiarch maps Go architectures to the Debian multiarch tuples of their library directories.
+var goarchMultiarch = map[string]string{
+	"386":     "i386-linux-gnu",
+	"amd64":   "x86_64-linux-gnu",
+	"arm":     "arm-linux-gnueabihf",
+	"arm64":   "aarch64-linux-gnu",
+	"ppc64le": "powerpc64le-linux-gnu",
+	"s390x":   "s390x-linux-gnu",
+}
+
+// metadata represents metadata stored for the apt layer.
+type metadata struct {
+	DependencyHash string `toml:"dependency_hash"`
+}
+
+func main() {
+	gcp.Main(detectFn, buildFn)
+}
+
+func detectFn(ctx *gcp.Context) error {
+	if !ctx.FileExists(aptfile) {
+		ctx.OptOut("%s not found.", aptfile)
+	}
+	return nil
+}
+
+func buildFn(ctx *gcp.Context) error {
+	pkgs := parseAptfile(string(ctx.ReadFileNormalized(aptfile)))
+	if len(pkgs) == 0 {
+		ctx.Logf("No packages found in %s, skipping installation.", aptfile)
+		return nil
+	}
+
+	l := ctx.Layer(aptLayer)
+	hash, err := cache.Hash(ctx, cache.WithFiles(aptfile))
+	if err != nil {
+		return fmt.Errorf("computing %s hash: %w", aptfile, err)
+	}
+
+	var meta metadata
+	ctx.ReadMetadata(l, &meta)
+	if hash == meta.DependencyHash {
+		ctx.CacheHit(aptLayer)
+		ctx.Logf("%s cache hit, skipping installation.", aptfile)
+	} else {
+		ctx.CacheMiss(aptLayer)
+		ctx.ClearLayer(l)
+		installPackages(ctx, pkgs, l.Root)
+		meta.DependencyHash = hash
+	}
+
+	root := l.Root
+	arch := multiarch(ctx)
+	ctx.PrependPathSharedEnv(l, "PATH", strings.Join([]string{
+		filepath.Join(root, "usr", "bin"),
+		filepath.Join(root, "bin"),
+	}, ":"))
+	libs := strings.Join([]string{
+		filepath.Join(root, "usr", "lib", arch),
+		filepath.Join(root, "usr", "lib"),
+		filepath.Join(root, "lib", arch),
+		filepath.Join(root, "lib"),
+	}, ":")
+	ctx.PrependPathSharedEnv(l, "LD_LIBRARY_PATH", libs)
+	ctx.PrependPathBuildEnv(l, "LIBRARY_PATH", libs)
+	ctx.PrependPathBuildEnv(l, "CPATH", filepath.Join(root, "usr", "include"))
+	ctx.PrependPathBuildEnv(l, "PKG_CONFIG_PATH", strings.Join([]string{
+		filepath.Join(root, "usr", "lib", arch, "pkgconfig"),
+		filepath.Join(root, "usr", "lib", "pkgconfig"),
+		filepath.Join(root, "usr", "share", "pkgconfig"),
+	}, ":"))
+	ctx.WriteMetadata(l, meta, layers.Build, layers.Cache, layers.Launch)
+
+	return nil
+}
+
+// multiarch returns the multiarch tuple of the build image, such as x86_64-linux-gnu, that names the library
+// directories of packages. It falls back to the tuple of the architecture the buildpack was built for if neither dpkg
+// nor gcc can report it.
+func multiarch(ctx *gcp.Context) string {
+	for _, cmd := range [][]string{{"dpkg-architecture", "-qDEB_HOST_MULTIARCH"}, {"gcc", "-print-multiarch"}} {
+		result, err := ctx.ExecWithErr(cmd)
+		if err == nil && result.Stdout != "" {
+			return result.Stdout
+		}
+		ctx.Debugf("Failed to determine the multiarch tuple with %s: %v", cmd[0], err)
+	}
+	if arch, ok := goarchMultiarch[runtime.GOARCH]; ok {
+		return arch
+	}
+	return runtime.GOARCH + "-linux-gnu"
+}
+
+// parseAptfile returns the packages listed in an Aptfile, one per line, ignoring blank lines and comments.
+func parseAptfile(content string) []string {
+	var pkgs []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pkgs = append(pkgs, line)
+	}
+	return pkgs
+}
+
+// installPackages downloads the given packages with apt-get and extracts them into dir.
+// Packages are not installed system-wide because the build does not run as root.
+func installPackages(ctx *gcp.Context, pkgs []string, dir string) {
+	tmp := ctx.TempDir("", "apt-")
+	// The downloaded archives are only needed for extraction.
+	defer ctx.RemoveAll(tmp)
+	cacheDir := filepath.Join(tmp, "cache")
+	stateDir := filepath.Join(tmp, "state")
+	ctx.MkdirAll(filepath.Join(cacheDir, "archives", "partial"), 0755)
+	ctx.MkdirAll(filepath.Join(stateDir, "lists", "partial"), 0755)
+	opts := []string{
+		"-o", "debug::nolocking=true",
+		"-o", "dir::cache=" + cacheDir,
+		"-o", "dir::state=" + stateDir,
+	}
+
+	ctx.Logf("Updating apt package lists.")
+	ctx.Exec(append(append([]string{"apt-get"}, opts...), "update"), gcp.WithUserTimingAttribution)
+
+	ctx.Logf("Downloading packages: %s", strings.Join(pkgs, ", "))
+	cmd := append(append([]string{"apt-get"}, opts...), "--yes", "--download-only", "--reinstall", "install")
+	ctx.Exec(append(cmd, pkgs...), gcp.WithUserAttribution, gcp.WithStderrTail)
+
+	for _, deb := range ctx.Glob(filepath.Join(cacheDir, "archives", "*.deb")) {
+		ctx.Debugf("Extracting %s", filepath.Base(deb))
+		ctx.Exec([]string{"dpkg", "--extract", deb, dir}, gcp.WithUserTimingAttribution)
+	}
+}
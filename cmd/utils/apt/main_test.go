@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		want  int
+	}{
+		{
+			name: "with Aptfile",
+			files: map[string]string{
+				"Aptfile": "imagemagick",
+			},
+			want: 0,
+		},
+		{
+			name: "without Aptfile",
+			files: map[string]string{
+				"index.js": "",
+			},
+			want: 100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gcp.TestDetect(t, detectFn, tc.name, tc.files, []string{}, tc.want)
+		})
+	}
+}
+
+func TestParseAptfile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "single package",
+			content: "imagemagick",
+			want:    []string{"imagemagick"},
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# image processing\nimagemagick\n\n  libpq-dev  \n#libfoo\n",
+			want:    []string{"imagemagick", "libpq-dev"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseAptfile(tc.content)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseAptfile(%q) = %v, want %v", tc.content, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMultiarch(t *testing.T) {
+	ctx := gcp.NewContextForTests(buildpack.Info{}, "")
+
+	if got := multiarch(ctx); !strings.Contains(got, "-linux-") {
+		t.Errorf("multiarch() = %q, want a multiarch tuple such as x86_64-linux-gnu", got)
+	}
+}
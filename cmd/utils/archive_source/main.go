@@ -17,8 +17,11 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
 )
@@ -36,9 +39,17 @@ func detectFn(ctx *gcp.Context) error {
 }
 
 func buildFn(ctx *gcp.Context) error {
+	exclude, err := excludeGlobs()
+	if err != nil {
+		return err
+	}
+	if len(exclude) > 0 {
+		ctx.Logf("Excluding paths matching %s from the source archive: %s", env.SourceExclude, strings.Join(exclude, ", "))
+	}
+
 	sl := ctx.Layer("src")
 	sp := filepath.Join(sl.Root, archiveName)
-	archiveSource(ctx, sp, ctx.ApplicationRoot())
+	archiveSource(ctx, sp, ctx.ApplicationRoot(), exclude)
 
 	// Symlink the archive to /workspace/.googlebuild for a stable path.
 	ctx.MkdirAll(".googlebuild", 0755)
@@ -49,11 +60,25 @@ func buildFn(ctx *gcp.Context) error {
 	return nil
 }
 
-// archiveSource archives user's source code in a layer
-func archiveSource(ctx *gcp.Context, fileName, dirName string) {
-	ctx.Exec([]string{"tar",
-		"--create", "--gzip", "--preserve-permissions",
-		"--file=" + fileName,
-		"--directory", dirName,
-		"."}, gcp.WithUserTimingAttribution)
+// excludeGlobs returns the globs in GOOGLE_SOURCE_EXCLUDE, validating them.
+func excludeGlobs() ([]string, error) {
+	var exclude []string
+	for _, glob := range strings.Split(os.Getenv(env.SourceExclude), ",") {
+		glob = strings.Trim(strings.TrimSpace(glob), "/")
+		if glob == "" {
+			continue
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, gcp.UserErrorf("invalid glob %q in %s: %v", glob, env.SourceExclude, err)
+		}
+		exclude = append(exclude, glob)
+	}
+	return exclude, nil
+}
+
+// archiveSource archives user's source code in a layer, leaving out the paths matching the exclude globs, which are
+// relative to dirName. A glob matching a directory excludes everything in it. The archive is reproducible, so that
+// identical source produces an identical archive.
+func archiveSource(ctx *gcp.Context, fileName, dirName string, exclude []string) {
+	ctx.CreateReproducibleTarGz(dirName, fileName, gcp.TarOptions{Exclude: exclude})
 }
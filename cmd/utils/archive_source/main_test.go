@@ -21,8 +21,12 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/buildpack"
 )
@@ -112,7 +116,7 @@ func TestArchiveSource(t *testing.T) {
 			defer os.RemoveAll(srcDir)
 
 			sp := filepath.Join(srcDir, archiveName)
-			archiveSource(gcp.NewContext(buildpack.Info{}), sp, appDir)
+			archiveSource(gcp.NewContext(buildpack.Info{}), sp, appDir, nil)
 
 			if _, err := os.Stat(sp); err != nil {
 				if os.IsNotExist(err) {
@@ -173,3 +177,67 @@ func TestArchiveSource(t *testing.T) {
 		})
 	}
 }
+
+func TestArchiveSourceExclude(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(appDir)
+	files := []string{
+		"index.js",
+		"data/big.bin",
+		"assets/logo.png",
+		"assets/intro.mp4",
+		"assets/videos/clip.mp4",
+		"src/data/fixture.json",
+	}
+	for _, f := range files {
+		fn := filepath.Join(appDir, f)
+		if err := os.MkdirAll(filepath.Dir(fn), 0744); err != nil {
+			t.Fatalf("creating directory tree %s: %v", filepath.Dir(fn), err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(f), 0644); err != nil {
+			t.Fatalf("writing file %s: %v", fn, err)
+		}
+	}
+
+	os.Setenv(env.SourceExclude, "data/, assets/*.mp4")
+	defer os.Unsetenv(env.SourceExclude)
+	exclude, err := excludeGlobs()
+	if err != nil {
+		t.Fatalf("excludeGlobs() got error: %v", err)
+	}
+
+	srcDir, err := ioutil.TempDir("", "src")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+	sp := filepath.Join(srcDir, archiveName)
+	archiveSource(gcp.NewContext(buildpack.Info{}), sp, appDir, exclude)
+
+	out, err := exec.Command("tar", "--list", "--file="+sp).Output()
+	if err != nil {
+		t.Fatalf("listing archive: %v", err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.HasSuffix(line, "/") {
+			got = append(got, strings.TrimPrefix(line, "./"))
+		}
+	}
+	sort.Strings(got)
+	want := []string{"assets/logo.png", "assets/videos/clip.mp4", "index.js", "src/data/fixture.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archived files got %v, want %v", got, want)
+	}
+}
+
+func TestExcludeGlobsInvalid(t *testing.T) {
+	os.Setenv(env.SourceExclude, "data,[")
+	defer os.Unsetenv(env.SourceExclude)
+	if _, err := excludeGlobs(); err == nil {
+		t.Error("excludeGlobs() got nil error, want error")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Implements utils/strip_tests buildpack.
+// The strip_tests buildpack removes conventional test directories and files from the application before it is exported.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/devmode"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/nodejs"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/procfile"
+)
+
+var (
+	// testDirs are top-level directories that conventionally contain only tests and fixtures.
+	testDirs = []string{"test", "tests", "spec", "__tests__"}
+	// skipDirs are never searched for test files because their contents are managed by package managers or git.
+	skipDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true}
+)
+
+func main() {
+	gcp.Main(detectFn, buildFn)
+}
+
+func detectFn(ctx *gcp.Context) error {
+	strip, err := env.IsPresentAndTrue(env.StripTests)
+	if err != nil {
+		return err
+	}
+	if !strip {
+		ctx.OptOut("%s not set", env.StripTests)
+	}
+	if devmode.Enabled(ctx) {
+		ctx.OptOut("Development mode enabled")
+	}
+	return nil
+}
+
+func buildFn(ctx *gcp.Context) error {
+	ctx.RequirePlatform(gcp.WritableDir(ctx.ApplicationRoot()))
+	keep, err := runtimePaths(ctx)
+	if err != nil {
+		return err
+	}
+	paths, err := pathsToRemove(ctx, ctx.ApplicationRoot(), keep)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		ctx.Logf("No tests found to remove.")
+		return nil
+	}
+	for _, path := range paths {
+		ctx.Logf("Removing %s", path)
+		ctx.RemoveAll(filepath.Join(ctx.ApplicationRoot(), path))
+	}
+	return nil
+}
+
+// runtimePaths returns the application-relative paths that are referenced by the launch configuration, including the
+// entrypoint and the Procfile processes, and so must be kept.
+func runtimePaths(ctx *gcp.Context) ([]string, error) {
+	var paths []string
+	if source := os.Getenv(env.FunctionSource); source != "" {
+		paths = append(paths, source)
+	}
+	paths = append(paths, commandPaths(os.Getenv(env.Entrypoint))...)
+	procs, err := procfile.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range procs {
+		paths = append(paths, commandPaths(cmd)...)
+	}
+	if ctx.FileExists("package.json") {
+		pjs, err := nodejs.ReadPackageJSON(ctx.ApplicationRoot())
+		if err != nil {
+			return nil, fmt.Errorf("reading package.json: %w", err)
+		}
+		if pjs.Main != "" {
+			paths = append(paths, pjs.Main)
+		}
+	}
+	return paths, nil
+}
+
+// commandPaths returns the words of cmd that may be paths, splitting flags such as --config=tests/app.yaml and removing
+// quotes.
+func commandPaths(cmd string) []string {
+	return strings.FieldsFunc(cmd, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '=' || r == '\'' || r == '"'
+	})
+}
+
+// pathsToRemove returns the application-relative test directories and files under root, excluding any that contain one of keep.
+// *_test.go files are only removed from applications without a go.mod, as Go applications may be rebuilt from their source.
+func pathsToRemove(ctx *gcp.Context, root string, keep []string) ([]string, error) {
+	var paths []string
+	removed := map[string]bool{}
+	for _, dir := range testDirs {
+		if fi, err := os.Stat(filepath.Join(root, dir)); err == nil && fi.IsDir() && !containsAny(dir, keep) {
+			paths = append(paths, dir)
+			removed[dir] = true
+		}
+	}
+	if ctx.FileExists(root, "go.mod") {
+		return paths, nil
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skipDirs[info.Name()] || removed[rel] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), "_test.go") && !containsAny(rel, keep) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, gcp.InternalErrorf("searching for test files: %v", err)
+	}
+	return paths, nil
+}
+
+// containsAny returns true if path is, or is a parent directory of, any of the given application-relative paths.
+func containsAny(path string, paths []string) bool {
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  []string
+		want int
+	}{
+		{
+			name: "strip tests set",
+			env:  []string{"GOOGLE_STRIP_TESTS=true"},
+			want: 0,
+		},
+		{
+			name: "strip tests false",
+			env:  []string{"GOOGLE_STRIP_TESTS=false"},
+			want: 100,
+		},
+		{
+			name: "strip tests not set",
+			want: 100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gcp.TestDetect(t, detectFn, tc.name, map[string]string{"index.js": ""}, tc.env, tc.want)
+		})
+	}
+}
+
+func TestPathsToRemove(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files []string
+		keep  []string
+		want  []string
+	}{
+		{
+			name:  "test directories",
+			files: []string{"index.js", "test/index.test.js", "spec/app_spec.rb", "__tests__/a.js", "src/test/fixture.json"},
+			want:  []string{"test", "spec", "__tests__"},
+		},
+		{
+			name:  "keeps runtime paths",
+			files: []string{"test/main.py", "tests/test_main.py"},
+			keep:  []string{"./test/main.py"},
+			want:  []string{"tests"},
+		},
+		{
+			name:  "go test files without go.mod",
+			files: []string{"main.py", "tools/gen_test.go", "node_modules/dep/dep_test.go", "test/x_test.go"},
+			want:  []string{"test", "tools/gen_test.go"},
+		},
+		{
+			name:  "go test files with go.mod",
+			files: []string{"go.mod", "main.go", "main_test.go"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "strip-tests-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range tc.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("creating dir for %s: %v", f, err)
+				}
+				if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+					t.Fatalf("writing %s: %v", f, err)
+				}
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			got, err := pathsToRemove(ctx, dir, tc.keep)
+			if err != nil {
+				t.Fatalf("pathsToRemove() got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("pathsToRemove() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuntimePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strip-tests-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "web: gunicorn --config='tests/gunicorn.py' main:app\nworker: python spec/worker.py\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte(content), 0644); err != nil {
+		t.Fatalf("writing Procfile: %v", err)
+	}
+	os.Setenv(env.Entrypoint, "python test/server.py")
+	defer os.Unsetenv(env.Entrypoint)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+
+	keep, err := runtimePaths(ctx)
+	if err != nil {
+		t.Fatalf("runtimePaths() got error: %v", err)
+	}
+	for _, want := range []string{"test/server.py", "tests/gunicorn.py", "spec/worker.py"} {
+		if !containsAny(filepath.Dir(want), keep) {
+			t.Errorf("runtimePaths() = %q, want it to contain %s", keep, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package appyaml reads the App Engine app.yaml configuration of an application.
+package appyaml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+const (
+	defaultPath  = "app.yaml"
+	envVariables = "env_variables"
+	runtimeKey   = "runtime"
+)
+
+// Path returns the path of app.yaml in the application root dir, or the path set by GAE_APPLICATION_YAML_PATH.
+func Path(dir string) string {
+	if p := os.Getenv(env.GAEApplicationYAMLPath); p != "" {
+		return filepath.Join(dir, p)
+	}
+	return filepath.Join(dir, defaultPath)
+}
+
+// EnvVariables returns the env vars defined in the env_variables section of the app.yaml at path, or nil if it
+// defines none. An env_variables section that cannot be parsed is reported as a user error.
+func EnvVariables(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, gcp.InternalErrorf("reading %s: %v", path, err)
+	}
+	vars, err := parseEnvVariables(string(content))
+	if err != nil {
+		return nil, gcp.UserErrorf("parsing %s in %s: %v", envVariables, filepath.Base(path), err)
+	}
+	return vars, nil
+}
+
+// Runtime returns the value of the runtime field of the app.yaml at path, such as python39, or an empty string if it
+// is not set. A runtime field that cannot be parsed is reported as a user error.
+func Runtime(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", gcp.InternalErrorf("reading %s: %v", path, err)
+	}
+	runtime, err := parseRuntime(string(content))
+	if err != nil {
+		return "", gcp.UserErrorf("parsing %s in %s: %v", runtimeKey, filepath.Base(path), err)
+	}
+	return runtime, nil
+}
+
+// parseRuntime returns the value of the top-level runtime field in the YAML content.
+func parseRuntime(content string) (string, error) {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, raw, ok := splitEntry(line)
+		if !ok || key != runtimeKey {
+			continue
+		}
+		value, err := unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %v", i+1, err)
+		}
+		return value, nil
+	}
+	return "", nil
+}
+
+// parseEnvVariables returns the entries of the top-level env_variables mapping in the YAML content. Only the block
+// style used by app.yaml is supported: one `NAME: value` entry per line, with plain, single-quoted or double-quoted
+// values, so that app.yaml can be read without a full YAML parser.
+func parseEnvVariables(content string) (map[string]string, error) {
+	var vars map[string]string
+	inSection := false
+	indent := ""
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		lineIndent := line[:len(line)-len(trimmed)]
+		if lineIndent == "" {
+			inSection = false
+			key, value, ok := splitEntry(trimmed)
+			if !ok || key != envVariables {
+				continue
+			}
+			if value != "" && value != "{}" {
+				return nil, fmt.Errorf("line %d: %s must be a mapping with one entry per line", i+1, envVariables)
+			}
+			inSection = true
+			indent = ""
+			if vars == nil {
+				vars = map[string]string{}
+			}
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if indent == "" {
+			indent = lineIndent
+		}
+		if lineIndent != indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation, values must be strings", i+1)
+		}
+		key, raw, ok := splitEntry(trimmed)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected NAME: value, got %q", i+1, trimmed)
+		}
+		name, err := unquote(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		value, err := unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: value of %s: %v", i+1, name, err)
+		}
+		vars[name] = value
+	}
+	if len(vars) == 0 {
+		return nil, nil
+	}
+	return vars, nil
+}
+
+// splitEntry splits the mapping entry `key: value` into its key and value, which may be empty.
+func splitEntry(s string) (string, string, bool) {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			// Skip the escaped character.
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i == len(s)-1 || s[i+1] == ' ' || s[i+1] == '\t'):
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), i > 0
+		}
+	}
+	return "", "", false
+}
+
+// unquote returns the string value of the YAML scalar s.
+func unquote(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("invalid single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.ContainsRune("{[|>&*!", rune(s[0])):
+		return "", fmt.Errorf("must be a string on a single line, got %s", s)
+	}
+	return s, nil
+}
+
+// stripComment removes a trailing YAML comment, which starts with # at the start of line or after whitespace outside
+// of quotes, from line.
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			// Skip the escaped character.
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
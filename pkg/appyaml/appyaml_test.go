@@ -0,0 +1,215 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appyaml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+func TestParseEnvVariables(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "no env_variables",
+			content: "runtime: python38\nentrypoint: gunicorn main:app\n",
+		},
+		{
+			name:    "empty env_variables",
+			content: "runtime: python38\nenv_variables: {}\n",
+		},
+		{
+			name: "plain and quoted values",
+			content: `runtime: python38
+env_variables:
+  PLAIN: hello world
+  PORT_NAME: 8080
+  DOUBLE: "a \"quoted\" value # not a comment"
+  SINGLE: 'it''s'
+  URL: http://example.com:8080/path
+  EMPTY: ""
+entrypoint: gunicorn main:app
+`,
+			want: map[string]string{
+				"PLAIN":     "hello world",
+				"PORT_NAME": "8080",
+				"DOUBLE":    `a "quoted" value # not a comment`,
+				"SINGLE":    "it's",
+				"URL":       "http://example.com:8080/path",
+				"EMPTY":     "",
+			},
+		},
+		{
+			name: "comments and blank lines",
+			content: `# Configuration.
+env_variables:
+  # The bucket.
+  BUCKET: my-bucket # Created by hand.
+
+  COLOR: blue#green
+handlers:
+- url: /.*
+  script: auto
+`,
+			want: map[string]string{
+				"BUCKET": "my-bucket",
+				"COLOR":  "blue#green",
+			},
+		},
+		{
+			name:    "windows line endings",
+			content: "env_variables:\r\n    A: b\r\n",
+			want:    map[string]string{"A": "b"},
+		},
+		{
+			name:    "nested keys are not env_variables",
+			content: "beta_settings:\n  env_variables: x\nenv_variables:\n  A: b\n",
+			want:    map[string]string{"A": "b"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseEnvVariables(tc.content)
+			if err != nil {
+				t.Fatalf("parseEnvVariables() got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseEnvVariables() got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvVariablesError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "flow style",
+			content: "env_variables: {A: b}\n",
+		},
+		{
+			name:    "nested mapping",
+			content: "env_variables:\n  A:\n    B: c\n",
+		},
+		{
+			name:    "missing value",
+			content: "env_variables:\n  A:\n",
+		},
+		{
+			name:    "list value",
+			content: "env_variables:\n  A: [b, c]\n",
+		},
+		{
+			name:    "not a mapping entry",
+			content: "env_variables:\n  - A\n",
+		},
+		{
+			name:    "unterminated quote",
+			content: "env_variables:\n  A: 'b\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := parseEnvVariables(tc.content); err == nil {
+				t.Errorf("parseEnvVariables() got %v, want error", got)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	if got, want := Path("/workspace"), "/workspace/app.yaml"; got != want {
+		t.Errorf("Path() got %q, want %q", got, want)
+	}
+	os.Setenv(env.GAEApplicationYAMLPath, "config/app.yaml")
+	defer os.Unsetenv(env.GAEApplicationYAMLPath)
+	if got, want := Path("/workspace"), "/workspace/config/app.yaml"; got != want {
+		t.Errorf("Path() with %s got %q, want %q", env.GAEApplicationYAMLPath, got, want)
+	}
+}
+
+func TestEnvVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appyaml")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte("env_variables:\n  A: b\n"), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+
+	got, err := EnvVariables(path)
+	if err != nil {
+		t.Fatalf("EnvVariables() got error: %v", err)
+	}
+	if want := map[string]string{"A": "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvVariables() got %v, want %v", got, want)
+	}
+}
+
+func TestParseRuntime(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "runtime",
+			content: "runtime: python39\nentrypoint: gunicorn main:app\n",
+			want:    "python39",
+		},
+		{
+			name:    "quoted with comment",
+			content: "# App Engine config\nruntime: 'python38' # standard\n",
+			want:    "python38",
+		},
+		{
+			name:    "nested runtime ignored",
+			content: "handlers:\n  runtime: python27\nservice: default\n",
+		},
+		{
+			name:    "no runtime",
+			content: "env_variables:\n  A: b\n",
+		},
+		{
+			name:    "invalid",
+			content: "runtime: [python39]\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRuntime(tc.content)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parseRuntime() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("parseRuntime() got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
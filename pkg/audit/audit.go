@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit contains helpers to fail builds on dependencies with known vulnerabilities.
+package audit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// Severities of vulnerabilities reported by audit tools, in increasing order.
+const (
+	Info     = "info"
+	Low      = "low"
+	Moderate = "moderate"
+	High     = "high"
+	Critical = "critical"
+	// Unknown is the severity of vulnerabilities reported without one, which are always at or above the audit level.
+	Unknown = "unknown"
+
+	defaultLevel = High
+)
+
+var (
+	ranks = map[string]int{
+		Info:     0,
+		Low:      1,
+		Moderate: 2,
+		High:     3,
+		Critical: 4,
+	}
+	// summaryOrder is the order in which severities are listed in summaries.
+	summaryOrder = []string{Unknown, Critical, High, Moderate, Low, Info}
+)
+
+// Findings counts vulnerabilities by severity.
+type Findings map[string]int
+
+// Add records n vulnerabilities with the given severity, as reported by an audit tool.
+func (f Findings) Add(severity string, n int) {
+	if n > 0 {
+		f[normalize(severity)] += n
+	}
+}
+
+// Total returns the number of vulnerabilities found.
+func (f Findings) Total() int {
+	total := 0
+	for _, n := range f {
+		total += n
+	}
+	return total
+}
+
+// String summarizes the findings with counts by severity, most severe first, for example "1 critical, 3 low".
+func (f Findings) String() string {
+	var parts []string
+	for _, s := range summaryOrder {
+		if n := f[s]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, s))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// atOrAbove returns the number of vulnerabilities with a severity at or above level.
+func (f Findings) atOrAbove(level string) int {
+	count := 0
+	for s, n := range f {
+		if r, ok := ranks[s]; !ok || r >= ranks[level] {
+			count += n
+		}
+	}
+	return count
+}
+
+// normalize maps the severity names used by audit tools to the ones above.
+func normalize(severity string) string {
+	s := strings.ToLower(strings.TrimSpace(severity))
+	if s == "medium" {
+		return Moderate
+	}
+	if _, ok := ranks[s]; ok {
+		return s
+	}
+	return Unknown
+}
+
+// Enabled returns true if dependencies should be audited for known vulnerabilities.
+func Enabled(ctx *gcp.Context) bool {
+	enabled, err := env.IsPresentAndTrue(env.AuditDependencies)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.AuditDependencies, err)
+		return false
+	}
+	return enabled
+}
+
+// Level returns the minimum severity of vulnerabilities that fail the build.
+func Level(ctx *gcp.Context) string {
+	v, ok := os.LookupEnv(env.AuditLevel)
+	if !ok || v == "" {
+		return defaultLevel
+	}
+	level := normalize(v)
+	if level == Unknown || level == Info {
+		ctx.Warnf("%s env var must be one of low, moderate, high or critical, using default of %s: got %q", env.AuditLevel, defaultLevel, v)
+		return defaultLevel
+	}
+	return level
+}
+
+// Check reports the vulnerabilities found by tool. It returns a user error if any of them is at or above Level,
+// and logs a warning for the others.
+func Check(ctx *gcp.Context, tool string, f Findings) error {
+	if f.Total() == 0 {
+		ctx.Logf("%s found no known vulnerabilities.", tool)
+		return nil
+	}
+	level := Level(ctx)
+	if n := f.atOrAbove(level); n > 0 {
+		return gcp.UserErrorf("%s found %d vulnerabilities at or above %s severity (%s), run it locally for details and update the affected dependencies", tool, n, level, f)
+	}
+	ctx.Warnf("%s found vulnerabilities below %s severity (%s).", tool, level, f)
+	return nil
+}
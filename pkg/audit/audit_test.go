@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestFindingsString(t *testing.T) {
+	f := Findings{}
+	f.Add("LOW", 3)
+	f.Add("medium", 2)
+	f.Add("critical", 1)
+	f.Add("", 4)
+	f.Add("high", 0)
+
+	want := "4 unknown, 1 critical, 2 moderate, 3 low"
+	if got := f.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := f.Total(); got != 10 {
+		t.Errorf("Total() = %d, want 10", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		name     string
+		level    string
+		findings Findings
+		wantErr  bool
+	}{
+		{
+			name:     "no findings",
+			findings: Findings{},
+		},
+		{
+			name:     "below default level",
+			findings: Findings{Moderate: 2, Low: 1},
+		},
+		{
+			name:     "at default level",
+			findings: Findings{High: 1, Low: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "below configured level",
+			level:    "critical",
+			findings: Findings{High: 1},
+		},
+		{
+			name:     "above configured level",
+			level:    "low",
+			findings: Findings{Moderate: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown severity",
+			level:    "critical",
+			findings: Findings{Unknown: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid level uses default",
+			level:    "severe",
+			findings: Findings{Moderate: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer os.Unsetenv(env.AuditLevel)
+			os.Setenv(env.AuditLevel, tc.level)
+
+			err := Check(gcp.NewContextForTests(buildpack.Info{}, ""), "audit", tc.findings)
+			if got := err != nil; got != tc.wantErr {
+				t.Errorf("Check() got error: %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
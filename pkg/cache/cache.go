@@ -18,7 +18,11 @@ package cache
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 )
@@ -67,3 +71,37 @@ func Hash(ctx *gcp.Context, opts ...Option) (result string, err error) {
 
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// HashFiles creates a sha256 hash from the names and contents of the given files. Directories are walked in lexical
+// order and every regular file within them is hashed, so a directory such as app/assets can be used as a cache key.
+func HashFiles(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, p := range paths {
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(p, path)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// Prefix the contents with the relative name and size so that the hash does not depend on where the files
+			// are, but renaming files or moving bytes between them changes the hash.
+			fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), info.Size())
+			_, err = io.Copy(h, f)
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("hashing %s: %w", p, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
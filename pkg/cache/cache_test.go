@@ -135,6 +135,47 @@ func TestWithFilesError(t *testing.T) {
 	}
 }
 
+func TestHashFiles(t *testing.T) {
+	temp, err := ioutil.TempDir("", "test-hash-files-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(temp)
+	if err := os.MkdirAll(filepath.Join(temp, "assets", "css"), 0755); err != nil {
+		t.Fatalf("creating assets dir: %v", err)
+	}
+	lock := writeFile(t, temp, "Gemfile.lock", "rails")
+	writeFile(t, temp, "assets/app.js", "js")
+	css := writeFile(t, temp, "assets/css/app.css", "css")
+	assets := filepath.Join(temp, "assets")
+
+	got, err := HashFiles(lock, assets)
+	if err != nil {
+		t.Fatalf("HashFiles() got err=%v, want err=nil", err)
+	}
+	if again, err := HashFiles(lock, assets); err != nil || again != got {
+		t.Errorf("HashFiles() second call = %q, %v, want %q, nil", again, err, got)
+	}
+	if other, err := HashFiles(lock); err != nil || other == got {
+		t.Errorf("HashFiles() without assets = %q, %v, want a different hash", other, err)
+	}
+
+	writeFile(t, temp, "assets/css/app.css", "changed")
+	changed, err := HashFiles(lock, assets)
+	if err != nil {
+		t.Fatalf("HashFiles() after change got err=%v, want err=nil", err)
+	}
+	if changed == got {
+		t.Errorf("HashFiles() after changing %s = %q, want a different hash", css, changed)
+	}
+}
+
+func TestHashFilesError(t *testing.T) {
+	if _, err := HashFiles("/does/not/exist"); err == nil {
+		t.Errorf("HashFiles() got err=nil, want err")
+	}
+}
+
 func TestHash_SameFileContentsYieldsSameHash(t *testing.T) {
 	temp, err := ioutil.TempDir("", "test-sha-same-contents-")
 	if err != nil {
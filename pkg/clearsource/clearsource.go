@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/appengine"
@@ -56,6 +57,7 @@ func DetectFn(ctx *gcp.Context) error {
 // exclusions is a list of pattern strings relative to the user application directory.
 func BuildFn(ctx *gcp.Context, exclusions []string) error {
 	ctx.Logf("Clearing source")
+	ctx.RequirePlatform(gcp.WritableDir(ctx.ApplicationRoot()))
 
 	defer func(now time.Time) {
 		ctx.Span("Clear source", now, gcp.StatusOk)
@@ -66,6 +68,20 @@ func BuildFn(ctx *gcp.Context, exclusions []string) error {
 	if err != nil {
 		return fmt.Errorf("filtering paths: %w", err)
 	}
+	keep, err := keepGlobs()
+	if err != nil {
+		return err
+	}
+	paths, kept, err := applyKeep(ctx.ApplicationRoot(), paths, keep)
+	if err != nil {
+		return fmt.Errorf("filtering paths to keep: %w", err)
+	}
+	if len(kept) > 0 {
+		ctx.Logf("Keeping paths matching %s: %s", env.ClearSourceKeep, strings.Join(relPaths(ctx.ApplicationRoot(), kept), ", "))
+	}
+	if len(paths) > 0 {
+		ctx.Logf("Removing: %s", strings.Join(relPaths(ctx.ApplicationRoot(), paths), ", "))
+	}
 	for _, path := range paths {
 		ctx.RemoveAll(path)
 	}
@@ -73,6 +89,98 @@ func BuildFn(ctx *gcp.Context, exclusions []string) error {
 	return nil
 }
 
+// keepGlobs returns the globs in GOOGLE_CLEAR_SOURCE_KEEP, validating them.
+func keepGlobs() ([]string, error) {
+	var keep []string
+	for _, glob := range strings.Split(os.Getenv(env.ClearSourceKeep), ",") {
+		glob = strings.Trim(strings.TrimSpace(glob), "/")
+		if glob == "" {
+			continue
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, gcp.UserErrorf("invalid glob %q in %s: %v", glob, env.ClearSourceKeep, err)
+		}
+		keep = append(keep, glob)
+	}
+	return keep, nil
+}
+
+// applyKeep splits paths, which are in root, into the paths to remove and the paths to keep because they match one of
+// the keep globs, relative to root. Directories containing paths to keep are descended into, so that only their
+// remaining entries are removed.
+func applyKeep(root string, paths, keep []string) ([]string, []string, error) {
+	if len(keep) == 0 {
+		return paths, nil, nil
+	}
+	var remove, kept []string
+	for _, path := range paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if matchesAny(keep, rel) {
+			kept = append(kept, path)
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fi.IsDir() || !keepsBeneath(keep, rel) {
+			remove = append(remove, path)
+			continue
+		}
+		entries, err := filepath.Glob(filepath.Join(path, "*"))
+		if err != nil {
+			return nil, nil, err
+		}
+		r, k, err := applyKeep(root, entries, keep)
+		if err != nil {
+			return nil, nil, err
+		}
+		remove = append(remove, r...)
+		kept = append(kept, k...)
+	}
+	return remove, kept, nil
+}
+
+// matchesAny returns true if the relative path rel matches any of the globs.
+func matchesAny(globs []string, rel string) bool {
+	for _, glob := range globs {
+		if match, _ := filepath.Match(glob, rel); match {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsBeneath returns true if any of the keep globs may match a path beneath the relative directory rel.
+func keepsBeneath(keep []string, rel string) bool {
+	dirParts := strings.Split(rel, string(filepath.Separator))
+	for _, glob := range keep {
+		globParts := strings.Split(glob, "/")
+		if len(globParts) <= len(dirParts) {
+			continue
+		}
+		if match, _ := filepath.Match(strings.Join(globParts[:len(dirParts)], "/"), rel); match {
+			return true
+		}
+	}
+	return false
+}
+
+// relPaths returns paths relative to root, for logging.
+func relPaths(root string, paths []string) []string {
+	var rels []string
+	for _, path := range paths {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+		rels = append(rels, path)
+	}
+	return rels
+}
+
 // pathsToRemove returns a list of entries in dir, filtering entries that match any in exclusions. exclusions should be a partial path relative to dir.
 func pathsToRemove(ctx *gcp.Context, dir string, exclusions []string) ([]string, error) {
 	paths := ctx.Glob(filepath.Join(dir, "*"))
@@ -15,6 +15,7 @@ package clearsource
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -92,3 +93,69 @@ func TestPathsToRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyKeep(t *testing.T) {
+	files := []string{"main.go", "docs/readme.md", "static/app.css", "static/app.js", "static/img/logo.png", "templates/index.html"}
+	testCases := []struct {
+		name       string
+		keep       []string
+		wantRemove []string
+		wantKept   []string
+	}{
+		{
+			name:       "no keep globs",
+			wantRemove: []string{"docs", "main.go", "static", "templates"},
+		},
+		{
+			name:       "top-level directory",
+			keep:       []string{"templates"},
+			wantRemove: []string{"docs", "main.go", "static"},
+			wantKept:   []string{"templates"},
+		},
+		{
+			name:       "nested glob",
+			keep:       []string{"templates", "static/*.css"},
+			wantRemove: []string{"docs", "main.go", "static/app.js", "static/img"},
+			wantKept:   []string{"static/app.css", "templates"},
+		},
+		{
+			name:       "deeply nested file",
+			keep:       []string{"*/img/logo.png"},
+			wantRemove: []string{"docs/readme.md", "main.go", "static/app.css", "static/app.js", "templates/index.html"},
+			wantKept:   []string{"static/img/logo.png"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "clearsource-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+			for _, f := range files {
+				path := filepath.Join(root, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("creating dir for %s: %v", path, err)
+				}
+				if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+					t.Fatalf("writing to file %s: %v", path, err)
+				}
+			}
+			paths, err := filepath.Glob(filepath.Join(root, "*"))
+			if err != nil {
+				t.Fatalf("listing %s: %v", root, err)
+			}
+
+			remove, kept, err := applyKeep(root, paths, tc.keep)
+			if err != nil {
+				t.Fatalf("applyKeep() returned error: %v", err)
+			}
+			if got := relPaths(root, remove); !reflect.DeepEqual(got, tc.wantRemove) {
+				t.Errorf("applyKeep() removed %v, want %v", got, tc.wantRemove)
+			}
+			if got := relPaths(root, kept); !reflect.DeepEqual(got, tc.wantKept) {
+				t.Errorf("applyKeep() kept %v, want %v", got, tc.wantKept)
+			}
+		})
+	}
+}
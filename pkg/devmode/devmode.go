@@ -141,8 +141,9 @@ func installFileWatcher(ctx *gcp.Context) {
 		// Download and install watchexec in layer.
 		ctx.Logf("Installing watchexec v%s", watchexecVersion)
 		archiveURL := fmt.Sprintf(watchexecURL, watchexecVersion)
-		command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xJ --directory %s --strip-components=1 --wildcards \"*watchexec\"", archiveURL, binDir)
-		ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+		if err := ctx.DownloadAndExtract(archiveURL, binDir, "--strip-components=1", "--wildcards", "*watchexec"); err != nil {
+			ctx.Exit(1, gcp.DownloadErrorf(err, "downloading watchexec v%s", watchexecVersion))
+		}
 
 		meta.WatchexecVersion = watchexecVersion
 	}
@@ -71,5 +71,5 @@ func WriteBuildScript(ctx *gcp.Context, layerSrc, dest string, command []string)
 
 	bin := filepath.Join(layerSrc, "bin")
 	ctx.MkdirAll(bin, 0755)
-	ctx.WriteFile(filepath.Join(bin, ".devmode_rebuild.sh"), script.Bytes(), 0744)
+	ctx.WriteFileIfChanged(filepath.Join(bin, ".devmode_rebuild.sh"), script.Bytes(), 0744)
 }
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package entrypoint resolves the command that starts the application.
+package entrypoint
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/procfile"
+)
+
+// Source is where an entrypoint was resolved from.
+type Source string
+
+const (
+	// SourceEnv is the GOOGLE_ENTRYPOINT env var.
+	SourceEnv Source = env.Entrypoint
+	// SourceProcfile is the web process in the Procfile.
+	SourceProcfile Source = procfile.Procfile
+	// SourceDefault is the default entrypoint of the language.
+	SourceDefault Source = "default"
+)
+
+// Entrypoint is a resolved application entrypoint.
+type Entrypoint struct {
+	// Command is the shell command that starts the application.
+	Command string
+	Source  Source
+}
+
+// Resolve returns the entrypoint of the application, in order of precedence: the GOOGLE_ENTRYPOINT env var, the web
+// process in the Procfile, and the given language default. It returns a user error if there is none, naming the
+// missing web process if a Procfile exists.
+func Resolve(ctx *gcp.Context, languageDefault string) (*Entrypoint, error) {
+	procs, err := procfile.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resolveLogged(ctx, procs, languageDefault)
+}
+
+// AddProcesses registers the entrypoint resolved by Resolve as the web process, with defaultWeb as the language
+// default, and the other processes declared in the Procfile, if any.
+func AddProcesses(ctx *gcp.Context, defaultWeb []string) error {
+	procs, err := procfile.Read(ctx)
+	if err != nil {
+		return err
+	}
+	ep, err := resolveLogged(ctx, procs, strings.Join(defaultWeb, " "))
+	if err != nil {
+		return err
+	}
+	if ep.Source == SourceDefault {
+		// The default is run as is, as it may be a single executable that does not need a shell.
+		ctx.AddWebProcess(defaultWeb)
+	} else {
+		// Use /bin/bash because lifecycle/launcher will assume the whole command is a single executable.
+		ctx.AddWebProcess([]string{"/bin/bash", "-c", ep.Command})
+	}
+	var types []string
+	for typ := range procs {
+		if typ != procfile.Web {
+			types = append(types, typ)
+		}
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		ctx.AddProcess(typ, []string{"/bin/bash", "-c", procs[typ]})
+	}
+	return nil
+}
+
+// resolveLogged resolves the entrypoint from the Procfile processes procs, logging where it was resolved from.
+func resolveLogged(ctx *gcp.Context, procs map[string]string, languageDefault string) (*Entrypoint, error) {
+	ep, err := resolve(procs, languageDefault)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Logf("Using entrypoint from %s: %s", ep.Source, ep.Command)
+	return ep, nil
+}
+
+func resolve(procs map[string]string, languageDefault string) (*Entrypoint, error) {
+	if ep := os.Getenv(env.Entrypoint); ep != "" {
+		return &Entrypoint{Command: ep, Source: SourceEnv}, nil
+	}
+	if procs != nil {
+		ep, err := webProcess(procs)
+		if err == nil {
+			return &Entrypoint{Command: ep, Source: SourceProcfile}, nil
+		}
+		// A Procfile may only declare other processes, such as workers, alongside the default web process.
+		if languageDefault == "" {
+			return nil, err
+		}
+	}
+	if languageDefault != "" {
+		return &Entrypoint{Command: languageDefault, Source: SourceDefault}, nil
+	}
+	return nil, gcp.UserErrorf("no entrypoint found, set the %s env var or add a %s with a web process", env.Entrypoint, procfile.Procfile)
+}
+
+// webProcess returns the command of the web process of the Procfile processes procs.
+func webProcess(procs map[string]string) (string, error) {
+	web, ok := procs[procfile.Web]
+	if !ok {
+		return "", gcp.UserErrorf("could not find web process in %s", procfile.Procfile)
+	}
+	return web, nil
+}
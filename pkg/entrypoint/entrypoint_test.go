@@ -0,0 +1,245 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entrypoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/procfile"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestResolve(t *testing.T) {
+	testCases := []struct {
+		name            string
+		env             string
+		procfile        string
+		languageDefault string
+		want            Entrypoint
+		wantErr         bool
+	}{
+		{
+			name:            "env var",
+			env:             "python main.py",
+			procfile:        "web: gunicorn main:app",
+			languageDefault: "python app.py",
+			want:            Entrypoint{Command: "python main.py", Source: SourceEnv},
+		},
+		{
+			name:            "Procfile",
+			procfile:        "web: gunicorn main:app",
+			languageDefault: "python app.py",
+			want:            Entrypoint{Command: "gunicorn main:app", Source: SourceProcfile},
+		},
+		{
+			name:            "language default",
+			languageDefault: "python app.py",
+			want:            Entrypoint{Command: "python app.py", Source: SourceDefault},
+		},
+		{
+			name:            "Procfile without web process",
+			procfile:        "worker: python worker.py",
+			languageDefault: "python app.py",
+			want:            Entrypoint{Command: "python app.py", Source: SourceDefault},
+		},
+		{
+			name:     "Procfile without web process or language default",
+			procfile: "worker: python worker.py",
+			wantErr:  true,
+		},
+		{
+			name:    "none",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "entrypoint-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if tc.procfile != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte(tc.procfile), 0644); err != nil {
+					t.Fatalf("writing Procfile: %v", err)
+				}
+			}
+			if tc.env != "" {
+				os.Setenv(env.Entrypoint, tc.env)
+				defer os.Unsetenv(env.Entrypoint)
+			}
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+
+			got, err := Resolve(ctx, tc.languageDefault)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Resolve() got error %v, want error %t", err, tc.wantErr)
+			}
+			if err == nil && *got != tc.want {
+				t.Errorf("Resolve() = %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+// resolveProcfile resolves the entrypoint of an application with the given Procfile content and no language default,
+// as the config/entrypoint buildpack does.
+func resolveProcfile(t *testing.T, content string) (*Entrypoint, error) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "entrypoint-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, procfile.Procfile), []byte(content), 0644); err != nil {
+		t.Fatalf("writing Procfile: %v", err)
+	}
+	return Resolve(gcp.NewContextForTests(buildpack.Info{}, dir), "")
+}
+
+func TestProcfileWebProcess(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "simple",
+			content: "web: foo bar baz",
+			want:    "foo bar baz",
+		},
+		{
+			name:    "dollar sign",
+			content: "web: foo $bar baz",
+			want:    "foo $bar baz",
+		},
+		{
+			name:    "whitespace start",
+			content: "web:  foo bar baz",
+			want:    "foo bar baz",
+		},
+		{
+			name:    "whitespace end",
+			content: "web:  foo bar baz  ",
+			want:    "foo bar baz",
+		},
+		{
+			name:    "carriage return",
+			content: "web: foo bar baz\r\n",
+			want:    "foo bar baz",
+		},
+		{
+			name:    "no space",
+			content: "web:foo",
+			want:    "foo",
+		},
+		{
+			name: "with web in command",
+			content: `dev: java --foo=web:something
+web: bar baz
+`,
+			want: "bar baz",
+		},
+		{
+			name: "multiple web use first",
+			content: `web: foo
+web: bar
+`,
+			want: "foo",
+		},
+		{
+			name: "multiple web one commented-out",
+			content: `# web: foo
+web: bar
+`,
+			want: "bar",
+		},
+		{
+			name:    "trailing newline",
+			content: "web: foo bar baz\n",
+			want:    "foo bar baz",
+		},
+		{
+			name: "multiple first",
+			content: `web:     foo bar
+release: baz
+dev:     foo
+`,
+			want: "foo bar",
+		},
+		{
+			name: "multiple middle",
+			content: `dev:     foo
+web:     bar
+release: baz
+`,
+			want: "bar",
+		},
+		{
+			name: "multiple last",
+			content: `dev:     foo
+release: bar
+web:     baz
+`,
+			want: "baz",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveProcfile(t, tc.content)
+			if err != nil {
+				t.Fatalf("Resolve() with Procfile %q got error: %v", tc.content, err)
+			}
+			if want := (Entrypoint{Command: tc.want, Source: SourceProcfile}); *got != want {
+				t.Errorf("Resolve() with Procfile %q = %+v, want %+v", tc.content, *got, want)
+			}
+		})
+	}
+}
+
+func TestProcfileWebProcessError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "whitespace",
+			content: "  web: foo",
+		},
+		{
+			name:    "web in command",
+			content: "dev: java --web=foo",
+		},
+		{
+			name:    "no web",
+			content: "dev: java",
+		},
+		{
+			name:    "comment",
+			content: "# web: java",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := resolveProcfile(t, tc.content); err == nil {
+				t.Errorf("Resolve() with Procfile %q = %+v, want error", tc.content, *got)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package env
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 )
 
@@ -32,7 +33,8 @@ const (
 	// Example: `13.7.0` for Node.js, `1.14.1` for Go.
 	RuntimeVersion = "GOOGLE_RUNTIME_VERSION"
 
-	// DebugMode enables more verbose logging. The value is unused; only the presense of the env var is required to enable.
+	// DebugMode enables more verbose logging, including ctx.Debugf output and the output of every executed command.
+	// Example: `true`, `True`, `1` will enable debug mode.
 	DebugMode = "GOOGLE_DEBUG"
 
 	// DevMode is an env var used to enable development mode in buildpacks.
@@ -49,6 +51,30 @@ const (
 	// Buildpacks for Go and Java support clearing the source.
 	ClearSource = "GOOGLE_CLEAR_SOURCE"
 
+	// ClearSourceKeep is an env var used to keep files matching a comma-separated list of globs, relative to the
+	// application root, when clearing source.
+	// Example: `templates,static/*.css` keeps the templates directory and CSS files in the static directory.
+	ClearSourceKeep = "GOOGLE_CLEAR_SOURCE_KEEP"
+
+	// SourceExclude is an env var used to exclude files matching a comma-separated list of globs, relative to the
+	// application root, from the archive of the source code.
+	// Example: `data,assets/*.mp4` excludes the data directory and MP4 files in the assets directory.
+	SourceExclude = "GOOGLE_SOURCE_EXCLUDE"
+
+	// StripTests is an env var used to remove conventional test directories and files from the final image.
+	// Example: `true`, `True`, `1` will strip tests.
+	StripTests = "GOOGLE_STRIP_TESTS"
+
+	// PrebuildCommand is an env var used to run a command before the language runtime is installed and the application
+	// is built, failing the build if it exits with a non-zero status.
+	// Example: `./scripts/generate.sh` generates source files.
+	PrebuildCommand = "GOOGLE_PREBUILD_COMMAND"
+
+	// VerifyCommand is an env var used to run a command after the application is built, failing the build if it exits
+	// with a non-zero status.
+	// Example: `node -e "require('./index.js')"` checks that the application can be loaded.
+	VerifyCommand = "GOOGLE_VERIFY_COMMAND"
+
 	// Buildable is an env var used to specify the buildable unit to build.
 	// Buildable should be respected by buildpacks that build source.
 	// Example: `./maindir` for Go will build the package rooted at maindir.
@@ -62,12 +88,23 @@ const (
 	// Behavior: In Go, the value is cleaned up and passed on to subsequent buildpacks as GOOGLE_BUILDABLE.
 	GAEMain = "GAE_YAML_MAIN"
 
+	// GAEApplicationYAMLPath is an env var used to specify the path of app.yaml, relative to the application root, in
+	// App Engine buildpacks. Defaults to `app.yaml`.
+	// Example: `config/app.yaml`.
+	GAEApplicationYAMLPath = "GAE_APPLICATION_YAML_PATH"
+
+	// TargetPlatform is an env var set by the platform to the product that the application is built for.
+	// Example: `gae` for App Engine, `gcf` for Cloud Functions, or `run` for Cloud Run.
+	TargetPlatform = "X_GOOGLE_TARGET_PLATFORM"
+
 	// FunctionTarget is an env var used to specify function name.
 	// FunctionTarget must be respected by all functions-framework buildpacks.
 	// Example: `helloWorld` or any exported function name.
 	FunctionTarget = "GOOGLE_FUNCTION_TARGET"
 	// FunctionTargetLaunch is a launch time version of FunctionTarget.
 	FunctionTargetLaunch = "FUNCTION_TARGET"
+	// FunctionTargetEntryPoint is a legacy name of FunctionTarget, set by older deployments.
+	FunctionTargetEntryPoint = "ENTRY_POINT"
 
 	// FunctionSource is an env var used to specify function source location.
 	// FunctionSource must be respected by all functions-framework buildpacks.
@@ -89,17 +126,279 @@ const (
 	// GoLDFlags is an env var used to pass through linker flags to the Go linker.
 	// Example: `-s -w` is sometimes used to strip and reduce binary size.
 	GoLDFlags = "GOOGLE_GOLDFLAGS"
+
+	// BuildTimeout is an env var used to set the maximum duration of the build, shared by all buildpacks. When it is
+	// exceeded, running commands are terminated and the build fails with an error naming the steps that were running.
+	// Example: `20m`, `1h30m`.
+	BuildTimeout = "GOOGLE_BUILD_TIMEOUT"
+
+	// BuildReport is an env var used to specify the path of a JSON build report summarizing the decisions made by each buildpack.
+	// Example: `/workspace/build-report.json`.
+	BuildReport = "GOOGLE_BUILD_REPORT"
+
+	// NodeFrozen is an env var used to install Node.js dependencies exactly as listed in the committed lockfile.
+	// Example: `true`, `True`, `1` will fail the build if the lockfile is missing or installing would change it.
+	NodeFrozen = "GOOGLE_NODE_FROZEN"
+
+	// NodeIgnoreScripts is an env var used to skip lifecycle scripts, such as postinstall, when installing Node.js dependencies.
+	// Example: `true`, `True`, `1` will pass `--ignore-scripts` to npm and yarn.
+	NodeIgnoreScripts = "GOOGLE_NODE_IGNORE_SCRIPTS"
+
+	// NodeProduction is an env var used to install Node.js devDependencies, and to default NODE_ENV to development,
+	// for applications that need them at runtime. Installing devDependencies increases the size of the image.
+	// Example: `false`, `False`, `0` will install all dependencies.
+	NodeProduction = "GOOGLE_NODE_PRODUCTION"
+
+	// JavaOpts is an env var used to pass JVM options to the java command that launches the application.
+	// These options take precedence over JAVA_TOOL_OPTIONS, including the memory settings configured by buildpacks.
+	// The value is read at build time and split on whitespace; quotes are not supported, so no option may contain a space.
+	// Example: `-Xmx512m -XX:+UseG1GC`.
+	JavaOpts = "GOOGLE_JAVA_OPTS"
+
+	// AppYAMLBuildEnv is an env var used to also set the env_variables in app.yaml during the build, for example for
+	// build scripts that read configuration from the environment. They are always set at launch.
+	// Example: `true`, `True`, `1` will set env_variables during the build.
+	AppYAMLBuildEnv = "GOOGLE_APP_YAML_BUILD_ENV"
+
+	// AuditDependencies is an env var used to run the package manager's vulnerability audit, such as `npm audit`,
+	// `pip-audit` or `composer audit`, after dependencies are installed.
+	// Example: `true`, `True`, `1` will fail the build on vulnerabilities at or above AuditLevel.
+	AuditDependencies = "GOOGLE_AUDIT_DEPENDENCIES"
+
+	// AuditLevel is an env var used to set the minimum severity of vulnerabilities that fail the build when
+	// AuditDependencies is set. Lower severity findings are reported as warnings. Defaults to `high`.
+	// Example: `low`, `moderate`, `high` or `critical`.
+	AuditLevel = "GOOGLE_AUDIT_LEVEL"
+
+	// BundleWithout is an env var used to set the Gemfile groups that are not installed by bundler, overriding the
+	// development and test groups that are excluded by default. An empty value installs all groups.
+	// Example: `development test ci` excludes those groups.
+	BundleWithout = "GOOGLE_BUNDLE_WITHOUT"
+
+	// ClearCache is an env var used to bypass the cached dependencies and runtimes of a build, which are cleared and
+	// reinstalled, to diagnose caching issues.
+	// Example: `true`, `True`, `1` will force a clean build.
+	ClearCache = "GOOGLE_CLEAR_CACHE"
+
+	// ComposerBin is an env var used to run Composer from an executable other than `composer` on PATH, for example
+	// in build images with a versioned or relocated Composer.
+	// Example: `composer2` or `/opt/composer/bin/composer`.
+	ComposerBin = "GOOGLE_COMPOSER_BIN"
+
+	// ComposerCacheExpiration is an env var used to specify how long PHP dependencies installed without a composer.lock
+	// are cached before being refreshed. A value of 0 disables expiration.
+	// Example: `24h` (the default), `30m`.
+	ComposerCacheExpiration = "GOOGLE_COMPOSER_CACHE_EXPIRATION"
+
+	// ComposerInstallDev is an env var used to install the require-dev dependencies of composer.json, which are
+	// otherwise skipped, before running the gcp-build script. They are removed with the rest of the vendor directory
+	// after the script runs.
+	// Example: `true`, `True`, `1` will install dev dependencies for the gcp-build script.
+	ComposerInstallDev = "GOOGLE_COMPOSER_INSTALL_DEV"
+
+	// DependencyWarnThreshold is an env var used to set the number of installed packages above which a warning
+	// suggests reviewing the dependency tree. The check is disabled if unset or 0.
+	// Example: `200`.
+	DependencyWarnThreshold = "GOOGLE_DEPENDENCY_WARN_THRESHOLD"
+
+	// DownloadAllowlist is an env var used to restrict the hosts that buildpacks download from to a comma-separated
+	// list of host names, which may contain `*` wildcards. Downloads from other hosts fail the build.
+	// Example: `*.googleapis.com,nodejs.org`.
+	DownloadAllowlist = "GOOGLE_DOWNLOAD_ALLOWLIST"
+
+	// LaunchEnvAllowlist is an env var used to restrict the env vars set in the launch image to a comma-separated list
+	// of names, which may contain wildcards. GOOGLE_ env vars and env vars the runtime relies on are always allowed.
+	// Example: `APP_*,DATABASE_URL` removes env vars set by buildpacks for launch other than those and the defaults.
+	LaunchEnvAllowlist = "GOOGLE_LAUNCH_ENV_ALLOWLIST"
+
+	// LayerContentsStrict is an env var used to fail the build when a layer contains files its buildpack disallows.
+	// Example: `true`, `True`, `1` will fail the build if a layer contains, for example, a .git directory.
+	LayerContentsStrict = "GOOGLE_LAYER_CONTENTS_STRICT"
+
+	// LockfileStrict is an env var used to fail the build when lockfiles of different package managers coexist.
+	// Example: `true`, `True`, `1` will fail the build if both yarn.lock and package-lock.json are present.
+	LockfileStrict = "GOOGLE_LOCKFILE_STRICT"
+
+	// NPMCIIgnoreScripts is an env var used to skip lifecycle scripts, such as prepare, only when dependencies are
+	// installed with `npm ci`. This works around `npm ci --production` running scripts that need devDependencies.
+	// Example: `true`, `True`, `1` will pass `--ignore-scripts` to `npm ci` but not to `npm install`.
+	NPMCIIgnoreScripts = "GOOGLE_NPM_CI_IGNORE_SCRIPTS"
+
+	// NPMInstallCommand is an env var used to choose the npm command used to install dependencies instead of selecting
+	// it from the Node.js version and the presence of package-lock.json.
+	// Example: `ci` requires package-lock.json and installs exactly what it lists, `install` may update it.
+	NPMInstallCommand = "GOOGLE_NPM_INSTALL_COMMAND"
+
+	// PipBin is an env var used to run pip from an executable instead of `python3 -m pip`, for example in build images
+	// with a versioned or relocated pip.
+	// Example: `pip3.9` or `/opt/python/bin/pip`.
+	PipBin = "GOOGLE_PIP_BIN"
+
+	// PipExcludeRequirements is an env var used to leave out requirements files, relative to the application root,
+	// that are included from requirements.txt with `-r`, such as development-only requirements. The excluded files are
+	// neither installed nor hashed for the dependencies cache key, so that editing them does not reinstall dependencies.
+	// Example: `requirements-dev.txt,requirements-test.txt`.
+	PipExcludeRequirements = "GOOGLE_PIP_EXCLUDE_REQUIREMENTS"
+
+	// PipFindLinks is an env var used to install Python dependencies offline from a directory of wheels, relative to
+	// the application root, instead of the package index. A `wheels` directory is used if it is not set.
+	// Example: `vendor/wheels` installs with `--find-links vendor/wheels --no-index`.
+	PipFindLinks = "GOOGLE_PIP_FIND_LINKS"
+
+	// PipParallel is an env var used to enable the features of the pip in use that parallelize or shorten downloads.
+	// Example: `true`, `True`, `1` will install with `--use-feature=fast-deps` with pip 20.2 or later.
+	PipParallel = "GOOGLE_PIP_PARALLEL"
+
+	// PipTarget is an env var used to install Python dependencies into a subdirectory of the pip layer, which is added to
+	// PYTHONPATH instead of the layer itself.
+	// Example: `app` installs dependencies into `<layer>/app`.
+	PipTarget = "GOOGLE_PIP_TARGET"
+
+	// PythonFFVersion is an env var used to constrain the version of the functions-framework package installed for
+	// Python functions that do not declare it in requirements.txt. A version declared in requirements.txt takes precedence.
+	// Example: `1.5.0` installs exactly that version, `>=1.4,<2` installs the newest matching version.
+	PythonFFVersion = "GOOGLE_PYTHON_FF_VERSION"
+
+	// RailsSkipAssetPrecompile is an env var used to skip Rails asset precompilation, for example when assets are
+	// precompiled in CI or by a CDN build step.
+	// Example: `true`, `True`, `1` will skip `rails assets:precompile`.
+	RailsSkipAssetPrecompile = "GOOGLE_RAILS_SKIP_ASSET_PRECOMPILE"
+
+	// RequiresPythonLenient is an env var used to warn instead of failing the build when the Python version does not
+	// satisfy the requires-python specifier declared in pyproject.toml.
+	// Example: `true`, `True`, `1` will install the Python version even if requires-python excludes it.
+	RequiresPythonLenient = "GOOGLE_REQUIRES_PYTHON_LENIENT"
+
+	// SetuptoolsVersion is an env var used to constrain the version of setuptools installed with the Python runtime,
+	// which is otherwise upgraded to the latest version.
+	// Example: `44.1.1` installs exactly that version, `<45` installs the newest matching version.
+	SetuptoolsVersion = "GOOGLE_SETUPTOOLS_VERSION"
+
+	// WheelVersion is an env var used to constrain the version of wheel installed with the Python runtime, which is
+	// otherwise upgraded to the latest version.
+	// Example: `0.34.2` installs exactly that version, `<0.35` installs the newest matching version.
+	WheelVersion = "GOOGLE_WHEEL_VERSION"
+
+	// YarnBin is an env var used to run Yarn from an executable other than `yarn` on PATH, which also skips installing
+	// Yarn.
+	// Example: `yarn1` or `/opt/yarn/bin/yarn`.
+	YarnBin = "GOOGLE_YARN_BIN"
+
+	// YarnStrict is an env var used to disable falling back to npm when Yarn cannot be installed.
+	// Example: `true`, `True`, `1` will fail the build if Yarn cannot be installed, even if npm could be used instead.
+	YarnStrict = "GOOGLE_YARN_STRICT"
 )
 
+// deprecated maps deprecated env var names to their replacements. Older function deployments set the launch time
+// names of the function env vars at build time too.
+var deprecated = map[string]string{
+	FunctionSignatureTypeLaunch: FunctionSignatureType,
+	FunctionSourceLaunch:        FunctionSource,
+}
+
+// Deprecation describes a deprecated env var which is set in the environment.
+type Deprecation struct {
+	Old string
+	New string
+	// Ignored is true if the replacement was already set, so the value of the deprecated env var was not used.
+	Ignored bool
+}
+
+// Deprecated registers old as a deprecated name of the env var new. It should be called before the buildpack starts,
+// for example from an init function.
+func Deprecated(old, new string) {
+	deprecated[old] = new
+}
+
+// MapDeprecated sets each registered replacement env var from its deprecated name, unless the replacement is
+// already set. It returns the deprecated env vars found in the environment, sorted by name.
+func MapDeprecated() ([]Deprecation, error) {
+	var found []Deprecation
+	for old, new := range deprecated {
+		val, ok := os.LookupEnv(old)
+		if !ok {
+			continue
+		}
+		d := Deprecation{Old: old, New: new}
+		if _, ok := os.LookupEnv(new); ok {
+			d.Ignored = true
+		} else if err := os.Setenv(new, val); err != nil {
+			return nil, fmt.Errorf("setting %s from deprecated %s: %v", new, old, err)
+		}
+		found = append(found, d)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Old < found[j].Old })
+	return found, nil
+}
+
+// functionTargetAliases are the legacy names of FunctionTarget, in order of precedence.
+var functionTargetAliases = []string{FunctionTargetLaunch, FunctionTargetEntryPoint}
+
+// functionSignatureTypes are the env vars that declare the signature type of a function.
+var functionSignatureTypes = []string{FunctionSignatureType, FunctionSignatureTypeLaunch}
+
+// Warner emits user-facing warnings, for example a *gcpbuildpack.Context.
+type Warner interface {
+	Warnf(format string, args ...interface{})
+}
+
+// FunctionTargetResolved returns the function target from FunctionTarget or, for backward compatibility, from one of
+// its legacy aliases FUNCTION_TARGET and ENTRY_POINT. ENTRY_POINT is a generic name that applications other than
+// functions may set, so it is only used if a function signature type is set too. A warning is emitted through w when a
+// legacy alias is used, unless w is nil. It returns false if none of the env vars is set.
+func FunctionTargetResolved(w Warner) (string, bool) {
+	name := FunctionTargetVar()
+	if name == "" {
+		return "", false
+	}
+	if name != FunctionTarget && w != nil {
+		w.Warnf("Using the function target from legacy env var %s, please set %s instead.", name, FunctionTarget)
+	}
+	return os.Getenv(name), true
+}
+
+// FunctionTargetVar returns the name of the env var that FunctionTargetResolved resolves the function target from, or
+// an empty string if none is set.
+func FunctionTargetVar() string {
+	if _, ok := os.LookupEnv(FunctionTarget); ok {
+		return FunctionTarget
+	}
+	for _, alias := range functionTargetAliases {
+		if _, ok := os.LookupEnv(alias); !ok {
+			continue
+		}
+		if alias == FunctionTargetEntryPoint && !anySet(functionSignatureTypes) {
+			continue
+		}
+		return alias
+	}
+	return ""
+}
+
+// anySet returns true if any of the named env vars is set.
+func anySet(names []string) bool {
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // IsDebugMode returns true if the buildpack debug mode is enabled.
 func IsDebugMode() (bool, error) {
-	val, found := os.LookupEnv(DebugMode)
+	return IsPresentAndTrue(DebugMode)
+}
+
+// IsPresentAndTrue returns true if the environment variable is set to a value that parses to true.
+func IsPresentAndTrue(varName string) (bool, error) {
+	val, found := os.LookupEnv(varName)
 	if !found {
 		return false, nil
 	}
 	parsed, err := strconv.ParseBool(val)
 	if err != nil {
-		return false, fmt.Errorf("parsing %s: %v", DebugMode, err)
+		return false, fmt.Errorf("parsing %s: %v", varName, err)
 	}
 	return parsed, nil
 }
@@ -15,7 +15,9 @@
 package env
 
 import (
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -90,3 +92,168 @@ func TestIsDebugMode(t *testing.T) {
 		})
 	}
 }
+
+func TestMapDeprecated(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		want    []Deprecation
+		wantNew string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:    "old set",
+			env:     map[string]string{"TEST_OLD_VAR": "old"},
+			want:    []Deprecation{{Old: "TEST_OLD_VAR", New: "TEST_NEW_VAR"}},
+			wantNew: "old",
+		},
+		{
+			name:    "both set",
+			env:     map[string]string{"TEST_OLD_VAR": "old", "TEST_NEW_VAR": "new"},
+			want:    []Deprecation{{Old: "TEST_OLD_VAR", New: "TEST_NEW_VAR", Ignored: true}},
+			wantNew: "new",
+		},
+		{
+			name:    "new set",
+			env:     map[string]string{"TEST_NEW_VAR": "new"},
+			wantNew: "new",
+		},
+	}
+
+	Deprecated("TEST_OLD_VAR", "TEST_NEW_VAR")
+	defer delete(deprecated, "TEST_OLD_VAR")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				if err := os.Setenv(k, v); err != nil {
+					t.Fatalf("Failed to set env: %v", err)
+				}
+			}
+			defer func() {
+				for _, k := range []string{"TEST_OLD_VAR", "TEST_NEW_VAR"} {
+					if err := os.Unsetenv(k); err != nil {
+						t.Fatalf("Failed to unset env: %v", err)
+					}
+				}
+			}()
+
+			got, err := MapDeprecated()
+			if err != nil {
+				t.Fatalf("MapDeprecated() got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("MapDeprecated() = %v, want %v", got, tc.want)
+			}
+			if got := os.Getenv("TEST_NEW_VAR"); got != tc.wantNew {
+				t.Errorf("TEST_NEW_VAR=%q, want %q", got, tc.wantNew)
+			}
+		})
+	}
+}
+
+type fakeWarner struct {
+	warnings []string
+}
+
+func (w *fakeWarner) Warnf(format string, args ...interface{}) {
+	w.warnings = append(w.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestFunctionTargetResolved(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		want     string
+		wantOK   bool
+		wantVar  string
+		wantWarn bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:    "modern",
+			env:     map[string]string{FunctionTarget: "modern", FunctionTargetLaunch: "launch", FunctionTargetEntryPoint: "entry"},
+			want:    "modern",
+			wantOK:  true,
+			wantVar: FunctionTarget,
+		},
+		{
+			name:     "launch alias",
+			env:      map[string]string{FunctionTargetLaunch: "launch", FunctionTargetEntryPoint: "entry"},
+			want:     "launch",
+			wantOK:   true,
+			wantVar:  FunctionTargetLaunch,
+			wantWarn: true,
+		},
+		{
+			name:     "entry point alias",
+			env:      map[string]string{FunctionTargetEntryPoint: "entry", FunctionSignatureType: "http"},
+			want:     "entry",
+			wantOK:   true,
+			wantVar:  FunctionTargetEntryPoint,
+			wantWarn: true,
+		},
+		{
+			name:     "entry point alias with launch signature type",
+			env:      map[string]string{FunctionTargetEntryPoint: "entry", FunctionSignatureTypeLaunch: "event"},
+			want:     "entry",
+			wantOK:   true,
+			wantVar:  FunctionTargetEntryPoint,
+			wantWarn: true,
+		},
+		{
+			name: "entry point without signature type",
+			env:  map[string]string{FunctionTargetEntryPoint: "entry"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				if err := os.Setenv(k, v); err != nil {
+					t.Fatalf("Failed to set env: %v", err)
+				}
+			}
+			defer func() {
+				for _, k := range []string{FunctionTarget, FunctionTargetLaunch, FunctionTargetEntryPoint, FunctionSignatureType, FunctionSignatureTypeLaunch} {
+					if err := os.Unsetenv(k); err != nil {
+						t.Fatalf("Failed to unset env: %v", err)
+					}
+				}
+			}()
+
+			w := &fakeWarner{}
+			got, ok := FunctionTargetResolved(w)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("FunctionTargetResolved() = %q, %t, want %q, %t", got, ok, tc.want, tc.wantOK)
+			}
+			if got := FunctionTargetVar(); got != tc.wantVar {
+				t.Errorf("FunctionTargetVar() = %q, want %q", got, tc.wantVar)
+			}
+			if gotWarn := len(w.warnings) > 0; gotWarn != tc.wantWarn {
+				t.Errorf("FunctionTargetResolved() warnings = %v, want warning: %t", w.warnings, tc.wantWarn)
+			}
+		})
+	}
+}
+
+func TestMapDeprecatedFunctionEnv(t *testing.T) {
+	os.Setenv(FunctionSourceLaunch, "src")
+	defer os.Unsetenv(FunctionSourceLaunch)
+	defer os.Unsetenv(FunctionSource)
+
+	got, err := MapDeprecated()
+	if err != nil {
+		t.Fatalf("MapDeprecated() got unexpected error: %v", err)
+	}
+	want := []Deprecation{{Old: FunctionSourceLaunch, New: FunctionSource}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MapDeprecated() = %v, want %v", got, want)
+	}
+	if got := os.Getenv(FunctionSource); got != "src" {
+		t.Errorf("%s = %q, want %q", FunctionSource, got, "src")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// TarOptions configures CreateReproducibleTarGz.
+type TarOptions struct {
+	// Exclude are globs of paths relative to the archived directory that are left out of the archive, matched with
+	// filepath.Match. A glob matching a directory excludes everything in it.
+	Exclude []string
+	// ModTime is the modification time of every entry. If it is zero, the time in seconds since the Unix epoch given by
+	// SOURCE_DATE_EPOCH is used if it is set, or the Unix epoch otherwise.
+	ModTime time.Time
+}
+
+// CreateReproducibleTarGz archives the contents of the directory root into the gzipped tar file dest, such that
+// identical contents produce identical archives: entries are sorted by path, have the same modification time, and are
+// owned by uid and gid 0, and the gzip header has no name or timestamp. Entry names start with "./", as with
+// `tar --directory root .`. Files other than regular files, directories, and symlinks are skipped.
+func (ctx *Context) CreateReproducibleTarGz(root, dest string, opts TarOptions) {
+	modTime := opts.ModTime
+	if modTime.IsZero() {
+		modTime = ctx.sourceDateEpoch()
+	}
+	if err := createReproducibleTarGz(root, dest, opts.Exclude, modTime); err != nil {
+		ctx.Exit(1, InternalErrorf("archiving %s to %s: %v", root, dest, err))
+	}
+}
+
+// sourceDateEpoch returns the time set by SOURCE_DATE_EPOCH, see https://reproducible-builds.org/specs/source-date-epoch/,
+// or the Unix epoch if it is not set or invalid.
+func (ctx *Context) sourceDateEpoch() time.Time {
+	val := os.Getenv("SOURCE_DATE_EPOCH")
+	if val == "" {
+		return time.Unix(0, 0)
+	}
+	secs, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		ctx.Warnf("Ignoring invalid SOURCE_DATE_EPOCH %q, it must be a number of seconds: %v", val, err)
+		return time.Unix(0, 0)
+	}
+	return time.Unix(secs, 0)
+}
+
+// createReproducibleTarGz implements CreateReproducibleTarGz.
+func createReproducibleTarGz(root, dest string, exclude []string, modTime time.Time) (err error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	// The gzip header has no name and a zero modification time unless they are set.
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	// filepath.Walk visits files in lexical order, which makes the order of entries stable.
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == absDest {
+			return nil
+		}
+		name := "./"
+		if rel != "." {
+			excluded, err := matchesAny(rel, exclude)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			name += filepath.ToSlash(rel)
+			if info.IsDir() {
+				name += "/"
+			}
+		}
+		return addTarEntry(tw, path, name, info, modTime)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// matchesAny returns true if name matches any of the globs.
+func matchesAny(name string, globs []string) (bool, error) {
+	for _, glob := range globs {
+		match, err := filepath.Match(glob, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %q: %v", glob, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addTarEntry writes the file at path to tw as an entry called name, with normalized metadata.
+func addTarEntry(tw *tar.Writer, path, name string, info os.FileInfo, modTime time.Time) error {
+	var link string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.ModTime = modTime
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+// writeTestTree creates files under a new temp dir with the given modification time.
+func writeTestTree(t *testing.T, files map[string]string, mtime time.Time) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "archive-")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Creating dir for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Writing %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Setting times of %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// readTarGz returns the headers of the entries of the gzipped tar file.
+func readTarGz(t *testing.T, path string) []*tar.Header {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Opening %s: %v", path, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Reading gzip %s: %v", path, err)
+	}
+	tr := tar.NewReader(zr)
+	var hdrs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hdrs
+		}
+		if err != nil {
+			t.Fatalf("Reading tar %s: %v", path, err)
+		}
+		hdrs = append(hdrs, hdr)
+	}
+}
+
+func TestCreateReproducibleTarGz(t *testing.T) {
+	files := map[string]string{
+		"b.txt":         "b",
+		"a/z.txt":       "z",
+		"a/b.txt":       "ab",
+		"data/big.bin":  "big",
+		"src/index.js":  "index",
+		"src/index.mp4": "video",
+	}
+	dir1 := writeTestTree(t, files, time.Unix(1000, 0))
+	defer os.RemoveAll(dir1)
+	dir2 := writeTestTree(t, files, time.Unix(2000, 0))
+	defer os.RemoveAll(dir2)
+	out, err := ioutil.TempDir("", "archive-out-")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(out)
+
+	ctx := NewContextForTests(buildpack.Info{}, dir1)
+	opts := TarOptions{Exclude: []string{"data", "src/*.mp4"}}
+	ctx.CreateReproducibleTarGz(dir1, filepath.Join(out, "1.tar.gz"), opts)
+	ctx.CreateReproducibleTarGz(dir2, filepath.Join(out, "2.tar.gz"), opts)
+
+	got1, err := ioutil.ReadFile(filepath.Join(out, "1.tar.gz"))
+	if err != nil {
+		t.Fatalf("Reading archive: %v", err)
+	}
+	got2, err := ioutil.ReadFile(filepath.Join(out, "2.tar.gz"))
+	if err != nil {
+		t.Fatalf("Reading archive: %v", err)
+	}
+	if !bytes.Equal(got1, got2) {
+		t.Error("CreateReproducibleTarGz() produced different archives for identical contents")
+	}
+
+	var names []string
+	for _, hdr := range readTarGz(t, filepath.Join(out, "1.tar.gz")) {
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("Entry %s has mtime %v, owner %d:%d (%q:%q), want epoch and 0:0", hdr.Name, hdr.ModTime, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+	}
+	want := []string{"./", "./a/", "./a/b.txt", "./a/z.txt", "./b.txt", "./src/", "./src/index.js"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("CreateReproducibleTarGz() entries = %v, want %v", names, want)
+	}
+}
+
+func TestCreateReproducibleTarGzSourceDateEpoch(t *testing.T) {
+	dir := writeTestTree(t, map[string]string{"a.txt": "a"}, time.Now())
+	defer os.RemoveAll(dir)
+	os.Setenv("SOURCE_DATE_EPOCH", "1600000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	out, err := ioutil.TempDir("", "archive-out-")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(out)
+	dest := filepath.Join(out, "a.tar.gz")
+
+	NewContextForTests(buildpack.Info{}, dir).CreateReproducibleTarGz(dir, dest, TarOptions{})
+
+	for _, hdr := range readTarGz(t, dest) {
+		if want := time.Unix(1600000000, 0); !hdr.ModTime.Equal(want) {
+			t.Errorf("Entry %s has mtime %v, want %v", hdr.Name, hdr.ModTime, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+const buildConfigFile = ".gcp-build.toml"
+
+// buildConfig represents the contents of .gcp-build.toml. Each value corresponds to an env var, see loadBuildConfig.
+type buildConfig struct {
+	Runtime struct {
+		Version string `toml:"version"`
+	} `toml:"runtime"`
+	Build struct {
+		Prebuild  string `toml:"prebuild"`
+		Postbuild string `toml:"postbuild"`
+	} `toml:"build"`
+	Install struct {
+		BuildArgs     string `toml:"build_args"`
+		BundleWithout string `toml:"bundle_without"`
+		NPMCommand    string `toml:"npm_command"`
+		PipFindLinks  string `toml:"pip_find_links"`
+		PipTarget     string `toml:"pip_target"`
+	} `toml:"install"`
+}
+
+// loadBuildConfig sets the env vars that configure buildpacks from .gcp-build.toml in the application root, if present,
+// so that a build can be configured declaratively in a committed file. Variables already set in the environment,
+// including those from build.env, take precedence. Unknown keys are ignored with a warning.
+func (ctx *Context) loadBuildConfig() {
+	path := filepath.Join(ctx.ApplicationRoot(), buildConfigFile)
+	if !ctx.FileExists(path) {
+		return
+	}
+	var c buildConfig
+	md, err := toml.DecodeFile(path, &c)
+	if err != nil {
+		ctx.Exit(1, UserErrorf("parsing %s: %v", buildConfigFile, err))
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		var keys []string
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		ctx.Warnf("Ignoring unknown keys in %s: %s", buildConfigFile, strings.Join(keys, ", "))
+	}
+	ctx.setConfigEnv(buildConfigFile, []configVar{
+		{name: env.RuntimeVersion, value: c.Runtime.Version},
+		{name: env.PrebuildCommand, value: c.Build.Prebuild},
+		{name: env.VerifyCommand, value: c.Build.Postbuild},
+		{name: env.BuildArgs, value: c.Install.BuildArgs},
+		{name: env.BundleWithout, value: c.Install.BundleWithout},
+		{name: env.NPMInstallCommand, value: c.Install.NPMCommand},
+		{name: env.PipFindLinks, value: c.Install.PipFindLinks},
+		{name: env.PipTarget, value: c.Install.PipTarget},
+	})
+}
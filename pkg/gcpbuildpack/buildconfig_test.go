@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestLoadBuildConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-config-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := `
+[runtime]
+version = "3.9.1"
+
+[build]
+prebuild = "./generate.sh"
+postbuild = "python -c 'import main'"
+
+[install]
+pip_find_links = "vendor/wheels"
+unknown = "ignored"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, buildConfigFile), []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", buildConfigFile, err)
+	}
+	os.Setenv(env.RuntimeVersion, "3.8.0")
+	for _, name := range []string{env.RuntimeVersion, env.PrebuildCommand, env.VerifyCommand, env.PipFindLinks} {
+		defer os.Unsetenv(name)
+	}
+
+	ctx := NewContextForTests(buildpack.Info{ID: "id", Version: "version", Name: "name"}, dir)
+	ctx.loadBuildConfig()
+
+	for name, want := range map[string]string{
+		env.RuntimeVersion:  "3.8.0",
+		env.PrebuildCommand: "./generate.sh",
+		env.VerifyCommand:   "python -c 'import main'",
+		env.PipFindLinks:    "vendor/wheels",
+		env.BuildArgs:       "",
+	} {
+		if got := os.Getenv(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if len(ctx.decisions.warnings) != 1 || !strings.Contains(ctx.decisions.warnings[0], "install.unknown") {
+		t.Errorf("loadBuildConfig() warnings = %v, want a warning about install.unknown", ctx.decisions.warnings)
+	}
+}
+
+func TestLoadBuildConfigDetect(t *testing.T) {
+	defer os.Unsetenv(env.PrebuildCommand)
+	detectFn := func(ctx *Context) error {
+		if os.Getenv(env.PrebuildCommand) == "" {
+			ctx.OptOut("%s not set", env.PrebuildCommand)
+		}
+		return nil
+	}
+
+	got := RunDetectInProcess(t, detectFn, map[string]string{buildConfigFile: "[build]\nprebuild = \"make\"\n"}, nil)
+
+	if got.ExitCode != 0 {
+		t.Errorf("RunDetectInProcess() exit code = %d, want 0", got.ExitCode)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const buildEnvFile = "build.env"
+
+var (
+	// envNameRegexp matches a valid environment variable name.
+	envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// envVar is a single variable declared in an env file.
+type envVar struct {
+	name  string
+	value string
+}
+
+// loadBuildEnv sets the variables declared in build.env in the application root, if present, in the environment of
+// the current buildpack, during both detect and build. Variables already set in the environment take precedence. Values are never logged.
+func (ctx *Context) loadBuildEnv() {
+	path := filepath.Join(ctx.ApplicationRoot(), buildEnvFile)
+	if !ctx.FileExists(path) {
+		return
+	}
+	// Every buildpack loads build.env in both detect and build, so only the build of the first one logs it.
+	logf := ctx.Debugf
+	if ctx.firstBuildpack {
+		logf = ctx.Logf
+	}
+	logf("Loading build environment from %s.", buildEnvFile)
+	vars, err := parseEnvFile(string(ctx.ReadFileNormalized(path)))
+	if err != nil {
+		ctx.Exit(1, UserErrorf("parsing %s: %v", buildEnvFile, err))
+	}
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v.name); ok {
+			ctx.Debugf("Skipping %s from %s, it is already set", v.name, buildEnvFile)
+			continue
+		}
+		ctx.Debugf("Setting %s=[REDACTED] from %s", v.name, buildEnvFile)
+		ctx.Setenv(v.name, v.value)
+	}
+}
+
+// parseEnvFile parses lines of the form NAME=value, optionally prefixed with `export` and with the value enclosed in
+// single or double quotes. Blank lines and lines starting with # are ignored.
+func parseEnvFile(content string) ([]envVar, error) {
+	var vars []envVar
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !envNameRegexp.MatchString(name) {
+			// The line is not echoed back as it may contain a secret value.
+			return nil, fmt.Errorf("line %d: expected NAME=value", i+1)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, envVar{name: name, value: value})
+	}
+	return vars, nil
+}
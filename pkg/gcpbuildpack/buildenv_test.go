@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    []envVar
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# endpoint\n\nAPI_URL=https://example.com\n",
+			want:    []envVar{{name: "API_URL", value: "https://example.com"}},
+		},
+		{
+			name:    "export and quotes",
+			content: "export A=\"b c\"\nB='d'\nC=\"e'\n",
+			want:    []envVar{{name: "A", value: "b c"}, {name: "B", value: "d"}, {name: "C", value: "\"e'"}},
+		},
+		{
+			name:    "empty value and equals in value",
+			content: "A=\nB=c=d\n",
+			want:    []envVar{{name: "A"}, {name: "B", value: "c=d"}},
+		},
+		{
+			name:    "missing equals",
+			content: "A=b\nsecret\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			content: "1A=b\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseEnvFile(tc.content)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parseEnvFile() got error %v, want error %t", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseEnvFile() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadBuildEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-env-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "BUILD_ENV_TEST_NEW=from-file\r\nBUILD_ENV_TEST_SET=from-file\r\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, buildEnvFile), []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", buildEnvFile, err)
+	}
+	os.Setenv("BUILD_ENV_TEST_SET", "from-env")
+	defer os.Unsetenv("BUILD_ENV_TEST_SET")
+	defer os.Unsetenv("BUILD_ENV_TEST_NEW")
+
+	ctx := NewContextForTests(buildpack.Info{ID: "id", Version: "version", Name: "name"}, dir)
+	ctx.loadBuildEnv()
+
+	if got, want := os.Getenv("BUILD_ENV_TEST_NEW"), "from-file"; got != want {
+		t.Errorf("BUILD_ENV_TEST_NEW = %q, want %q", got, want)
+	}
+	if got, want := os.Getenv("BUILD_ENV_TEST_SET"), "from-env"; got != want {
+		t.Errorf("BUILD_ENV_TEST_SET = %q, want %q", got, want)
+	}
+}
+
+func TestLoadBuildEnvDetect(t *testing.T) {
+	defer os.Unsetenv("BUILD_ENV_TEST_DETECT")
+	detectFn := func(ctx *Context) error {
+		if os.Getenv("BUILD_ENV_TEST_DETECT") == "" {
+			ctx.OptOut("BUILD_ENV_TEST_DETECT not set")
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	defer func(l *log.Logger) { logger = l }(logger)
+	logger = log.New(&buf, "", 0)
+
+	got := RunDetectInProcess(t, detectFn, map[string]string{buildEnvFile: "BUILD_ENV_TEST_DETECT=true\n"}, nil)
+
+	if got.ExitCode != 0 {
+		t.Errorf("RunDetectInProcess() exit code = %d, want 0", got.ExitCode)
+	}
+	// Only the build of the first buildpack logs that build.env is loaded.
+	if strings.Contains(buf.String(), "Loading build environment") {
+		t.Errorf("detect output %q logs loading %s, want it only in debug mode", buf.String(), buildEnvFile)
+	}
+}
@@ -17,6 +17,7 @@ package gcpbuildpack
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,13 +26,15 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 )
 
 const (
 	errorIDLength            = 8
 	builderOutputEnv         = "BUILDER_OUTPUT"
-	builderOutputFilename    = "output"
+	builderOutputFileEnv     = "BUILDER_OUTPUT_FILE"
+	defaultBuilderOutputFile = "output"
 	expectedBuilderOutputEnv = "EXPECTED_BUILDER_OUTPUT"
 )
 
@@ -62,6 +65,9 @@ type builderStat struct {
 	BuildpackVersion string `json:"buildpackVersion"`
 	DurationMs       int64  `json:"totalDurationMs"`
 	UserDurationMs   int64  `json:"userDurationMs"`
+	// CPUDurationMs and MaxRSSBytes summarize the resource usage of the commands run by the buildpack.
+	CPUDurationMs int64 `json:"cpuDurationMs,omitempty"`
+	MaxRSSBytes   int64 `json:"maxRssBytes,omitempty"`
 }
 
 func (e *Error) Error() string {
@@ -104,6 +110,11 @@ var KeepCombinedHead = func(result *ExecResult) string { return keepHead(result.
 // KeepStderrTail returns the tail of stderr from the result.
 var KeepStderrTail = func(result *ExecResult) string { return keepTail(result.Stderr) }
 
+// KeepStderrTailLines returns a MessageProducer that keeps the last n complete lines of stderr from the result.
+func KeepStderrTailLines(n int) MessageProducer {
+	return func(result *ExecResult) string { return keepTailLines(result.Stderr, n) }
+}
+
 // KeepStderrHead returns the head of stderr from the result.
 var KeepStderrHead = func(result *ExecResult) string { return keepHead(result.Stderr) }
 
@@ -138,14 +149,15 @@ func (ctx *Context) saveErrorOutput(be *Error) {
 	}
 
 	// /bin/detect steps run in parallel, so they might compete over the output file. To eliminate
-	// this competition, write to temp file, then `mv -f` to final location (last one in wins).
-	tname := filepath.Join(outputDir, fmt.Sprintf("%s-%d", builderOutputFilename, rand.Int()))
+	// this competition, write to temp file, then move it to final location (last one in wins).
+	name := builderOutputFilename()
+	tname := filepath.Join(outputDir, fmt.Sprintf("%s-%d", name, rand.Int()))
 	if err := ioutil.WriteFile(tname, data, 0644); err != nil {
 		ctx.Warnf("Failed to write %s, skipping structured error output: %v", tname, err)
 		return
 	}
-	fname := filepath.Join(outputDir, builderOutputFilename)
-	if _, err := ctx.ExecWithErr([]string{"mv", "-f", tname, fname}); err != nil {
+	fname := filepath.Join(outputDir, name)
+	if err := moveFile(tname, fname); err != nil {
 		ctx.Warnf("Failed to move %s to %s, skipping structured error output: %v", tname, fname, err)
 		return
 	}
@@ -163,6 +175,15 @@ func (ctx *Context) saveErrorOutput(be *Error) {
 	return
 }
 
+// builderOutputFilename returns the name of the builder output file within $BUILDER_OUTPUT. It can be overridden with
+// $BUILDER_OUTPUT_FILE so that concurrent builds sharing a directory write distinct files.
+func builderOutputFilename() string {
+	if name := os.Getenv(builderOutputFileEnv); name != "" {
+		return filepath.Base(name)
+	}
+	return defaultBuilderOutputFile
+}
+
 func keepTail(message string) string {
 	message = strings.TrimSpace(message)
 
@@ -173,6 +194,34 @@ func keepTail(message string) string {
 	return "..." + message[len(message)-maxMessageBytes+3:]
 }
 
+// keepTailLines returns the last n lines of message, dropping more lines from the start if needed to fit within
+// maxMessageBytes, so that the message does not start mid-line. Dropped lines are replaced by a "..." line. If even the
+// last line does not fit, its tail is kept as with keepTail.
+func keepTailLines(message string, n int) string {
+	message = strings.TrimSpace(message)
+	if n <= 0 {
+		return keepTail(message)
+	}
+	lines := strings.Split(message, "\n")
+	start := 0
+	if len(lines) > n {
+		start = len(lines) - n
+	}
+	const prefix = "...\n"
+	size := len(strings.Join(lines[start:], "\n"))
+	for start < len(lines)-1 && (size > maxMessageBytes || start > 0 && size+len(prefix) > maxMessageBytes) {
+		size -= len(lines[start]) + 1
+		start++
+	}
+	if size > maxMessageBytes || start > 0 && size+len(prefix) > maxMessageBytes {
+		return keepTail(lines[len(lines)-1])
+	}
+	if start > 0 {
+		return prefix + strings.Join(lines[start:], "\n")
+	}
+	return message
+}
+
 func keepHead(message string) string {
 	message = strings.TrimSpace(message)
 
@@ -183,6 +232,48 @@ func keepHead(message string) string {
 	return message[:maxMessageBytes-3] + "..."
 }
 
+// moveFile atomically replaces dst with src. If they are on different devices, which cannot be renamed across, src is
+// copied to a temp file next to dst, which is renamed to dst, and src is removed.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	return copyAndRemove(src, dst)
+}
+
+// copyAndRemove atomically replaces dst with a copy of src, then removes src.
+func copyAndRemove(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
 // generateErrorID creates a short hash from the provided parts.
 func generateErrorID(parts ...string) ErrorID {
 	h := sha256.New()
@@ -202,7 +293,7 @@ func (ctx *Context) saveSuccessOutput(duration time.Duration) {
 	}
 
 	var bo builderOutput
-	fname := filepath.Join(outputDir, builderOutputFilename)
+	fname := filepath.Join(outputDir, builderOutputFilename())
 
 	if ctx.FileExists(fname) {
 		content, err := ioutil.ReadFile(fname)
@@ -221,6 +312,8 @@ func (ctx *Context) saveSuccessOutput(duration time.Duration) {
 		BuildpackVersion: ctx.BuildpackVersion(),
 		DurationMs:       duration.Milliseconds(),
 		UserDurationMs:   ctx.stats.user.Milliseconds(),
+		CPUDurationMs:    ctx.stats.cpu.Milliseconds(),
+		MaxRSSBytes:      ctx.stats.maxRSSBytes,
 	})
 
 	content, err := json.Marshal(&bo)
@@ -73,6 +73,54 @@ func TestSaveErrorOutput(t *testing.T) {
 	}
 }
 
+func TestSaveErrorOutputWithFilename(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "save-error-output-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("BUILDER_OUTPUT", tempDir)
+	os.Setenv("BUILDER_OUTPUT_FILE", "output-build-1")
+	defer func() {
+		os.Unsetenv("BUILDER_OUTPUT")
+		os.Unsetenv("BUILDER_OUTPUT_FILE")
+	}()
+	ctx := NewContext(buildpack.Info{ID: "id", Version: "version", Name: "name"})
+
+	ctx.saveErrorOutput(Errorf(StatusInternal, "failed"))
+
+	files, err := ioutil.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("reading %s: %v", tempDir, err)
+	}
+	if len(files) != 1 || files[0].Name() != "output-build-1" {
+		t.Errorf("files in $BUILDER_OUTPUT = %v, want only output-build-1", files)
+	}
+}
+
+func TestBuilderOutputFilename(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "default", want: "output"},
+		{name: "custom", value: "output-1", want: "output-1"},
+		{name: "path is reduced to base name", value: "../other/output-1", want: "output-1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv("BUILDER_OUTPUT_FILE", tc.value)
+			defer os.Unsetenv("BUILDER_OUTPUT_FILE")
+
+			if got := builderOutputFilename(); got != tc.want {
+				t.Errorf("builderOutputFilename() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestMessageProducers(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -191,6 +239,74 @@ func TestKeepTail(t *testing.T) {
 	}
 }
 
+func TestKeepTailLines(t *testing.T) {
+	testCases := []struct {
+		name            string
+		message         string
+		n               int
+		want            string
+		maxMessageBytes int
+	}{
+		{
+			name:            "empty message",
+			message:         "",
+			n:               2,
+			want:            "",
+			maxMessageBytes: 16,
+		},
+		{
+			name:            "fewer lines than n",
+			message:         "a\nb\n",
+			n:               3,
+			want:            "a\nb",
+			maxMessageBytes: 16,
+		},
+		{
+			name:            "more lines than n",
+			message:         "a\nb\nc\nd",
+			n:               2,
+			want:            "...\nc\nd",
+			maxMessageBytes: 16,
+		},
+		{
+			name:            "lines over budget",
+			message:         "1234\n5678\n9012\n3456",
+			n:               4,
+			want:            "...\n9012\n3456",
+			maxMessageBytes: 14,
+		},
+		{
+			name:            "last line over budget",
+			message:         "a\n12345678901234567890",
+			n:               2,
+			want:            "...67890",
+			maxMessageBytes: 8,
+		},
+		{
+			name:            "non-positive n",
+			message:         "12345678901234567890",
+			n:               0,
+			want:            "...67890",
+			maxMessageBytes: 8,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.maxMessageBytes != 0 {
+				oldMax := maxMessageBytes
+				maxMessageBytes = tc.maxMessageBytes
+				defer func() {
+					maxMessageBytes = oldMax
+				}()
+			}
+			got := keepTailLines(tc.message, tc.n)
+			if got != tc.want {
+				t.Errorf("keepTailLines(%q, %d) got=%q want=%q", tc.message, tc.n, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestKeepHead(t *testing.T) {
 	testCases := []struct {
 		name            string
@@ -258,6 +374,67 @@ func TestGenerateErrorId(t *testing.T) {
 	}
 }
 
+func TestMoveFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		move func(src, dst string) error
+	}{
+		{
+			name: "rename",
+			move: moveFile,
+		},
+		{
+			name: "copy across devices",
+			move: copyAndRemove,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "move-file-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+			if err := ioutil.WriteFile(src, []byte("new"), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", src, err)
+			}
+			if err := ioutil.WriteFile(dst, []byte("old"), 0600); err != nil {
+				t.Fatalf("Failed to write %s: %v", dst, err)
+			}
+
+			if err := tc.move(src, dst); err != nil {
+				t.Fatalf("moving %s to %s got error: %v", src, dst, err)
+			}
+
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Errorf("%s still exists after move, stat error: %v", src, err)
+			}
+			got, err := ioutil.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", dst, err)
+			}
+			if string(got) != "new" {
+				t.Errorf("%s got content %q, want %q", dst, got, "new")
+			}
+			fi, err := os.Stat(dst)
+			if err != nil {
+				t.Fatalf("Failed to stat %s: %v", dst, err)
+			}
+			if fi.Mode().Perm() != 0644 {
+				t.Errorf("%s got mode %v, want %v", dst, fi.Mode().Perm(), os.FileMode(0644))
+			}
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", dir, err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%s got %d entries, want only dst", dir, len(entries))
+			}
+		})
+	}
+}
+
 func TestSaveBuilderSuccessOutput(t *testing.T) {
 	dur := 30 * time.Second
 	userDur := 5 * time.Second
@@ -300,7 +477,7 @@ func TestSaveBuilderSuccessOutput(t *testing.T) {
 				os.Unsetenv("BUILDER_OUTPUT")
 			}()
 
-			fname := filepath.Join(tempDir, builderOutputFilename)
+			fname := filepath.Join(tempDir, builderOutputFilename())
 			if len(tc.initial) > 0 {
 				bo := builderOutput{
 					Stats: tc.initial,
@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+// buildDeadline enforces the maximum duration of the build set by GOOGLE_BUILD_TIMEOUT.
+type buildDeadline struct {
+	timeout time.Duration
+	// ctx is done when the deadline is exceeded, which terminates the commands derived from it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards the spans of the Context, which are recorded by concurrent commands.
+	mu sync.Mutex
+	// exitMu is held by the first goroutine to exit, so that only one of a failing build and the timeout error is
+	// reported.
+	exitMu sync.Mutex
+}
+
+// enforceBuildDeadline starts enforcing GOOGLE_BUILD_TIMEOUT, if set, from the start of the build of the first
+// buildpack. When the deadline is exceeded, the commands being executed are terminated with their process groups and
+// the build fails with a timeout error once they have exited.
+func (ctx *Context) enforceBuildDeadline() {
+	val := os.Getenv(env.BuildTimeout)
+	if val == "" {
+		return
+	}
+	timeout, err := time.ParseDuration(val)
+	if err != nil || timeout <= 0 {
+		ctx.Exit(1, UserErrorf("invalid %s %q, must be a positive duration such as 20m", env.BuildTimeout, val))
+	}
+	ctx.Debugf("Build deadline is %v from now.", (timeout - time.Since(ctx.buildStart)).Round(time.Second))
+	// A deadline that has already passed is exceeded immediately.
+	dctx, cancel := context.WithDeadline(context.Background(), ctx.buildStart.Add(timeout))
+	ctx.deadline = &buildDeadline{timeout: timeout, ctx: dctx, cancel: cancel}
+}
+
+// stopBuildDeadline stops enforcing the build deadline, if any.
+func (ctx *Context) stopBuildDeadline() {
+	if ctx.deadline != nil {
+		ctx.deadline.cancel()
+	}
+}
+
+// buildDeadlineExceeded reports whether the build deadline, if any, was exceeded.
+func (ctx *Context) buildDeadlineExceeded() bool {
+	return ctx.deadline != nil && ctx.deadline.ctx.Err() == context.DeadlineExceeded
+}
+
+// commandContext returns the context of a command, which is done when the command runs for longer than timeout, if
+// positive, or when the build deadline is exceeded, unless untracked is set.
+func (ctx *Context) commandContext(untracked bool, timeout time.Duration) (context.Context, context.CancelFunc) {
+	parent := context.Background()
+	if ctx.deadline != nil && !untracked {
+		parent = ctx.deadline.ctx
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// startCommand starts ecmd, created by exec.CommandContext with a context from commandContext, so that its process
+// group is terminated when the context is done. A build that exceeded its deadline exits instead, unless untracked is
+// set.
+func (ctx *Context) startCommand(ecmd *exec.Cmd, name string, untracked bool) error {
+	if !untracked {
+		ctx.exitIfBuildDeadlineExceeded(name)
+	}
+	if ecmd.SysProcAttr == nil {
+		ecmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// Commands that start a session, such as those with a pseudo-terminal, already lead their own process group.
+	if !ecmd.SysProcAttr.Setsid {
+		ecmd.SysProcAttr.Setpgid = true
+	}
+	ecmd.Cancel = func() error {
+		// A negative pid signals the process group of the command, including any processes it started. The group id
+		// is not reused while any of its processes are alive, even after the command itself has been reaped.
+		return syscall.Kill(-ecmd.Process.Pid, syscall.SIGKILL)
+	}
+	return ecmd.Start()
+}
+
+// waitCommand waits for ecmd, started by startCommand with the context cctx, to exit. If the build deadline was
+// exceeded while it ran, the build exits with a timeout error, unless untracked is set. It returns whether the command
+// was terminated by its timeout and the error of ecmd.Wait.
+func (ctx *Context) waitCommand(ecmd *exec.Cmd, name string, untracked bool, cctx context.Context) (bool, error) {
+	err := ecmd.Wait()
+	if !untracked {
+		ctx.exitIfBuildDeadlineExceeded(name)
+	}
+	timedOut := cctx.Err() == context.DeadlineExceeded
+	if timedOut && err == context.DeadlineExceeded {
+		// The command exited successfully as it was being terminated, which is reported as the timeout instead.
+		err = nil
+	}
+	return timedOut, err
+}
+
+// exitIfBuildDeadlineExceeded exits with a timeout error listing the steps that completed and the command that was
+// running, if any, when the build deadline was exceeded.
+func (ctx *Context) exitIfBuildDeadlineExceeded(running string) {
+	if !ctx.buildDeadlineExceeded() {
+		return
+	}
+	d := ctx.deadline
+	var completed []string
+	d.mu.Lock()
+	for _, s := range ctx.stats.spans {
+		if s != nil {
+			completed = append(completed, fmt.Sprintf("%s (%v)", s.name, s.end.Sub(s.start).Round(time.Millisecond)))
+		}
+	}
+	d.mu.Unlock()
+
+	msg := fmt.Sprintf("build exceeded the %s of %v", env.BuildTimeout, d.timeout)
+	if running != "" {
+		msg += fmt.Sprintf(" while running %q", running)
+	}
+	if len(completed) > 0 {
+		msg += fmt.Sprintf("; completed steps: %s", strings.Join(completed, ", "))
+	}
+	ctx.Exit(ctx.b.Failure(1), Errorf(StatusDeadlineExceeded, msg))
+}
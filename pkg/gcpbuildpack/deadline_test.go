@@ -0,0 +1,236 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+func TestBuildDeadlineExceeded(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "build-deadline-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(outDir)
+	os.Setenv(builderOutputEnv, outDir)
+	defer os.Unsetenv(builderOutputEnv)
+	os.Setenv(env.BuildTimeout, "500ms")
+	defer os.Unsetenv(env.BuildTimeout)
+
+	_, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+
+	exited := make(chan int, 1)
+	oldExit := exit
+	exit = func(code int) {
+		exited <- code
+		// The process would have exited, so the exiting goroutine never resumes.
+		select {}
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	start := time.Now()
+	go build(func(ctx *Context) error {
+		ctx.Exec([]string{"echo", "done"})
+		// The background sleep is in the process group of the command, so it is terminated too.
+		ctx.Exec([]string{"/bin/bash", "-c", "sleep 30 & sleep 30"})
+		return nil
+	})
+
+	select {
+	case code := <-exited:
+		if code == 0 {
+			t.Errorf("exit code got=0, want non-zero")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("build did not exit after exceeding the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("build exited after %v, want shortly after the deadline", elapsed)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(outDir, builderOutputFilename()))
+	if err != nil {
+		t.Fatalf("reading builder output: %v", err)
+	}
+	var got builderOutput
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("unmarshalling builder output: %v", err)
+	}
+	if got.Error.Status != StatusDeadlineExceeded {
+		t.Errorf("error status got=%s want=%s", got.Error.Status, StatusDeadlineExceeded)
+	}
+	for _, want := range []string{env.BuildTimeout, `while running "/bin/bash -c sleep 30 & sleep 30"`, `completed steps: Exec "echo done"`} {
+		if !strings.Contains(got.Error.Message, want) {
+			t.Errorf("error message %q does not contain %q", got.Error.Message, want)
+		}
+	}
+}
+
+func TestBuildDeadlineInvalid(t *testing.T) {
+	os.Setenv(env.BuildTimeout, "soon")
+	defer os.Unsetenv(env.BuildTimeout)
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	oldExit := exit
+	exit = func(code int) {
+		panic(exitPanic(code))
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	defer func() {
+		if r := recover(); r != exitPanic(1) {
+			t.Errorf("enforceBuildDeadline() exit got=%v want=%v", r, exitPanic(1))
+		}
+	}()
+	ctx.enforceBuildDeadline()
+}
+
+func TestBuildDeadlineSharedAcrossBuildpacks(t *testing.T) {
+	os.Setenv(env.BuildTimeout, "1m")
+	defer os.Unsetenv(env.BuildTimeout)
+	// An earlier buildpack started the build more than a minute ago.
+	os.Setenv(buildStartEnv, strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+	defer os.Unsetenv(buildStartEnv)
+
+	_, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+
+	exited := make(chan int, 1)
+	oldExit := exit
+	exit = func(code int) {
+		exited <- code
+		select {}
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	go build(func(ctx *Context) error {
+		ctx.Exec([]string{"sleep", "30"})
+		return nil
+	})
+
+	select {
+	case code := <-exited:
+		if code == 0 {
+			t.Errorf("exit code got=0, want non-zero")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("build did not exit after the shared deadline passed")
+	}
+}
+
+func TestBuildStartExported(t *testing.T) {
+	os.Setenv(env.BuildTimeout, "1m")
+	defer os.Unsetenv(env.BuildTimeout)
+	temps, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+
+	oldExit := exit
+	exit = func(code int) {
+		if code != 0 {
+			t.Errorf("exit code got=%d, want 0", code)
+		}
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	before := time.Now().Unix()
+	build(func(ctx *Context) error { return nil })
+
+	content, err := ioutil.ReadFile(filepath.Join(temps.layersDir, buildStartLayer, "env.build", buildStartEnv+".override"))
+	if err != nil {
+		t.Fatalf("reading %s: %v", buildStartEnv, err)
+	}
+	got, err := strconv.ParseInt(string(content), 10, 64)
+	if err != nil {
+		t.Fatalf("parsing %s %q: %v", buildStartEnv, content, err)
+	}
+	if got < before || got > time.Now().Unix() {
+		t.Errorf("%s got=%d, want the start of the build at or after %d", buildStartEnv, got, before)
+	}
+}
+
+func TestBuildDeadlineExceededBetweenCommands(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "build-deadline-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(outDir)
+	os.Setenv(builderOutputEnv, outDir)
+	defer os.Unsetenv(builderOutputEnv)
+	os.Setenv(env.BuildTimeout, "100ms")
+	defer os.Unsetenv(env.BuildTimeout)
+
+	_, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+
+	exited := make(chan int, 1)
+	oldExit := exit
+	exit = func(code int) {
+		exited <- code
+		select {}
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	go build(func(ctx *Context) error {
+		time.Sleep(300 * time.Millisecond)
+		ctx.Exec([]string{"echo", "too late"})
+		t.Error("command ran after the build deadline was exceeded")
+		return nil
+	})
+
+	select {
+	case code := <-exited:
+		if code == 0 {
+			t.Errorf("exit code got=0, want non-zero")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("build did not exit after exceeding the deadline")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(outDir, builderOutputFilename()))
+	if err != nil {
+		t.Fatalf("reading builder output: %v", err)
+	}
+	var got builderOutput
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("unmarshalling builder output: %v", err)
+	}
+	if got.Error.Status != StatusDeadlineExceeded {
+		t.Errorf("error status got=%s want=%s", got.Error.Status, StatusDeadlineExceeded)
+	}
+	if want := `while running "echo too late"`; !strings.Contains(got.Error.Message, want) {
+		t.Errorf("error message %q does not contain %q", got.Error.Message, want)
+	}
+}
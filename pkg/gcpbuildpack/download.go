@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+const (
+	// downloadRetries is the number of times a failed download is retried, like `curl --retry 3`.
+	downloadRetries = 3
+	downloadBackoff = time.Second
+	// maxRedirects is the number of redirects followed, like the default of net/http.
+	maxRedirects = 10
+)
+
+// allowlistClient is an HTTP client that checks every redirect target against GOOGLE_DOWNLOAD_ALLOWLIST.
+var allowlistClient = &http.Client{CheckRedirect: checkRedirectAllowed}
+
+// Downloader fetches the contents of URLs. Tests can replace the default implementation with SetDownloader.
+type Downloader interface {
+	// Download writes the contents of url to the file dest.
+	Download(url, dest string) error
+}
+
+// Download writes the contents of url to the file dest, creating or truncating it. Redirects are followed and
+// transient failures are retried.
+// The hosts of url and of any redirects must be allowed by GOOGLE_DOWNLOAD_ALLOWLIST, if it is set.
+func (ctx *Context) Download(url, dest string) error {
+	if err := checkDownloadAllowed(url); err != nil {
+		return err
+	}
+	ctx.Debugf("Downloading %s to %s", url, dest)
+	return ctx.downloader.Download(url, dest)
+}
+
+// DownloadString returns the contents of url, like Download.
+func (ctx *Context) DownloadString(url string) (string, error) {
+	tmp := ctx.TempDir("", "download")
+	defer ctx.RemoveAll(tmp)
+	dest := filepath.Join(tmp, "contents")
+	if err := ctx.Download(url, dest); err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(dest)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %v", dest, err)
+	}
+	return string(b), nil
+}
+
+// DownloadAndExtract downloads the tarball at url, like Download, and extracts it into dir with tar, which detects the
+// compression. Additional tar arguments, such as --strip-components=1, are passed to it.
+func (ctx *Context) DownloadAndExtract(url, dir string, tarArgs ...string) error {
+	tmp := ctx.TempDir("", "download")
+	defer ctx.RemoveAll(tmp)
+	archive := filepath.Join(tmp, path.Base(url))
+	if err := ctx.Download(url, archive); err != nil {
+		return err
+	}
+	ctx.Exec(append([]string{"tar", "xf", archive, "--directory", dir}, tarArgs...), WithUserAttribution)
+	return nil
+}
+
+// DownloadErrorf returns the error of a failed download, with the formatted message followed by err. The failure is
+// attributed to the user if err is, such as for a URL that does not exist or a host blocked by
+// GOOGLE_DOWNLOAD_ALLOWLIST, and is an internal error otherwise.
+func DownloadErrorf(err error, format string, args ...interface{}) *Error {
+	msg := fmt.Sprintf(format, args...)
+	var be *Error
+	if errors.As(err, &be) {
+		return Errorf(be.Status, "%s: %s", msg, be.Message)
+	}
+	return InternalErrorf("%s: %v", msg, err)
+}
+
+// checkRedirectAllowed implements http.Client.CheckRedirect, so that a redirect cannot leave the hosts allowed by
+// GOOGLE_DOWNLOAD_ALLOWLIST.
+func checkRedirectAllowed(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := checkDownloadAllowed(req.URL.String()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkDownloadAllowed returns a user error naming the host of rawURL if GOOGLE_DOWNLOAD_ALLOWLIST is set and none of
+// its patterns match the host.
+func checkDownloadAllowed(rawURL string) *Error {
+	allowlist := os.Getenv(env.DownloadAllowlist)
+	if allowlist == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return UserErrorf("parsing download URL %q: %v", rawURL, err)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range strings.Split(allowlist, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		match, err := path.Match(pattern, host)
+		if err != nil {
+			return UserErrorf("invalid host pattern %q in %s: %v", pattern, env.DownloadAllowlist, err)
+		}
+		if match {
+			return nil
+		}
+	}
+	return UserErrorf("download of %s blocked: host %q is not allowed by %s=%s", rawURL, host, env.DownloadAllowlist, allowlist)
+}
+
+// SetDownloader replaces the Downloader used by Download, for example with a FakeDownloader in tests.
+func (ctx *Context) SetDownloader(d Downloader) {
+	ctx.downloader = d
+}
+
+// httpDownloader is the default Downloader.
+type httpDownloader struct {
+	client  *http.Client
+	backoff time.Duration
+}
+
+func (d httpDownloader) Download(url, dest string) error {
+	var err error
+	for attempt := 0; attempt <= downloadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.backoff)
+		}
+		var retry bool
+		if retry, err = d.get(url, dest); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// get downloads url to dest once, returning whether the error is transient.
+func (d httpDownloader) get(url, dest string) (bool, error) {
+	resp, err := d.client.Get(url)
+	if err != nil {
+		var blocked *Error
+		if errors.As(err, &blocked) {
+			return false, blocked
+		}
+		return true, fmt.Errorf("fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		// The URL is derived from the requested version, which likely does not exist.
+		return false, UserErrorf("fetching %s: %s", url, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return false, fmt.Errorf("creating %s: %v", dest, err)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return true, fmt.Errorf("reading %s: %v", url, err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("writing %s: %v", dest, err)
+	}
+	return false, nil
+}
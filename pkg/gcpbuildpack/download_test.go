@@ -0,0 +1,301 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestHTTPDownloader(t *testing.T) {
+	testCases := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantUser     bool
+		wantRequests int
+	}{
+		{
+			name:         "ok",
+			statuses:     []int{http.StatusOK},
+			wantRequests: 1,
+		},
+		{
+			name:         "retries server errors",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "gives up after retries",
+			statuses:     []int{http.StatusInternalServerError},
+			wantErr:      true,
+			wantRequests: downloadRetries + 1,
+		},
+		{
+			name:         "not found",
+			statuses:     []int{http.StatusNotFound},
+			wantErr:      true,
+			wantUser:     true,
+			wantRequests: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[len(tc.statuses)-1]
+				if requests < len(tc.statuses) {
+					status = tc.statuses[requests]
+				}
+				requests++
+				w.WriteHeader(status)
+				w.Write([]byte("content"))
+			}))
+			defer server.Close()
+			dir, err := ioutil.TempDir("", "download-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			dest := filepath.Join(dir, "file")
+
+			err = httpDownloader{client: server.Client()}.Download(server.URL, dest)
+
+			if got := err != nil; got != tc.wantErr {
+				t.Errorf("Download() got error: %v, want error: %t", err, tc.wantErr)
+			}
+			if requests != tc.wantRequests {
+				t.Errorf("Download() made %d requests, want %d", requests, tc.wantRequests)
+			}
+			if tc.wantErr {
+				if got := DownloadErrorf(err, "downloading").Status == StatusUnknown; got != tc.wantUser {
+					t.Errorf("Download() got error %v attributed to the user: %t, want %t", err, got, tc.wantUser)
+				}
+				return
+			}
+			got, err := ioutil.ReadFile(dest)
+			if err != nil {
+				t.Fatalf("reading %s: %v", dest, err)
+			}
+			if string(got) != "content" {
+				t.Errorf("Download() wrote %q, want %q", got, "content")
+			}
+		})
+	}
+}
+
+func TestDownloadWithFake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+	ctx.SetDownloader(FakeDownloader{"https://example.com/a.tar.gz": []byte("archive")})
+	dest := filepath.Join(dir, "a.tar.gz")
+
+	if err := ctx.Download("https://example.com/a.tar.gz", dest); err != nil {
+		t.Fatalf("Download() got error: %v", err)
+	}
+	if got, err := ioutil.ReadFile(dest); err != nil || string(got) != "archive" {
+		t.Errorf("Download() wrote %q (error: %v), want %q", got, err, "archive")
+	}
+	if err := ctx.Download("https://example.com/missing.tar.gz", dest); err == nil {
+		t.Error("Download() of a missing URL got nil error, want error")
+	}
+}
+
+func TestCheckDownloadAllowed(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allowlist string
+		url       string
+		wantErr   string
+	}{
+		{
+			name: "no allowlist",
+			url:  "https://mirror.example.net/a.tar.gz",
+		},
+		{
+			name:      "exact host",
+			allowlist: "nodejs.org, storage.googleapis.com",
+			url:       "https://storage.googleapis.com/bucket/a.tar.gz",
+		},
+		{
+			name:      "wildcard host with port",
+			allowlist: "*.googleapis.com",
+			url:       "https://dl.googleapis.com:443/a.tar.gz",
+		},
+		{
+			name:      "case insensitive",
+			allowlist: "NodeJS.org",
+			url:       "https://nodejs.ORG/dist/index.json",
+		},
+		{
+			name:      "blocked host",
+			allowlist: "*.googleapis.com",
+			url:       "https://mirror.example.net/a.tar.gz",
+			wantErr:   `host "mirror.example.net" is not allowed`,
+		},
+		{
+			name:      "suffix is not a match",
+			allowlist: "googleapis.com",
+			url:       "https://evilgoogleapis.com/a.tar.gz",
+			wantErr:   `host "evilgoogleapis.com" is not allowed`,
+		},
+		{
+			name:      "invalid pattern",
+			allowlist: "[",
+			url:       "https://nodejs.org/",
+			wantErr:   "invalid host pattern",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.allowlist != "" {
+				os.Setenv(env.DownloadAllowlist, tc.allowlist)
+				defer os.Unsetenv(env.DownloadAllowlist)
+			}
+
+			err := checkDownloadAllowed(tc.url)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkDownloadAllowed(%q) got error: %v", tc.url, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Message, tc.wantErr) {
+				t.Errorf("checkDownloadAllowed(%q) got error %v, want error containing %q", tc.url, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadBlocked(t *testing.T) {
+	os.Setenv(env.DownloadAllowlist, "allowed.example.com")
+	defer os.Unsetenv(env.DownloadAllowlist)
+	ctx := NewContextForTests(buildpack.Info{}, "")
+	ctx.SetDownloader(FakeDownloader{"https://blocked.example.com/a.tar.gz": []byte("archive")})
+
+	if err := ctx.Download("https://blocked.example.com/a.tar.gz", "a.tar.gz"); err == nil {
+		t.Error("Download() from a blocked host got nil error, want error")
+	}
+}
+
+func TestDownloadErrorf(t *testing.T) {
+	testCases := []struct {
+		name        string
+		err         error
+		wantStatus  Status
+		wantMessage string
+	}{
+		{
+			name:        "user error",
+			err:         UserErrorf("fetching https://example.com/go1.99.tar.gz: 404 Not Found"),
+			wantStatus:  StatusUnknown,
+			wantMessage: "downloading Go v1.99: fetching https://example.com/go1.99.tar.gz: 404 Not Found",
+		},
+		{
+			name:        "other error",
+			err:         fmt.Errorf("fetching https://example.com/go1.99.tar.gz: 503 Service Unavailable"),
+			wantStatus:  StatusInternal,
+			wantMessage: "downloading Go v1.99: fetching https://example.com/go1.99.tar.gz: 503 Service Unavailable",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DownloadErrorf(tc.err, "downloading Go v%s", "1.99")
+			if got.Status != tc.wantStatus {
+				t.Errorf("DownloadErrorf() status = %v, want %v", got.Status, tc.wantStatus)
+			}
+			if got.Message != tc.wantMessage {
+				t.Errorf("DownloadErrorf() message = %q, want %q", got.Message, tc.wantMessage)
+			}
+		})
+	}
+}
+
+func TestHTTPDownloaderRedirect(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allowlist string
+		wantErr   bool
+	}{
+		{
+			name: "no allowlist",
+		},
+		{
+			name:      "redirect to allowed host",
+			allowlist: "127.0.0.1,localhost",
+		},
+		{
+			name:      "redirect to blocked host",
+			allowlist: "127.0.0.1",
+			wantErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("content"))
+			}))
+			defer target.Close()
+			// The redirect leaves 127.0.0.1, which both servers listen on, for localhost.
+			redirect := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+			server := httptest.NewServer(http.RedirectHandler(redirect, http.StatusFound))
+			defer server.Close()
+			if tc.allowlist != "" {
+				os.Setenv(env.DownloadAllowlist, tc.allowlist)
+				defer os.Unsetenv(env.DownloadAllowlist)
+			}
+			dir, err := ioutil.TempDir("", "download-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			err = httpDownloader{client: allowlistClient}.Download(server.URL, filepath.Join(dir, "file"))
+
+			if got := err != nil; got != tc.wantErr {
+				t.Errorf("Download() got error: %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadString(t *testing.T) {
+	ctx := NewContextForTests(buildpack.Info{}, "")
+	ctx.SetDownloader(FakeDownloader{"https://example.com/latest.version": []byte("1.2.3\n")})
+
+	got, err := ctx.DownloadString("https://example.com/latest.version")
+	if err != nil {
+		t.Fatalf("DownloadString() got error: %v", err)
+	}
+	if got != "1.2.3\n" {
+		t.Errorf("DownloadString() = %q, want %q", got, "1.2.3\n")
+	}
+	if _, err := ctx.DownloadString("https://example.com/missing.version"); err == nil {
+		t.Error("DownloadString() of a missing URL got nil error, want error")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+)
+
+const (
+	// SourceDefault is the Source of a Setting that was not configured.
+	SourceDefault = "default"
+)
+
+// Setting is a value that a buildpack resolved from its configuration, such as the runtime version or install flags.
+type Setting struct {
+	// Name describes the setting, for example "install command".
+	Name string
+	// Value is the resolved value of the setting.
+	Value string
+	// Source is where the value comes from, such as an env var or a file, or SourceDefault.
+	Source string
+}
+
+// EnvSetting returns a Setting with the given name and resolved value, whose source is the env var envVar if it is
+// set, or SourceDefault otherwise.
+func EnvSetting(name, envVar, value string) Setting {
+	if os.Getenv(envVar) == "" {
+		return Setting{Name: name, Value: value, Source: SourceDefault}
+	}
+	return Setting{Name: name, Value: value, Source: envVar}
+}
+
+// LogEffectiveConfig logs the settings that the buildpack resolved as a single block, so that users can see the
+// effect of their configuration. Call it once the settings are known, before installing anything.
+func (ctx *Context) LogEffectiveConfig(settings ...Setting) {
+	if len(settings) == 0 {
+		return
+	}
+	ctx.Logf("Effective configuration:")
+	for _, s := range settings {
+		value := s.Value
+		if value == "" {
+			value = "(none)"
+		}
+		switch s.Source {
+		case "":
+			ctx.Logf("  %s: %s", s.Name, value)
+		case SourceDefault:
+			ctx.Logf("  %s: %s (default)", s.Name, value)
+		default:
+			ctx.Logf("  %s: %s (from %s)", s.Name, value, s.Source)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestEnvSetting(t *testing.T) {
+	defer os.Unsetenv("GOOGLE_TEST_SETTING")
+
+	if got, want := EnvSetting("flag", "GOOGLE_TEST_SETTING", "a"), (Setting{Name: "flag", Value: "a", Source: SourceDefault}); got != want {
+		t.Errorf("EnvSetting() with env var unset = %+v, want %+v", got, want)
+	}
+	os.Setenv("GOOGLE_TEST_SETTING", "b")
+	if got, want := EnvSetting("flag", "GOOGLE_TEST_SETTING", "b"), (Setting{Name: "flag", Value: "b", Source: "GOOGLE_TEST_SETTING"}); got != want {
+		t.Errorf("EnvSetting() with env var set = %+v, want %+v", got, want)
+	}
+}
+
+func TestLogEffectiveConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings []Setting
+		want     string
+	}{
+		{
+			name: "no settings",
+		},
+		{
+			name: "settings",
+			settings: []Setting{
+				{Name: "runtime version", Value: "14.4.0", Source: "package.json"},
+				{Name: "install flags", Source: SourceDefault},
+				{Name: "package manager", Value: "npm"},
+			},
+			want: "Effective configuration:\n" +
+				"  runtime version: 14.4.0 (from package.json)\n" +
+				"  install flags: (none) (default)\n" +
+				"  package manager: npm\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer func(l *log.Logger) { logger = l }(logger)
+			logger = log.New(&buf, "", 0)
+
+			NewContextForTests(buildpack.Info{}, "").LogEffectiveConfig(tc.settings...)
+
+			if got := buf.String(); got != tc.want {
+				t.Errorf("LogEffectiveConfig() logged %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -16,18 +16,44 @@ package gcpbuildpack
 
 import (
 	"os"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
+// RequireEnv returns a user error listing all of the given env vars that are not set or are empty.
+func (ctx *Context) RequireEnv(names ...string) error {
+	if err := requireEnv(names...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// requireEnv implements RequireEnv, returning nil rather than a nil *Error in an error interface.
+func requireEnv(names ...string) *Error {
+	var missing []string
+	for _, name := range names {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return UserErrorf("required env var %s not found", missing[0])
+	}
+	return UserErrorf("required env vars %s not found", strings.Join(missing, ", "))
+}
+
 // SetFunctionsEnvVars sets launch-time functions environment variables.
 func (ctx *Context) SetFunctionsEnvVars(l *layers.Layer) {
-	if target := os.Getenv(env.FunctionTarget); target != "" {
-		ctx.DefaultLaunchEnv(l, env.FunctionTargetLaunch, target)
-	} else {
+	target, _ := env.FunctionTargetResolved(ctx)
+	if target == "" {
 		ctx.Exit(1, UserErrorf("required env var %s not found", env.FunctionTarget))
 	}
+	ctx.DefaultLaunchEnv(l, env.FunctionTargetLaunch, target)
 
 	if signature, ok := os.LookupEnv(env.FunctionSignatureType); ok {
 		ctx.DefaultLaunchEnv(l, env.FunctionSignatureTypeLaunch, signature)
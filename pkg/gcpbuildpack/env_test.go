@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestRequireEnv(t *testing.T) {
+	os.Setenv("REQUIRE_ENV_TEST_SET", "value")
+	defer os.Unsetenv("REQUIRE_ENV_TEST_SET")
+	os.Setenv("REQUIRE_ENV_TEST_EMPTY", "")
+	defer os.Unsetenv("REQUIRE_ENV_TEST_EMPTY")
+
+	testCases := []struct {
+		name    string
+		names   []string
+		wantErr string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "set",
+			names: []string{"REQUIRE_ENV_TEST_SET"},
+		},
+		{
+			name:    "one missing",
+			names:   []string{"REQUIRE_ENV_TEST_SET", "REQUIRE_ENV_TEST_UNSET"},
+			wantErr: "required env var REQUIRE_ENV_TEST_UNSET not found",
+		},
+		{
+			name:    "all missing listed",
+			names:   []string{"REQUIRE_ENV_TEST_UNSET", "REQUIRE_ENV_TEST_SET", "REQUIRE_ENV_TEST_EMPTY"},
+			wantErr: "required env vars REQUIRE_ENV_TEST_UNSET, REQUIRE_ENV_TEST_EMPTY not found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := NewContextForTests(buildpack.Info{}, "")
+
+			err := ctx.RequireEnv(tc.names...)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("RequireEnv(%v) got error: %v", tc.names, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("RequireEnv(%v) got no error, want %q", tc.names, tc.wantErr)
+			}
+			be, ok := err.(*Error)
+			if !ok || be.Status != StatusUnknown {
+				t.Fatalf("RequireEnv(%v) = %v, want user error", tc.names, err)
+			}
+			if be.Message != tc.wantErr {
+				t.Errorf("RequireEnv(%v) message = %q, want %q", tc.names, be.Message, tc.wantErr)
+			}
+		})
+	}
+}
@@ -16,17 +16,23 @@ package gcpbuildpack
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 var (
 	divider = strings.Repeat("—", 80)
+
+	// allowlistBaseEnv are the variables always inherited when the environment is restricted with WithEnvAllowlist.
+	allowlistBaseEnv = []string{"HOME", "PATH", "TMPDIR"}
 )
 
 // ExecResult bundles exec results.
@@ -37,14 +43,34 @@ type ExecResult struct {
 	Combined string
 }
 
+// ResourceUsage is the CPU time and memory used by a command, as reported by wait4.
+type ResourceUsage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSSBytes is the peak resident set size of the command, or of the largest descendant process it waited for.
+	MaxRSSBytes int64
+}
+
 type execParams struct {
-	cmd []string
-	dir string
-	env []string
+	cmd          []string
+	dir          string
+	env          []string
+	envAllowlist []string
 
 	userFailure     bool
 	userTiming      bool
 	messageProducer MessageProducer
+	secretArgs      []int
+	duration        *time.Duration
+	resourceUsage   *ResourceUsage
+	sandbox         bool
+	pty             bool
+	// ignoreDeadline runs the command even if the build deadline was exceeded, without terminating it.
+	ignoreDeadline bool
+	timeout        time.Duration
+	// streamStdout and streamStderr receive the output of the command as it is written, if set.
+	streamStdout io.Writer
+	streamStderr io.Writer
 }
 
 type execOption func(o *execParams)
@@ -56,6 +82,14 @@ func WithEnv(env ...string) execOption {
 	}
 }
 
+// WithEnvAllowlist restricts the inherited environment to variables whose names start with one of the given prefixes,
+// plus HOME, PATH and TMPDIR. Variables set with WithEnv are always passed.
+func WithEnvAllowlist(prefixes ...string) execOption {
+	return func(o *execParams) {
+		o.envAllowlist = append(append(o.envAllowlist, allowlistBaseEnv...), prefixes...)
+	}
+}
+
 // WithWorkDir sets a specific working directory.
 func WithWorkDir(dir string) execOption {
 	return func(o *execParams) {
@@ -63,6 +97,67 @@ func WithWorkDir(dir string) execOption {
 	}
 }
 
+// WithSandbox runs the command with HOME and TMPDIR set to a throwaway directory, which is removed when the command
+// exits, and in the application root unless WithWorkDir is set. Use it for user scripts so that they cannot modify the
+// home directory, and any caches in it, shared by later build steps.
+var WithSandbox = func(o *execParams) {
+	o.sandbox = true
+}
+
+// WithPTY runs the command with a pseudo-terminal as its standard streams, for tools that hang, prompt, or do not
+// render progress output when they detect they are not run interactively. All output is captured as both Stdout and
+// Combined, with line endings normalized to \n, and Stderr is empty.
+var WithPTY = func(o *execParams) {
+	o.pty = true
+}
+
+// withoutDeadline runs the command even if the build deadline was exceeded, for reporting the timeout.
+var withoutDeadline = func(o *execParams) {
+	o.ignoreDeadline = true
+}
+
+// WithTimeout terminates the command, with any processes it started, if it runs for longer than d, for example to
+// fail fast with a clear error when a dependency resolver hangs on an unreachable repository. The error names the
+// command and the timeout. Its status is StatusDeadlineExceeded if failure is attributed to the user, and
+// StatusInternal otherwise.
+func WithTimeout(d time.Duration) execOption {
+	return func(o *execParams) {
+		o.timeout = d
+	}
+}
+
+// WithStreamingOutput copies the stdout and stderr of the command to the given writers as it is written, for example
+// to report the progress of a slow install, in addition to capturing it in the ExecResult. Either writer may be nil,
+// and both may be the same writer. Errors writing to them are ignored. With WithPTY, all output is copied to stdout.
+func WithStreamingOutput(stdout, stderr io.Writer) execOption {
+	return func(o *execParams) {
+		o.streamStdout = stdout
+		o.streamStderr = stderr
+	}
+}
+
+// WithSecretArgs redacts the arguments at the given indices of the command (0 is the executable) from logs.
+func WithSecretArgs(indices ...int) execOption {
+	return func(o *execParams) {
+		o.secretArgs = append(o.secretArgs, indices...)
+	}
+}
+
+// WithDurationTo stores the wall-clock duration of the command in d, whether or not it succeeds.
+func WithDurationTo(d *time.Duration) execOption {
+	return func(o *execParams) {
+		o.duration = d
+	}
+}
+
+// WithResourceUsageTo stores the CPU time and peak memory used by the command in u, whether or not it succeeds, for
+// example to identify steps that risk running out of memory. u is left unchanged if the command could not be started.
+func WithResourceUsageTo(u *ResourceUsage) execOption {
+	return func(o *execParams) {
+		o.resourceUsage = u
+	}
+}
+
 // WithUserAttribution indicates that failure and timing both are attributed to the user.
 var WithUserAttribution = func(o *execParams) {
 	o.userFailure = true
@@ -95,6 +190,11 @@ var WithCombinedHead = WithMessageProducer(KeepCombinedHead)
 // WithStderrTail keeps the tail of stderr for the error message.
 var WithStderrTail = WithMessageProducer(KeepStderrTail)
 
+// WithStderrTailLines keeps the last n complete lines of stderr for the error message, such as the end of a traceback.
+func WithStderrTailLines(n int) execOption {
+	return WithMessageProducer(KeepStderrTailLines(n))
+}
+
 // WithStderrHead keeps the head of stderr for the error message.
 var WithStderrHead = WithMessageProducer(KeepStderrHead)
 
@@ -126,8 +226,12 @@ func (ctx *Context) ExecWithErr(cmd []string, opts ...execOption) (*ExecResult,
 
 	result, err := ctx.configuredExec(params)
 
+	elapsed := time.Since(start)
 	if params.userTiming {
-		ctx.stats.user += time.Since(start)
+		ctx.stats.user += elapsed
+	}
+	if params.duration != nil {
+		*params.duration = elapsed
 	}
 
 	if err == nil {
@@ -135,8 +239,19 @@ func (ctx *Context) ExecWithErr(cmd []string, opts ...execOption) (*ExecResult,
 	}
 
 	var be *Error
+	var te *timeoutError
 	if result == nil {
 		be = Errorf(StatusInternal, err.Error())
+	} else if errors.As(err, &te) {
+		status := StatusInternal
+		if params.userFailure {
+			status = StatusDeadlineExceeded
+		}
+		message := te.Error()
+		if output := params.messageProducer(result); output != "" {
+			message += ": " + output
+		}
+		be = Errorf(status, "%s", message)
 	} else {
 		message := params.messageProducer(result)
 		if params.userFailure {
@@ -149,6 +264,30 @@ func (ctx *Context) ExecWithErr(cmd []string, opts ...execOption) (*ExecResult,
 	return result, be
 }
 
+// ExecExpect runs the given command like ExecWithErr, additionally returning an error if the command succeeds but its
+// combined stdout/stderr does not contain want.
+func (ctx *Context) ExecExpect(cmd []string, want string, opts ...execOption) (*ExecResult, *Error) {
+	result, err := ctx.ExecWithErr(cmd, opts...)
+	if err != nil {
+		return result, err
+	}
+	if strings.Contains(result.Combined, want) {
+		return result, nil
+	}
+
+	params := execParams{}
+	for _, o := range opts {
+		o(&params)
+	}
+	status := StatusInternal
+	if params.userFailure {
+		status = StatusUnknown
+	}
+	be := Errorf(status, "output of %q does not contain %q: %s", strings.Join(redactArgs(cmd, params.secretArgs), " "), want, keepTail(result.Combined))
+	be.ID = generateErrorID(cmd...)
+	return result, be
+}
+
 func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 	if len(params.cmd) < 1 {
 		return nil, fmt.Errorf("no command provided")
@@ -170,7 +309,8 @@ func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 		ctx.Logf(format, args...)
 	}
 
-	readableCmd := strings.Join(params.cmd, " ")
+	displayCmd := redactArgs(params.cmd, params.secretArgs)
+	readableCmd := strings.Join(displayCmd, " ")
 	if len(params.env) > 0 {
 		env := strings.Join(params.env, " ")
 		readableCmd = fmt.Sprintf("%s (%s)", readableCmd, env)
@@ -178,6 +318,29 @@ func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 	optionalLogf(divider)
 	optionalLogf("Running %q", readableCmd)
 
+	if params.sandbox {
+		if params.dir == "" {
+			params.dir = ctx.ApplicationRoot()
+		}
+		home, err := ioutil.TempDir("", "sandbox-")
+		if err != nil {
+			return nil, fmt.Errorf("creating sandbox home: %v", err)
+		}
+		defer os.RemoveAll(home)
+		ctx.Debugf("Sandbox home %q", home)
+		params.env = append(append([]string(nil), params.env...), "HOME="+home, "TMPDIR="+home)
+	}
+
+	if ctx.debug {
+		dir := params.dir
+		if dir == "" {
+			if wd, err := os.Getwd(); err == nil {
+				dir = wd
+			}
+		}
+		ctx.Debugf("Exec argv=%q dir=%q", displayCmd, dir)
+	}
+
 	status := StatusInternal
 	defer func(start time.Time) {
 		truncated := readableCmd
@@ -185,26 +348,53 @@ func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 			truncated = truncated[:60] + "..."
 		}
 		optionalLogf("Done %q (%v)", truncated, time.Since(start))
-		ctx.Span(ctx.createSpanName(params.cmd), start, status)
+		ctx.Span(ctx.createSpanName(displayCmd), start, status)
 	}(time.Now())
 
 	exitCode := 0
-	ecmd := exec.Command(params.cmd[0], params.cmd[1:]...)
+	cctx, cancel := ctx.commandContext(params.ignoreDeadline, params.timeout)
+	defer cancel()
+	ecmd := exec.CommandContext(cctx, params.cmd[0], params.cmd[1:]...)
 
 	if params.dir != "" {
 		ecmd.Dir = params.dir
 	}
 
-	if len(params.env) > 0 {
-		ecmd.Env = append(os.Environ(), params.env...)
+	if len(params.env) > 0 || params.envAllowlist != nil {
+		ecmd.Env = commandEnv(os.Environ(), params)
 	}
 
 	var outb, errb bytes.Buffer
 	combinedb := lockingBuffer{log: log}
-	ecmd.Stdout = io.MultiWriter(&outb, &combinedb)
-	ecmd.Stderr = io.MultiWriter(&errb, &combinedb)
-
-	if err := ecmd.Run(); err != nil {
+	stdout := []io.Writer{&outb, &combinedb}
+	stderr := []io.Writer{&errb, &combinedb}
+	var streamMu sync.Mutex
+	if params.streamStdout != nil {
+		stdout = append(stdout, streamWriter{w: params.streamStdout, mu: &streamMu})
+	}
+	if params.streamStderr != nil {
+		stderr = append(stderr, streamWriter{w: params.streamStderr, mu: &streamMu})
+	}
+	var err error
+	var timedOut bool
+	if params.pty {
+		timedOut, err = ctx.runWithPTY(ecmd, readableCmd, params.ignoreDeadline, cctx, io.MultiWriter(stdout...))
+	} else {
+		ecmd.Stdout = io.MultiWriter(stdout...)
+		ecmd.Stderr = io.MultiWriter(stderr...)
+		if err = ctx.startCommand(ecmd, readableCmd, params.ignoreDeadline); err == nil {
+			timedOut, err = ctx.waitCommand(ecmd, readableCmd, params.ignoreDeadline, cctx)
+		}
+	}
+	if ecmd.ProcessState != nil {
+		usage := processUsage(ecmd.ProcessState)
+		ctx.stats.recordUsage(usage)
+		if params.resourceUsage != nil {
+			*params.resourceUsage = usage
+		}
+		ctx.Debugf("Resource usage of %q: user %v, system %v, max RSS %d bytes", readableCmd, usage.UserTime, usage.SystemTime, usage.MaxRSSBytes)
+	}
+	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
 			// The command returned a non-zero result.
 			exitCode = ee.ExitCode()
@@ -219,7 +409,16 @@ func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 		Stderr:   strings.TrimSpace(string(errb.Bytes())),
 		Combined: strings.TrimSpace(string(combinedb.Bytes())),
 	}
+	if params.pty {
+		// Terminals translate \n in output to \r\n.
+		result.Stdout = strings.ReplaceAll(result.Stdout, "\r\n", "\n")
+		result.Combined = strings.ReplaceAll(result.Combined, "\r\n", "\n")
+	}
 
+	if timedOut {
+		status = StatusDeadlineExceeded
+		return result, &timeoutError{cmd: readableCmd, timeout: params.timeout}
+	}
 	if exitCode != 0 {
 		return result, fmt.Errorf("executing command %q: exit code %d", readableCmd, exitCode)
 	}
@@ -228,6 +427,70 @@ func (ctx *Context) configuredExec(params execParams) (*ExecResult, error) {
 	return result, nil
 }
 
+// timeoutError is the error of a command terminated by WithTimeout.
+type timeoutError struct {
+	cmd     string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("command %q timed out after %v", e.cmd, e.timeout)
+}
+
+// processUsage returns the resource usage of an exited process.
+func processUsage(ps *os.ProcessState) ResourceUsage {
+	u := ResourceUsage{UserTime: ps.UserTime(), SystemTime: ps.SystemTime()}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		// Linux reports the maximum resident set size in kilobytes.
+		u.MaxRSSBytes = ru.Maxrss * 1024
+	}
+	return u
+}
+
+// commandEnv returns the environment for a command, filtering the parent environment by the allowlist if one is set.
+func commandEnv(environ []string, params execParams) []string {
+	if params.envAllowlist == nil {
+		return append(environ, params.env...)
+	}
+	var env []string
+	for _, e := range environ {
+		name := strings.SplitN(e, "=", 2)[0]
+		for _, prefix := range params.envAllowlist {
+			if strings.HasPrefix(name, prefix) {
+				env = append(env, e)
+				break
+			}
+		}
+	}
+	return append(env, params.env...)
+}
+
+// redactArgs returns a copy of cmd with the arguments at the given indices replaced by a placeholder.
+func redactArgs(cmd []string, indices []int) []string {
+	redacted := append([]string(nil), cmd...)
+	for _, i := range indices {
+		if i >= 0 && i < len(redacted) {
+			redacted[i] = "[REDACTED]"
+		}
+	}
+	return redacted
+}
+
+// streamWriter copies output to a writer set by WithStreamingOutput. The writers of the stdout and stderr of a command
+// share mu, so that the same writer can be used for both.
+type streamWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+// Write implements io.Writer, ignoring errors so that a failing writer does not interrupt the command.
+func (s streamWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(p)
+	return len(p), nil
+}
+
 type lockingBuffer struct {
 	buf bytes.Buffer
 	sync.Mutex
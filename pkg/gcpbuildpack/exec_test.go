@@ -15,10 +15,16 @@
 package gcpbuildpack
 
 import (
+	"bytes"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestExecEmitsSpan(t *testing.T) {
@@ -65,6 +71,60 @@ func TestExecInvokesCommand(t *testing.T) {
 	}
 }
 
+func TestExecExpect(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cmd        string
+		want       string
+		opts       []execOption
+		wantErr    bool
+		wantStatus Status
+	}{
+		{
+			name: "output contains want",
+			cmd:  "echo /usr/bin/yarn",
+			want: "yarn",
+		},
+		{
+			name:       "output missing want",
+			cmd:        "echo /usr/bin/npm",
+			want:       "yarn",
+			wantErr:    true,
+			wantStatus: StatusInternal,
+		},
+		{
+			name:       "output missing want attributed to user",
+			cmd:        "echo /usr/bin/npm",
+			want:       "yarn",
+			opts:       []execOption{WithUserAttribution},
+			wantErr:    true,
+			wantStatus: StatusUnknown,
+		},
+		{
+			name:       "command fails",
+			cmd:        "false yarn",
+			want:       "yarn",
+			wantErr:    true,
+			wantStatus: StatusInternal,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cleanUp := simpleContext(t)
+			defer cleanUp()
+
+			_, err := ctx.ExecExpect(strings.Fields(tc.cmd), tc.want, tc.opts...)
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExecExpect(%q, %q) got error %v, want error %t", tc.cmd, tc.want, err, tc.wantErr)
+			}
+			if err != nil && err.Status != tc.wantStatus {
+				t.Errorf("ExecExpect(%q, %q) got status %v, want %v", tc.cmd, tc.want, err.Status, tc.wantStatus)
+			}
+		})
+	}
+}
+
 func TestExecResult(t *testing.T) {
 	cmd := []string{"/bin/bash", "-f", "-c", "printf 'stdout'; printf 'stderr' >&2"}
 	ctx, cleanUp := simpleContext(t)
@@ -300,6 +360,370 @@ func TestExecWithWorkDir(t *testing.T) {
 	}
 }
 
+func TestExecWithSecretArgs(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	result := ctx.Exec([]string{"echo", "--token", "s3cr3t"}, WithSecretArgs(2))
+
+	if got, want := result.Stdout, "--token s3cr3t"; got != want {
+		t.Errorf("incorrect output got=%q want=%q", got, want)
+	}
+	if len(ctx.stats.spans) != 1 {
+		t.Fatalf("Unexpected number of spans, got %d want 1", len(ctx.stats.spans))
+	}
+	if got, want := ctx.stats.spans[0].name, `Exec "echo --token [REDACTED]"`; got != want {
+		t.Errorf("incorrect span name got=%q want=%q", got, want)
+	}
+}
+
+func TestExecWithSandbox(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+	root, err := ioutil.TempDir("", "sandbox-root-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	ctx.applicationRoot = root
+
+	result := ctx.Exec([]string{"/bin/bash", "-c", "touch $HOME/file && echo $HOME $TMPDIR $PWD"}, WithSandbox)
+
+	fields := strings.Fields(result.Stdout)
+	if len(fields) != 3 {
+		t.Fatalf("unexpected output %q", result.Stdout)
+	}
+	home, tmp, wd := fields[0], fields[1], fields[2]
+	if home == os.Getenv("HOME") {
+		t.Errorf("HOME got=%q, want a sandbox directory", home)
+	}
+	if tmp != home {
+		t.Errorf("TMPDIR got=%q want=%q", tmp, home)
+	}
+	if wd != root {
+		t.Errorf("working dir got=%q want=%q", wd, root)
+	}
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Errorf("sandbox home %q still exists after exec: %v", home, err)
+	}
+}
+
+func TestExecWithPTY(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+	cmd := []string{"/bin/bash", "-c", "if [ -t 0 ] && [ -t 1 ]; then echo tty; else echo pipe; fi; echo err >&2"}
+
+	result := ctx.Exec(cmd, WithPTY)
+
+	if got, want := result.Stdout, "tty\nerr"; got != want {
+		t.Errorf("incorrect output with pty got=%q want=%q", got, want)
+	}
+	if result.Stderr != "" {
+		t.Errorf("incorrect stderr with pty got=%q want empty", result.Stderr)
+	}
+
+	result = ctx.Exec(cmd)
+
+	if got, want := result.Stdout, "pipe"; got != want {
+		t.Errorf("incorrect output without pty got=%q want=%q", got, want)
+	}
+}
+
+func TestExecWithPTYExitCode(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	result, err := ctx.ExecWithErr([]string{"/bin/bash", "-c", "echo failed; exit 3"}, WithPTY)
+
+	if err == nil {
+		t.Fatal("ExecWithErr() got nil error, want error")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("exit code got=%d want=3", result.ExitCode)
+	}
+	if got, want := result.Combined, "failed"; got != want {
+		t.Errorf("incorrect output got=%q want=%q", got, want)
+	}
+}
+
+func TestExecWithDurationTo(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	var d time.Duration
+	ctx.Exec(strings.Fields("sleep .1"), WithDurationTo(&d))
+
+	if d < 100*time.Millisecond {
+		t.Errorf("duration got=%v want>=100ms", d)
+	}
+}
+
+func TestExecWithErrWithDurationToOnFailure(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	var d time.Duration
+	if _, err := ctx.ExecWithErr([]string{"/bin/bash", "-c", "sleep .1; exit 1"}, WithDurationTo(&d)); err == nil {
+		t.Fatal("ExecWithErr() got nil error, want error")
+	}
+
+	if d < 100*time.Millisecond {
+		t.Errorf("duration got=%v want>=100ms", d)
+	}
+}
+
+func TestExecWithTimeout(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []execOption
+		wantStatus Status
+		wantUser   bool
+	}{
+		{name: "default", wantStatus: StatusInternal},
+		{name: "WithUserAttribution", opts: []execOption{WithUserAttribution}, wantStatus: StatusDeadlineExceeded, wantUser: true},
+		{name: "WithPTY", opts: []execOption{WithPTY}, wantStatus: StatusInternal},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cleanUp := simpleContext(t)
+			defer cleanUp()
+			// The background sleep keeps the output open, so the command only finishes early if its process group is killed.
+			cmd := []string{"/bin/bash", "-c", "echo started; sleep 10 & sleep 10"}
+			opts := append([]execOption{WithTimeout(100 * time.Millisecond)}, tc.opts...)
+
+			start := time.Now()
+			result, err := ctx.ExecWithErr(cmd, opts...)
+			elapsed := time.Since(start)
+
+			if err == nil {
+				t.Fatal("ExecWithErr() got nil error, want error")
+			}
+			if elapsed > 5*time.Second {
+				t.Errorf("ExecWithErr() took %v, want the command to be killed after 100ms", elapsed)
+			}
+			if got := err.Status; got != tc.wantStatus {
+				t.Errorf("error status got %v want %v", got, tc.wantStatus)
+			}
+			if want := `timed out after 100ms: started`; !strings.Contains(err.Message, want) {
+				t.Errorf("error message got %q, want it to contain %q", err.Message, want)
+			}
+			if result == nil || result.ExitCode == 0 {
+				t.Errorf("ExecWithErr() got result %v, want non-zero exit code", result)
+			}
+			if gotUser := ctx.stats.user >= 100*time.Millisecond; gotUser != tc.wantUser {
+				t.Errorf("user duration got %v, want counted=%t", ctx.stats.user, tc.wantUser)
+			}
+		})
+	}
+}
+
+func TestExecWithTimeoutNotExceeded(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	result, err := ctx.ExecWithErr([]string{"/bin/bash", "-c", "echo done"}, WithTimeout(10*time.Second))
+
+	if err != nil {
+		t.Fatalf("ExecWithErr() got error: %v", err)
+	}
+	if got, want := result.Stdout, "done"; got != want {
+		t.Errorf("incorrect output got=%q want=%q", got, want)
+	}
+}
+
+// notifyingWriter records the output written to it, closing written on the first write.
+type notifyingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	once    sync.Once
+	written chan struct{}
+}
+
+func (w *notifyingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.once.Do(func() { close(w.written) })
+	return w.buf.Write(p)
+}
+
+func (w *notifyingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestExecWithStreamingOutput(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+	dir, err := ioutil.TempDir("", "streaming-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	proceed := filepath.Join(dir, "proceed")
+	// The command waits for the test to create a file once it has received the first line of output.
+	cmd := []string{"/bin/bash", "-c", "echo first; while [ ! -f " + proceed + " ]; do sleep .01; done; echo last >&2"}
+	stdout := &notifyingWriter{written: make(chan struct{})}
+	stderr := &notifyingWriter{written: make(chan struct{})}
+
+	type execReturn struct {
+		result *ExecResult
+		err    *Error
+	}
+	done := make(chan execReturn, 1)
+	go func() {
+		result, err := ctx.ExecWithErr(cmd, WithStreamingOutput(stdout, stderr))
+		done <- execReturn{result: result, err: err}
+	}()
+	select {
+	case <-stdout.written:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stdout writer received no output before the command exited")
+	}
+	if err := ioutil.WriteFile(proceed, nil, 0644); err != nil {
+		t.Fatalf("writing %s: %v", proceed, err)
+	}
+	got := <-done
+
+	if got.err != nil {
+		t.Fatalf("ExecWithErr() got error: %v", got.err)
+	}
+	if got, want := stdout.String(), "first\n"; got != want {
+		t.Errorf("streamed stdout got=%q want=%q", got, want)
+	}
+	if got, want := stderr.String(), "last\n"; got != want {
+		t.Errorf("streamed stderr got=%q want=%q", got, want)
+	}
+	if got, want := got.result.Combined, "first\nlast"; got != want {
+		t.Errorf("combined output got=%q want=%q", got, want)
+	}
+	if got, want := got.result.Stderr, "last"; got != want {
+		t.Errorf("stderr got=%q want=%q", got, want)
+	}
+}
+
+func TestExecWithStreamingOutputMessageProducer(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+	var out bytes.Buffer
+
+	_, err := ctx.ExecWithErr([]string{"/bin/bash", "-c", "echo progress; echo failed >&2; exit 1"}, WithStreamingOutput(&out, &out), WithStderrTail)
+
+	if err == nil {
+		t.Fatal("ExecWithErr() got nil error, want error")
+	}
+	if got, want := err.Message, "failed"; !strings.Contains(got, want) || strings.Contains(got, "progress") {
+		t.Errorf("error message got=%q, want it to contain %q and not stdout", got, want)
+	}
+	if got := out.String(); !strings.Contains(got, "progress\n") || !strings.Contains(got, "failed\n") {
+		t.Errorf("streamed output got=%q, want both streams", got)
+	}
+}
+
+func TestExecWithResourceUsageTo(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	var u ResourceUsage
+	ctx.Exec([]string{"/bin/bash", "-c", "for i in $(seq 100000); do :; done"}, WithResourceUsageTo(&u))
+
+	if u.UserTime+u.SystemTime <= 0 {
+		t.Errorf("CPU time got=%v want>0", u.UserTime+u.SystemTime)
+	}
+	if u.MaxRSSBytes <= 0 {
+		t.Errorf("MaxRSSBytes got=%d want>0", u.MaxRSSBytes)
+	}
+	if ctx.stats.maxRSSBytes != u.MaxRSSBytes {
+		t.Errorf("stats.maxRSSBytes got=%d want=%d", ctx.stats.maxRSSBytes, u.MaxRSSBytes)
+	}
+}
+
+func TestExecWithErrWithResourceUsageToOnFailure(t *testing.T) {
+	ctx, cleanUp := simpleContext(t)
+	defer cleanUp()
+
+	var u ResourceUsage
+	if _, err := ctx.ExecWithErr([]string{"/bin/bash", "-c", "exit 1"}, WithResourceUsageTo(&u)); err == nil {
+		t.Fatal("ExecWithErr() got nil error, want error")
+	}
+
+	if u.MaxRSSBytes <= 0 {
+		t.Errorf("MaxRSSBytes got=%d want>0", u.MaxRSSBytes)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cmd     []string
+		indices []int
+		want    []string
+	}{
+		{
+			name: "no indices",
+			cmd:  []string{"curl", "-H", "token"},
+			want: []string{"curl", "-H", "token"},
+		},
+		{
+			name:    "single index",
+			cmd:     []string{"curl", "-H", "token"},
+			indices: []int{2},
+			want:    []string{"curl", "-H", "[REDACTED]"},
+		},
+		{
+			name:    "out of range",
+			cmd:     []string{"curl"},
+			indices: []int{-1, 5},
+			want:    []string{"curl"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := redactArgs(tc.cmd, tc.indices)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("redactArgs(%v, %v) = %v, want %v", tc.cmd, tc.indices, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	environ := []string{"PATH=/bin", "GOOGLE_RUNTIME=python", "PIP_INDEX_URL=https://pypi", "SECRET=value"}
+	testCases := []struct {
+		name string
+		opts []execOption
+		want []string
+	}{
+		{
+			name: "inherits everything by default",
+			opts: []execOption{WithEnv("A=b")},
+			want: []string{"PATH=/bin", "GOOGLE_RUNTIME=python", "PIP_INDEX_URL=https://pypi", "SECRET=value", "A=b"},
+		},
+		{
+			name: "allowlist filters by prefix",
+			opts: []execOption{WithEnvAllowlist("GOOGLE_", "PIP_"), WithEnv("A=b")},
+			want: []string{"PATH=/bin", "GOOGLE_RUNTIME=python", "PIP_INDEX_URL=https://pypi", "A=b"},
+		},
+		{
+			name: "empty allowlist keeps base",
+			opts: []execOption{WithEnvAllowlist()},
+			want: []string{"PATH=/bin"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var params execParams
+			for _, o := range tc.opts {
+				o(&params)
+			}
+			got := commandEnv(append([]string(nil), environ...), params)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("commandEnv() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestExecWithMessageProducer(t *testing.T) {
 	ctx, cleanUp := simpleContext(t)
 	defer cleanUp()
@@ -16,8 +16,19 @@ package gcpbuildpack
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+const gitModules = ".gitmodules"
+
+var (
+	// submodulePathRegexp matches the path of each submodule declared in .gitmodules.
+	submodulePathRegexp = regexp.MustCompile(`(?m)^\s*path\s*=\s*(.+?)\s*$`)
 )
 
 // Glob returns the names of all files matching pattern or nil if there is no matching file, exiting on any error.
@@ -59,3 +70,136 @@ func (ctx *Context) HasAtLeastOne(pattern string) bool {
 	}
 	return false
 }
+
+// CheckForCircularSymlinks returns a user error naming the first symlink under root, relative to it, that makes a
+// traversal following symlinks loop: a symlink to a directory containing it, a chain of symlinks pointing back to
+// itself, or symlinked directories leading back to each other. Broken symlinks, symlinks to directories outside of
+// root, and directories that cannot be read are ignored. Run it before commands
+// that follow symlinks in the application, so that the build fails fast instead of hanging.
+func (ctx *Context) CheckForCircularSymlinks(root string) error {
+	link, err := circularSymlink(root)
+	if err != nil {
+		return InternalErrorf("checking for circular symlinks in %s: %v", root, err)
+	}
+	if link == "" {
+		return nil
+	}
+	return UserErrorf("found circular symlink %s, which makes traversing the application loop forever; remove it or make it point to a directory that does not contain it", link)
+}
+
+// circularSymlink returns the path relative to root of the first symlink creating a cycle, or an empty string.
+func circularSymlink(root string) (string, error) {
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	f := symlinkCycleFinder{root: root, realRoot: real, visiting: map[string]bool{}, done: map[string]bool{}}
+	return f.find(real, root)
+}
+
+// symlinkCycleFinder searches a directory tree for a cycle, following symlinks to directories within it. Directories
+// are identified by their real paths: visiting are those being searched, and done are those searched without a cycle.
+type symlinkCycleFinder struct {
+	root     string
+	realRoot string
+	visiting map[string]bool
+	done     map[string]bool
+}
+
+// find searches the directory with the real path real, reached as path, returning the path relative to the root of
+// the first symlink creating a cycle.
+func (f *symlinkCycleFinder) find(real, path string) (string, error) {
+	entries, err := ioutil.ReadDir(real)
+	if os.IsPermission(err) {
+		// Directories the build cannot read are not traversed by it either.
+		f.done[real] = true
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	f.visiting[real] = true
+	for _, e := range entries {
+		p := filepath.Join(path, e.Name())
+		next := filepath.Join(real, e.Name())
+		if e.Mode()&os.ModeSymlink != 0 {
+			fi, err := os.Stat(next)
+			if errors.Is(err, syscall.ELOOP) {
+				return filepath.Rel(f.root, p)
+			}
+			if os.IsNotExist(err) || os.IsPermission(err) || (err == nil && !fi.IsDir()) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			next, err = filepath.EvalSymlinks(next)
+			if os.IsPermission(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if f.visiting[next] {
+				return filepath.Rel(f.root, p)
+			}
+			// Directories outside of the root, such as those of the system, cannot contain the symlink, and following
+			// them could traverse the whole filesystem.
+			if !withinDir(f.realRoot, next) {
+				continue
+			}
+		} else if !e.IsDir() {
+			continue
+		}
+		if f.done[next] {
+			continue
+		}
+		if link, err := f.find(next, p); link != "" || err != nil {
+			return link, err
+		}
+	}
+	delete(f.visiting, real)
+	f.done[real] = true
+	return "", nil
+}
+
+// withinDir returns true if path is dir or a path inside it.
+func withinDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// warnUninitializedSubmodules warns if any Git submodule declared in .gitmodules has not been populated. Submodules
+// are often unused at build time, or intentionally left empty, so the build continues.
+func (ctx *Context) warnUninitializedSubmodules() {
+	paths, err := uninitializedSubmodules(ctx.ApplicationRoot())
+	if err != nil {
+		ctx.Debugf("Failed to check git submodules: %v", err)
+		return
+	}
+	if len(paths) > 0 {
+		ctx.Warnf("Git submodules are not populated: %s. If the build needs them, run `git submodule update --init --recursive` before building.", strings.Join(paths, ", "))
+	}
+}
+
+// uninitializedSubmodules returns the paths of the Git submodules declared in .gitmodules whose directories are
+// missing or empty.
+func uninitializedSubmodules(root string) ([]string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, gitModules))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, match := range submodulePathRegexp.FindAllStringSubmatch(string(content), -1) {
+		files, err := ioutil.ReadDir(filepath.Join(root, match[1]))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(files) == 0 {
+			paths = append(paths, match[1])
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+const functionConfigFile = ".gcp-function.toml"
+
+// functionConfig represents the contents of .gcp-function.toml.
+type functionConfig struct {
+	Target        string `toml:"target"`
+	SignatureType string `toml:"signature_type"`
+}
+
+// loadFunctionConfig sets GOOGLE_FUNCTION_TARGET and GOOGLE_FUNCTION_SIGNATURE_TYPE from .gcp-function.toml in the
+// application root, if present, so that functions buildpacks can be used without setting env vars. Variables already
+// set in the environment take precedence.
+func (ctx *Context) loadFunctionConfig() {
+	path := filepath.Join(ctx.ApplicationRoot(), functionConfigFile)
+	if !ctx.FileExists(path) {
+		return
+	}
+	var c functionConfig
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		ctx.Exit(1, UserErrorf("parsing %s: %v", functionConfigFile, err))
+	}
+	ctx.setConfigEnv(functionConfigFile, []configVar{
+		{name: env.FunctionTarget, value: c.Target},
+		{name: env.FunctionSignatureType, value: c.SignatureType},
+	})
+}
+
+// configVar is an env var set from a value in a config file.
+type configVar struct {
+	name  string
+	value string
+}
+
+// setConfigEnv sets the env vars with non-empty values read from the config file, unless they are already set in the
+// environment.
+func (ctx *Context) setConfigEnv(file string, vars []configVar) {
+	for _, v := range vars {
+		if v.value == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(v.name); ok {
+			ctx.Debugf("Skipping %s from %s, it is already set", v.name, file)
+			continue
+		}
+		ctx.Debugf("Setting %s=%s from %s", v.name, v.value, file)
+		ctx.Setenv(v.name, v.value)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestLoadFunctionConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "function-config-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "target = \"fromFile\"\nsignature_type = \"event\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, functionConfigFile), []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", functionConfigFile, err)
+	}
+	os.Setenv(env.FunctionTarget, "fromEnv")
+	defer os.Unsetenv(env.FunctionTarget)
+	defer os.Unsetenv(env.FunctionSignatureType)
+
+	ctx := NewContextForTests(buildpack.Info{ID: "id", Version: "version", Name: "name"}, dir)
+	ctx.loadFunctionConfig()
+
+	if got, want := os.Getenv(env.FunctionTarget), "fromEnv"; got != want {
+		t.Errorf("%s = %q, want %q", env.FunctionTarget, got, want)
+	}
+	if got, want := os.Getenv(env.FunctionSignatureType), "event"; got != want {
+		t.Errorf("%s = %q, want %q", env.FunctionSignatureType, got, want)
+	}
+}
+
+func TestLoadFunctionConfigDetect(t *testing.T) {
+	defer os.Unsetenv(env.FunctionTarget)
+	detectFn := func(ctx *Context) error {
+		if _, ok := os.LookupEnv(env.FunctionTarget); ok {
+			ctx.OptIn("%s set", env.FunctionTarget)
+		}
+		ctx.OptOut("%s not set", env.FunctionTarget)
+		return nil
+	}
+
+	got := RunDetectInProcess(t, detectFn, map[string]string{functionConfigFile: "target = \"fromFile\"\n"}, nil)
+
+	if got.ExitCode != 0 {
+		t.Errorf("RunDetectInProcess() exit code = %d, want 0", got.ExitCode)
+	}
+}
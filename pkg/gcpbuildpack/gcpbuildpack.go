@@ -19,9 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
@@ -39,10 +39,23 @@ const (
 
 	// cacheMissMessage is emitted by ctx.CacheMiss(). Must match acceptance test value.
 	cacheMissMessage = "***** CACHE MISS:"
+
+	webProcess         = "web"
+	healthCheckProcess = "health-check"
+
+	// buildStartEnv is set by the first buildpack to the Unix time at which the build started, so that later
+	// buildpacks share the same build deadline and know they are not the first.
+	buildStartEnv = "GOOGLE_BUILD_START"
+	// buildStartLayer is the layer that sets buildStartEnv for later buildpacks.
+	buildStartLayer = "build-start"
 )
 
 var (
 	logger = log.New(os.Stderr, "", 0)
+
+	// PortHealthCheck is a health-check command that succeeds when the application accepts TCP connections on $PORT.
+	// It does not send a request, so it is safe for applications, such as functions, that have no health endpoint.
+	PortHealthCheck = []string{"/bin/bash", "-c", "exec 3<>/dev/tcp/127.0.0.1/${PORT:-8080}"}
 )
 
 // DetectFn is the callback signature for Detect()
@@ -53,7 +66,20 @@ type BuildFn func(*Context) error
 
 type stats struct {
 	spans []*spanInfo
+	start time.Time
 	user  time.Duration
+	// cpu is the CPU time used by the commands run by the buildpack.
+	cpu time.Duration
+	// maxRSSBytes is the peak memory used by any command run by the buildpack.
+	maxRSSBytes int64
+}
+
+// recordUsage adds the resource usage of a command to the stats.
+func (s *stats) recordUsage(u ResourceUsage) {
+	s.cpu += u.UserTime + u.SystemTime
+	if u.MaxRSSBytes > s.maxRSSBytes {
+		s.maxRSSBytes = u.MaxRSSBytes
+	}
 }
 
 // Context provides contextually aware functions for buildpack authors.
@@ -69,6 +95,48 @@ type Context struct {
 	d               *libdetect.Detect
 	b               *libbuild.Build
 	stats           stats
+	decisions       decisions
+	deadline        *buildDeadline
+	// buildStart is the time at which the build step of the first buildpack started.
+	buildStart time.Time
+	// firstBuildpack is true in the build step of the first buildpack, which reports issues with the whole build once.
+	firstBuildpack bool
+	downloader     Downloader
+	// clearCache caches the result of ClearCacheRequested, nil until it is first called.
+	clearCache *bool
+	// clearedLayers records the layers cleared because of GOOGLE_CLEAR_CACHE, which are only cleared once per build.
+	clearedLayers map[string]bool
+	// detectReason is the reason recorded by the last call to OptIn or OptOut and their variants.
+	detectReason DetectReason
+}
+
+// DetectCriterion is the kind of condition that decided whether a buildpack participates in a build.
+type DetectCriterion string
+
+const (
+	// CriterionFile is the presence of a file in the application root.
+	CriterionFile DetectCriterion = "file"
+	// CriterionEnv is whether an env var is set.
+	CriterionEnv DetectCriterion = "env"
+	// CriterionOther is any other condition, described only by the message of the reason.
+	CriterionOther DetectCriterion = "other"
+)
+
+// DetectReason is the structured reason a buildpack opted in to or out of a build.
+type DetectReason struct {
+	Criterion DetectCriterion
+	// Value is the file or env var the criterion refers to, or empty for CriterionOther.
+	Value string
+	// Message is the human-readable reason logged during detect.
+	Message string
+}
+
+// String returns the criterion and value of the reason, e.g. "file=package.json".
+func (r DetectReason) String() string {
+	if r.Value == "" {
+		return string(r.Criterion)
+	}
+	return fmt.Sprintf("%s=%s", r.Criterion, r.Value)
 }
 
 // NewContext creates a context.
@@ -79,8 +147,10 @@ func NewContext(info buildpack.Info) *Context {
 		os.Exit(1)
 	}
 	return &Context{
-		debug: debug,
-		info:  info,
+		debug:      debug,
+		info:       info,
+		stats:      stats{start: time.Now()},
+		downloader: httpDownloader{client: allowlistClient, backoff: downloadBackoff},
 	}
 }
 
@@ -117,6 +187,25 @@ func newBuildContext() *Context {
 	return ctx
 }
 
+// mapDeprecatedEnv maps deprecated env vars, including those set in build.env, to their replacements. If warn is set,
+// it warns about each one that is set; every buildpack maps them, so only the first one warns.
+func (ctx *Context) mapDeprecatedEnv(warn bool) {
+	deprecations, err := env.MapDeprecated()
+	if err != nil {
+		ctx.Exit(1, InternalErrorf("mapping deprecated env vars: %v", err))
+	}
+	if !warn {
+		return
+	}
+	for _, d := range deprecations {
+		if d.Ignored {
+			ctx.Warnf("%s is deprecated and ignored because %s is set.", d.Old, d.New)
+			continue
+		}
+		ctx.Warnf("%s is deprecated, use %s instead.", d.Old, d.New)
+	}
+}
+
 // BuildpackID returns the buildpack id.
 func (ctx *Context) BuildpackID() string {
 	return ctx.info.ID
@@ -147,6 +236,9 @@ func (ctx *Context) Debug() bool {
 	return ctx.debug
 }
 
+// exit terminates the process with the given exit code. It is replaced to run detect in-process in tests.
+var exit = os.Exit
+
 // Main is the main entrypoint to a buildpack's detect and build functions.
 func Main(d DetectFn, b BuildFn) {
 	switch filepath.Base(os.Args[0]) {
@@ -167,6 +259,11 @@ func detect(f DetectFn) {
 	defer func(now time.Time) {
 		ctx.Span(fmt.Sprintf("Buildpack Detect %s", ctx.info.ID), now, status)
 	}(time.Now())
+	// Load build.env in detect too, so that detection sees the same GOOGLE_* env vars as the build.
+	ctx.loadBuildEnv()
+	ctx.mapDeprecatedEnv(false)
+	ctx.loadFunctionConfig()
+	ctx.loadBuildConfig()
 
 	if err := f(ctx); err != nil {
 		msg := fmt.Sprintf("Failed to run /bin/detect: %v", err)
@@ -190,13 +287,27 @@ func build(b BuildFn) {
 	start := time.Now()
 	ctx := newBuildContext()
 	ctx.Logf("=== %s (%s@%s) ===", ctx.BuildpackName(), ctx.BuildpackID(), ctx.BuildpackVersion())
+	ctx.Debugf("Debug mode enabled by %s.", env.DebugMode)
+	ctx.recordBuildStart()
+	if ctx.firstBuildpack {
+		ctx.warnUninitializedSubmodules()
+	}
+	ctx.loadBuildEnv()
+	ctx.mapDeprecatedEnv(ctx.firstBuildpack)
+	ctx.loadFunctionConfig()
+	ctx.loadBuildConfig()
+	ctx.enforceBuildDeadline()
+	defer ctx.stopBuildDeadline()
 
 	status := StatusInternal
 	defer func(now time.Time) {
 		ctx.Span(fmt.Sprintf("Buildpack Build %s", ctx.BuildpackID()), now, status)
 	}(time.Now())
 
-	if err := b(ctx); err != nil {
+	err := b(ctx)
+	// Failures caused by exceeding the deadline are reported as such.
+	ctx.exitIfBuildDeadlineExceeded("")
+	if err != nil {
 		msg := fmt.Sprintf("Failed to run /bin/build: %v", err)
 		var be *Error
 		if errors.As(err, &be) {
@@ -206,6 +317,8 @@ func build(b BuildFn) {
 		ctx.Exit(ctx.b.Failure(1), Errorf(status, msg))
 	}
 
+	ctx.stripLaunchEnv()
+
 	// Emit application metadata.
 	if len(ctx.processes) > 0 {
 		metadata := layers.Metadata{Processes: ctx.processes}
@@ -220,10 +333,33 @@ func build(b BuildFn) {
 
 	status = StatusOk
 	ctx.saveSuccessOutput(time.Since(start))
+	ctx.saveBuildReport(nil)
+}
+
+// recordBuildStart sets the time at which the build started, as exported by an earlier buildpack. If no buildpack has
+// exported it, this is the first buildpack: the build starts now and the time is exported to later buildpacks.
+func (ctx *Context) recordBuildStart() {
+	if val := os.Getenv(buildStartEnv); val != "" {
+		sec, err := strconv.ParseInt(val, 10, 64)
+		if err == nil {
+			ctx.buildStart = time.Unix(sec, 0)
+			return
+		}
+		ctx.Debugf("Ignoring invalid %s %q: %v", buildStartEnv, val, err)
+	}
+	ctx.buildStart = time.Now()
+	ctx.firstBuildpack = true
+	l := ctx.Layer(buildStartLayer)
+	ctx.OverrideBuildEnv(l, buildStartEnv, "%d", ctx.buildStart.Unix())
+	ctx.WriteMetadata(l, nil, layers.Build)
 }
 
 // Exit causes the buildpack to exit with the given exit code and message.
 func (ctx *Context) Exit(exitCode int, be *Error) {
+	if ctx.deadline != nil {
+		// Never released, the process exits.
+		ctx.deadline.exitMu.Lock()
+	}
 	if be != nil {
 		msg := "Failure: "
 		if be.ID != "" {
@@ -233,6 +369,10 @@ func (ctx *Context) Exit(exitCode int, be *Error) {
 		ctx.Logf(msg)
 		ctx.saveErrorOutput(be)
 	}
+	// Failed builds need the report the most, so it is written before exiting.
+	if ctx.b != nil && exitCode != 0 {
+		ctx.saveBuildReport(be)
+	}
 
 	if exitCode != 0 {
 		ctx.Tipf(divider)
@@ -245,19 +385,54 @@ func (ctx *Context) Exit(exitCode int, be *Error) {
 	}
 
 	ctx.exitCode = exitCode
-	os.Exit(exitCode)
+	exit(exitCode)
 }
 
 // OptOut is used during the detect phase to opt out of the build process.
 func (ctx *Context) OptOut(format string, args ...interface{}) {
-	ctx.Logf(format, args...)
-	os.Exit(libdetect.FailStatusCode)
+	ctx.optOut(DetectReason{Criterion: CriterionOther, Message: fmt.Sprintf(format, args...)})
+}
+
+// OptOutFileNotFound opts out of the build process because file does not exist in the application root.
+func (ctx *Context) OptOutFileNotFound(file string) {
+	ctx.optOut(DetectReason{Criterion: CriterionFile, Value: file, Message: fmt.Sprintf("%s not found", file)})
+}
+
+// OptOutEnvNotSet opts out of the build process because the env var name is not set.
+func (ctx *Context) OptOutEnvNotSet(name string) {
+	ctx.optOut(DetectReason{Criterion: CriterionEnv, Value: name, Message: fmt.Sprintf("%s not set", name)})
 }
 
 // OptIn is used during the detect phase to opt in to the build process.
 func (ctx *Context) OptIn(format string, args ...interface{}) {
-	ctx.Logf(format, args...)
-	os.Exit(libdetect.PassStatusCode)
+	ctx.optIn(DetectReason{Criterion: CriterionOther, Message: fmt.Sprintf(format, args...)})
+}
+
+// OptInFileFound opts in to the build process because file exists in the application root.
+func (ctx *Context) OptInFileFound(file string) {
+	ctx.optIn(DetectReason{Criterion: CriterionFile, Value: file, Message: fmt.Sprintf("found %s", file)})
+}
+
+// OptInEnvSet opts in to the build process because the env var name is set.
+func (ctx *Context) OptInEnvSet(name string) {
+	ctx.optIn(DetectReason{Criterion: CriterionEnv, Value: name, Message: fmt.Sprintf("%s set", name)})
+}
+
+func (ctx *Context) optOut(r DetectReason) {
+	ctx.recordDetectReason(r)
+	exit(libdetect.FailStatusCode)
+}
+
+func (ctx *Context) optIn(r DetectReason) {
+	ctx.recordDetectReason(r)
+	exit(libdetect.PassStatusCode)
+}
+
+// recordDetectReason logs the reason for the detect outcome and keeps it for tests.
+func (ctx *Context) recordDetectReason(r DetectReason) {
+	ctx.detectReason = r
+	ctx.Logf("%s", r.Message)
+	ctx.Debugf("Detect criterion: %s", r)
 }
 
 // Logf emits a structured logging line.
@@ -275,6 +450,7 @@ func (ctx *Context) Debugf(format string, args ...interface{}) {
 
 // Warnf emits a structured logging line for warnings.
 func (ctx *Context) Warnf(format string, args ...interface{}) {
+	ctx.decisions.warnings = append(ctx.decisions.warnings, fmt.Sprintf(format, args...))
 	ctx.Logf("Warning: "+format, args...)
 }
 
@@ -288,11 +464,13 @@ func (ctx *Context) Tipf(format string, args ...interface{}) {
 
 // CacheHit records a cache hit debug message. This is used in acceptance test validation.
 func (ctx *Context) CacheHit(tag string) {
+	ctx.recordCache(tag, cacheHit)
 	ctx.Debugf("%s %q", cacheHitMessage, tag)
 }
 
 // CacheMiss records a cache miss debug message. This is used in acceptance test validation.
 func (ctx *Context) CacheMiss(tag string) {
+	ctx.recordCache(tag, cacheMiss)
 	ctx.Debugf("%s %q", cacheMissMessage, tag)
 }
 
@@ -308,6 +486,10 @@ func (ctx *Context) Span(label string, start time.Time, status Status) {
 	if err != nil {
 		ctx.Logf("Warning: invalid span dropped: %v", err)
 	}
+	if ctx.deadline != nil {
+		ctx.deadline.mu.Lock()
+		defer ctx.deadline.mu.Unlock()
+	}
 	ctx.stats.spans = append(ctx.stats.spans, si)
 }
 
@@ -328,17 +510,36 @@ func (ctx *Context) AddBuildpackPlan(plan buildpackplan.Plan) {
 
 // AddWebProcess adds the given command as the web start process, overwriting any previous web start process.
 func (ctx *Context) AddWebProcess(cmd []string) {
+	ctx.addProcess(webProcess, cmd)
+}
+
+// AddWebProcessWithHealthCheck adds the given command as the web start process and healthCmd as the health-check
+// process, overwriting any previous ones. Platforms that support health checks can run the health-check process, for
+// example with `/cnb/process/health-check` as a Docker HEALTHCHECK; others ignore it.
+func (ctx *Context) AddWebProcessWithHealthCheck(cmd, healthCmd []string) {
+	ctx.addProcess(webProcess, cmd)
+	ctx.addProcess(healthCheckProcess, healthCmd)
+}
+
+// AddProcess adds the given command as a process of type typ, overwriting any previous process of the same type.
+// Use AddWebProcess for the web process.
+func (ctx *Context) AddProcess(typ string, cmd []string) {
+	ctx.addProcess(typ, cmd)
+}
+
+// addProcess adds the given command as a process of type typ, overwriting any previous process of the same type.
+func (ctx *Context) addProcess(typ string, cmd []string) {
 	current := ctx.processes
 	ctx.processes = layers.Processes{}
 	for _, p := range current {
-		if p.Type == "web" {
-			ctx.Logf("Warning: overwriting existing web process %q.", p.Command)
+		if p.Type == typ {
+			ctx.Logf("Warning: overwriting existing %s process %q.", typ, p.Command)
 			continue // Do not add this item back to the ctx.processes; we are overwriting it.
 		}
 		ctx.processes = append(ctx.processes, p)
 	}
 	p := layers.Process{
-		Type:    "web",
+		Type:    typ,
 		Command: cmd[0],
 		Direct:  true, // Uses Exec (no shell).
 	}
@@ -348,10 +549,18 @@ func (ctx *Context) AddWebProcess(cmd []string) {
 	ctx.processes = append(ctx.processes, p)
 }
 
-// HTTPStatus returns the status code for a url.
+// HTTPStatus returns the status code for a url. The hosts of url and of any redirects must be allowed by
+// GOOGLE_DOWNLOAD_ALLOWLIST, if it is set.
 func (ctx *Context) HTTPStatus(url string) int {
-	res, err := http.Head(url)
+	if err := checkDownloadAllowed(url); err != nil {
+		ctx.Exit(1, err)
+	}
+	res, err := allowlistClient.Head(url)
 	if err != nil {
+		var blocked *Error
+		if errors.As(err, &blocked) {
+			ctx.Exit(1, blocked)
+		}
 		ctx.Exit(1, UserErrorf("making a request to %s", url))
 	}
 	return res.StatusCode
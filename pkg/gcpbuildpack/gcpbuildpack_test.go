@@ -15,17 +15,22 @@
 package gcpbuildpack
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/buildplan"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
@@ -132,6 +137,115 @@ func TestDetectEmitsSpan(t *testing.T) {
 	}
 }
 
+func TestRunDetectInProcess(t *testing.T) {
+	testCases := []struct {
+		name       string
+		detectFn   DetectFn
+		files      map[string]string
+		env        []string
+		want       int
+		wantPlan   buildplan.Plan
+		wantReason DetectReason
+	}{
+		{
+			name:     "returns nil",
+			detectFn: func(ctx *Context) error { return nil },
+			want:     0,
+		},
+		{
+			name: "opts in",
+			detectFn: func(ctx *Context) error {
+				ctx.OptIn("found")
+				return fmt.Errorf("unreachable")
+			},
+			want:       0,
+			wantReason: DetectReason{Criterion: CriterionOther, Message: "found"},
+		},
+		{
+			name: "opts out",
+			detectFn: func(ctx *Context) error {
+				ctx.OptOut("not found")
+				return nil
+			},
+			want:       100,
+			wantReason: DetectReason{Criterion: CriterionOther, Message: "not found"},
+		},
+		{
+			name: "opts in file found",
+			detectFn: func(ctx *Context) error {
+				ctx.OptInFileFound("main.py")
+				return nil
+			},
+			want:       0,
+			wantReason: DetectReason{Criterion: CriterionFile, Value: "main.py", Message: "found main.py"},
+		},
+		{
+			name: "opts in env set",
+			detectFn: func(ctx *Context) error {
+				ctx.OptInEnvSet("GOOGLE_FUNCTION_TARGET")
+				return nil
+			},
+			want:       0,
+			wantReason: DetectReason{Criterion: CriterionEnv, Value: "GOOGLE_FUNCTION_TARGET", Message: "GOOGLE_FUNCTION_TARGET set"},
+		},
+		{
+			name: "opts out file not found",
+			detectFn: func(ctx *Context) error {
+				ctx.OptOutFileNotFound("package.json")
+				return nil
+			},
+			want:       100,
+			wantReason: DetectReason{Criterion: CriterionFile, Value: "package.json", Message: "package.json not found"},
+		},
+		{
+			name: "opts out env not set",
+			detectFn: func(ctx *Context) error {
+				ctx.OptOutEnvNotSet("GOOGLE_FUNCTION_TARGET")
+				return nil
+			},
+			want:       100,
+			wantReason: DetectReason{Criterion: CriterionEnv, Value: "GOOGLE_FUNCTION_TARGET", Message: "GOOGLE_FUNCTION_TARGET not set"},
+		},
+		{
+			name:     "returns error",
+			detectFn: func(ctx *Context) error { return fmt.Errorf("detect failed") },
+			want:     1,
+		},
+		{
+			name: "files and env",
+			detectFn: func(ctx *Context) error {
+				if !ctx.FileExists("dir", "main.py") || os.Getenv("TEST_DETECT_IN_PROCESS") != "true" {
+					ctx.OptOut("not found")
+				}
+				ctx.AddBuildPlanProvides(buildplan.Provided{Name: "python"})
+				return nil
+			},
+			files:    map[string]string{"dir/main.py": ""},
+			env:      []string{"TEST_DETECT_IN_PROCESS=true"},
+			want:     0,
+			wantPlan: buildplan.Plan{Provides: []buildplan.Provided{{Name: "python"}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := RunDetectInProcess(t, tc.detectFn, tc.files, tc.env)
+
+			if got.ExitCode != tc.want {
+				t.Errorf("RunDetectInProcess() exit code = %d, want %d", got.ExitCode, tc.want)
+			}
+			if !reflect.DeepEqual(got.BuildPlan, tc.wantPlan) {
+				t.Errorf("RunDetectInProcess() build plan = %v, want %v", got.BuildPlan, tc.wantPlan)
+			}
+			if got.Reason != tc.wantReason {
+				t.Errorf("RunDetectInProcess() reason = %+v, want %+v", got.Reason, tc.wantReason)
+			}
+		})
+	}
+	if _, ok := os.LookupEnv("TEST_DETECT_IN_PROCESS"); ok {
+		t.Error("RunDetectInProcess() did not restore env")
+	}
+}
+
 // func TestDetectCallbackReturingErrorExits(t *testing.T) {}
 // func TestDetectFinalizes(t *testing.T) {}
 
@@ -208,7 +322,7 @@ func TestBuildEmitsSuccessOutput(t *testing.T) {
 		return nil
 	})
 
-	fname := filepath.Join(tempDir, builderOutputFilename)
+	fname := filepath.Join(tempDir, builderOutputFilename())
 	var got builderOutput
 	content, err := ioutil.ReadFile(fname)
 	if err != nil {
@@ -266,6 +380,22 @@ func TestAddWebProcess(t *testing.T) {
 	}
 }
 
+func TestAddWebProcessWithHealthCheck(t *testing.T) {
+	ctx := NewContext(buildpack.Info{ID: "id", Version: "version", Name: "name"})
+	ctx.processes = layers.Processes{proc("/dev", "dev"), proc("/old", "health-check"), proc("/web", "web")}
+
+	ctx.AddWebProcessWithHealthCheck([]string{"/OVERRIDE"}, []string{"/probe", "--port", "8080"})
+
+	want := layers.Processes{
+		proc("/dev", "dev"),
+		proc("/OVERRIDE", "web"),
+		{Command: "/probe", Args: []string{"--port", "8080"}, Type: "health-check", Direct: true},
+	}
+	if !reflect.DeepEqual(ctx.processes, want) {
+		t.Errorf("Processes not equal got %#v, want %#v", ctx.processes, want)
+	}
+}
+
 func TestHasAtLeastOne(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -333,6 +463,238 @@ func TestHasAtLeastOne(t *testing.T) {
 	}
 }
 
+func TestUninitializedSubmodules(t *testing.T) {
+	gitmodules := `[submodule "lib"]
+	path = lib
+	url = https://example.com/lib.git
+[submodule "third_party/dep"]
+	path = third_party/dep
+	url = https://example.com/dep.git
+`
+	testCases := []struct {
+		name  string
+		files map[string]string
+		dirs  []string
+		want  []string
+	}{
+		{
+			name: "no gitmodules",
+		},
+		{
+			name:  "missing and empty submodules",
+			files: map[string]string{".gitmodules": gitmodules},
+			dirs:  []string{"lib"},
+			want:  []string{"lib", "third_party/dep"},
+		},
+		{
+			name: "populated submodules",
+			files: map[string]string{
+				".gitmodules":               gitmodules,
+				"lib/lib.go":                "",
+				"third_party/dep/README.md": "",
+			},
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cleanup := tempWorkingDir(t)
+			defer cleanup()
+
+			for _, d := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+					t.Fatalf("creating dir %s: %v", d, err)
+				}
+			}
+			for f, c := range tc.files {
+				fn := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+					t.Fatalf("creating dir for %s: %v", f, err)
+				}
+				if err := ioutil.WriteFile(fn, []byte(c), 0644); err != nil {
+					t.Fatalf("writing file %s: %v", f, err)
+				}
+			}
+
+			got, err := uninitializedSubmodules(dir)
+			if err != nil {
+				t.Fatalf("uninitializedSubmodules() got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("uninitializedSubmodules()=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildUninitializedSubmodules(t *testing.T) {
+	_, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+	if err := ioutil.WriteFile(".gitmodules", []byte("[submodule \"lib\"]\n\tpath = lib\n"), 0644); err != nil {
+		t.Fatalf("writing .gitmodules: %v", err)
+	}
+
+	oldExit := exit
+	exit = func(code int) {
+		if code != 0 {
+			t.Errorf("exit code got=%d, want 0 as unpopulated submodules only warn", code)
+		}
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	build(func(ctx *Context) error { return nil })
+}
+
+func TestBuildMapsDeprecatedEnv(t *testing.T) {
+	testCases := []struct {
+		name     string
+		first    bool
+		wantWarn bool
+	}{
+		{name: "first buildpack warns", first: true, wantWarn: true},
+		{name: "later buildpack does not warn"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, cleanUp := setUpBuildEnvironment(t)
+			defer cleanUp()
+			if !tc.first {
+				os.Setenv(buildStartEnv, strconv.FormatInt(time.Now().Unix(), 10))
+				defer os.Unsetenv(buildStartEnv)
+			}
+			// Deprecated env vars set in build.env are mapped too.
+			if err := ioutil.WriteFile(buildEnvFile, []byte(env.FunctionSourceLaunch+"=src/main.py\n"), 0644); err != nil {
+				t.Fatalf("writing %s: %v", buildEnvFile, err)
+			}
+			defer os.Unsetenv(env.FunctionSourceLaunch)
+			defer os.Unsetenv(env.FunctionSource)
+
+			var buf bytes.Buffer
+			defer func(l *log.Logger) { logger = l }(logger)
+			logger = log.New(&buf, "", 0)
+			oldExit := exit
+			exit = func(code int) {
+				if code != 0 {
+					t.Errorf("exit code got=%d, want 0", code)
+				}
+			}
+			defer func() {
+				exit = oldExit
+			}()
+
+			var got string
+			build(func(ctx *Context) error {
+				got = os.Getenv(env.FunctionSource)
+				return nil
+			})
+
+			if got != "src/main.py" {
+				t.Errorf("%s got=%q, want %q", env.FunctionSource, got, "src/main.py")
+			}
+			if gotWarn := strings.Contains(buf.String(), env.FunctionSourceLaunch+" is deprecated"); gotWarn != tc.wantWarn {
+				t.Errorf("deprecation warning got=%t, want %t in output:\n%s", gotWarn, tc.wantWarn, buf.String())
+			}
+		})
+	}
+}
+
+func TestCircularSymlink(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dirs     []string
+		symlinks map[string]string
+		want     string
+	}{
+		{
+			name: "no symlinks",
+			dirs: []string{"a/b"},
+		},
+		{
+			name:     "symlink to parent",
+			dirs:     []string{"a"},
+			symlinks: map[string]string{"a/loop": ".."},
+			want:     "a/loop",
+		},
+		{
+			name:     "symlink to itself",
+			symlinks: map[string]string{"x": "y", "y": "x"},
+			want:     "x",
+		},
+		{
+			name:     "symlinked directories leading to each other",
+			dirs:     []string{"a", "b"},
+			symlinks: map[string]string{"a/tob": "../b", "b/toa": "../a"},
+			want:     "a/tob/toa",
+		},
+		{
+			name:     "broken symlink",
+			symlinks: map[string]string{"broken": "missing"},
+		},
+		{
+			name:     "symlink to sibling",
+			dirs:     []string{"a", "b/c"},
+			symlinks: map[string]string{"a/tob": "../b"},
+		},
+		{
+			name:     "symlinks outside of the root",
+			dirs:     []string{"a"},
+			symlinks: map[string]string{"vendor": "/", "a/up": "../..", "a/self": "/proc/self/root"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cleanUp := tempWorkingDir(t)
+			defer cleanUp()
+
+			for _, d := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+					t.Fatalf("creating directory %s: %v", d, err)
+				}
+			}
+			for link, target := range tc.symlinks {
+				if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+					t.Fatalf("creating symlink %s: %v", link, err)
+				}
+			}
+
+			got, err := circularSymlink(dir)
+			if err != nil {
+				t.Fatalf("circularSymlink() got unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("circularSymlink()=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckForCircularSymlinks(t *testing.T) {
+	dir, cleanUp := tempWorkingDir(t)
+	defer cleanUp()
+	if err := os.Symlink(".", filepath.Join(dir, "loop")); err != nil {
+		t.Fatalf("creating symlink: %v", err)
+	}
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+
+	err := ctx.CheckForCircularSymlinks(dir)
+	if err == nil {
+		t.Fatal("CheckForCircularSymlinks() got nil error, want error")
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("CheckForCircularSymlinks() got error of type %T, want *Error", err)
+	}
+	if e.Status != StatusUnknown {
+		t.Errorf("CheckForCircularSymlinks() got status %v, want %v", e.Status, StatusUnknown)
+	}
+	if !strings.Contains(e.Message, "loop") {
+		t.Errorf("CheckForCircularSymlinks() got message %q, want it to contain %q", e.Message, "loop")
+	}
+}
+
 func proc(command, commandType string) layers.Process {
 	return layers.Process{Command: command, Type: commandType, Direct: true}
 }
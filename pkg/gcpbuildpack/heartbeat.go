@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"time"
+)
+
+// WithHeartbeat runs f, logging message every interval until f returns so that build logs show liveness during
+// steps that produce no output until they are done.
+func (ctx *Context) WithHeartbeat(interval time.Duration, message string, f func()) {
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx.Logf("%s (%s elapsed)", message, time.Since(start).Truncate(time.Second))
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	f()
+}
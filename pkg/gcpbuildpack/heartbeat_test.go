@@ -0,0 +1,60 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestWithHeartbeat(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *log.Logger) { logger = l }(logger)
+	logger = log.New(&buf, "", 0)
+	dir, err := ioutil.TempDir("", "heartbeat-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+
+	ran := false
+	ctx.WithHeartbeat(10*time.Millisecond, "Still working", func() {
+		time.Sleep(55 * time.Millisecond)
+		ran = true
+	})
+
+	if !ran {
+		t.Fatal("WithHeartbeat() did not run the wrapped function")
+	}
+	got := strings.Count(buf.String(), "Still working")
+	if got < 2 {
+		t.Errorf("WithHeartbeat() logged %d heartbeats, want at least 2; output: %q", got, buf.String())
+	}
+
+	// No heartbeats are logged after the wrapped function returns.
+	buf.Reset()
+	time.Sleep(30 * time.Millisecond)
+	if buf.Len() != 0 {
+		t.Errorf("WithHeartbeat() logged after returning: %q", buf.String())
+	}
+}
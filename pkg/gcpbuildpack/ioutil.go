@@ -15,11 +15,18 @@
 package gcpbuildpack
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 )
 
+const (
+	// maxConfigFileSize is the maximum size of a configuration file read with ReadFileNormalized.
+	maxConfigFileSize = 64 * 1024
+)
+
 // TempDir creates a temp directory, returning the directory name. exiting on any error. It is the caller's responsibility to remove the created directory.
 func (ctx *Context) TempDir(dir, prefix string) string {
 	tmp, err := ioutil.TempDir(dir, prefix)
@@ -36,6 +43,19 @@ func (ctx *Context) WriteFile(filename string, data []byte, perm os.FileMode) {
 	}
 }
 
+// WriteFileIfChanged writes data to filename unless the file already contains exactly data, exiting on any error.
+// Skipping identical writes keeps file modification times, and any layer that contains the file, stable across builds.
+func (ctx *Context) WriteFileIfChanged(filename string, data []byte, perm os.FileMode) {
+	if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, data) {
+		ctx.Debugf("File %q unchanged, skipping write", filename)
+		if err := os.Chmod(filename, perm); err != nil {
+			ctx.Exit(1, Errorf(StatusInternal, "chmoding file %q: %v", filename, err))
+		}
+		return
+	}
+	ctx.WriteFile(filename, data, perm)
+}
+
 // ReadFile invokes ioutil.ReadFile, exiting on any error.
 func (ctx *Context) ReadFile(filename string) []byte {
 	data, err := ioutil.ReadFile(filename)
@@ -45,6 +65,37 @@ func (ctx *Context) ReadFile(filename string) []byte {
 	return data
 }
 
+// ReadFileNormalized reads a small configuration file, converting CRLF and CR line endings to LF, exiting on any error
+// or if the file is larger than 64 KiB. Use it for files that may be authored on Windows and are parsed line by line.
+func (ctx *Context) ReadFileNormalized(filename string) []byte {
+	return normalizeLineEndings(ctx.ReadFileLimit(filename, maxConfigFileSize))
+}
+
+// normalizeLineEndings converts CRLF and lone CR line endings to LF.
+func normalizeLineEndings(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+}
+
+// ReadFileLimit reads a file of at most max bytes, exiting on any error or if the file is larger than max.
+func (ctx *Context) ReadFileLimit(filename string, max int64) []byte {
+	f, err := os.Open(filename)
+	if err != nil {
+		ctx.Exit(1, Errorf(StatusInternal, "opening file %q: %v", filename, err))
+	}
+	defer f.Close()
+
+	// Read one extra byte to detect files exceeding the limit.
+	data, err := ioutil.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		ctx.Exit(1, Errorf(StatusInternal, "reading file %q: %v", filename, err))
+	}
+	if int64(len(data)) > max {
+		ctx.Exit(1, UserErrorf("file %q exceeds the maximum size of %d bytes", filename, max))
+	}
+	return data
+}
+
 // ReadDir invokes ioutil.ReadDir, exiting on any error.
 func (ctx *Context) ReadDir(elem ...string) []os.FileInfo {
 	n := filepath.Join(elem...)
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestWriteFileIfChanged(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contents    string
+		wantModTime bool
+	}{
+		{
+			name:        "identical contents keep mtime",
+			contents:    "original",
+			wantModTime: true,
+		},
+		{
+			name:     "changed contents are written",
+			contents: "changed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "write-file-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "launch.sh")
+			if err := ioutil.WriteFile(path, []byte("original"), 0644); err != nil {
+				t.Fatalf("writing %s: %v", path, err)
+			}
+			past := time.Now().Add(-time.Hour).Truncate(time.Second)
+			if err := os.Chtimes(path, past, past); err != nil {
+				t.Fatalf("setting times on %s: %v", path, err)
+			}
+
+			ctx := NewContext(buildpack.Info{ID: "id", Version: "version", Name: "name"})
+			ctx.WriteFileIfChanged(path, []byte(tc.contents), 0755)
+
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading %s: %v", path, err)
+			}
+			if string(got) != tc.contents {
+				t.Errorf("contents = %q, want %q", got, tc.contents)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat %s: %v", path, err)
+			}
+			if gotModTime := fi.ModTime().Equal(past); gotModTime != tc.wantModTime {
+				t.Errorf("mtime preserved = %t, want %t", gotModTime, tc.wantModTime)
+			}
+			if tc.wantModTime && fi.Mode().Perm() != 0755 {
+				t.Errorf("mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0755))
+			}
+		})
+	}
+}
+
+func TestReadFileNormalized(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "lf",
+			content: "web: python main.py\nworker: python worker.py\n",
+			want:    "web: python main.py\nworker: python worker.py\n",
+		},
+		{
+			name:    "crlf",
+			content: "web: python main.py\r\nworker: python worker.py\r\n",
+			want:    "web: python main.py\nworker: python worker.py\n",
+		},
+		{
+			name:    "cr",
+			content: "3.8.0\r",
+			want:    "3.8.0\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "read-normalized-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "Procfile")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("writing %s: %v", path, err)
+			}
+
+			ctx := NewContext(buildpack.Info{ID: "id", Version: "version", Name: "name"})
+			if got := string(ctx.ReadFileNormalized(path)); got != tc.want {
+				t.Errorf("ReadFileNormalized() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+// runtimeEnv lists the env vars set by the buildpacks that applications rely on at launch. They are always allowed in
+// the launch environment.
+var runtimeEnv = []string{
+	"DOTNET_ROOT",
+	"DOTNET_RUNNING_IN_CONTAINER",
+	env.FunctionSignatureTypeLaunch,
+	env.FunctionSourceLaunch,
+	env.FunctionTargetLaunch,
+	"GOCACHE",
+	"LD_LIBRARY_PATH",
+	"NODE_ENV",
+	"NODE_PATH",
+	"PATH",
+	"PORT",
+	"PYTHONPATH",
+	"PYTHONUNBUFFERED",
+}
+
+// stripLaunchEnv removes the env vars that are not in the allowlist set by GOOGLE_LAUNCH_ENV_ALLOWLIST from the
+// launch environment of the layers of the current buildpack. Shared env vars of launch layers remain available to
+// subsequent buildpacks at build time. It does nothing if the allowlist is not set.
+func (ctx *Context) stripLaunchEnv() {
+	allowlist := os.Getenv(env.LaunchEnvAllowlist)
+	if allowlist == "" {
+		return
+	}
+	allowed := append(strings.Split(allowlist, ","), runtimeEnv...)
+	fis, err := ioutil.ReadDir(ctx.b.Layers.Root)
+	if err != nil {
+		ctx.Exit(1, InternalErrorf("reading layers dir: %v", err))
+	}
+	var stripped []string
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		l := ctx.b.Layers.Layer(fi.Name())
+		stripped = append(stripped, ctx.stripEnvDir(filepath.Join(l.Root, "env.launch"), "", allowed)...)
+		if isLaunchLayer(l.Metadata) {
+			stripped = append(stripped, ctx.stripEnvDir(filepath.Join(l.Root, "env"), filepath.Join(l.Root, "env.build"), allowed)...)
+		}
+	}
+	if len(stripped) > 0 {
+		sort.Strings(stripped)
+		ctx.Logf("Removed env vars not in %s from the launch environment: %s", env.LaunchEnvAllowlist, strings.Join(stripped, ", "))
+	}
+}
+
+// stripEnvDir removes the env files in dir for env vars that are not allowed, moving them to buildDir instead if it is
+// not empty. It returns the names of the env vars removed.
+func (ctx *Context) stripEnvDir(dir, buildDir string, allowed []string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		ctx.Exit(1, InternalErrorf("reading env dir %s: %v", dir, err))
+	}
+	var stripped []string
+	for _, fi := range fis {
+		// Env files are named after the env var, optionally with a suffix such as .override or .prepend.
+		name := strings.SplitN(fi.Name(), ".", 2)[0]
+		if launchEnvAllowed(name, allowed) {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		if buildDir == "" {
+			ctx.RemoveAll(path)
+		} else {
+			ctx.MkdirAll(buildDir, layerMode)
+			ctx.Rename(path, filepath.Join(buildDir, fi.Name()))
+		}
+		stripped = append(stripped, name)
+	}
+	return stripped
+}
+
+// launchEnvAllowed returns true if the env var name is a GOOGLE_ env var or matches one of the allowed patterns, which
+// may contain wildcards like `APP_*`.
+func launchEnvAllowed(name string, allowed []string) bool {
+	if strings.HasPrefix(name, "GOOGLE_") {
+		return true
+	}
+	for _, pattern := range allowed {
+		if ok, _ := filepath.Match(strings.TrimSpace(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isLaunchLayer returns true if the layer metadata file at path marks the layer as a launch layer.
+func isLaunchLayer(path string) bool {
+	var meta struct {
+		Launch bool `toml:"launch"`
+	}
+	if _, err := toml.DecodeFile(path, &meta); err != nil {
+		return false
+	}
+	return meta.Launch
+}
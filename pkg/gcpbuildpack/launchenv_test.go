@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+func TestStripLaunchEnv(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allowlist string
+		want      []string
+		wantGone  []string
+	}{
+		{
+			name: "no allowlist",
+			want: []string{
+				"launch/env.launch/SECRET.override",
+				"launch/env.launch/APP_NAME.override",
+				"launch/env.launch/PATH",
+				"launch/env.launch/GOOGLE_FOO.override",
+				"launch/env/TOKEN.default",
+				"build/env/TOKEN.default",
+			},
+		},
+		{
+			name:      "allowlist",
+			allowlist: "APP_*, OTHER",
+			want: []string{
+				"launch/env.launch/APP_NAME.override",
+				"launch/env.launch/PATH",
+				"launch/env.launch/GOOGLE_FOO.override",
+				"launch/env.build/TOKEN.default",
+				"build/env/TOKEN.default",
+			},
+			wantGone: []string{
+				"launch/env.launch/SECRET.override",
+				"launch/env/TOKEN.default",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, cleanUp := setUpBuildEnvironment(t)
+			defer cleanUp()
+			if tc.allowlist != "" {
+				os.Setenv(env.LaunchEnvAllowlist, tc.allowlist)
+				defer os.Unsetenv(env.LaunchEnvAllowlist)
+			}
+
+			var ctx *Context
+			build(func(c *Context) error {
+				ctx = c
+				ll := c.Layer("launch")
+				c.OverrideLaunchEnv(ll, "SECRET", "secret")
+				c.OverrideLaunchEnv(ll, "APP_NAME", "app")
+				c.PrependPathLaunchEnv(ll, "PATH", "/bin")
+				c.OverrideLaunchEnv(ll, "GOOGLE_FOO", "foo")
+				c.DefaultSharedEnv(ll, "TOKEN", "token")
+				c.WriteMetadata(ll, nil, layers.Launch)
+				bl := c.Layer("build")
+				c.DefaultSharedEnv(bl, "TOKEN", "token")
+				c.WriteMetadata(bl, nil, layers.Build)
+				return nil
+			})
+
+			for _, f := range tc.want {
+				if !ctx.FileExists(ctx.b.Layers.Root, f) {
+					t.Errorf("%s does not exist, want it to exist", f)
+				}
+			}
+			for _, f := range tc.wantGone {
+				if ctx.FileExists(ctx.b.Layers.Root, f) {
+					t.Errorf("%s exists, want it removed", f)
+				}
+			}
+		})
+	}
+}
+
+func TestLaunchEnvAllowed(t *testing.T) {
+	allowed := []string{"APP_*", " DATABASE_URL"}
+	testCases := []struct {
+		name string
+		want bool
+	}{
+		{name: "APP_NAME", want: true},
+		{name: "DATABASE_URL", want: true},
+		{name: "GOOGLE_RUNTIME", want: true},
+		{name: "DATABASE_PASSWORD", want: false},
+		{name: "APP", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := launchEnvAllowed(tc.name, allowed); got != tc.want {
+				t.Errorf("launchEnvAllowed(%q, %v) = %t, want %t", tc.name, allowed, got, tc.want)
+			}
+		})
+	}
+}
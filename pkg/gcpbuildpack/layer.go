@@ -15,24 +15,273 @@
 package gcpbuildpack
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
 const (
 	layerMode os.FileMode = 0755
+	// builtAtFile is the file in a layer storing the time the layer was built, as recorded by MarkLayerBuilt.
+	builtAtFile = ".built_at"
+	// maxReportedLayerFiles is the maximum number of disallowed files named by AssertLayerContents.
+	maxReportedLayerFiles = 10
+	// execDDir is the directory in a layer containing programs run by the launcher before the process starts.
+	execDDir = "exec.d"
+	// execDMinAPI is the earliest buildpack API for which the launcher runs exec.d programs.
+	execDMinAPI = "0.5"
 )
 
-// Layer returns a layer, creating its directory.
+// Layer returns a layer, creating its directory. If GOOGLE_CLEAR_CACHE is set, the contents and metadata restored
+// from the cache are cleared the first time the layer is returned in the build, so that every cached layer is rebuilt.
 func (ctx *Context) Layer(name string) *layers.Layer {
 	l := ctx.b.Layers.Layer(name)
+	if ctx.ClearCacheRequested() && !ctx.clearedLayers[name] {
+		if ctx.clearedLayers == nil {
+			ctx.clearedLayers = map[string]bool{}
+		}
+		ctx.clearedLayers[name] = true
+		ctx.RemoveAll(l.Root)
+		ctx.RemoveMetadata(&l)
+	}
 	ctx.MkdirAll(l.Root, layerMode)
 	return &l
 }
 
+// BuildToolLayer returns a layer for tools that are only needed during the build, such as a C compiler or a package
+// manager plugin, creating its directory. The layer is available to this and later buildpacks during the build, with
+// its bin directory prepended to PATH, and is cached between builds, but its contents are never in the launch image.
+// Metadata written for the layer later must not set layers.Launch.
+func (ctx *Context) BuildToolLayer(name string) *layers.Layer {
+	l := ctx.Layer(name)
+	// The lifecycle adds the bin directory of build layers to PATH for later buildpacks.
+	bin := filepath.Join(l.Root, "bin")
+	ctx.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ctx.WriteMetadata(l, nil, layers.Build, layers.Cache)
+	return l
+}
+
+// ClearCacheRequested returns true if GOOGLE_CLEAR_CACHE is set to force a clean build, in which case cache checks must
+// report a miss so that cached layers are cleared and reinstalled. A warning is logged the first time it returns true.
+func (ctx *Context) ClearCacheRequested() bool {
+	if ctx.clearCache == nil {
+		clear, err := env.IsPresentAndTrue(env.ClearCache)
+		if err != nil {
+			ctx.Warnf("%s env var must be parseable to a bool: %v", env.ClearCache, err)
+		}
+		if clear {
+			ctx.Warnf("%s is set, bypassing cached layers: dependencies and runtimes will be reinstalled.", env.ClearCache)
+		}
+		ctx.clearCache = &clear
+	}
+	return *ctx.clearCache
+}
+
 // ClearLayer erases the existing layer, and re-creates the directory.
 func (ctx *Context) ClearLayer(l *layers.Layer) {
 	ctx.RemoveAll(l.Root)
 	ctx.MkdirAll(l.Root, layerMode)
 }
+
+// ClearLayerExcept erases the existing layer except for the given paths relative to the layer root, for example to
+// keep a download cache inside an install layer. Paths that do not exist are ignored.
+func (ctx *Context) ClearLayerExcept(l *layers.Layer, subpaths ...string) {
+	keep := map[string]bool{}
+	for _, p := range subpaths {
+		p = filepath.Clean(p)
+		if filepath.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			ctx.Exit(1, InternalErrorf("invalid path %q to keep in layer %s: it must be relative to the layer root", p, l.Root))
+		}
+		keep[p] = true
+	}
+	ctx.clearDirExcept(l.Root, "", keep)
+	ctx.MkdirAll(l.Root, layerMode)
+}
+
+// clearDirExcept removes the entries of the directory rel in root, except for kept paths and their parents.
+func (ctx *Context) clearDirExcept(root, rel string, keep map[string]bool) {
+	fis, err := ioutil.ReadDir(filepath.Join(root, rel))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		ctx.Exit(1, InternalErrorf("reading directory %s: %v", filepath.Join(root, rel), err))
+	}
+	for _, fi := range fis {
+		p := filepath.Join(rel, fi.Name())
+		if keep[p] {
+			continue
+		}
+		if fi.IsDir() && containsKept(p, keep) {
+			ctx.clearDirExcept(root, p, keep)
+			continue
+		}
+		ctx.RemoveAll(filepath.Join(root, p))
+	}
+}
+
+// containsKept returns true if any kept path is inside the directory dir.
+func containsKept(dir string, keep map[string]bool) bool {
+	for p := range keep {
+		if strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddExecD installs script as the executable name in the exec.d directory of layer l. The launcher runs it before
+// the application starts and sets the env vars it writes to file descriptor 3 in TOML, so that launch-time env can be
+// computed in the running container, for example from its CPU limit. The script must start with a shebang line.
+// exec.d is only run for buildpacks using buildpack API 0.5 or later, so it is an error to call AddExecD from a
+// buildpack whose buildpack.toml declares an earlier API.
+func (ctx *Context) AddExecD(l *layers.Layer, name string, script []byte) {
+	if api := ctx.buildpackAPI(); !apiAtLeast(api, execDMinAPI) {
+		ctx.Exit(1, InternalErrorf("exec.d program %s requires buildpack API %s or later, buildpack %s uses API %q", name, execDMinAPI, ctx.BuildpackID(), api))
+	}
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		ctx.Exit(1, InternalErrorf("invalid exec.d program name %q", name))
+	}
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		ctx.Exit(1, InternalErrorf("exec.d program %s is not executable: it must start with a shebang line", name))
+	}
+	dir := filepath.Join(l.Root, execDDir)
+	ctx.MkdirAll(dir, layerMode)
+	path := filepath.Join(dir, name)
+	ctx.WriteFile(path, script, 0755)
+	// WriteFile does not change the mode of an existing file.
+	if err := os.Chmod(path, 0755); err != nil {
+		ctx.Exit(1, InternalErrorf("making %s executable: %v", path, err))
+	}
+}
+
+// buildpackAPI returns the buildpack API declared in the buildpack.toml of the current buildpack, or an empty string
+// if it cannot be read.
+func (ctx *Context) buildpackAPI() string {
+	var bt struct {
+		API string `toml:"api"`
+	}
+	if _, err := toml.DecodeFile(filepath.Join(ctx.BuildpackRoot(), "buildpack.toml"), &bt); err != nil {
+		ctx.Debugf("Reading buildpack API: %v", err)
+		return ""
+	}
+	return bt.API
+}
+
+// apiAtLeast returns true if the buildpack API api, such as 0.2, is min or later.
+func apiAtLeast(api, min string) bool {
+	var major, minor, minMajor, minMinor int
+	if _, err := fmt.Sscanf(api, "%d.%d", &major, &minor); err != nil {
+		return false
+	}
+	if _, err := fmt.Sscanf(min, "%d.%d", &minMajor, &minMinor); err != nil {
+		return false
+	}
+	return major > minMajor || major == minMajor && minor >= minMinor
+}
+
+// MarkLayerBuilt records the current time in the layer as the time it was built, for LayerFreshVsSource.
+func (ctx *Context) MarkLayerBuilt(l *layers.Layer) {
+	ctx.WriteFile(filepath.Join(l.Root, builtAtFile), []byte(time.Now().Format(time.RFC3339Nano)), 0644)
+}
+
+// LayerFreshVsSource returns true if the named layer was marked built by MarkLayerBuilt after the newest modification
+// of any application file matching sourceGlobs. It is a fast check to skip rebuilding a layer in local iteration, but
+// it relies on file modification times, which are not preserved by every platform, so it should be followed by a
+// content hash check when it returns true in production builds. It returns false if the layer was never marked built.
+func (ctx *Context) LayerFreshVsSource(layer string, sourceGlobs ...string) bool {
+	l := ctx.b.Layers.Layer(layer)
+	b, err := ioutil.ReadFile(filepath.Join(l.Root, builtAtFile))
+	if err != nil {
+		return false
+	}
+	builtAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		ctx.Debugf("Invalid build time %q in layer %s: %v", b, layer, err)
+		return false
+	}
+	for _, glob := range sourceGlobs {
+		for _, path := range ctx.Glob(filepath.Join(ctx.ApplicationRoot(), glob)) {
+			fi, err := os.Stat(path)
+			if err != nil {
+				ctx.Exit(1, InternalErrorf("stating %s: %v", path, err))
+			}
+			if fi.ModTime().After(builtAt) {
+				ctx.Debugf("Layer %s is stale, %s was modified after it was built", layer, path)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AssertLayerContents warns if layer l contains files or directories matching any of disallowedGlobs, for example
+// `.git` or `*.log`, to catch caches or VCS metadata accidentally left in a layer. Globs are matched against both the
+// base name and the path relative to the layer root, and the contents of a matching directory are not reported
+// separately. If GOOGLE_LAYER_CONTENTS_STRICT is set, it returns a user error instead.
+func (ctx *Context) AssertLayerContents(l *layers.Layer, disallowedGlobs ...string) error {
+	found, err := disallowedLayerFiles(l.Root, disallowedGlobs)
+	if err != nil {
+		ctx.Exit(1, InternalErrorf("checking contents of layer %s: %v", filepath.Base(l.Root), err))
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	names := found
+	if len(names) > maxReportedLayerFiles {
+		names = append(names[:maxReportedLayerFiles:maxReportedLayerFiles], "...")
+	}
+	msg := "layer %s contains %d disallowed files or directories: %s"
+	strict, err := env.IsPresentAndTrue(env.LayerContentsStrict)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.LayerContentsStrict, err)
+	}
+	if strict {
+		return UserErrorf(msg, filepath.Base(l.Root), len(found), strings.Join(names, ", "))
+	}
+	ctx.Warnf(msg+" (set %s=true to fail the build instead).", filepath.Base(l.Root), len(found), strings.Join(names, ", "), env.LayerContentsStrict)
+	return nil
+}
+
+// disallowedLayerFiles returns the paths relative to root of the files and directories matching any of globs.
+func disallowedLayerFiles(root string, globs []string) ([]string, error) {
+	var found []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		match, err := matchesAny(info.Name(), globs)
+		if err != nil {
+			return err
+		}
+		if !match {
+			if match, err = matchesAny(rel, globs); err != nil {
+				return err
+			}
+		}
+		if !match {
+			return nil
+		}
+		found = append(found, rel)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,424 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+func TestLayerFreshVsSource(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mark      bool
+		sourceAge time.Duration
+		want      bool
+	}{
+		{
+			name:      "source older than layer",
+			mark:      true,
+			sourceAge: time.Hour,
+			want:      true,
+		},
+		{
+			name:      "source newer than layer",
+			mark:      true,
+			sourceAge: -time.Hour,
+			want:      false,
+		},
+		{
+			name:      "layer not marked built",
+			sourceAge: time.Hour,
+			want:      false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			temps, cleanUp := setUpBuildEnvironment(t)
+			defer cleanUp()
+			src := filepath.Join(temps.codeDir, "main.py")
+			if err := ioutil.WriteFile(src, nil, 0644); err != nil {
+				t.Fatalf("writing %s: %v", src, err)
+			}
+			mtime := time.Now().Add(-tc.sourceAge)
+			if err := os.Chtimes(src, mtime, mtime); err != nil {
+				t.Fatalf("setting mtime of %s: %v", src, err)
+			}
+
+			var got bool
+			build(func(ctx *Context) error {
+				l := ctx.Layer("deps")
+				if tc.mark {
+					ctx.MarkLayerBuilt(l)
+				}
+				got = ctx.LayerFreshVsSource("deps", "*.py", "*.txt")
+				return nil
+			})
+
+			if got != tc.want {
+				t.Errorf("LayerFreshVsSource() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClearLayerExcept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clear-layer-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	l := &layers.Layer{Root: filepath.Join(dir, "layer")}
+	for _, f := range []string{"bin/python", "lib/site-packages/flask/__init__.py", "lib/cache/wheels/flask.whl", "lib/cache/http/index", "env/PATH"} {
+		path := filepath.Join(l.Root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating dir for %s: %v", f, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+
+	ctx.ClearLayerExcept(l, "lib/cache/wheels", "env/PATH", "missing")
+
+	var got []string
+	if err := filepath.Walk(l.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(l.Root, path)
+			if err != nil {
+				return err
+			}
+			got = append(got, rel)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("walking layer: %v", err)
+	}
+	want := []string{"env/PATH", "lib/cache/wheels/flask.whl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ClearLayerExcept() kept %v, want %v", got, want)
+	}
+}
+
+func TestClearLayerExceptInvalidPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clear-layer-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	l := &layers.Layer{Root: filepath.Join(dir, "layer")}
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+	oldExit := exit
+	exit = func(code int) {
+		panic(exitPanic(code))
+	}
+	defer func() {
+		exit = oldExit
+		if r := recover(); r != exitPanic(1) {
+			t.Errorf("ClearLayerExcept() exit got=%v want=%v", r, exitPanic(1))
+		}
+	}()
+
+	ctx.ClearLayerExcept(l, "../other")
+}
+
+func TestClearCacheRequested(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		set   bool
+		want  bool
+	}{
+		{name: "not set"},
+		{name: "true", value: "true", set: true, want: true},
+		{name: "false", value: "false", set: true},
+		{name: "invalid", value: "yes please", set: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.set {
+				os.Setenv(env.ClearCache, tc.value)
+				defer os.Unsetenv(env.ClearCache)
+			}
+			ctx := NewContextForTests(buildpack.Info{}, "")
+
+			if got := ctx.ClearCacheRequested(); got != tc.want {
+				t.Errorf("ClearCacheRequested() = %t, want %t", got, tc.want)
+			}
+			// The result is kept for the rest of the build.
+			os.Setenv(env.ClearCache, "true")
+			defer os.Unsetenv(env.ClearCache)
+			if got := ctx.ClearCacheRequested(); got != tc.want {
+				t.Errorf("second ClearCacheRequested() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLayerClearCache(t *testing.T) {
+	os.Setenv(env.ClearCache, "true")
+	defer os.Unsetenv(env.ClearCache)
+	temps, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+	cached := filepath.Join(temps.layersDir, "deps", "cached")
+	metadata := filepath.Join(temps.layersDir, "deps.toml")
+	for _, f := range []string{cached, metadata} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatalf("creating dir for %s: %v", f, err)
+		}
+		if err := ioutil.WriteFile(f, []byte("cache = true\n"), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+	ctx := newBuildContext()
+
+	l := ctx.Layer("deps")
+	for _, f := range []string{cached, metadata} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s exists after Layer(), want it cleared", f)
+		}
+	}
+
+	// Files written during the build are kept when the layer is returned again.
+	built := filepath.Join(l.Root, "built")
+	if err := ioutil.WriteFile(built, []byte("built"), 0644); err != nil {
+		t.Fatalf("writing %s: %v", built, err)
+	}
+	ctx.Layer("deps")
+	if _, err := os.Stat(built); err != nil {
+		t.Errorf("%s was cleared by the second Layer(): %v", built, err)
+	}
+}
+
+func TestAssertLayerContents(t *testing.T) {
+	testCases := []struct {
+		name         string
+		files        []string
+		strict       bool
+		wantErr      bool
+		wantWarnings int
+	}{
+		{
+			name:  "allowed",
+			files: []string{"lib/app.py", "lib/app.pyc", "bin/run"},
+		},
+		{
+			name:         "disallowed warns",
+			files:        []string{"lib/app.py", "src/.git/HEAD", "logs/build.log", "lib/__pycache__/app.pyc"},
+			wantWarnings: 1,
+		},
+		{
+			name:    "disallowed strict",
+			files:   []string{"lib/app.py", "src/.git/HEAD"},
+			strict:  true,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "layer-contents-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			l := &layers.Layer{Root: filepath.Join(dir, "layer")}
+			for _, f := range tc.files {
+				path := filepath.Join(l.Root, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("creating dir for %s: %v", f, err)
+				}
+				if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+					t.Fatalf("writing %s: %v", f, err)
+				}
+			}
+			if tc.strict {
+				os.Setenv(env.LayerContentsStrict, "true")
+				defer os.Unsetenv(env.LayerContentsStrict)
+			}
+			ctx := NewContextForTests(buildpack.Info{}, dir)
+
+			err = ctx.AssertLayerContents(l, ".git", "*.log", "lib/__pycache__")
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("AssertLayerContents() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got := len(ctx.decisions.warnings); got != tc.wantWarnings {
+				t.Errorf("AssertLayerContents() logged %d warnings, want %d: %v", got, tc.wantWarnings, ctx.decisions.warnings)
+			}
+		})
+	}
+}
+
+func TestDisallowedLayerFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-contents-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"src/.git/HEAD", "src/.git/objects/ab", "logs/build.log", "lib/__pycache__/app.pyc", "lib/app.py", "vendor/__pycache__/x.pyc"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating dir for %s: %v", f, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	got, err := disallowedLayerFiles(dir, []string{".git", "*.log", "lib/__pycache__"})
+	if err != nil {
+		t.Fatalf("disallowedLayerFiles() got error: %v", err)
+	}
+
+	want := []string{"lib/__pycache__", "logs/build.log", "src/.git"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("disallowedLayerFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestBuildToolLayer(t *testing.T) {
+	temps, cleanUp := setUpBuildEnvironment(t)
+	defer cleanUp()
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+
+	var l *layers.Layer
+	build(func(ctx *Context) error {
+		l = ctx.BuildToolLayer("tools")
+		return nil
+	})
+
+	var flags struct {
+		Launch bool `toml:"launch"`
+		Build  bool `toml:"build"`
+		Cache  bool `toml:"cache"`
+	}
+	if _, err := toml.DecodeFile(filepath.Join(temps.layersDir, "tools.toml"), &flags); err != nil {
+		t.Fatalf("decoding layer metadata: %v", err)
+	}
+	if flags.Launch || !flags.Build || !flags.Cache {
+		t.Errorf("BuildToolLayer() flags launch=%t build=%t cache=%t, want launch=false build=true cache=true", flags.Launch, flags.Build, flags.Cache)
+	}
+	if got, want := strings.SplitN(os.Getenv("PATH"), string(os.PathListSeparator), 2)[0], filepath.Join(l.Root, "bin"); got != want {
+		t.Errorf("BuildToolLayer() PATH starts with %q, want %q", got, want)
+	}
+}
+
+// execDContext returns a context for a buildpack declaring the given buildpack API, and a layer in a temp dir.
+func execDContext(t *testing.T, api string) (*Context, *layers.Layer, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "exec-d-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "buildpack.toml"), []byte("api = \""+api+"\"\n"), 0644); err != nil {
+		t.Fatalf("writing buildpack.toml: %v", err)
+	}
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+	ctx.buildpackRoot = dir
+	return ctx, &layers.Layer{Root: filepath.Join(dir, "layer")}, func() { os.RemoveAll(dir) }
+}
+
+func TestAddExecD(t *testing.T) {
+	ctx, l, cleanUp := execDContext(t, "0.5")
+	defer cleanUp()
+	script := []byte("#!/bin/bash\necho \"WEB_CONCURRENCY = \\\"$(nproc)\\\"\" >&3\n")
+
+	ctx.AddExecD(l, "concurrency", script)
+
+	path := filepath.Join(l.Root, "exec.d", "concurrency")
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if string(got) != string(script) {
+		t.Errorf("AddExecD() wrote %q, want %q", got, script)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stating %s: %v", path, err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("AddExecD() mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0755))
+	}
+}
+
+func TestAddExecDErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		api    string
+		script string
+	}{
+		{
+			name:   "not executable",
+			api:    "0.5",
+			script: "echo WEB_CONCURRENCY = 2 >&3\n",
+		},
+		{
+			name:   "buildpack API without exec.d",
+			api:    "0.2",
+			script: "#!/bin/bash\necho WEB_CONCURRENCY = 2 >&3\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, l, cleanUp := execDContext(t, tc.api)
+			defer cleanUp()
+			oldExit := exit
+			exit = func(code int) {
+				panic(exitPanic(code))
+			}
+			defer func() {
+				exit = oldExit
+				if r := recover(); r != exitPanic(1) {
+					t.Errorf("AddExecD() exit got=%v want=%v", r, exitPanic(1))
+				}
+			}()
+
+			ctx.AddExecD(l, "concurrency", []byte(tc.script))
+		})
+	}
+}
+
+func TestAPIAtLeast(t *testing.T) {
+	testCases := []struct {
+		api  string
+		want bool
+	}{
+		{api: "0.2", want: false},
+		{api: "0.5", want: true},
+		{api: "0.10", want: true},
+		{api: "1.0", want: true},
+		{api: "", want: false},
+	}
+	for _, tc := range testCases {
+		if got := apiAtLeast(tc.api, "0.5"); got != tc.want {
+			t.Errorf("apiAtLeast(%q, %q) = %t, want %t", tc.api, "0.5", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+// CheckLockfiles warns if any of the ignored lockfiles exists in the application root alongside used, the lockfile
+// the buildpack installs dependencies from. If GOOGLE_LOCKFILE_STRICT is set, it returns a user error instead.
+func (ctx *Context) CheckLockfiles(used string, ignored ...string) error {
+	if !ctx.FileExists(ctx.ApplicationRoot(), used) {
+		return nil
+	}
+	var conflicts []string
+	for _, f := range ignored {
+		if ctx.FileExists(ctx.ApplicationRoot(), f) {
+			conflicts = append(conflicts, f)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	msg := "found conflicting lockfiles %s and %s, dependencies will be installed from %s. Remove the lockfiles that are not used to ensure deterministic builds"
+	strict, err := env.IsPresentAndTrue(env.LockfileStrict)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.LockfileStrict, err)
+	}
+	if strict {
+		return UserErrorf(msg, used, strings.Join(conflicts, ", "), used)
+	}
+	ctx.Warnf(msg+" (set %s=true to fail the build instead).", used, strings.Join(conflicts, ", "), used, env.LockfileStrict)
+	return nil
+}
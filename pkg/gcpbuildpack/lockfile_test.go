@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestCheckLockfiles(t *testing.T) {
+	testCases := []struct {
+		name         string
+		files        []string
+		strict       bool
+		wantErr      bool
+		wantWarnings int
+	}{
+		{
+			name:  "only used lockfile",
+			files: []string{"yarn.lock"},
+		},
+		{
+			name:  "only ignored lockfile",
+			files: []string{"package-lock.json"},
+		},
+		{
+			name:         "conflict warns",
+			files:        []string{"yarn.lock", "package-lock.json"},
+			wantWarnings: 1,
+		},
+		{
+			name:    "conflict in strict mode fails",
+			files:   []string{"yarn.lock", "package-lock.json"},
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name:   "no conflict in strict mode",
+			files:  []string{"yarn.lock"},
+			strict: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lockfiles-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatalf("writing %s: %v", f, err)
+				}
+			}
+			if tc.strict {
+				os.Setenv(env.LockfileStrict, "true")
+				defer os.Unsetenv(env.LockfileStrict)
+			}
+
+			ctx := NewContextForTests(buildpack.Info{ID: "id", Version: "version", Name: "name"}, dir)
+			err = ctx.CheckLockfiles("yarn.lock", "package-lock.json")
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("CheckLockfiles() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got := len(ctx.decisions.warnings); got != tc.wantWarnings {
+				t.Errorf("CheckLockfiles() emitted %d warnings, want %d", got, tc.wantWarnings)
+			}
+		})
+	}
+}
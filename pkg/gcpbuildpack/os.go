@@ -17,6 +17,7 @@ package gcpbuildpack
 import (
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Rename renames the old path to the new path, exiting on any error.
@@ -68,6 +69,25 @@ func (ctx *Context) FileExists(elem ...string) bool {
 	return true
 }
 
+// RequireFiles returns a user error listing all of paths that do not exist, for example the expected outputs of a
+// build step, or nil if they all exist. It exits on any other error.
+func (ctx *Context) RequireFiles(paths ...string) error {
+	var missing []string
+	for _, p := range paths {
+		if !ctx.FileExists(p) {
+			missing = append(missing, p)
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return UserErrorf("expected output %s does not exist", missing[0])
+	default:
+		return UserErrorf("expected outputs %s do not exist", strings.Join(missing, ", "))
+	}
+}
+
 // Setenv immediately sets an environment variable, exiting on any error.
 // Note: this only sets an env var for the current script invocation. If you need an env var that
 // persists through the build environment or the launch environment, use ctx.PrependBuildEnv,...
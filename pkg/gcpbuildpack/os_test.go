@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestRequireFiles(t *testing.T) {
+	testCases := []struct {
+		name    string
+		paths   []string
+		wantErr string
+	}{
+		{
+			name: "no paths",
+		},
+		{
+			name:  "all exist",
+			paths: []string{"a.jar", "b.jar"},
+		},
+		{
+			name:    "one missing",
+			paths:   []string{"a.jar", "missing.jar"},
+			wantErr: "expected output missing.jar does not exist",
+		},
+		{
+			name:    "several missing",
+			paths:   []string{"missing.jar", "a.jar", "target/missing.jar"},
+			wantErr: "expected outputs missing.jar, target/missing.jar do not exist",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "require-files-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range []string{"a.jar", "b.jar"} {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", f, err)
+				}
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatalf("Failed to change to %s: %v", dir, err)
+			}
+			defer os.Chdir(wd)
+			ctx := NewContextForTests(buildpack.Info{}, dir)
+
+			err = ctx.RequireFiles(tc.paths...)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("RequireFiles() got error: %v", err)
+				}
+				return
+			}
+			be, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("RequireFiles() got error %v, want *Error", err)
+			}
+			if be.Message != tc.wantErr {
+				t.Errorf("RequireFiles() got message %q, want %q", be.Message, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Platform describes the operating system and architecture that a build targets.
+type Platform struct {
+	// OS is the operating system, using Go naming, e.g. linux.
+	OS string
+	// Arch is the architecture, using Go naming, e.g. amd64 or arm64.
+	Arch string
+}
+
+// String returns the platform in os/arch form.
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// Platform returns the platform that the build targets.
+// Buildpack binaries are compiled for the builder they run on, so this matches the build and run images.
+func (ctx *Context) Platform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// FindArtifactURL returns the first of urls that is available for download.
+// If none are available, it returns a user error listing every URL tried.
+func (ctx *Context) FindArtifactURL(urls ...string) (string, error) {
+	var tried []string
+	for _, url := range urls {
+		code := ctx.HTTPStatus(url)
+		if code == http.StatusOK {
+			return url, nil
+		}
+		tried = append(tried, fmt.Sprintf("%s (status %d)", url, code))
+	}
+	return "", UserErrorf("no artifact available for platform %s, tried: %s", ctx.Platform(), strings.Join(tried, ", "))
+}
+
+// PlatformFeature is a capability of the build environment that a buildpack requires, see RequirePlatform.
+type PlatformFeature struct {
+	name  string
+	check func() error
+}
+
+// String returns a description of the feature.
+func (f PlatformFeature) String() string {
+	return f.name
+}
+
+// WritableTmp requires the temporary directory to be writable.
+var WritableTmp = WritableDir(os.TempDir())
+
+// WritableDir requires dir to exist and be writable.
+func WritableDir(dir string) PlatformFeature {
+	return PlatformFeature{
+		name: fmt.Sprintf("writable %s", dir),
+		check: func() error {
+			f, err := ioutil.TempFile(dir, ".write-check-")
+			if err != nil {
+				return fmt.Errorf("%s is not writable, check that it is not mounted read-only: %v", dir, err)
+			}
+			f.Close()
+			os.Remove(f.Name())
+			return nil
+		},
+	}
+}
+
+// MinFreeDisk requires at least bytes of free disk space on the filesystem containing dir.
+func MinFreeDisk(dir string, bytes uint64) PlatformFeature {
+	return PlatformFeature{
+		name: fmt.Sprintf("%d bytes free in %s", bytes, dir),
+		check: func() error {
+			var st syscall.Statfs_t
+			if err := syscall.Statfs(dir, &st); err != nil {
+				return fmt.Errorf("checking free disk space in %s: %v", dir, err)
+			}
+			if free := st.Bavail * uint64(st.Bsize); free < bytes {
+				return fmt.Errorf("%s has %d bytes of free disk space, at least %d are required, increase the disk size of the build environment", dir, free, bytes)
+			}
+			return nil
+		},
+	}
+}
+
+// networkTimeout is how long NetworkAccess waits for a connection.
+var networkTimeout = 10 * time.Second
+
+// NetworkAccess requires that a TCP connection can be made to address, in host:port form.
+func NetworkAccess(address string) PlatformFeature {
+	return PlatformFeature{
+		name: fmt.Sprintf("network access to %s", address),
+		check: func() error {
+			conn, err := net.DialTimeout("tcp", address, networkTimeout)
+			if err != nil {
+				return fmt.Errorf("cannot connect to %s, check the network and proxy configuration of the build environment: %v", address, err)
+			}
+			conn.Close()
+			return nil
+		},
+	}
+}
+
+// RequirePlatform checks that the build environment provides all of features and exits with an internal error
+// listing every unmet feature otherwise. Call it at the start of build to report misconfigured environments, such as a
+// read-only workspace, before they cause confusing failures later.
+func (ctx *Context) RequirePlatform(features ...PlatformFeature) {
+	if err := requirePlatform(features...); err != nil {
+		ctx.Exit(1, err)
+	}
+}
+
+// requirePlatform implements RequirePlatform, returning nil rather than a nil *Error in an error interface.
+func requirePlatform(features ...PlatformFeature) *Error {
+	var unmet []string
+	for _, f := range features {
+		if err := f.check(); err != nil {
+			unmet = append(unmet, err.Error())
+		}
+	}
+	if len(unmet) == 0 {
+		return nil
+	}
+	return InternalErrorf("build environment does not meet the requirements of this buildpack: %s", strings.Join(unmet, "; "))
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestFindArtifactURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/found" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	found, missing := server.URL+"/found", server.URL+"/missing"
+
+	testCases := []struct {
+		name    string
+		urls    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "first available",
+			urls: []string{found, missing},
+			want: found,
+		},
+		{
+			name: "falls back",
+			urls: []string{missing, found},
+			want: found,
+		},
+		{
+			name:    "none available",
+			urls:    []string{missing},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := NewContext(buildpack.Info{ID: "id", Version: "version", Name: "name"})
+
+			got, err := ctx.FindArtifactURL(tc.urls...)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("FindArtifactURL(%v) got nil error, want error", tc.urls)
+				}
+				for _, url := range tc.urls {
+					if !strings.Contains(err.Error(), url) {
+						t.Errorf("FindArtifactURL(%v) error %q does not mention %s", tc.urls, err, url)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindArtifactURL(%v) got error: %v", tc.urls, err)
+			}
+			if got != tc.want {
+				t.Errorf("FindArtifactURL(%v) = %q, want %q", tc.urls, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequirePlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platform")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	missingDir := filepath.Join(dir, "missing")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listening: %v", err)
+	}
+	defer ln.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listening: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	testCases := []struct {
+		name     string
+		features []PlatformFeature
+		want     []string
+	}{
+		{
+			name: "no features",
+		},
+		{
+			name:     "all met",
+			features: []PlatformFeature{WritableDir(dir), MinFreeDisk(dir, 1), NetworkAccess(ln.Addr().String())},
+		},
+		{
+			name:     "missing dir",
+			features: []PlatformFeature{WritableDir(missingDir)},
+			want:     []string{missingDir + " is not writable"},
+		},
+		{
+			name:     "not enough disk",
+			features: []PlatformFeature{MinFreeDisk(dir, math.MaxUint64)},
+			want:     []string{"increase the disk size"},
+		},
+		{
+			name:     "no network",
+			features: []PlatformFeature{NetworkAccess(closedAddr)},
+			want:     []string{"cannot connect to " + closedAddr},
+		},
+		{
+			name:     "reports all unmet",
+			features: []PlatformFeature{WritableDir(missingDir), WritableDir(dir), MinFreeDisk(dir, math.MaxUint64)},
+			want:     []string{missingDir + " is not writable", "increase the disk size"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := requirePlatform(tc.features...)
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("requirePlatform() got unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("requirePlatform() got nil error, want error")
+			}
+			if err.Status != StatusInternal {
+				t.Errorf("requirePlatform() got status %v, want %v", err.Status, StatusInternal)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Message, want) {
+					t.Errorf("requirePlatform() got message %q, want it to contain %q", err.Message, want)
+				}
+			}
+		})
+	}
+}
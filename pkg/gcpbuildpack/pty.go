@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ptyDrainTimeout is how long output is read from a pseudo-terminal after the command exits.
+const ptyDrainTimeout = 50 * time.Millisecond
+
+// openPTY allocates a pseudo-terminal, returning its master side and the terminal to attach to a command.
+func openPTY() (*os.File, *os.File, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening /dev/ptmx: %v", err)
+	}
+	var unlock int32
+	if err := ioctl(ptmx, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		ptmx.Close()
+		return nil, nil, fmt.Errorf("unlocking pseudo-terminal: %v", err)
+	}
+	var n uint32
+	if err := ioctl(ptmx, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		ptmx.Close()
+		return nil, nil, fmt.Errorf("getting pseudo-terminal number: %v", err)
+	}
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	tty, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, fmt.Errorf("opening %s: %v", name, err)
+	}
+	return ptmx, tty, nil
+}
+
+// ioctl performs the ioctl req on f. It does not use f.Fd, which would put f in blocking mode and prevent read
+// deadlines.
+func ioctl(f *os.File, req, arg uintptr) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// runWithPTY runs ecmd, displayed as name, with a pseudo-terminal as its controlling terminal and standard streams,
+// copying its output to w. timedOut is true if the command was terminated by its timeout, and the error is the same
+// as that of ecmd.Run. See startCommand and waitCommand for untracked and cctx.
+func (ctx *Context) runWithPTY(ecmd *exec.Cmd, name string, untracked bool, cctx context.Context, w io.Writer) (timedOut bool, err error) {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		return false, err
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	ecmd.Stdin = tty
+	ecmd.Stdout = tty
+	ecmd.Stderr = tty
+	ecmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := ctx.startCommand(ecmd, name, untracked); err != nil {
+		return false, err
+	}
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, ptmx)
+		copied <- err
+	}()
+	timedOut, err = ctx.waitCommand(ecmd, name, untracked, cctx)
+
+	// The terminal is kept open until the command exits, as the kernel may discard output that has not reached the
+	// master side when the terminal is closed. Output written just before exiting may still be in flight, so reading
+	// continues briefly.
+	if derr := ptmx.SetReadDeadline(time.Now().Add(ptyDrainTimeout)); derr != nil {
+		// Closing the terminal ends reading instead, at the risk of losing output.
+		tty.Close()
+	}
+	if cerr := <-copied; cerr != nil && !os.IsTimeout(cerr) && !errors.Is(cerr, syscall.EIO) && err == nil {
+		return timedOut, fmt.Errorf("reading pseudo-terminal: %v", cerr)
+	}
+	return timedOut, err
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// buildReport is a machine-readable summary of the decisions made by each buildpack in a build.
+type buildReport struct {
+	Buildpacks []buildpackReport `json:"buildpacks"`
+}
+
+type buildpackReport struct {
+	BuildpackID      string            `json:"buildpackId"`
+	BuildpackVersion string            `json:"buildpackVersion"`
+	RuntimeVersions  map[string]string `json:"runtimeVersions,omitempty"`
+	PackageManager   string            `json:"packageManager,omitempty"`
+	Dependencies     map[string]string `json:"dependencies,omitempty"`
+	DependencyCount  int               `json:"dependencyCount,omitempty"`
+	// InstalledDependencies maps layer names to the packages installed in them.
+	InstalledDependencies map[string][]Dependency `json:"installedDependencies,omitempty"`
+	Cache                 map[string]string       `json:"cache,omitempty"`
+	Warnings              []string                `json:"warnings,omitempty"`
+	// Error is the message of the error that failed the buildpack, empty if it succeeded.
+	Error          string `json:"error,omitempty"`
+	DurationMs     int64  `json:"totalDurationMs"`
+	UserDurationMs int64  `json:"userDurationMs"`
+}
+
+// Dependency is a package installed by a buildpack.
+type Dependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// decisions are the build decisions recorded for the build report.
+type decisions struct {
+	runtimeVersions map[string]string
+	packageManager  string
+	dependencyCount int
+	installed       map[string][]Dependency
+	cache           map[string]string
+	warnings        []string
+}
+
+// BuildReportRequested returns true if the platform requested a build report. Buildpacks can use it to skip
+// collecting information that is only used in the report.
+func (ctx *Context) BuildReportRequested() bool {
+	return os.Getenv(env.BuildReport) != ""
+}
+
+// RecordRuntimeVersion records the resolved version of a runtime for the build report.
+func (ctx *Context) RecordRuntimeVersion(runtime, version string) {
+	if ctx.decisions.runtimeVersions == nil {
+		ctx.decisions.runtimeVersions = map[string]string{}
+	}
+	ctx.decisions.runtimeVersions[runtime] = version
+}
+
+// RecordPackageManager records the package manager used to install dependencies for the build report.
+func (ctx *Context) RecordPackageManager(name string) {
+	ctx.decisions.packageManager = name
+}
+
+// RecordDependencyCount records the number of application dependencies for the build report.
+func (ctx *Context) RecordDependencyCount(count int) {
+	ctx.decisions.dependencyCount = count
+}
+
+// DependenciesRequested returns true if the installed packages should be listed and passed to RecordDependencies,
+// either for the build report or to check the size of the dependency tree.
+func (ctx *Context) DependenciesRequested() bool {
+	return ctx.BuildReportRequested() || dependencyWarnThreshold(ctx) > 0
+}
+
+// RecordDependencies records the packages installed in the named layer for the build report. It warns when there are
+// more packages than GOOGLE_DEPENDENCY_WARN_THRESHOLD, as large dependency trees make builds slower and riskier.
+func (ctx *Context) RecordDependencies(layer string, deps []Dependency) {
+	if ctx.decisions.installed == nil {
+		ctx.decisions.installed = map[string][]Dependency{}
+	}
+	ctx.decisions.installed[layer] = deps
+	if threshold := dependencyWarnThreshold(ctx); threshold > 0 && len(deps) > threshold {
+		ctx.Warnf("%d packages are installed in %s, more than %d. Large dependency trees slow down builds and increase the risk of vulnerable or conflicting packages, consider reviewing them. Set %s to change this threshold.", len(deps), layer, threshold, env.DependencyWarnThreshold)
+	}
+}
+
+// dependencyWarnThreshold returns the number of installed packages above which RecordDependencies warns, or 0 if the
+// check is disabled, which it is unless GOOGLE_DEPENDENCY_WARN_THRESHOLD is set, as listing packages costs a command.
+func dependencyWarnThreshold(ctx *Context) int {
+	val := os.Getenv(env.DependencyWarnThreshold)
+	if val == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		ctx.Warnf("%s must be a non-negative integer, got %q, disabling the check.", env.DependencyWarnThreshold, val)
+		return 0
+	}
+	return n
+}
+
+func (ctx *Context) recordCache(tag, result string) {
+	if ctx.decisions.cache == nil {
+		ctx.decisions.cache = map[string]string{}
+	}
+	ctx.decisions.cache[tag] = result
+}
+
+// WriteBuildReport adds a summary of the current buildpack to the JSON build report at path, creating it if necessary.
+// Reports from previous buildpacks in the same build are preserved. The report is informational, so failing to write
+// it only emits a warning.
+func (ctx *Context) WriteBuildReport(path string) {
+	ctx.writeBuildReport(path, nil)
+}
+
+// writeBuildReport implements WriteBuildReport, recording be as the error that failed the buildpack if it is not nil.
+func (ctx *Context) writeBuildReport(path string, be *Error) {
+	var br buildReport
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &br); err != nil {
+			ctx.Warnf("Failed to unmarshal %s, overwriting build report: %v", path, err)
+			br = buildReport{}
+		}
+	} else if !os.IsNotExist(err) {
+		ctx.Warnf("Failed to read %s, overwriting build report: %v", path, err)
+	}
+
+	deps := map[string]string{}
+	for _, p := range ctx.buildpackPlans {
+		deps[p.Name] = p.Version
+	}
+
+	report := buildpackReport{
+		BuildpackID:           ctx.BuildpackID(),
+		BuildpackVersion:      ctx.BuildpackVersion(),
+		RuntimeVersions:       ctx.decisions.runtimeVersions,
+		PackageManager:        ctx.decisions.packageManager,
+		Dependencies:          deps,
+		DependencyCount:       ctx.decisions.dependencyCount,
+		InstalledDependencies: ctx.decisions.installed,
+		Cache:                 ctx.decisions.cache,
+		Warnings:              ctx.decisions.warnings,
+		DurationMs:            time.Since(ctx.stats.start).Milliseconds(),
+		UserDurationMs:        ctx.stats.user.Milliseconds(),
+	}
+	if be != nil {
+		report.Error = be.Message
+	}
+	br.Buildpacks = append(br.Buildpacks, report)
+
+	data, err := json.MarshalIndent(&br, "", "  ")
+	if err != nil {
+		ctx.Warnf("Failed to marshal build report: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		ctx.Warnf("Failed to create dir for build report %s: %v", path, err)
+		return
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		ctx.Warnf("Failed to write build report %s: %v", path, err)
+	}
+}
+
+// saveBuildReport writes the build report if requested by the platform, recording be as the error that failed the
+// buildpack if it is not nil.
+func (ctx *Context) saveBuildReport(be *Error) {
+	if ctx.BuildReportRequested() {
+		ctx.writeBuildReport(os.Getenv(env.BuildReport), be)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/buildpackplan"
+)
+
+func TestWriteBuildReport(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "build-report-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "report", "report.json")
+
+	runtime := NewContext(buildpack.Info{ID: "runtime", Version: "1"})
+	runtime.RecordRuntimeVersion("nodejs", "12.18.0")
+	runtime.AddBuildpackPlan(buildpackplan.Plan{Name: "node", Version: "12.18.0"})
+	runtime.CacheHit("node")
+	runtime.WriteBuildReport(path)
+
+	npm := NewContext(buildpack.Info{ID: "npm", Version: "2"})
+	npm.RecordPackageManager("npm")
+	npm.RecordDependencyCount(3)
+	npm.RecordDependencies("npm", []Dependency{{Name: "express", Version: "4.17.1"}})
+	npm.CacheMiss("prod dependencies")
+	npm.Warnf("something %s", "happened")
+	npm.WriteBuildReport(path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading build report: %v", err)
+	}
+	var got buildReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshalling build report: %v", err)
+	}
+	for i := range got.Buildpacks {
+		got.Buildpacks[i].DurationMs = 0
+	}
+
+	want := buildReport{
+		Buildpacks: []buildpackReport{
+			{
+				BuildpackID:      "runtime",
+				BuildpackVersion: "1",
+				RuntimeVersions:  map[string]string{"nodejs": "12.18.0"},
+				Dependencies:     map[string]string{"node": "12.18.0"},
+				Cache:            map[string]string{"node": "hit"},
+			},
+			{
+				BuildpackID:      "npm",
+				BuildpackVersion: "2",
+				PackageManager:   "npm",
+				DependencyCount:  3,
+				InstalledDependencies: map[string][]Dependency{
+					"npm": {{Name: "express", Version: "4.17.1"}},
+				},
+				Cache:    map[string]string{"prod dependencies": "miss"},
+				Warnings: []string{"something happened"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("build report does not match\ngot:\n%#v\nwant:\n%#v", got, want)
+	}
+}
+
+func TestWriteBuildReportFailure(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "build-report-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "report.json")
+	ctx := NewContext(buildpack.Info{ID: "npm", Version: "2"})
+
+	ctx.writeBuildReport(path, UserErrorf("npm install failed"))
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading build report: %v", err)
+	}
+	var got buildReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshalling build report: %v", err)
+	}
+	if len(got.Buildpacks) != 1 || got.Buildpacks[0].Error != "npm install failed" {
+		t.Errorf("build report = %+v, want one buildpack with error %q", got, "npm install failed")
+	}
+}
+
+func TestWriteBuildReportUnwritable(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "build-report-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	file := filepath.Join(tempDir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("writing %s: %v", file, err)
+	}
+	ctx := NewContext(buildpack.Info{})
+
+	// The report cannot be written below a regular file, which must not fail the build.
+	ctx.WriteBuildReport(filepath.Join(file, "report.json"))
+
+	if len(ctx.decisions.warnings) == 0 {
+		t.Error("WriteBuildReport() to an unwritable path did not warn")
+	}
+}
+
+func TestRecordDependenciesWarning(t *testing.T) {
+	testCases := []struct {
+		name      string
+		threshold string
+		count     int
+		want      bool
+	}{
+		{name: "unset", count: 1000},
+		{name: "custom above", threshold: "2", count: 3, want: true},
+		{name: "custom at", threshold: "3", count: 3},
+		{name: "disabled", threshold: "0", count: 1000},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.threshold != "" {
+				os.Setenv(env.DependencyWarnThreshold, tc.threshold)
+				defer os.Unsetenv(env.DependencyWarnThreshold)
+			}
+			ctx := NewContextForTests(buildpack.Info{}, "")
+			deps := make([]Dependency, tc.count)
+
+			ctx.RecordDependencies("pip", deps)
+
+			if got := len(ctx.decisions.warnings) > 0; got != tc.want {
+				t.Errorf("RecordDependencies() warned %t, want %t: %v", got, tc.want, ctx.decisions.warnings)
+			}
+		})
+	}
+}
+
+func TestDependenciesRequested(t *testing.T) {
+	testCases := []struct {
+		name      string
+		report    string
+		threshold string
+		want      bool
+	}{
+		{name: "nothing set"},
+		{name: "threshold disabled", threshold: "0"},
+		{name: "threshold set", threshold: "200", want: true},
+		{name: "build report", report: "/tmp/report.json", want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.threshold != "" {
+				os.Setenv(env.DependencyWarnThreshold, tc.threshold)
+				defer os.Unsetenv(env.DependencyWarnThreshold)
+			}
+			if tc.report != "" {
+				os.Setenv(env.BuildReport, tc.report)
+				defer os.Unsetenv(env.BuildReport)
+			}
+			ctx := NewContextForTests(buildpack.Info{}, "")
+
+			if got := ctx.DependenciesRequested(); got != tc.want {
+				t.Errorf("DependenciesRequested() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+// Targets that an application can be built for.
+const (
+	// TargetUnknown is the target of builds that did not specify one, such as local builds with pack.
+	TargetUnknown = ""
+	// TargetAppEngine is the target of App Engine builds.
+	TargetAppEngine = "gae"
+	// TargetFunctions is the target of Cloud Functions builds.
+	TargetFunctions = "gcf"
+	// TargetCloudRun is the target of Cloud Run builds.
+	TargetCloudRun = "run"
+)
+
+// Target returns the product that the application is built for, from X_GOOGLE_TARGET_PLATFORM. Builds of a function
+// that do not specify a target are assumed to target Cloud Functions, other builds return TargetUnknown.
+func (ctx *Context) Target() string {
+	switch t := strings.ToLower(os.Getenv(env.TargetPlatform)); t {
+	case TargetAppEngine, TargetFunctions, TargetCloudRun:
+		return t
+	case TargetUnknown:
+		if target, _ := env.FunctionTargetResolved(nil); target != "" {
+			return TargetFunctions
+		}
+	default:
+		ctx.Debugf("Ignoring unknown %s %q.", env.TargetPlatform, t)
+	}
+	return TargetUnknown
+}
+
+// WarnfForTarget emits a warning only if the application may be built for target, that is if Target is target or
+// TargetUnknown. Use it for warnings that are irrelevant to other products, such as about App Engine APIs.
+func (ctx *Context) WarnfForTarget(target, format string, args ...interface{}) {
+	if t := ctx.Target(); t == target || t == TargetUnknown {
+		ctx.Warnf(format, args...)
+	}
+}
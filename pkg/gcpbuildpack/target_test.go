@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestTarget(t *testing.T) {
+	testCases := []struct {
+		name           string
+		targetPlatform string
+		functionTarget string
+		want           string
+	}{
+		{
+			name: "unknown",
+			want: TargetUnknown,
+		},
+		{
+			name:           "app engine",
+			targetPlatform: "gae",
+			want:           TargetAppEngine,
+		},
+		{
+			name:           "case insensitive",
+			targetPlatform: "RUN",
+			want:           TargetCloudRun,
+		},
+		{
+			name:           "function without target platform",
+			functionTarget: "helloWorld",
+			want:           TargetFunctions,
+		},
+		{
+			name:           "function on cloud run",
+			targetPlatform: "run",
+			functionTarget: "helloWorld",
+			want:           TargetCloudRun,
+		},
+		{
+			name:           "invalid",
+			targetPlatform: "mainframe",
+			want:           TargetUnknown,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer os.Unsetenv(env.TargetPlatform)
+			defer os.Unsetenv(env.FunctionTarget)
+			os.Setenv(env.TargetPlatform, tc.targetPlatform)
+			os.Setenv(env.FunctionTarget, tc.functionTarget)
+
+			if got := NewContextForTests(buildpack.Info{}, "").Target(); got != tc.want {
+				t.Errorf("Target() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWarnfForTarget(t *testing.T) {
+	testCases := []struct {
+		name           string
+		targetPlatform string
+		want           bool
+	}{
+		{
+			name:           "matching target",
+			targetPlatform: "gae",
+			want:           true,
+		},
+		{
+			name: "unknown target",
+			want: true,
+		},
+		{
+			name:           "other target",
+			targetPlatform: "run",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer func(l *log.Logger) { logger = l }(logger)
+			logger = log.New(&buf, "", 0)
+			defer os.Unsetenv(env.TargetPlatform)
+			os.Setenv(env.TargetPlatform, tc.targetPlatform)
+
+			NewContextForTests(buildpack.Info{}, "").WarnfForTarget(TargetAppEngine, "App Engine APIs are deprecated")
+
+			if got := buf.Len() > 0; got != tc.want {
+				t.Errorf("WarnfForTarget() warned: %t, want %t; output: %q", got, tc.want, buf.String())
+			}
+		})
+	}
+}
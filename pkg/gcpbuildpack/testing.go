@@ -26,6 +26,7 @@ import (
 	"testing"
 
 	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/buildplan"
 )
 
 type tempDirs struct {
@@ -53,19 +54,7 @@ func TestDetectWithStack(t *testing.T, detectFn DetectFn, testName string, files
 	temps, cleanUp := setUpDetectEnvironmentWithStack(t, stack)
 	defer cleanUp()
 
-	for f, c := range files {
-		fn := filepath.Join(temps.codeDir, f)
-
-		if dir := path.Dir(fn); dir != "" {
-			if err := os.MkdirAll(dir, 0744); err != nil {
-				t.Fatalf("creating directory tree %s: %v", dir, err)
-			}
-		}
-
-		if err := ioutil.WriteFile(fn, []byte(c), 0644); err != nil {
-			t.Fatalf("writing file %s: %v", fn, err)
-		}
-	}
+	writeFiles(t, temps.codeDir, files)
 
 	ctx := newDetectContext()
 	ctx.applicationRoot = temps.codeDir
@@ -103,6 +92,121 @@ func TestDetectWithStack(t *testing.T, detectFn DetectFn, testName string, files
 	}
 }
 
+// DetectResult is the outcome of a detect function run in-process.
+type DetectResult struct {
+	// ExitCode is the exit code of the detect process.
+	ExitCode int
+	// BuildPlan is the build plan provided and required by the buildpack.
+	BuildPlan buildplan.Plan
+	// Reason is the reason the buildpack opted in or out, or the zero value if it did neither.
+	Reason DetectReason
+}
+
+// exitPanic is raised in place of exiting the process while detect runs in-process.
+type exitPanic int
+
+// RunDetectInProcess is a helper for testing a buildpack's implementation of /bin/detect which calls detectFn in the
+// test process rather than in a subprocess, which is much faster for large test matrices. Only exits through the
+// Context, such as OptOut, OptIn, and failed commands, are captured, so it must not be used for detect functions that
+// exit the process by other means; use TestDetect for those.
+func RunDetectInProcess(t *testing.T, detectFn DetectFn, files map[string]string, env []string) DetectResult {
+	t.Helper()
+	temps, cleanUp := setUpDetectEnvironment(t)
+	defer cleanUp()
+
+	writeFiles(t, temps.codeDir, files)
+	defer setEnv(t, env)()
+
+	oldExit := exit
+	exit = func(code int) {
+		panic(exitPanic(code))
+	}
+	defer func() {
+		exit = oldExit
+	}()
+
+	var ctx *Context
+	code := runDetect(func(c *Context) error {
+		ctx = c
+		return detectFn(c)
+	})
+
+	result := DetectResult{ExitCode: code}
+	if ctx != nil {
+		result.BuildPlan = ctx.buildPlan
+		result.Reason = ctx.detectReason
+	}
+	return result
+}
+
+// TestDetectInProcess is a helper for testing a buildpack's implementation of /bin/detect like TestDetect, but using
+// RunDetectInProcess.
+func TestDetectInProcess(t *testing.T, detectFn DetectFn, files map[string]string, env []string, want int) {
+	t.Helper()
+	if got := RunDetectInProcess(t, detectFn, files, env).ExitCode; got != want {
+		t.Errorf("unexpected exit status %d, want %d", got, want)
+	}
+}
+
+// runDetect runs detect and returns its exit code, recovering from the exitPanic raised by the replaced exit.
+func runDetect(detectFn DetectFn) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			ep, ok := r.(exitPanic)
+			if !ok {
+				panic(r)
+			}
+			code = int(ep)
+		}
+	}()
+	detect(detectFn)
+	return 0
+}
+
+// writeFiles writes the given files, keyed by path relative to dir, creating parent directories as needed.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for f, c := range files {
+		fn := filepath.Join(dir, f)
+
+		if dir := path.Dir(fn); dir != "" {
+			if err := os.MkdirAll(dir, 0744); err != nil {
+				t.Fatalf("creating directory tree %s: %v", dir, err)
+			}
+		}
+
+		if err := ioutil.WriteFile(fn, []byte(c), 0644); err != nil {
+			t.Fatalf("writing file %s: %v", fn, err)
+		}
+	}
+}
+
+// setEnv sets the given env vars, in KEY=VALUE form, and returns a clean up function to restore their old values.
+func setEnv(t *testing.T, env []string) func() {
+	t.Helper()
+	var restore []func()
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 {
+			t.Fatalf("invalid env var %q, want KEY=VALUE", e)
+		}
+		key := parts[0]
+		if old, ok := os.LookupEnv(key); ok {
+			restore = append(restore, func() { os.Setenv(key, old) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(key) })
+		}
+		if err := os.Setenv(key, parts[1]); err != nil {
+			t.Fatalf("setting env var %s: %v", key, err)
+		}
+	}
+	return func() {
+		for i := len(restore) - 1; i >= 0; i-- {
+			restore[i]()
+		}
+	}
+}
+
 // tempWorkingDir creates a temp dir, sets the current working directory to it, and returns a clean up function to restore everything back.
 func tempWorkingDir(t *testing.T) (string, func()) {
 	t.Helper()
@@ -256,3 +360,18 @@ func setUpBuildEnvironment(t *testing.T) (tempDirs, func()) {
 		cleanUpTempDirs()
 	}
 }
+
+// FakeDownloader is a Downloader that serves files from memory, for tests. Other URLs fail as if they did not exist.
+type FakeDownloader map[string][]byte
+
+// Download writes the contents of url in the map to dest.
+func (f FakeDownloader) Download(url, dest string) error {
+	content, ok := f[url]
+	if !ok {
+		return UserErrorf("fetching %s: 404 Not Found", url)
+	}
+	if err := ioutil.WriteFile(dest, content, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v", dest, err)
+	}
+	return nil
+}
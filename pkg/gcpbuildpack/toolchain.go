@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// cHeader is a header installed with the C standard library development files, without which native extensions
+// cannot be compiled even if a compiler is installed.
+var cHeader = "/usr/include/stdio.h"
+
+// HasCToolchain returns true if a C compiler, make, and the C standard library headers are installed, which are
+// needed to build packages with native extensions from source.
+func (ctx *Context) HasCToolchain() bool {
+	missing := missingCToolchain(cHeader)
+	if len(missing) > 0 {
+		ctx.Debugf("C toolchain is incomplete, missing: %s", strings.Join(missing, ", "))
+	}
+	return len(missing) == 0
+}
+
+// WarnNativeDependencies warns that deps, which are commonly compiled from source, may fail to build if the C
+// toolchain is not installed. It is a warning rather than an error because prebuilt binaries may be available for the
+// versions and platform being built.
+func (ctx *Context) WarnNativeDependencies(deps ...string) {
+	if len(deps) == 0 || ctx.HasCToolchain() {
+		return
+	}
+	ctx.Warnf("Dependencies %s may need to be compiled with a C compiler, which is not installed. If the build fails while compiling them, use versions with prebuilt binaries for this platform or extend the builder image with a C toolchain.", strings.Join(deps, ", "))
+}
+
+// ToolCommand returns the command that runs a tool such as a package manager: the executable named by the env var
+// envVar if it is set, or def otherwise. The executable is either a path or a name looked up on PATH. One that cannot be
+// found exits with an internal error, as it means the build image is not set up as configured.
+func (ctx *Context) ToolCommand(envVar string, def ...string) []string {
+	bin := os.Getenv(envVar)
+	if bin == "" {
+		return append([]string(nil), def...)
+	}
+	if _, err := exec.LookPath(bin); err != nil {
+		ctx.Exit(1, InternalErrorf("%s is set to %q, which is not an executable: %v", envVar, bin, err))
+	}
+	return []string{bin}
+}
+
+// missingCToolchain returns the parts of the C toolchain that are not installed.
+func missingCToolchain(header string) []string {
+	var missing []string
+	if !onPath("cc") && !onPath("gcc") {
+		missing = append(missing, "C compiler (cc or gcc)")
+	}
+	if !onPath("make") {
+		missing = append(missing, "make")
+	}
+	if _, err := os.Stat(header); err != nil {
+		missing = append(missing, "C headers ("+header+")")
+	}
+	return missing
+}
+
+// onPath returns true if the executable name is found on PATH.
+func onPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
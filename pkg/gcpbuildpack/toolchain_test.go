@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpbuildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestMissingCToolchain(t *testing.T) {
+	testCases := []struct {
+		name        string
+		executables []string
+		header      bool
+		want        []string
+	}{
+		{
+			name:        "complete with cc",
+			executables: []string{"cc", "make"},
+			header:      true,
+		},
+		{
+			name:        "complete with gcc",
+			executables: []string{"gcc", "make"},
+			header:      true,
+		},
+		{
+			name:        "no compiler",
+			executables: []string{"make"},
+			header:      true,
+			want:        []string{"C compiler (cc or gcc)"},
+		},
+		{
+			name:        "no make or headers",
+			executables: []string{"gcc"},
+			want:        []string{"make"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "toolchain-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, e := range tc.executables {
+				if err := ioutil.WriteFile(filepath.Join(dir, e), []byte("#!/bin/sh\n"), 0755); err != nil {
+					t.Fatalf("Failed to write %s: %v", e, err)
+				}
+			}
+			header := filepath.Join(dir, "stdio.h")
+			if tc.header {
+				if err := ioutil.WriteFile(header, nil, 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", header, err)
+				}
+			}
+			defer os.Setenv("PATH", os.Getenv("PATH"))
+			os.Setenv("PATH", dir)
+
+			got := missingCToolchain(header)
+			want := tc.want
+			if !tc.header {
+				want = append(want, "C headers ("+header+")")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("missingCToolchain() got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestToolCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tool-command-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "pip3.9")
+	if err := ioutil.WriteFile(bin, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write %s: %v", bin, err)
+	}
+	ctx := NewContextForTests(buildpack.Info{}, dir)
+	const envVar = "GOOGLE_TEST_TOOL_BIN"
+	defer os.Unsetenv(envVar)
+
+	if got, want := ctx.ToolCommand(envVar, "python3", "-m", "pip"), []string{"python3", "-m", "pip"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ToolCommand() without %s got %v, want %v", envVar, got, want)
+	}
+	os.Setenv(envVar, bin)
+	if got, want := ctx.ToolCommand(envVar, "python3", "-m", "pip"), []string{bin}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ToolCommand() with %s got %v, want %v", envVar, got, want)
+	}
+}
+
+func TestToolCommandMissing(t *testing.T) {
+	ctx := NewContextForTests(buildpack.Info{}, "")
+	const envVar = "GOOGLE_TEST_TOOL_BIN"
+	os.Setenv(envVar, "/does/not/exist/pip")
+	defer os.Unsetenv(envVar)
+	oldExit := exit
+	exit = func(code int) {
+		panic(exitPanic(code))
+	}
+	defer func() {
+		exit = oldExit
+		if r := recover(); r != exitPanic(1) {
+			t.Errorf("ToolCommand() exit got=%v want=%v", r, exitPanic(1))
+		}
+	}()
+
+	ctx.ToolCommand(envVar, "pip")
+}
@@ -20,7 +20,7 @@ import (
 	"regexp"
 
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
-	"github.com/blang/semver"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/version"
 )
 
 const (
@@ -41,13 +41,11 @@ var (
 func SupportsNoGoMod(ctx *gcp.Context) bool {
 	v := GoVersion(ctx)
 
-	version, err := semver.ParseTolerant(v)
+	go113OrLower, err := version.Satisfies(v, "<1.14.0")
 	if err != nil {
 		ctx.Exit(1, gcp.InternalErrorf("unable to parse go version string %q: %s", v, err))
 	}
-
-	go113OrLower := semver.MustParseRange("<1.14.0")
-	return go113OrLower(version)
+	return go113OrLower
 }
 
 // SupportsAutoVendor returns true if both:
@@ -68,28 +66,21 @@ func VersionMatches(ctx *gcp.Context, versionCheck string) bool {
 		return false
 	}
 
-	version, err := semver.ParseTolerant(v)
+	goModVersionMatches, err := version.Satisfies(v, versionCheck)
 	if err != nil {
 		ctx.Exit(1, gcp.InternalErrorf("unable to parse go version string %q: %s", v, err))
 	}
-
-	goVersionMatches, err := semver.ParseRange(versionCheck)
-	if err != nil {
-		ctx.Exit(1, gcp.InternalErrorf("unable to parse go version string %q: %s", v, err))
-	}
-
-	if !goVersionMatches(version) {
+	if !goModVersionMatches {
 		return false
 	}
 
 	v = GoVersion(ctx)
 
-	version, err = semver.ParseTolerant(v)
+	goVersionMatches, err := version.Satisfies(v, versionCheck)
 	if err != nil {
 		ctx.Exit(1, gcp.InternalErrorf("unable to parse go version string %q: %s", v, err))
 	}
-
-	return goVersionMatches(version)
+	return goVersionMatches
 }
 
 // GoVersion reads the version of the installed Go runtime.
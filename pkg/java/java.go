@@ -17,14 +17,17 @@ package java
 
 import (
 	"archive/zip"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
 )
@@ -32,6 +35,8 @@ import (
 var (
 	// re matches lines in the manifest for a Main-Class entry to detect which jar is appropriate for execution. For some reason, it does not like `(?m)^Main-Class: [^\s]+`.
 	re = regexp.MustCompile("(?m)^Main-Class: [^\r\n\t\f\v ]+")
+	// featureVersionRegexp matches a Java feature version, such as 8 or 11.
+	featureVersionRegexp = regexp.MustCompile(`^[0-9]+$`)
 )
 
 const (
@@ -48,6 +53,14 @@ type RepoMetadata struct {
 	ExpiryTimestamp string `toml:"expiry_timestamp"`
 }
 
+// Command returns a java launch command with the JVM options from GOOGLE_JAVA_OPTS followed by args.
+// Options given on the command line take precedence over those in JAVA_TOOL_OPTIONS, which the JVM reads first.
+// GOOGLE_JAVA_OPTS is split on whitespace without honoring quotes, so an option cannot contain a space.
+func Command(args ...string) []string {
+	cmd := append([]string{"java"}, strings.Fields(os.Getenv(env.JavaOpts))...)
+	return append(cmd, args...)
+}
+
 // ExecutableJar looks for the jar with a Main-Class manifest. If there is not exactly 1 of these jars, throw an error.
 func ExecutableJar(ctx *gcp.Context) (string, error) {
 	// Maven-built jar(s) in target directory take precedence over existing jars at app root.
@@ -105,6 +118,37 @@ func hasMain(r io.Reader) bool {
 	return re.Match(content)
 }
 
+// BundlesDependencies returns true if the jar appears to bundle its dependencies, as a Spring Boot jar, a jar of
+// nested jars, or a shaded jar does. It is a best-effort check: a jar without dependencies is reported as not
+// bundling them.
+func BundlesDependencies(jar string) (bool, error) {
+	r, err := zip.OpenReader(jar)
+	if err != nil {
+		return false, fmt.Errorf("unzipping jar %s: %v", jar, err)
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	return bundlesDependencies(names), nil
+}
+
+// bundlesDependencies returns true if the jar entries in names include nested jars, such as those in BOOT-INF/lib,
+// or the Maven descriptors of more than one artifact, which shading plugins copy along with the classes.
+func bundlesDependencies(names []string) bool {
+	artifacts := 0
+	for _, name := range names {
+		if strings.HasSuffix(name, ".jar") {
+			return true
+		}
+		if strings.HasPrefix(name, "META-INF/maven/") && strings.HasSuffix(name, "/pom.properties") {
+			artifacts++
+		}
+	}
+	return artifacts > 1
+}
+
 // MainFromManifest returns the main class specified in the manifest at the input path.
 func MainFromManifest(ctx *gcp.Context, manifestPath string) (string, error) {
 	content := ctx.ReadFile(manifestPath)
@@ -115,6 +159,43 @@ func MainFromManifest(ctx *gcp.Context, manifestPath string) (string, error) {
 	return "", gcp.UserErrorf("no Main-Class manifest entry found in %s", manifestPath)
 }
 
+// pomProperties is the part of a pom.xml declaring the Java version that the project is compiled for.
+type pomProperties struct {
+	Properties struct {
+		Release     string `xml:"maven.compiler.release"`
+		Target      string `xml:"maven.compiler.target"`
+		JavaVersion string `xml:"java.version"`
+	} `xml:"properties"`
+}
+
+// FeatureVersionFromPOM returns the Java feature version, such as 11, that the project in pom.xml is compiled for,
+// from the maven.compiler.release, maven.compiler.target, or java.version property, in that order of precedence. It
+// returns an empty string if there is no pom.xml or none of the properties is a literal version.
+func FeatureVersionFromPOM(ctx *gcp.Context) (string, error) {
+	pom := filepath.Join(ctx.ApplicationRoot(), "pom.xml")
+	if !ctx.FileExists(pom) {
+		return "", nil
+	}
+	return parseFeatureVersion(ctx.ReadFile(pom))
+}
+
+// parseFeatureVersion returns the Java feature version declared in the properties of the pom.xml content.
+func parseFeatureVersion(content []byte) (string, error) {
+	var p pomProperties
+	if err := xml.Unmarshal(content, &p); err != nil {
+		return "", fmt.Errorf("parsing pom.xml: %v", err)
+	}
+	for _, v := range []string{p.Properties.Release, p.Properties.Target, p.Properties.JavaVersion} {
+		v = strings.TrimSpace(v)
+		// Versions before 9 are written as 1.8, and properties may refer to other properties such as ${java.version}.
+		v = strings.TrimPrefix(v, "1.")
+		if featureVersionRegexp.MatchString(v) {
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
 // CheckCacheExpiration clears the m2 layer and sets a new expiry timestamp when the cache is past expiration.
 func CheckCacheExpiration(ctx *gcp.Context, repoMeta *RepoMetadata, m2CachedRepo *layers.Layer) {
 	t := time.Now()
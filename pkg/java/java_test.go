@@ -15,12 +15,16 @@
 package java
 
 import (
+	"archive/zip"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/buildpack"
 	"github.com/buildpack/libbuildpack/layers"
@@ -97,6 +101,150 @@ another: example`,
 	}
 }
 
+func TestBundlesDependencies(t *testing.T) {
+	testCases := []struct {
+		name    string
+		entries []string
+		want    bool
+	}{
+		{
+			name:    "classes only",
+			entries: []string{"META-INF/MANIFEST.MF", "META-INF/maven/com.example/function/pom.properties", "com/example/Function.class"},
+		},
+		{
+			name:    "spring boot",
+			entries: []string{"META-INF/MANIFEST.MF", "BOOT-INF/classes/com/example/Function.class", "BOOT-INF/lib/gson-2.8.6.jar"},
+			want:    true,
+		},
+		{
+			name: "shaded",
+			entries: []string{
+				"META-INF/MANIFEST.MF",
+				"META-INF/maven/com.example/function/pom.properties",
+				"META-INF/maven/com.google.code.gson/gson/pom.properties",
+				"com/example/Function.class",
+				"com/google/gson/Gson.class",
+			},
+			want: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "test-bundles-dependencies-*.jar")
+			if err != nil {
+				t.Fatalf("Failed to create jar: %v", err)
+			}
+			defer os.Remove(f.Name())
+			w := zip.NewWriter(f)
+			for _, e := range tc.entries {
+				if _, err := w.Create(e); err != nil {
+					t.Fatalf("Failed to add %s to jar: %v", e, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Failed to write jar: %v", err)
+			}
+			f.Close()
+
+			got, err := BundlesDependencies(f.Name())
+			if err != nil {
+				t.Fatalf("BundlesDependencies() got error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("BundlesDependencies() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseFeatureVersion(t *testing.T) {
+	testCases := []struct {
+		name string
+		pom  string
+		want string
+	}{
+		{
+			name: "release",
+			pom: `<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <properties>
+    <maven.compiler.target>1.8</maven.compiler.target>
+    <maven.compiler.release>11</maven.compiler.release>
+  </properties>
+</project>`,
+			want: "11",
+		},
+		{
+			name: "legacy target",
+			pom:  `<project><properties><maven.compiler.target>1.8</maven.compiler.target></properties></project>`,
+			want: "8",
+		},
+		{
+			name: "java version",
+			pom:  `<project><properties><java.version>14</java.version></properties></project>`,
+			want: "14",
+		},
+		{
+			name: "property reference",
+			pom:  `<project><properties><maven.compiler.release>${java.version}</maven.compiler.release><java.version>11</java.version></properties></project>`,
+			want: "11",
+		},
+		{
+			name: "no properties",
+			pom:  `<project><artifactId>function</artifactId></project>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseFeatureVersion([]byte(tc.pom))
+			if err != nil {
+				t.Fatalf("parseFeatureVersion() got error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("parseFeatureVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseFeatureVersionInvalid(t *testing.T) {
+	if _, err := parseFeatureVersion([]byte("<project><properties>")); err == nil {
+		t.Error("parseFeatureVersion() got nil error, want error")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts string
+		want []string
+	}{
+		{
+			name: "no options",
+			want: []string{"java", "-jar", "app.jar"},
+		},
+		{
+			name: "options",
+			opts: " -Xmx512m  -XX:+UseG1GC ",
+			want: []string{"java", "-Xmx512m", "-XX:+UseG1GC", "-jar", "app.jar"},
+		},
+		{
+			name: "quotes are not interpreted",
+			opts: `-Dgreeting="hello world"`,
+			want: []string{"java", `-Dgreeting="hello`, `world"`, "-jar", "app.jar"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer os.Unsetenv(env.JavaOpts)
+			os.Setenv(env.JavaOpts, tc.opts)
+
+			if got := Command("-jar", "app.jar"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Command() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestMainFromManifest(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodejs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// Frozen returns true if dependencies must be installed exactly as listed in the committed lockfile.
+func Frozen(ctx *gcp.Context) bool {
+	frozen, err := env.IsPresentAndTrue(env.NodeFrozen)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.NodeFrozen, err)
+		return false
+	}
+	return frozen
+}
+
+// RequireLockfile returns a user error if Frozen is set and lockfile was not committed with the application.
+func RequireLockfile(ctx *gcp.Context, lockfile string) error {
+	if !Frozen(ctx) || ctx.FileExists(lockfile) {
+		return nil
+	}
+	return gcp.UserErrorf("%s=true requires a committed %s, generate it locally and commit it", env.NodeFrozen, lockfile)
+}
+
+// WatchLockfile records the contents of lockfile and returns a function that, if Frozen is set, returns a user error
+// when the lockfile has changed since, for example because the install command updated it to match package.json.
+func WatchLockfile(ctx *gcp.Context, lockfile string) func() error {
+	if !Frozen(ctx) {
+		return func() error { return nil }
+	}
+	before, err := readLockfile(lockfile)
+	if err != nil {
+		return func() error { return err }
+	}
+	return func() error {
+		after, err := readLockfile(lockfile)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(before, after) {
+			return gcp.UserErrorf("installing dependencies changed %s, which must match package.json when %s=true; update it locally and commit it", lockfile, env.NodeFrozen)
+		}
+		return nil
+	}
+}
+
+// readLockfile returns the contents of lockfile, or nil if it does not exist.
+func readLockfile(lockfile string) ([]byte, error) {
+	b, err := ioutil.ReadFile(lockfile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, gcp.InternalErrorf("reading %s: %v", lockfile, err)
+	}
+	return b, nil
+}
@@ -21,8 +21,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
 )
@@ -34,13 +36,24 @@ const (
 	EnvProduction = "production"
 )
 
+// configFiles are the npm and Yarn configuration files that can change which packages are installed, for example by
+// setting a registry.
+var configFiles = []string{".npmrc", ".yarnrc", ".yarnrc.yml"}
+
+// nativePackages are packages with native addons that are compiled with node-gyp when no prebuilt binary is
+// available for the Node.js version and platform.
+var nativePackages = []string{"bcrypt", "canvas", "grpc", "libxmljs", "node-sass", "sqlite3"}
+
 type packageEnginesJSON struct {
 	Node string `json:"node"`
 }
 
 type packageScriptsJSON struct {
-	Start    string `json:"start"`
-	GCPBuild string `json:"gcp-build"`
+	Start       string `json:"start"`
+	GCPBuild    string `json:"gcp-build"`
+	PreInstall  string `json:"preinstall"`
+	Install     string `json:"install"`
+	PostInstall string `json:"postinstall"`
 }
 
 // PackageJSON represents the contents of a package.json file.
@@ -59,6 +72,25 @@ type Metadata struct {
 	DependencyHash string `toml:"dependency_hash"`
 }
 
+// WithConfigFiles returns a cache option that hashes the names and contents of the npm and Yarn configuration files
+// in the given dir, skipping files that do not exist, so that changing a registry invalidates the dependency cache.
+func WithConfigFiles(dir string) cache.Option {
+	return func() ([]string, error) {
+		var strings []string
+		for _, f := range configFiles {
+			b, err := ioutil.ReadFile(filepath.Join(dir, f))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			strings = append(strings, f, string(b))
+		}
+		return strings, nil
+	}
+}
+
 // ReadPackageJSON returns deserialized package.json from the given dir. Empty dir uses the current working directory.
 func ReadPackageJSON(dir string) (*PackageJSON, error) {
 	f := filepath.Join(dir, "package.json")
@@ -73,21 +105,139 @@ func ReadPackageJSON(dir string) (*PackageJSON, error) {
 	return &pjs, nil
 }
 
+// RequirePackageJSON returns deserialized package.json from the given dir, or a user error describing why it is
+// missing or cannot be parsed, so that the problem is reported before the package manager emits a less clear message.
+func RequirePackageJSON(dir string) (*PackageJSON, error) {
+	f := filepath.Join(dir, "package.json")
+	rawpjs, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, gcp.UserErrorf("package.json not found, it is required to install dependencies; add a package.json to the application root")
+	}
+	if err != nil {
+		return nil, gcp.InternalErrorf("reading package.json: %v", err)
+	}
+	var pjs PackageJSON
+	if err := json.Unmarshal(rawpjs, &pjs); err != nil {
+		return nil, gcp.UserErrorf("parsing package.json: %v", describeJSONError(rawpjs, err))
+	}
+	return &pjs, nil
+}
+
+// describeJSONError adds the line and column at which content failed to parse to err, if known.
+func describeJSONError(content []byte, err error) string {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return err.Error()
+	}
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	line, col := 1, 1
+	for _, c := range content[:offset] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Sprintf("%v (line %d, column %d)", err, line, col)
+}
+
+// NativeDependencies returns the dependencies and devDependencies in pjs that may be compiled with a C compiler.
+func NativeDependencies(pjs *PackageJSON) []string {
+	var native []string
+	for _, p := range nativePackages {
+		_, dep := pjs.Dependencies[p]
+		_, devDep := pjs.DevDependencies[p]
+		if dep || devDep {
+			native = append(native, p)
+		}
+	}
+	return native
+}
+
 // NodeVersion returns the installed version of Node.js.
 func NodeVersion(ctx *gcp.Context) string {
 	result := ctx.Exec([]string{"node", "-v"})
 	return result.Stdout
 }
 
-// NodeEnv returns the value of NODE_ENV or `production`.
+// NodeEnv returns the value of NODE_ENV, or `development` if GOOGLE_NODE_PRODUCTION is false, or `production`.
 func NodeEnv() string {
 	nodeEnv := os.Getenv("NODE_ENV")
 	if nodeEnv == "" {
 		nodeEnv = EnvProduction
+		if production, err := parseProduction(); err == nil && !production {
+			nodeEnv = EnvDevelopment
+		}
 	}
 	return nodeEnv
 }
 
+// InstallNodeEnv returns the value of NODE_ENV that dependencies are installed with: `development` if
+// GOOGLE_NODE_PRODUCTION is false, so that npm and Yarn both install devDependencies even if NODE_ENV is set to
+// production, or NodeEnv otherwise.
+func InstallNodeEnv() string {
+	if production, err := parseProduction(); err == nil && !production {
+		return EnvDevelopment
+	}
+	return NodeEnv()
+}
+
+// Production returns false if devDependencies should be installed because GOOGLE_NODE_PRODUCTION is false.
+func Production(ctx *gcp.Context) bool {
+	production, err := parseProduction()
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.NodeProduction, err)
+		return true
+	}
+	return production
+}
+
+// parseProduction returns the value of GOOGLE_NODE_PRODUCTION, which defaults to true.
+func parseProduction() (bool, error) {
+	v := os.Getenv(env.NodeProduction)
+	if v == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// IgnoreScripts returns true if lifecycle scripts should be skipped when installing dependencies.
+func IgnoreScripts(ctx *gcp.Context) bool {
+	ignore, err := env.IsPresentAndTrue(env.NodeIgnoreScripts)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.NodeIgnoreScripts, err)
+		return false
+	}
+	return ignore
+}
+
+// WarnSkippedScripts emits a warning for each dependency installed in nodeModules that declares install lifecycle
+// scripts, which were skipped because of IgnoreScripts.
+func WarnSkippedScripts(ctx *gcp.Context, nodeModules string) {
+	pkgs := ctx.Glob(filepath.Join(nodeModules, "*", "package.json"))
+	pkgs = append(pkgs, ctx.Glob(filepath.Join(nodeModules, "@*", "*", "package.json"))...)
+	for _, p := range pkgs {
+		dir := filepath.Dir(p)
+		pjs, err := ReadPackageJSON(dir)
+		if err != nil {
+			ctx.Debugf("Skipping lifecycle script check for %s: %v", dir, err)
+			continue
+		}
+		if pjs.Scripts.PreInstall != "" || pjs.Scripts.Install != "" || pjs.Scripts.PostInstall != "" {
+			name, _ := filepath.Rel(nodeModules, dir)
+			ctx.Warnf("Skipped install scripts of dependency %q because %s is set; it may not work correctly.", name, env.NodeIgnoreScripts)
+		}
+	}
+}
+
 // CheckCache checks whether cached dependencies exist and match.
 func CheckCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool, *Metadata, error) {
 	currentNodeVersion := NodeVersion(ctx)
@@ -103,7 +253,7 @@ func CheckCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool,
 	// Perform install, skipping if the dependency hash matches existing metadata.
 	ctx.Debugf("Current dependency hash: %q", currentDependencyHash)
 	ctx.Debugf("  Cache dependency hash: %q", meta.DependencyHash)
-	if currentDependencyHash == meta.DependencyHash {
+	if currentDependencyHash == meta.DependencyHash && !ctx.ClearCacheRequested() {
 		ctx.Logf("Dependencies cache hit, skipping installation.")
 		return true, &meta, nil
 	}
@@ -21,6 +21,11 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
 )
 
 func TestReadPackageJSON(t *testing.T) {
@@ -75,3 +80,461 @@ func TestReadPackageJSON(t *testing.T) {
 		t.Errorf("ReadPackageJSON\ngot %#v\nwant %#v", *got, want)
 	}
 }
+
+func TestRequirePackageJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			contents: `{"dependencies": {"a": "1.0"}}`,
+		},
+		{
+			name:    "missing",
+			wantErr: "package.json not found",
+		},
+		{
+			name:     "syntax error",
+			contents: "{\n  \"dependencies\": {\n    \"a\": \"1.0\",\n  }\n}",
+			wantErr:  "(line 4, column 4)",
+		},
+		{
+			name:     "wrong type",
+			contents: `{"dependencies": ["a"]}`,
+			wantErr:  "(line 1, column 19)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ioutil.TempDir("", "test-require-package-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(d)
+			if tc.contents != "" {
+				if err := ioutil.WriteFile(filepath.Join(d, "package.json"), []byte(tc.contents), 0644); err != nil {
+					t.Fatalf("Failed to write package.json: %v", err)
+				}
+			}
+
+			pjs, err := RequirePackageJSON(d)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("RequirePackageJSON() got error: %v", err)
+				}
+				if pjs.Dependencies["a"] != "1.0" {
+					t.Errorf("RequirePackageJSON() got dependencies %v, want a=1.0", pjs.Dependencies)
+				}
+				return
+			}
+			be, ok := err.(*gcp.Error)
+			if !ok {
+				t.Fatalf("RequirePackageJSON() got error %v, want *gcp.Error", err)
+			}
+			if be.Status != gcp.StatusUnknown {
+				t.Errorf("RequirePackageJSON() got status %v, want user error", be.Status)
+			}
+			if !strings.Contains(be.Message, tc.wantErr) {
+				t.Errorf("RequirePackageJSON() got error %q, want it to contain %q", be.Message, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNativeDependencies(t *testing.T) {
+	pjs := &PackageJSON{
+		Dependencies:    map[string]string{"express": "4.17.1", "sqlite3": "5.0.0"},
+		DevDependencies: map[string]string{"bcrypt": "5.0.0", "mocha": "8.1.3"},
+	}
+	want := []string{"bcrypt", "sqlite3"}
+	if got := NativeDependencies(pjs); !reflect.DeepEqual(got, want) {
+		t.Errorf("NativeDependencies() got %v, want %v", got, want)
+	}
+	if got := NativeDependencies(&PackageJSON{}); got != nil {
+		t.Errorf("NativeDependencies() with no dependencies got %v, want nil", got)
+	}
+}
+
+func TestWithConfigFiles(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "no config files",
+		},
+		{
+			name:  "npmrc",
+			files: map[string]string{".npmrc": "registry=https://registry.example.com/\n"},
+			want:  []string{".npmrc", "registry=https://registry.example.com/\n"},
+		},
+		{
+			name: "npmrc and yarnrc.yml",
+			files: map[string]string{
+				".yarnrc.yml": "npmRegistryServer: https://registry.example.com\n",
+				".npmrc":      "@scope:registry=https://registry.example.com/\n",
+			},
+			want: []string{".npmrc", "@scope:registry=https://registry.example.com/\n", ".yarnrc.yml", "npmRegistryServer: https://registry.example.com\n"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ioutil.TempDir("", "test-config-files-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(d)
+			for name, contents := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(d, name), []byte(contents), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			got, err := WithConfigFiles(d)()
+			if err != nil {
+				t.Fatalf("WithConfigFiles(%q)() got error: %v", d, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("WithConfigFiles(%q)() = %q, want %q", d, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNodeEnv(t *testing.T) {
+	testCases := []struct {
+		name           string
+		nodeEnv        string
+		production     string
+		want           string
+		wantInstall    string
+		wantProduction bool
+	}{
+		{
+			name:           "default",
+			want:           EnvProduction,
+			wantInstall:    EnvProduction,
+			wantProduction: true,
+		},
+		{
+			name:        "not production",
+			production:  "false",
+			want:        EnvDevelopment,
+			wantInstall: EnvDevelopment,
+		},
+		{
+			name:        "explicit NODE_ENV",
+			nodeEnv:     "staging",
+			production:  "false",
+			want:        "staging",
+			wantInstall: EnvDevelopment,
+		},
+		{
+			name:           "explicit NODE_ENV production",
+			nodeEnv:        EnvProduction,
+			want:           EnvProduction,
+			wantInstall:    EnvProduction,
+			wantProduction: true,
+		},
+		{
+			name:           "invalid production",
+			production:     "sometimes",
+			want:           EnvProduction,
+			wantInstall:    EnvProduction,
+			wantProduction: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer os.Unsetenv("NODE_ENV")
+			defer os.Unsetenv(env.NodeProduction)
+			os.Setenv("NODE_ENV", tc.nodeEnv)
+			os.Setenv(env.NodeProduction, tc.production)
+
+			if got := NodeEnv(); got != tc.want {
+				t.Errorf("NodeEnv() = %q, want %q", got, tc.want)
+			}
+			if got := InstallNodeEnv(); got != tc.wantInstall {
+				t.Errorf("InstallNodeEnv() = %q, want %q", got, tc.wantInstall)
+			}
+			if got := Production(gcp.NewContextForTests(buildpack.Info{}, "")); got != tc.wantProduction {
+				t.Errorf("Production() = %t, want %t", got, tc.wantProduction)
+			}
+		})
+	}
+}
+
+func TestParseNPMLs(t *testing.T) {
+	out := `{
+  "name": "app",
+  "version": "1.0.0",
+  "dependencies": {
+    "express": {
+      "version": "4.17.1",
+      "dependencies": {
+        "debug": {"version": "2.6.9", "dependencies": {"ms": {"version": "2.0.0"}}},
+        "ms": {"version": "2.1.2"}
+      }
+    },
+    "ms": {"version": "2.1.2"},
+    "missing": {"required": "^1.0.0", "missing": true}
+  }
+}`
+	want := []gcp.Dependency{
+		{Name: "debug", Version: "2.6.9"},
+		{Name: "express", Version: "4.17.1"},
+		{Name: "ms", Version: "2.0.0"},
+		{Name: "ms", Version: "2.1.2"},
+	}
+
+	got, err := parseNPMLs(out)
+	if err != nil {
+		t.Fatalf("parseNPMLs() got error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNPMLs() = %v, want %v", got, want)
+	}
+}
+
+func TestNPMInstallCommand(t *testing.T) {
+	testCases := []struct {
+		name    string
+		lock    bool
+		command string
+		want    string
+	}{
+		{
+			name: "no lockfile",
+			want: "install",
+		},
+		{
+			name:    "install override",
+			lock:    true,
+			command: "install",
+			want:    "install",
+		},
+		{
+			name:    "ci override",
+			lock:    true,
+			command: "ci",
+			want:    "ci",
+		},
+		{
+			name:    "ci override without lockfile",
+			command: "ci",
+			want:    "install",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ioutil.TempDir("", "test-npm-install-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(d)
+			if tc.lock {
+				if err := ioutil.WriteFile(filepath.Join(d, PackageLock), []byte("{}"), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", PackageLock, err)
+				}
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(d); err != nil {
+				t.Fatalf("Failed to change to %s: %v", d, err)
+			}
+			defer os.Chdir(wd)
+			defer os.Unsetenv(env.NPMInstallCommand)
+			os.Setenv(env.NPMInstallCommand, tc.command)
+
+			if got := NPMInstallCommand(gcp.NewContextForTests(buildpack.Info{}, d)); got != tc.want {
+				t.Errorf("NPMInstallCommand() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCIIgnoreScripts(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  bool
+	}{
+		{value: "", want: false},
+		{value: "true", want: true},
+		{value: "false", want: false},
+		{value: "invalid", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			os.Setenv(env.NPMCIIgnoreScripts, tc.value)
+			defer os.Unsetenv(env.NPMCIIgnoreScripts)
+
+			if got := CIIgnoreScripts(gcp.NewContextForTests(buildpack.Info{}, "")); got != tc.want {
+				t.Errorf("CIIgnoreScripts() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseNPMAudit(t *testing.T) {
+	out := `{"auditReportVersion": 2, "vulnerabilities": {}, "metadata": {"vulnerabilities": {"info": 0, "low": 2, "moderate": 0, "high": 1, "critical": 0, "total": 3}}}`
+	want := audit.Findings{audit.Low: 2, audit.High: 1}
+
+	got, err := parseNPMAudit(out)
+	if err != nil {
+		t.Fatalf("parseNPMAudit() got error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNPMAudit() = %v, want %v", got, want)
+	}
+}
+
+func TestParseNPMAuditError(t *testing.T) {
+	out := `{"error": {"code": "ENOLOCK", "summary": "This command requires an existing lockfile."}}`
+	if _, err := parseNPMAudit(out); err == nil {
+		t.Error("parseNPMAudit() got nil error, want error")
+	}
+}
+
+func TestNPMAuditMissingNPM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "npm-audit-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(env.AuditDependencies, "true")
+	defer os.Unsetenv(env.AuditDependencies)
+	// A PATH without npm makes the command impossible to start.
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+
+	if err := NPMAudit(ctx); err == nil {
+		t.Error("NPMAudit() without npm got nil error, want error")
+	}
+}
+
+func TestWatchLockfile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		frozen  bool
+		update  string
+		wantErr bool
+	}{
+		{
+			name: "unchanged",
+		},
+		{
+			name:   "changed without frozen",
+			update: `{"lockfileVersion": 2}`,
+		},
+		{
+			name:   "unchanged with frozen",
+			frozen: true,
+		},
+		{
+			name:    "changed with frozen",
+			frozen:  true,
+			update:  `{"lockfileVersion": 2}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ioutil.TempDir("", "test-watch-lockfile-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(d)
+			lockfile := filepath.Join(d, PackageLock)
+			if err := ioutil.WriteFile(lockfile, []byte(`{"lockfileVersion": 1}`), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", lockfile, err)
+			}
+			if tc.frozen {
+				os.Setenv(env.NodeFrozen, "true")
+				defer os.Unsetenv(env.NodeFrozen)
+			}
+			ctx := gcp.NewContextForTests(buildpack.Info{}, d)
+
+			check := WatchLockfile(ctx, lockfile)
+			if tc.update != "" {
+				if err := ioutil.WriteFile(lockfile, []byte(tc.update), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", lockfile, err)
+				}
+			}
+			if err := check(); (err != nil) != tc.wantErr {
+				t.Errorf("WatchLockfile() check got error %v, want error? %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireLockfile(t *testing.T) {
+	d, err := ioutil.TempDir("", "test-require-lockfile-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	lockfile := filepath.Join(d, PackageLock)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, d)
+
+	if err := RequireLockfile(ctx, lockfile); err != nil {
+		t.Errorf("RequireLockfile() without %s got error: %v", env.NodeFrozen, err)
+	}
+	os.Setenv(env.NodeFrozen, "true")
+	defer os.Unsetenv(env.NodeFrozen)
+	if err := RequireLockfile(ctx, lockfile); err == nil {
+		t.Errorf("RequireLockfile() with missing lockfile got no error, want error")
+	}
+	if err := ioutil.WriteFile(lockfile, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", lockfile, err)
+	}
+	if err := RequireLockfile(ctx, lockfile); err != nil {
+		t.Errorf("RequireLockfile() with lockfile got error: %v", err)
+	}
+}
+
+func TestYarnInstallError(t *testing.T) {
+	installErr := gcp.UserErrorf("yarn install failed")
+	testCases := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "yarn 1 frozen lockfile",
+			output: "yarn install v1.22.4\n[1/4] Resolving packages...\nerror Your lockfile needs to be updated, but yarn was run with `--frozen-lockfile`.\n",
+			want:   "yarn.lock is out of sync with package.json; run `yarn install` and commit the lockfile",
+		},
+		{
+			name:   "yarn 2 immutable",
+			output: "➤ YN0028: │ The lockfile would have been modified by this install, which is explicitly forbidden.\n",
+			want:   "yarn.lock is out of sync with package.json; run `yarn install` and commit the lockfile",
+		},
+		{
+			name:   "other failure",
+			output: "error An unexpected error occurred: \"https://registry.yarnpkg.com/left-pad: Not found\".\n",
+			want:   "yarn install failed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := YarnInstallError(&gcp.ExecResult{ExitCode: 1, Combined: tc.output}, installErr)
+
+			if err == nil {
+				t.Fatal("YarnInstallError() got nil error, want error")
+			}
+			gotErr, ok := err.(*gcp.Error)
+			if !ok {
+				t.Fatalf("YarnInstallError() got %T, want *gcp.Error", err)
+			}
+			if gotErr.Message != tc.want {
+				t.Errorf("YarnInstallError() = %q, want %q", gotErr.Message, tc.want)
+			}
+		})
+	}
+}
@@ -15,8 +15,14 @@
 package nodejs
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/blang/semver"
 )
@@ -40,12 +46,166 @@ func EnsurePackageLock(ctx *gcp.Context) {
 	}
 }
 
-// NPMInstallCommand returns the correct install commmand based on the version of Node.js.
+// npmLsJSON represents a package in the output of `npm ls --json`.
+type npmLsJSON struct {
+	Version      string               `json:"version"`
+	Dependencies map[string]npmLsJSON `json:"dependencies"`
+}
+
+// RecordDependencies records the production packages installed in node_modules, if requested for the build report or
+// the dependency count check. The packages are recorded under the given layer name.
+func RecordDependencies(ctx *gcp.Context, layer string) {
+	if !ctx.DependenciesRequested() {
+		return
+	}
+	// npm ls exits with an error if the tree has problems, such as extraneous packages, but still lists it.
+	result, _ := ctx.ExecWithErr([]string{"npm", "ls", "--json", "--prod"})
+	if result == nil {
+		ctx.Warnf("Failed to list installed packages, skipping dependencies in build report.")
+		return
+	}
+	deps, err := parseNPMLs(result.Stdout)
+	if err != nil {
+		ctx.Warnf("Failed to parse installed packages, skipping dependencies in build report: %v", err)
+		return
+	}
+	ctx.RecordDependencies(layer, deps)
+}
+
+// parseNPMLs returns the flattened, sorted list of unique packages in the output of `npm ls --json`.
+func parseNPMLs(out string) ([]gcp.Dependency, error) {
+	var root npmLsJSON
+	if err := json.Unmarshal([]byte(out), &root); err != nil {
+		return nil, err
+	}
+	seen := map[gcp.Dependency]bool{}
+	var walk func(deps map[string]npmLsJSON)
+	walk = func(deps map[string]npmLsJSON) {
+		for name, p := range deps {
+			// Missing packages have no version.
+			if p.Version != "" {
+				seen[gcp.Dependency{Name: name, Version: p.Version}] = true
+			}
+			walk(p.Dependencies)
+		}
+	}
+	walk(root.Dependencies)
+
+	var result []gcp.Dependency
+	for d := range seen {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+const (
+	npmCI      = "ci"
+	npmInstall = "install"
+)
+
+// NPMInstallCommand returns the npm command used to install dependencies: `ci` when package-lock.json is present and
+// `install` otherwise, as `npm ci` fails without a lockfile. GOOGLE_NPM_INSTALL_COMMAND overrides the selection, except
+// that `ci` is always used with a lockfile if Frozen is set.
 func NPMInstallCommand(ctx *gcp.Context) string {
+	hasLock := ctx.FileExists(PackageLock)
+	// `npm ci` fails instead of updating a lockfile that does not match package.json.
+	if hasLock && Frozen(ctx) {
+		return npmCI
+	}
+	if c := os.Getenv(env.NPMInstallCommand); c != "" {
+		switch c {
+		case npmCI:
+			if !hasLock {
+				ctx.Warnf("%s=%s requires %s, using `npm %s` instead.", env.NPMInstallCommand, c, PackageLock, npmInstall)
+				return npmInstall
+			}
+			return npmCI
+		case npmInstall:
+			return npmInstall
+		default:
+			ctx.Warnf("%s must be %q or %q, ignoring %q.", env.NPMInstallCommand, npmCI, npmInstall, c)
+		}
+	}
+
+	if !hasLock {
+		return npmInstall
+	}
 	// HACK: For backwards compatibility on App Engine Node.js 10, always use `npm install`.
 	if strings.HasPrefix(strings.TrimSpace(NodeVersion(ctx)), "v10.") {
-		return "install"
+		return npmInstall
 	}
+	return npmCI
+}
 
-	return "ci"
+// CIIgnoreScripts returns true if lifecycle scripts should be skipped when dependencies are installed with `npm ci`.
+func CIIgnoreScripts(ctx *gcp.Context) bool {
+	ignore, err := env.IsPresentAndTrue(env.NPMCIIgnoreScripts)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.NPMCIIgnoreScripts, err)
+		return false
+	}
+	return ignore
+}
+
+// npmAuditJSON is the part of the output of `npm audit --json` with vulnerability counts by severity, which has the
+// same shape for all npm versions.
+type npmAuditJSON struct {
+	Error *struct {
+		Code    string `json:"code"`
+		Summary string `json:"summary"`
+	} `json:"error"`
+	Metadata struct {
+		Vulnerabilities map[string]int `json:"vulnerabilities"`
+	} `json:"metadata"`
+}
+
+// NPMAudit runs `npm audit` if audit.Enabled, and returns an error if it finds vulnerabilities at or above audit.Level.
+// Only production dependencies are audited when they are installed with NODE_ENV production, see InstallNodeEnv.
+func NPMAudit(ctx *gcp.Context) error {
+	if !audit.Enabled(ctx) {
+		return nil
+	}
+	nodeEnv := InstallNodeEnv()
+	cmd := []string{"npm", "audit", "--json"}
+	if nodeEnv == EnvProduction {
+		cmd = append(cmd, "--production")
+	}
+	ctx.Logf("Auditing dependencies for known vulnerabilities.")
+	// npm audit exits with a non-zero code when it finds vulnerabilities, so rely on its output instead.
+	result, cerr := ctx.ExecWithErr(cmd, gcp.WithEnv("NODE_ENV="+nodeEnv), gcp.WithUserAttribution)
+	if result == nil {
+		return cerr
+	}
+	findings, err := parseNPMAudit(result.Stdout)
+	if err != nil {
+		if cerr != nil {
+			return cerr
+		}
+		return gcp.InternalErrorf("parsing npm audit output: %v", err)
+	}
+	return audit.Check(ctx, "npm audit", findings)
+}
+
+// parseNPMAudit returns the vulnerabilities reported in the output of `npm audit --json`.
+func parseNPMAudit(out string) (audit.Findings, error) {
+	var a npmAuditJSON
+	if err := json.Unmarshal([]byte(out), &a); err != nil {
+		return nil, err
+	}
+	if a.Error != nil {
+		return nil, fmt.Errorf("%s: %s", a.Error.Code, a.Error.Summary)
+	}
+	findings := audit.Findings{}
+	for severity, n := range a.Metadata.Vulnerabilities {
+		if severity != "total" {
+			findings.Add(severity, n)
+		}
+	}
+	return findings, nil
 }
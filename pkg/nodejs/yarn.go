@@ -15,8 +15,10 @@
 package nodejs
 
 import (
+	"regexp"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 )
 
@@ -25,8 +27,20 @@ const (
 	YarnLock = "yarn.lock"
 )
 
+// yarnLockOutOfSyncRegexp matches the errors of `yarn install --frozen-lockfile` in Yarn 1 and of
+// `yarn install --immutable` in Yarn 2 when yarn.lock does not match package.json.
+var yarnLockOutOfSyncRegexp = regexp.MustCompile(`Your lockfile needs to be updated|YN0028|The lockfile would have been modified by this install`)
+
+// YarnCommand returns the command that runs Yarn with args: `yarn` on PATH, or the executable set by GOOGLE_YARN_BIN.
+func YarnCommand(ctx *gcp.Context, args ...string) []string {
+	return append(ctx.ToolCommand(env.YarnBin, "yarn"), args...)
+}
+
 // LockfileFlag returns an appropriate lockfile handling flag, including empty string.
 func LockfileFlag(ctx *gcp.Context) string {
+	if Frozen(ctx) {
+		return "--frozen-lockfile"
+	}
 	// HACK: For backwards compatibility on App Engine Node.js 10, skip using `--frozen-lockfile`.
 	if strings.HasPrefix(strings.TrimSpace(NodeVersion(ctx)), "v10.") {
 		return ""
@@ -34,3 +48,12 @@ func LockfileFlag(ctx *gcp.Context) string {
 
 	return "--frozen-lockfile"
 }
+
+// YarnInstallError returns the error for a failed `yarn install` with output result and error err: a concise user
+// error if yarn.lock is out of sync with package.json, or err otherwise.
+func YarnInstallError(result *gcp.ExecResult, err *gcp.Error) error {
+	if result != nil && yarnLockOutOfSyncRegexp.MatchString(result.Combined) {
+		return gcp.UserErrorf("%s is out of sync with package.json; run `yarn install` and commit the lockfile", YarnLock)
+	}
+	return err
+}
@@ -19,9 +19,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/buildpack/libbuildpack/layers"
 )
@@ -33,6 +39,12 @@ const (
 	composerLock = "composer.lock"
 	// Vendor is the name of the Composer vendor directory.
 	Vendor = "vendor"
+	// composerCacheLayer is the name of the layer used as Composer's download cache.
+	composerCacheLayer = "composercache"
+
+	dateFormat = time.RFC3339Nano
+	// defaultExpiration is the default amount of time of 1 day to refresh dependencies installed without a lock file.
+	defaultExpiration = time.Duration(time.Hour * 24)
 )
 
 type composerScriptsJSON struct {
@@ -41,14 +53,16 @@ type composerScriptsJSON struct {
 
 // ComposerJSON represents the contents of a composer.json file.
 type ComposerJSON struct {
-	Require map[string]string   `json:"require"`
-	Scripts composerScriptsJSON `json:"scripts"`
+	Require    map[string]string   `json:"require"`
+	RequireDev map[string]string   `json:"require-dev"`
+	Scripts    composerScriptsJSON `json:"scripts"`
 }
 
 // Metadata represents metadata stored for a dependencies layer.
 type Metadata struct {
-	PHPVersion     string `toml:"php_version"`
-	DependencyHash string `toml:"dependency_hash"`
+	PHPVersion      string `toml:"php_version"`
+	DependencyHash  string `toml:"dependency_hash"`
+	ExpiryTimestamp string `toml:"expiry_timestamp"`
 }
 
 // ReadComposerJSON returns the deserialized composer.json from the given dir. Empty dir uses the current working directory.
@@ -66,6 +80,69 @@ func ReadComposerJSON(dir string) (*ComposerJSON, error) {
 	return &cjs, nil
 }
 
+// FindComposerProjects returns the directories, relative to the application root, that contain a composer.json.
+// Vendor, node_modules and hidden directories are not searched.
+func FindComposerProjects(ctx *gcp.Context) ([]string, error) {
+	root := ctx.ApplicationRoot()
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && (info.Name() == Vendor || info.Name() == "node_modules" || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != composerJSON {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, gcp.InternalErrorf("searching for %s: %v", composerJSON, err)
+	}
+	return dirs, nil
+}
+
+// ComposerProject returns the directory of the Composer project to build, relative to the application root.
+// GOOGLE_BUILDABLE selects a project explicitly, and must be inside the application root; otherwise a composer.json in
+// the application root is used. If neither applies and more than one project is found, the candidates are returned in
+// a user error. Only the composer buildpack builds a nested project: the gcp-build script and functions are only
+// supported in the application root.
+func ComposerProject(ctx *gcp.Context) (string, error) {
+	if dir, ok := os.LookupEnv(env.Buildable); ok {
+		dir = filepath.Clean(dir)
+		if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+			return "", gcp.UserErrorf("%s specified directory %q outside the application root", env.Buildable, dir)
+		}
+		if !ctx.FileExists(ctx.ApplicationRoot(), dir, composerJSON) {
+			return "", gcp.UserErrorf("%s specified directory %q but it does not contain %s", env.Buildable, dir, composerJSON)
+		}
+		return dir, nil
+	}
+	if ctx.FileExists(ctx.ApplicationRoot(), composerJSON) {
+		return ".", nil
+	}
+	dirs, err := FindComposerProjects(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch len(dirs) {
+	case 0:
+		return "", gcp.UserErrorf("no %s found", composerJSON)
+	case 1:
+		return dirs[0], nil
+	}
+	return "", gcp.UserErrorf("found more than one %s, set %s to one of: %s", composerJSON, env.Buildable, strings.Join(dirs, ", "))
+}
+
 // version returns the installed version of PHP.
 func version(ctx *gcp.Context) string {
 	result := ctx.Exec([]string{"php", "-r", "echo PHP_VERSION;"})
@@ -73,7 +150,8 @@ func version(ctx *gcp.Context) string {
 }
 
 // checkCache checks whether cached dependencies exist and match.
-func checkCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool, *Metadata, error) {
+// A non-zero expiration causes cached dependencies to be refreshed after that amount of time.
+func checkCache(ctx *gcp.Context, l *layers.Layer, expiration time.Duration, opts ...cache.Option) (bool, *Metadata, error) {
 	currentPHPVersion := version(ctx)
 	opts = append(opts, cache.WithStrings(currentPHPVersion))
 	currentDependencyHash, err := cache.Hash(ctx, opts...)
@@ -84,10 +162,12 @@ func checkCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool,
 	var meta Metadata
 	ctx.ReadMetadata(l, &meta)
 
+	expired := expiration > 0 && checkCacheExpiration(ctx, &meta)
+
 	// Perform install, skipping if the dependency hash matches existing metadata.
 	ctx.Debugf("Current dependency hash: %q", currentDependencyHash)
 	ctx.Debugf("  Cache dependency hash: %q", meta.DependencyHash)
-	if currentDependencyHash == meta.DependencyHash {
+	if currentDependencyHash == meta.DependencyHash && !expired && !ctx.ClearCacheRequested() {
 		ctx.Logf("Dependencies cache hit, skipping installation.")
 		return true, &meta, nil
 	}
@@ -99,41 +179,100 @@ func checkCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool,
 	// Update the layer metadata.
 	meta.DependencyHash = currentDependencyHash
 	meta.PHPVersion = currentPHPVersion
+	meta.ExpiryTimestamp = ""
+	if expiration > 0 {
+		meta.ExpiryTimestamp = time.Now().Add(expiration).Format(dateFormat)
+	}
 
 	return false, &meta, nil
 }
 
-// composerInstall runs `composer install` with the given flags.
-func composerInstall(ctx *gcp.Context, flags []string) {
-	cmd := append([]string{"composer", "install"}, flags...)
-	ctx.Exec(cmd, gcp.WithUserAttribution)
+// checkCacheExpiration returns true when the cache is past expiration.
+func checkCacheExpiration(ctx *gcp.Context, meta *Metadata) bool {
+	t := time.Now()
+	if meta.ExpiryTimestamp != "" {
+		var err error
+		t, err = time.Parse(dateFormat, meta.ExpiryTimestamp)
+		if err != nil {
+			ctx.Debugf("Could not parse expiration date %q, assuming now: %v", meta.ExpiryTimestamp, err)
+		}
+	}
+	return !t.After(time.Now())
+}
+
+// cacheExpiration returns how long dependencies installed without a lock file are cached.
+func cacheExpiration(ctx *gcp.Context) time.Duration {
+	val := os.Getenv(env.ComposerCacheExpiration)
+	if val == "" {
+		return defaultExpiration
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		ctx.Warnf("%s env var must be a duration such as 24h, using default of %v: %v", env.ComposerCacheExpiration, defaultExpiration, err)
+		return defaultExpiration
+	}
+	return d
+}
+
+// ComposerCommand returns the command that runs Composer with args: `composer` on PATH, or the executable set by
+// GOOGLE_COMPOSER_BIN.
+func ComposerCommand(ctx *gcp.Context, args ...string) []string {
+	return append(ctx.ToolCommand(env.ComposerBin, "composer"), args...)
 }
 
-// ComposerInstall runs `composer install`, using the cache iff a lock file is present.
+// composerInstall runs `composer install` in dir with the given flags.
+func composerInstall(ctx *gcp.Context, dir string, flags []string) {
+	// Keep downloaded package archives across builds, even when the vendor directory must be rebuilt.
+	cl := ctx.Layer(composerCacheLayer)
+	cmd := ComposerCommand(ctx, append([]string{"install"}, flags...)...)
+	ctx.Exec(cmd, gcp.WithWorkDir(dir), gcp.WithEnv("COMPOSER_CACHE_DIR="+cl.Root), gcp.WithUserAttribution)
+	ctx.WriteMetadata(cl, nil, layers.Cache)
+}
+
+// ComposerInstall runs `composer install` for the project in dir, using the cache iff a lock file is present.
 // It creates a layer, so it returns the layer so that the caller may further modify it
 // if they desire.
-func ComposerInstall(ctx *gcp.Context, cacheTag string) (*layers.Layer, error) {
-	// We don't install dev dependencies (i.e. we pass --no-dev to composer) because doing so has caused
+func ComposerInstall(ctx *gcp.Context, cacheTag, dir string) (*layers.Layer, error) {
+	return composerInstallLayer(ctx, cacheTag, dir, false)
+}
+
+// ComposerInstallDev is like ComposerInstall, but also installs the require-dev dependencies, for example for tools
+// used by the gcp-build script. The installed dependencies must not be left in the application image.
+func ComposerInstallDev(ctx *gcp.Context, cacheTag, dir string) (*layers.Layer, error) {
+	return composerInstallLayer(ctx, cacheTag, dir, true)
+}
+
+// composerInstallLayer implements ComposerInstall and ComposerInstallDev.
+func composerInstallLayer(ctx *gcp.Context, cacheTag, dir string, dev bool) (*layers.Layer, error) {
+	// We don't install dev dependencies (i.e. we pass --no-dev to composer) by default because doing so has caused
 	// problems for customers in the past. For more information see these links:
 	//   https://github.com/GoogleCloudPlatform/php-docs-samples/issues/736
 	//   https://github.com/GoogleCloudPlatform/runtimes-common/pull/763
 	//   https://github.com/GoogleCloudPlatform/runtimes-common/commit/6c4970f609d80f9436ac58ae272cfcc6bcd57143
-	flags := []string{"--no-dev", "--no-progress", "--no-suggest", "--no-interaction"}
+	flags := []string{"--no-progress", "--no-suggest", "--no-interaction"}
+	if !dev {
+		flags = append([]string{"--no-dev"}, flags...)
+	}
 
-	ctx.RemoveAll(Vendor)
+	vendor := filepath.Join(dir, Vendor)
+	ctx.RemoveAll(vendor)
 	l := ctx.Layer("composer")
 	layerVendor := filepath.Join(l.Root, Vendor)
 
-	// If there's no composer.lock then don't attempt to cache. We'd have to cache using composer.json,
-	// which could result in outdated dependencies if the version constraints in composer.json resolve
-	// to newer versions in the future.
-	if !ctx.FileExists(composerLock) {
+	// If there's no composer.lock then cache using composer.json with an expiration. Otherwise the cache
+	// could result in outdated dependencies if the version constraints in composer.json resolve to newer
+	// versions in the future. Dependencies are pinned by composer.lock, so its cache never expires.
+	depFile, expiration := filepath.Join(dir, composerLock), time.Duration(0)
+	if !ctx.FileExists(depFile) {
 		ctx.Logf("*** Improve build performance by generating and committing %s.", composerLock)
-		composerInstall(ctx, flags)
-		return l, nil
+		depFile, expiration = filepath.Join(dir, composerJSON), cacheExpiration(ctx)
 	}
 
-	cached, meta, err := checkCache(ctx, l, cache.WithStrings(composerLock))
+	opts := []cache.Option{cache.WithFiles(depFile)}
+	if dev {
+		opts = append(opts, cache.WithStrings("require-dev"))
+	}
+	cached, meta, err := checkCache(ctx, l, expiration, opts...)
 	if err != nil {
 		return l, fmt.Errorf("checking cache: %w", err)
 	}
@@ -141,26 +280,146 @@ func ComposerInstall(ctx *gcp.Context, cacheTag string) (*layers.Layer, error) {
 		ctx.CacheHit(cacheTag)
 
 		// PHP expects the vendor/ directory to be in the application directory.
-		ctx.Exec([]string{"cp", "--archive", layerVendor, Vendor}, gcp.WithUserTimingAttribution)
+		ctx.Exec([]string{"cp", "--archive", layerVendor, vendor}, gcp.WithUserTimingAttribution)
 	} else {
 		ctx.CacheMiss(cacheTag)
 		// Clear layer so we don't end up with outdated dependencies (e.g. something was removed from composer.json).
 		ctx.ClearLayer(l)
-		composerInstall(ctx, flags)
+		composerInstall(ctx, dir, flags)
 
 		// Ensure vendor exists even if no dependencies were installed.
-		ctx.MkdirAll(Vendor, 0755)
-		ctx.Exec([]string{"cp", "--archive", Vendor, layerVendor}, gcp.WithUserTimingAttribution)
+		ctx.MkdirAll(vendor, 0755)
+		ctx.Exec([]string{"cp", "--archive", vendor, layerVendor}, gcp.WithUserTimingAttribution)
 	}
 
 	ctx.WriteMetadata(l, &meta, layers.Cache)
 	return l, nil
 }
 
+// DevDependencyCommands returns the require-dev packages of cjs that appear to provide a command used by its gcp-build
+// script, such as phpunit/phpunit for `vendor/bin/phpunit`. A package is assumed to provide a command named after the
+// last part of its name.
+func DevDependencyCommands(cjs *ComposerJSON) []string {
+	commands := map[string]bool{}
+	for _, word := range strings.FieldsFunc(cjs.Scripts.GCPBuild, func(r rune) bool {
+		return strings.ContainsRune(" \t\n;&|()", r)
+	}) {
+		commands[filepath.Base(word)] = true
+	}
+	var pkgs []string
+	for pkg := range cjs.RequireDev {
+		parts := strings.Split(pkg, "/")
+		if commands[parts[len(parts)-1]] {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// composerShowJSON represents the output of `composer show --format=json`.
+type composerShowJSON struct {
+	Installed []gcp.Dependency `json:"installed"`
+}
+
+// RecordDependencies records the packages installed for the project in dir, if requested for the build report or the
+// dependency count check.
+func RecordDependencies(ctx *gcp.Context, dir string) {
+	if !ctx.DependenciesRequested() {
+		return
+	}
+	result, cerr := ctx.ExecWithErr(ComposerCommand(ctx, "show", "--format=json", "--no-interaction"), gcp.WithWorkDir(dir))
+	if cerr != nil {
+		ctx.Warnf("Failed to list installed packages, skipping dependencies in build report: %v", cerr)
+		return
+	}
+	deps, err := parseComposerShow(result.Stdout)
+	if err != nil {
+		ctx.Warnf("Failed to parse installed packages, skipping dependencies in build report: %v", err)
+		return
+	}
+	ctx.RecordDependencies("composer", deps)
+}
+
+// parseComposerShow returns the installed packages in the output of `composer show --format=json`.
+func parseComposerShow(out string) ([]gcp.Dependency, error) {
+	var show composerShowJSON
+	if err := json.Unmarshal([]byte(out), &show); err != nil {
+		return nil, err
+	}
+	return show.Installed, nil
+}
+
+// composerAdvisory is an advisory in the output of `composer audit --format=json`.
+type composerAdvisory struct {
+	AdvisoryID string `json:"advisoryId"`
+	Severity   string `json:"severity"`
+}
+
+// Audit runs `composer audit` for the project in dir if audit.Enabled, and returns an error if it finds
+// vulnerabilities at or above audit.Level. Dev dependencies are not audited, as they are not installed.
+func Audit(ctx *gcp.Context, dir string) error {
+	if !audit.Enabled(ctx) {
+		return nil
+	}
+	ctx.Logf("Auditing dependencies for known vulnerabilities.")
+	// composer audit exits with a non-zero code when it finds vulnerabilities, so rely on its output instead.
+	cmd := ComposerCommand(ctx, "audit", "--format=json", "--no-dev", "--no-interaction")
+	result, cerr := ctx.ExecWithErr(cmd, gcp.WithWorkDir(dir), gcp.WithUserAttribution)
+	if result == nil {
+		return cerr
+	}
+	findings, err := parseComposerAudit(result.Stdout)
+	if err != nil {
+		if cerr != nil {
+			return cerr
+		}
+		return gcp.InternalErrorf("parsing composer audit output: %v", err)
+	}
+	return audit.Check(ctx, "composer audit", findings)
+}
+
+// parseComposerAudit returns the vulnerabilities reported in the output of `composer audit --format=json`. Composer
+// encodes empty advisory lists as `[]` and may encode the advisories of a package as an object keyed by index.
+func parseComposerAudit(out string) (audit.Findings, error) {
+	var a struct {
+		Advisories json.RawMessage `json:"advisories"`
+	}
+	if err := json.Unmarshal([]byte(out), &a); err != nil {
+		return nil, err
+	}
+	findings := audit.Findings{}
+	var packages map[string]json.RawMessage
+	if err := json.Unmarshal(a.Advisories, &packages); err != nil {
+		// An empty list of advisories is the only valid value that is not an object.
+		var empty []json.RawMessage
+		if lerr := json.Unmarshal(a.Advisories, &empty); lerr != nil || len(empty) > 0 {
+			return nil, fmt.Errorf("parsing advisories: %v", err)
+		}
+		return findings, nil
+	}
+	for name, raw := range packages {
+		var advisories []composerAdvisory
+		if err := json.Unmarshal(raw, &advisories); err != nil {
+			var indexed map[string]composerAdvisory
+			if err := json.Unmarshal(raw, &indexed); err != nil {
+				return nil, fmt.Errorf("parsing advisories of %s: %v", name, err)
+			}
+			for _, adv := range indexed {
+				advisories = append(advisories, adv)
+			}
+		}
+		for _, adv := range advisories {
+			findings.Add(adv.Severity, 1)
+		}
+	}
+	return findings, nil
+}
+
 // ComposerRequire runs `composer require` with the given packages. It expects packages to
 // be specified as `composer require` would expect them on the command line, for example
 // "myorg/mypackage:^0.7". It does no caching.
 func ComposerRequire(ctx *gcp.Context, packages []string) {
-	cmd := append([]string{"composer", "require", "--no-progress", "--no-suggest", "--no-interaction"}, packages...)
+	cmd := ComposerCommand(ctx, append([]string{"require", "--no-progress", "--no-suggest", "--no-interaction"}, packages...)...)
 	ctx.Exec(cmd, gcp.WithUserAttribution)
 }
@@ -21,6 +21,11 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
 )
 
 func TestReadComposerJSON(t *testing.T) {
@@ -61,3 +66,230 @@ func TestReadComposerJSON(t *testing.T) {
 		t.Errorf("ReadComposerJSON\ngot %#v\nwant %#v", *got, want)
 	}
 }
+
+func TestComposerProject(t *testing.T) {
+	testCases := []struct {
+		name      string
+		files     []string
+		buildable string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:  "root project preferred",
+			files: []string{"composer.json", "api/composer.json"},
+			want:  ".",
+		},
+		{
+			name:  "single nested project",
+			files: []string{"api/composer.json", "api/vendor/foo/composer.json", ".git/composer.json", "node_modules/foo/composer.json"},
+			want:  "api",
+		},
+		{
+			name:      "selected with buildable",
+			files:     []string{"api/composer.json", "web/composer.json"},
+			buildable: "web",
+			want:      "web",
+		},
+		{
+			name:      "buildable without composer.json",
+			files:     []string{"api/composer.json"},
+			buildable: "web",
+			wantErr:   true,
+		},
+		{
+			name:      "buildable outside the application root",
+			files:     []string{"composer.json"},
+			buildable: "../app",
+			wantErr:   true,
+		},
+		{
+			name:      "absolute buildable",
+			files:     []string{"composer.json"},
+			buildable: "/",
+			wantErr:   true,
+		},
+		{
+			name:      "buildable cleaned",
+			files:     []string{"web/composer.json"},
+			buildable: "./web/",
+			want:      "web",
+		},
+		{
+			name:    "multiple projects",
+			files:   []string{"api/composer.json", "web/composer.json"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ioutil.TempDir("", "test-composer-project-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(d)
+			for _, f := range tc.files {
+				path := filepath.Join(d, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir for %s: %v", f, err)
+				}
+				if err := ioutil.WriteFile(path, []byte("{}"), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", f, err)
+				}
+			}
+			if tc.buildable != "" {
+				os.Setenv("GOOGLE_BUILDABLE", tc.buildable)
+				defer os.Unsetenv("GOOGLE_BUILDABLE")
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, d)
+			got, err := ComposerProject(ctx)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ComposerProject() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ComposerProject() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckCacheExpiration(t *testing.T) {
+	testCases := []struct {
+		name   string
+		expiry string
+		want   bool
+	}{
+		{
+			name: "no timestamp",
+			want: true,
+		},
+		{
+			name:   "past",
+			expiry: time.Now().Add(-time.Hour).Format(dateFormat),
+			want:   true,
+		},
+		{
+			name:   "future",
+			expiry: time.Now().Add(time.Hour).Format(dateFormat),
+			want:   false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := checkCacheExpiration(nil, &Metadata{ExpiryTimestamp: tc.expiry}); got != tc.want {
+				t.Errorf("checkCacheExpiration(%q) = %t, want %t", tc.expiry, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseComposerShow(t *testing.T) {
+	out := `{"installed": [{"name": "google/cloud-functions-framework", "version": "v0.7.2", "description": "Google Cloud Functions Framework for PHP"}, {"name": "guzzlehttp/psr7", "version": "1.6.1"}]}`
+	want := []gcp.Dependency{
+		{Name: "google/cloud-functions-framework", Version: "v0.7.2"},
+		{Name: "guzzlehttp/psr7", Version: "1.6.1"},
+	}
+
+	got, err := parseComposerShow(out)
+	if err != nil {
+		t.Fatalf("parseComposerShow() got error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseComposerShow() = %v, want %v", got, want)
+	}
+}
+
+func TestParseComposerShowInvalid(t *testing.T) {
+	if _, err := parseComposerShow("No dependencies installed."); err == nil {
+		t.Error("parseComposerShow() got nil error, want error")
+	}
+}
+
+func TestParseComposerAudit(t *testing.T) {
+	testCases := []struct {
+		name string
+		out  string
+		want audit.Findings
+	}{
+		{
+			name: "no advisories",
+			out:  `{"advisories": [], "abandoned": []}`,
+			want: audit.Findings{},
+		},
+		{
+			name: "advisories list",
+			out:  `{"advisories": {"guzzlehttp/psr7": [{"advisoryId": "PKSA-1", "severity": "high"}, {"advisoryId": "PKSA-2", "severity": "medium"}]}}`,
+			want: audit.Findings{audit.High: 1, audit.Moderate: 1},
+		},
+		{
+			name: "advisories keyed by index",
+			out:  `{"advisories": {"symfony/http-kernel": {"1": {"advisoryId": "PKSA-3", "severity": null}}}}`,
+			want: audit.Findings{audit.Unknown: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseComposerAudit(tc.out)
+			if err != nil {
+				t.Fatalf("parseComposerAudit() got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseComposerAudit() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseComposerAuditInvalid(t *testing.T) {
+	for _, out := range []string{"Could not open input file", `{"advisories": ["PKSA-1"]}`} {
+		if _, err := parseComposerAudit(out); err == nil {
+			t.Errorf("parseComposerAudit(%q) got nil error, want error", out)
+		}
+	}
+}
+
+func TestDevDependencyCommands(t *testing.T) {
+	testCases := []struct {
+		name       string
+		gcpBuild   string
+		requireDev map[string]string
+		want       []string
+	}{
+		{
+			name:       "no gcp-build script",
+			requireDev: map[string]string{"phpunit/phpunit": "^9"},
+		},
+		{
+			name:     "no dev dependencies",
+			gcpBuild: "vendor/bin/phpunit",
+		},
+		{
+			name:       "vendor bin command",
+			gcpBuild:   "vendor/bin/phpunit --testsuite unit",
+			requireDev: map[string]string{"phpunit/phpunit": "^9", "mockery/mockery": "^1"},
+			want:       []string{"phpunit/phpunit"},
+		},
+		{
+			name:       "several commands",
+			gcpBuild:   "php-cs-fixer fix --dry-run && (psalm; true)",
+			requireDev: map[string]string{"vimeo/psalm": "^4", "friendsofphp/php-cs-fixer": "^3"},
+			want:       []string{"friendsofphp/php-cs-fixer", "vimeo/psalm"},
+		},
+		{
+			name:       "only arguments mention package",
+			gcpBuild:   "php generate.php --no-phpunit",
+			requireDev: map[string]string{"phpunit/phpunit": "^9"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cjs := &ComposerJSON{RequireDev: tc.requireDev, Scripts: composerScriptsJSON{GCPBuild: tc.gcpBuild}}
+
+			got := DevDependencyCommands(cjs)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("DevDependencyCommands() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
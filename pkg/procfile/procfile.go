@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package procfile reads the processes declared in a Procfile.
+package procfile
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+const (
+	// Procfile is the name of the file declaring the processes of the application.
+	Procfile = "Procfile"
+	// Web is the type of the process that serves requests.
+	Web = "web"
+)
+
+var (
+	// lineRegexp matches a `type: command` process declaration.
+	lineRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+):(.*)$`)
+)
+
+// Read parses the Procfile in the application root into a map of process type to command. It returns nil if there is
+// no Procfile, and a user error naming the line if a line is malformed.
+func Read(ctx *gcp.Context) (map[string]string, error) {
+	path := filepath.Join(ctx.ApplicationRoot(), Procfile)
+	if !ctx.FileExists(path) {
+		return nil, nil
+	}
+	return Parse(string(ctx.ReadFileNormalized(path)))
+}
+
+// Parse parses Procfile content into a map of process type to command. Blank lines and comments starting with # are
+// ignored. Process declarations must start at the beginning of the line. If a process type is declared more than once,
+// the first declaration is used.
+func Parse(content string) (map[string]string, error) {
+	procs := map[string]string{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		m := lineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, gcp.UserErrorf("%s line %d: expected `type: command`, got %q", Procfile, i+1, line)
+		}
+		cmd := strings.TrimSpace(m[2])
+		if cmd == "" {
+			return nil, gcp.UserErrorf("%s line %d: process %s has no command", Procfile, i+1, m[1])
+		}
+		if _, ok := procs[m[1]]; !ok {
+			procs[m[1]] = cmd
+		}
+	}
+	return procs, nil
+}
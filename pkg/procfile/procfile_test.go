@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    map[string]string{},
+		},
+		{
+			name: "multiple processes",
+			content: `web:     gunicorn main:app
+worker:  celery -A tasks worker
+release: python manage.py migrate
+`,
+			want: map[string]string{
+				"web":     "gunicorn main:app",
+				"worker":  "celery -A tasks worker",
+				"release": "python manage.py migrate",
+			},
+		},
+		{
+			name:    "comments, blank lines and carriage returns",
+			content: "# web: foo\r\n\r\nweb: bar $PORT\r\n",
+			want:    map[string]string{"web": "bar $PORT"},
+		},
+		{
+			name:    "duplicate uses first",
+			content: "web: foo\nweb: bar\n",
+			want:    map[string]string{"web": "foo"},
+		},
+		{
+			name:    "colon in command",
+			content: "dev-server: java --foo=web:something\n",
+			want:    map[string]string{"dev-server": "java --foo=web:something"},
+		},
+		{
+			name:    "indented comment",
+			content: "web: foo\n\t# worker: bar\n",
+			want:    map[string]string{"web": "foo"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.content)
+			if err != nil {
+				t.Fatalf("Parse(%q) got error: %v", tc.content, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tc.content, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "no type",
+			content: "web foo\nworker: bar\n",
+			want:    "Procfile line 1: expected `type: command`, got \"web foo\"",
+		},
+		{
+			name:    "invalid type",
+			content: "web process: foo",
+			want:    "Procfile line 1: expected `type: command`, got \"web process: foo\"",
+		},
+		{
+			name:    "leading whitespace",
+			content: "  web: foo",
+			want:    "Procfile line 1: expected `type: command`, got \"  web: foo\"",
+		},
+		{
+			name:    "no command",
+			content: "web: foo\nworker:   \n",
+			want:    "Procfile line 2: process worker has no command",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.content)
+			var ge *gcp.Error
+			if !errors.As(err, &ge) {
+				t.Fatalf("Parse(%q) = %v, %v, want a gcp.Error", tc.content, got, err)
+			}
+			if ge.Message != tc.want || ge.Status != gcp.StatusUnknown {
+				t.Errorf("Parse(%q) got error %q with status %s, want user error %q", tc.content, ge.Message, ge.Status, tc.want)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procfile-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+
+	if got, err := Read(ctx); err != nil || got != nil {
+		t.Errorf("Read() without Procfile = %v, %v, want nil, nil", got, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, Procfile), []byte("web: foo\n"), 0644); err != nil {
+		t.Fatalf("writing %s: %v", Procfile, err)
+	}
+	want := map[string]string{"web": "foo"}
+	if got, err := Read(ctx); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, %v, want %v, nil", got, err, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// auditLayer is the build-only layer that pip-audit is installed in.
+const auditLayer = "pip-audit"
+
+// pipAuditJSON is the output of `pip-audit --format json`.
+type pipAuditJSON struct {
+	Dependencies []struct {
+		Name  string `json:"name"`
+		Vulns []struct {
+			ID string `json:"id"`
+		} `json:"vulns"`
+	} `json:"dependencies"`
+}
+
+// Audit runs pip-audit on the packages installed in dir if audit.Enabled, and returns an error if it finds
+// vulnerabilities. pip-audit does not report severities, so all of its findings fail the build regardless of
+// audit.Level. pip-audit is installed with the additional env vars in env, into a layer that is reused by later builds
+// but is not in the application image.
+func Audit(ctx *gcp.Context, dir string, env ...string) error {
+	if !audit.Enabled(ctx) {
+		return nil
+	}
+	tool := ctx.BuildToolLayer(auditLayer).Root
+	ctx.Logf("Auditing dependencies for known vulnerabilities.")
+	if !ctx.FileExists(tool, "pip_audit") {
+		ctx.Exec(PipCommand(ctx, "install", "--quiet", "-t", tool, "pip-audit"), gcp.WithEnv(env...), gcp.WithUserAttribution)
+	}
+
+	// pip-audit exits with a non-zero code when it finds vulnerabilities, so rely on its output instead.
+	cmd := []string{"python3", "-m", "pip_audit", "--path", dir, "--format", "json", "--progress-spinner", "off"}
+	result, cerr := ctx.ExecWithErr(cmd, gcp.WithEnv("PYTHONPATH="+tool), gcp.WithUserAttribution)
+	if result == nil {
+		return cerr
+	}
+	findings, err := parsePipAudit(result.Stdout)
+	if err != nil {
+		if cerr != nil {
+			return cerr
+		}
+		return gcp.InternalErrorf("parsing pip-audit output: %v", err)
+	}
+	return audit.Check(ctx, "pip-audit", findings)
+}
+
+// parsePipAudit returns the vulnerabilities reported in the output of `pip-audit --format json`.
+func parsePipAudit(out string) (audit.Findings, error) {
+	var a pipAuditJSON
+	if err := json.Unmarshal([]byte(out), &a); err != nil {
+		return nil, err
+	}
+	findings := audit.Findings{}
+	for _, d := range a.Dependencies {
+		findings.Add(audit.Unknown, len(d.Vulns))
+	}
+	return findings, nil
+}
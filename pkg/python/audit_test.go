@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/audit"
+)
+
+func TestParsePipAudit(t *testing.T) {
+	testCases := []struct {
+		name string
+		out  string
+		want audit.Findings
+	}{
+		{
+			name: "no vulnerabilities",
+			out:  `{"dependencies": [{"name": "flask", "version": "2.0.1", "vulns": []}], "fixes": []}`,
+			want: audit.Findings{},
+		},
+		{
+			name: "vulnerabilities",
+			out:  `{"dependencies": [{"name": "flask", "version": "0.5", "vulns": [{"id": "PYSEC-2019-179"}, {"id": "PYSEC-2018-66"}]}, {"name": "jinja2", "version": "2.4", "vulns": [{"id": "PYSEC-2014-8"}]}]}`,
+			want: audit.Findings{audit.Unknown: 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parsePipAudit(tc.out)
+			if err != nil {
+				t.Fatalf("parsePipAudit() got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parsePipAudit() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
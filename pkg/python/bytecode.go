@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// CompileDeterministicCached is like CompileDeterministic but reuses the bytecode compiled by previous builds, which
+// is stored in cacheDir keyed on the path and content of each source file. Only files that are new or changed are
+// compiled, so that reinstalling a large dependency tree after changing a single requirement does not recompile every
+// package. Source modification times are not used as pip rewrites every file when it reinstalls dependencies. Bytecode
+// not used by this build is removed from cacheDir.
+func CompileDeterministicCached(ctx *gcp.Context, cacheDir string, dirs ...string) {
+	result, cerr := ctx.ExecWithErr([]string{"python3", "-c", "import sys; print(sys.implementation.cache_tag)"})
+	if cerr != nil {
+		ctx.Debugf("Failed to determine the bytecode cache tag, compiling all files: %v", cerr)
+		CompileDeterministic(ctx, dirs...)
+		return
+	}
+	tag := strings.TrimSpace(result.Stdout)
+	sources, err := pythonSources(dirs)
+	if err != nil {
+		ctx.Debugf("Failed to list Python files, compiling all files: %v", err)
+		CompileDeterministic(ctx, dirs...)
+		return
+	}
+
+	used := make(map[string]bool)
+	var missing []string
+	for _, src := range sources {
+		key, err := bytecodeKey(src, tag)
+		if err != nil {
+			missing = append(missing, src)
+			continue
+		}
+		used[key] = true
+		if err := copyFile(filepath.Join(cacheDir, key), bytecodePath(src, tag)); err != nil {
+			missing = append(missing, src)
+		}
+	}
+	ctx.Debugf("Reusing cached bytecode of %d of %d Python files.", len(sources)-len(missing), len(sources))
+
+	if len(missing) > 0 {
+		tmp := ctx.TempDir("", "compileall")
+		defer ctx.RemoveAll(tmp)
+		list := filepath.Join(tmp, "sources")
+		ctx.WriteFile(list, []byte(strings.Join(missing, "\n")+"\n"), 0644)
+		compileDeterministic(ctx, "-i", list)
+		for _, src := range missing {
+			key, err := bytecodeKey(src, tag)
+			if err != nil {
+				continue
+			}
+			// Files that failed to compile have no bytecode and are retried by the next build.
+			if err := copyFile(bytecodePath(src, tag), filepath.Join(cacheDir, key)); err != nil && !os.IsNotExist(err) {
+				ctx.Debugf("Failed to cache bytecode of %s: %v", src, err)
+			}
+		}
+	}
+
+	if err := pruneBytecode(cacheDir, used); err != nil {
+		ctx.Debugf("Failed to remove unused cached bytecode: %v", err)
+	}
+}
+
+// pythonSources returns the paths of the Python source files in dirs and their subdirectories.
+func pythonSources(dirs []string) ([]string, error) {
+	var sources []string
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == "__pycache__" {
+				return filepath.SkipDir
+			}
+			if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".py") {
+				sources = append(sources, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// bytecodePath returns the path that the bytecode of the source file src is written to by an interpreter with the
+// given cache tag, such as cpython-38.
+func bytecodePath(src, tag string) string {
+	name := strings.TrimSuffix(filepath.Base(src), ".py")
+	return filepath.Join(filepath.Dir(src), "__pycache__", name+"."+tag+".pyc")
+}
+
+// bytecodeKey returns the name of the cached bytecode of the source file src. It depends on the path of src as well
+// as its content since the path is embedded in the bytecode, and on the cache tag of the interpreter.
+func bytecodeKey(src, tag string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	io.WriteString(h, tag+"\x00"+src+"\x00")
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)) + ".pyc", nil
+}
+
+// pruneBytecode removes the files in cacheDir that are not in used.
+func pruneBytecode(cacheDir string, used map[string]bool) error {
+	fis, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if used[fi.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file src to dst, creating the directory of dst if needed.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
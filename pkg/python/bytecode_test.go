@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPythonSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{
+		"a.py",
+		"pkg/__init__.py",
+		"pkg/b.py",
+		"pkg/__pycache__/b.cpython-38.pyc",
+		"pkg/__pycache__/stale.py",
+		"pkg/data.txt",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	got, err := pythonSources([]string{dir})
+	if err != nil {
+		t.Fatalf("pythonSources() got error: %v", err)
+	}
+	sort.Strings(got)
+	want := []string{
+		filepath.Join(dir, "a.py"),
+		filepath.Join(dir, "pkg/__init__.py"),
+		filepath.Join(dir, "pkg/b.py"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pythonSources() got %v, want %v", got, want)
+	}
+}
+
+func TestBytecodePath(t *testing.T) {
+	got := bytecodePath("/layers/pip/pkg/mod.py", "cpython-38")
+	want := "/layers/pip/pkg/__pycache__/mod.cpython-38.pyc"
+	if got != want {
+		t.Errorf("bytecodePath() got %q, want %q", got, want)
+	}
+}
+
+func TestBytecodeKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+		return path
+	}
+	key := func(src, tag string) string {
+		k, err := bytecodeKey(src, tag)
+		if err != nil {
+			t.Fatalf("bytecodeKey(%q) got error: %v", src, err)
+		}
+		return k
+	}
+
+	a := write("a.py", "x = 1")
+	b := write("b.py", "x = 1")
+	base := key(a, "cpython-38")
+	if got := key(a, "cpython-38"); got != base {
+		t.Errorf("bytecodeKey() is not stable, got %q and %q", base, got)
+	}
+	if got := key(b, "cpython-38"); got == base {
+		t.Errorf("bytecodeKey() of a different path got the same key %q", got)
+	}
+	if got := key(a, "cpython-39"); got == base {
+		t.Errorf("bytecodeKey() with a different tag got the same key %q", got)
+	}
+	write("a.py", "x = 2")
+	if got := key(a, "cpython-38"); got == base {
+		t.Errorf("bytecodeKey() of changed content got the same key %q", got)
+	}
+}
+
+func TestPruneBytecode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"used.pyc", "unused.pyc"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	if err := pruneBytecode(dir, map[string]bool{"used.pyc": true}); err != nil {
+		t.Fatalf("pruneBytecode() got error: %v", err)
+	}
+	got, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("globbing %s: %v", dir, err)
+	}
+	want := []string{filepath.Join(dir, "used.pyc")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pruneBytecode() left %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Framework describes a Python web framework.
+type Framework struct {
+	// Name is the name of the framework package, for example `flask`.
+	Name string
+	// ASGI is true if applications built with the framework are served by an ASGI server rather than a WSGI server.
+	ASGI bool
+}
+
+// frameworks are the detected web frameworks, in order of precedence.
+var frameworks = []Framework{
+	{Name: "django"},
+	{Name: "fastapi", ASGI: true},
+	{Name: "starlette", ASGI: true},
+	{Name: "quart", ASGI: true},
+	{Name: "flask"},
+	{Name: "falcon"},
+	{Name: "bottle"},
+	{Name: "pyramid"},
+}
+
+// DetectFramework returns the web framework declared in the given requirements.txt content.
+func DetectFramework(requirements string) (Framework, bool) {
+	for _, f := range frameworks {
+		if ContainsPackage(requirements, f.Name) {
+			return f, true
+		}
+	}
+	return Framework{}, false
+}
+
+// ContainsPackage returns true if the given requirements.txt content declares the package name, matched
+// case-insensitively as pip does.
+func ContainsPackage(requirements, name string) bool {
+	q := regexp.QuoteMeta(strings.ToLower(name))
+	re := regexp.MustCompile(`(?mi)(^` + q + `\b([^-]|$))|(#egg=` + q + `$)`)
+	return re.MatchString(requirements)
+}
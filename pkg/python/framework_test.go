@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+)
+
+func TestDetectFramework(t *testing.T) {
+	testCases := []struct {
+		name         string
+		requirements string
+		want         Framework
+		wantOK       bool
+	}{
+		{
+			name:         "flask",
+			requirements: "Flask==1.1.2\nrequests\n",
+			want:         Framework{Name: "flask"},
+			wantOK:       true,
+		},
+		{
+			name:         "fastapi",
+			requirements: "fastapi>=0.60 # api\nuvicorn\n",
+			want:         Framework{Name: "fastapi", ASGI: true},
+			wantOK:       true,
+		},
+		{
+			name:         "django takes precedence",
+			requirements: "flask\nDjango==3.1\n",
+			want:         Framework{Name: "django"},
+			wantOK:       true,
+		},
+		{
+			name:         "egg",
+			requirements: "git+https://github.com/pallets/flask@master#egg=flask\n",
+			want:         Framework{Name: "flask"},
+			wantOK:       true,
+		},
+		{
+			name:         "extension only",
+			requirements: "flask-cors\nrequests\n",
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := DetectFramework(tc.requirements)
+			if ok != tc.wantOK || got != tc.want {
+				t.Errorf("DetectFramework(%q) = %v, %t, want %v, %t", tc.requirements, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestContainsPackage(t *testing.T) {
+	testCases := []struct {
+		requirements string
+		name         string
+		want         bool
+	}{
+		{requirements: "gunicorn==20.0.4", name: "gunicorn", want: true},
+		{requirements: "flask\nGunicorn", name: "gunicorn", want: true},
+		{requirements: "gunicorn-websocket", name: "gunicorn", want: false},
+		{requirements: "uvicorn[standard]", name: "uvicorn", want: true},
+		{requirements: "# gunicorn", name: "gunicorn", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.requirements, func(t *testing.T) {
+			if got := ContainsPackage(tc.requirements, tc.name); got != tc.want {
+				t.Errorf("ContainsPackage(%q, %q) = %t, want %t", tc.requirements, tc.name, got, tc.want)
+			}
+		})
+	}
+}
@@ -17,11 +17,18 @@ package python
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/cache"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/version"
 	"github.com/buildpack/libbuildpack/layers"
 )
 
@@ -29,8 +36,32 @@ const (
 	dateFormat = time.RFC3339Nano
 	// expirationTime is an arbitrary amount of time of 1 day to refresh the cache layer.
 	expirationTime = time.Duration(time.Hour * 24)
+	// wheelhouse is the directory of wheels committed with the application that dependencies are installed from
+	// when GOOGLE_PIP_FIND_LINKS is not set.
+	wheelhouse = "wheels"
+	// installRequirementsFile is the name of the requirements file written next to requirements.txt when some of the
+	// files it includes are excluded from the install.
+	installRequirementsFile = ".requirements-install.txt"
+	// installErrorLines is the number of lines of pip install errors kept for the error message, enough for the
+	// traceback of a failing setup.py.
+	installErrorLines = 30
 )
 
+// specRegexp matches a PEP 440 version specifier list, such as `1.5.0` or `>=1.4,<2`.
+var specRegexp = regexp.MustCompile(`^((==|!=|<=|>=|<|>|~=)?[0-9][0-9A-Za-z.*+!-]*)(,\s*(==|!=|<=|>=|<|>|~=)[0-9][0-9A-Za-z.*+!-]*)*$`)
+
+// missingDistRegexp matches the package pip failed to find in the output of `pip install`.
+var missingDistRegexp = regexp.MustCompile(`No matching distribution found for (\S+)`)
+
+// pipParallelFeatures are the pip features enabled by GOOGLE_PIP_PARALLEL, with the pip versions that support them.
+var pipParallelFeatures = []struct {
+	constraint string
+	feature    string
+}{
+	// fast-deps downloads only the metadata of wheels while resolving dependencies.
+	{constraint: ">=20.2", feature: "fast-deps"},
+}
+
 // Metadata represents metadata stored for a dependencies layer.
 type Metadata struct {
 	PythonVersion   string `toml:"python_version"`
@@ -44,6 +75,236 @@ func Version(ctx *gcp.Context) string {
 	return strings.TrimSpace(result.Stderr)
 }
 
+// PipCommand returns the command that runs pip with args: `python3 -m pip`, or the executable set by GOOGLE_PIP_BIN.
+func PipCommand(ctx *gcp.Context, args ...string) []string {
+	return append(ctx.ToolCommand(env.PipBin, "python3", "-m", "pip"), args...)
+}
+
+// CompileDeterministic compiles the Python files in dirs to bytecode, replacing any existing bytecode. The pyc files
+// embed a hash of the source rather than its timestamp and are never checked against the source, so that they are
+// reproducible across builds and used at startup without recompilation. Do not use it for source that may change
+// after the build, such as application source in development mode.
+func CompileDeterministic(ctx *gcp.Context, dirs ...string) {
+	compileDeterministic(ctx, dirs...)
+}
+
+// compileDeterministic runs compileall with the given arguments, which name the files to compile.
+func compileDeterministic(ctx *gcp.Context, args ...string) {
+	cmd := append([]string{"python3", "-m", "compileall", "-f", "-q", "--invalidation-mode", "unchecked-hash"}, args...)
+	if _, err := ctx.ExecWithErr(cmd, gcp.WithUserTimingAttribution); err != nil {
+		// Packages commonly include files that are not valid Python 3, such as templates, which fail to compile.
+		ctx.Debugf("Some files could not be compiled to bytecode: %v", err)
+	}
+}
+
+// Requirement returns the pip requirement for package pkg constrained by version, which is either a bare version,
+// pinned exactly, or a version specifier list passed to pip as is. An invalid version is reported as a user error
+// naming envVar, the env var it was read from.
+func Requirement(pkg, version, envVar string) (string, error) {
+	v := strings.TrimSpace(version)
+	if !specRegexp.MatchString(v) {
+		return "", gcp.UserErrorf("invalid %s %q, must be a version such as 1.5.0 or a version specifier such as >=1.4,<2", envVar, version)
+	}
+	if v[0] >= '0' && v[0] <= '9' {
+		v = "==" + v
+	}
+	return pkg + v, nil
+}
+
+// FindLinks returns the directory of wheels to install dependencies from without accessing the package index, or
+// an empty string if dependencies are installed from the index.
+func FindLinks(ctx *gcp.Context) string {
+	if dir := os.Getenv(env.PipFindLinks); dir != "" {
+		return dir
+	}
+	if fi, err := os.Stat(filepath.Join(ctx.ApplicationRoot(), wheelhouse)); err == nil && fi.IsDir() {
+		return wheelhouse
+	}
+	return ""
+}
+
+// WithFindLinks returns a cache option that hashes the names of the files in the wheel directory dir, so that
+// adding or upgrading a wheel invalidates the dependency cache. It hashes nothing if dir is empty.
+func WithFindLinks(dir string) cache.Option {
+	return func() ([]string, error) {
+		if dir == "" {
+			return nil, nil
+		}
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{dir}
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		sort.Strings(names[1:])
+		return names, nil
+	}
+}
+
+// ExcludedRequirements returns the requirements files named by GOOGLE_PIP_EXCLUDE_REQUIREMENTS.
+func ExcludedRequirements() []string {
+	var files []string
+	for _, f := range strings.Split(os.Getenv(env.PipExcludeRequirements), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// RequirementsToInstall returns the requirements file to install in place of req, and a cache option that hashes
+// exactly the requirements it installs. If GOOGLE_PIP_EXCLUDE_REQUIREMENTS is set, the files it names are left out of
+// the files that req includes, and the returned file is a copy of req with the other included files inlined. It is
+// written next to req, so that relative paths resolve as they do for req, and the caller must remove it after
+// installing. Otherwise req is returned unchanged.
+func RequirementsToInstall(ctx *gcp.Context, req string) (string, cache.Option, error) {
+	excluded := ExcludedRequirements()
+	if len(excluded) == 0 {
+		return req, cache.WithFiles(req), nil
+	}
+	ctx.Logf("Excluding %s from the installed requirements.", strings.Join(excluded, ", "))
+	inlined, err := InlineRequirementsExcluding(excluded, req)
+	if err != nil {
+		return "", nil, gcp.UserErrorf("merging requirements: %v", err)
+	}
+	file := filepath.Join(filepath.Dir(req), installRequirementsFile)
+	ctx.WriteFile(file, []byte(inlined), 0644)
+	return file, cache.WithStrings(inlined), nil
+}
+
+// InstallRequirements installs the packages in the requirements file req into the dir target with `pip install`, run
+// with the additional env vars in env. If findLinks is not empty, packages are installed only from the wheels in that
+// directory, and a package missing from it fails the build with a user error naming the package.
+func InstallRequirements(ctx *gcp.Context, req, target, findLinks string, env ...string) error {
+	cmd := PipCommand(ctx, "install", "--upgrade", "-r", req, "-t", target)
+	if findLinks != "" {
+		ctx.Logf("Installing dependencies from %s without accessing the package index.", findLinks)
+		cmd = append(cmd, "--find-links", findLinks, "--no-index")
+	}
+	cmd = append(cmd, pipParallelFlags(ctx)...)
+	result, err := ctx.ExecWithErr(cmd, gcp.WithEnv(env...), gcp.WithStderrTailLines(installErrorLines), gcp.WithUserAttribution)
+	if err == nil {
+		return nil
+	}
+	if findLinks != "" && result != nil {
+		if m := missingDistRegexp.FindStringSubmatch(result.Combined); m != nil {
+			return gcp.UserErrorf("package %s is not in %s, add a wheel for it to install dependencies offline", m[1], findLinks)
+		}
+	}
+	return err
+}
+
+// PipVersion returns the version of pip run by PipCommand.
+func PipVersion(ctx *gcp.Context) (string, error) {
+	result, err := ctx.ExecWithErr(PipCommand(ctx, "--version"))
+	if err != nil {
+		return "", err
+	}
+	// The output is of the form "pip 20.2.4 from /usr/lib/python3/dist-packages/pip (python 3.8)".
+	fields := strings.Fields(result.Stdout)
+	if len(fields) < 2 || fields[0] != "pip" {
+		return "", fmt.Errorf("unexpected output of pip --version: %q", result.Stdout)
+	}
+	return fields[1], nil
+}
+
+// pipParallelFlags returns the `pip install` flags enabling the parallelism features supported by the pip in use if
+// GOOGLE_PIP_PARALLEL is set. Features the pip in use does not support are skipped.
+func pipParallelFlags(ctx *gcp.Context) []string {
+	parallel, err := env.IsPresentAndTrue(env.PipParallel)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.PipParallel, err)
+	}
+	if !parallel {
+		return nil
+	}
+	v, err := PipVersion(ctx)
+	if err != nil {
+		ctx.Debugf("Failed to determine the pip version, not enabling %s: %v", env.PipParallel, err)
+		return nil
+	}
+	flags := parallelFlags(v)
+	if len(flags) == 0 {
+		ctx.Debugf("pip %s does not support any of the features enabled by %s", v, env.PipParallel)
+		return nil
+	}
+	ctx.Logf("Enabling pip %s features: %s", v, strings.Join(flags, " "))
+	return flags
+}
+
+// parallelFlags returns the flags enabling the features of pipParallelFeatures supported by pip version v. No features
+// are enabled if v cannot be parsed.
+func parallelFlags(v string) []string {
+	var flags []string
+	for _, f := range pipParallelFeatures {
+		if ok, err := version.Satisfies(v, f.constraint); err == nil && ok {
+			flags = append(flags, "--use-feature="+f.feature)
+		}
+	}
+	return flags
+}
+
+// VirtualenvDirs returns the top-level directories of dir, relative to it, that contain a virtualenv, identified by its
+// pyvenv.cfg file.
+func VirtualenvDirs(dir string) ([]string, error) {
+	cfgs, err := filepath.Glob(filepath.Join(dir, "*", "pyvenv.cfg"))
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, cfg := range cfgs {
+		rel, err := filepath.Rel(dir, filepath.Dir(cfg))
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, rel)
+	}
+	return dirs, nil
+}
+
+// InstallTarget returns the directory in layer l that dependencies are installed into and that is added to PYTHONPATH:
+// the subdirectory named by GOOGLE_PIP_TARGET if it is set, or the layer itself.
+func InstallTarget(l *layers.Layer) (string, error) {
+	sub := os.Getenv(env.PipTarget)
+	if sub == "" {
+		return l.Root, nil
+	}
+	sub = filepath.Clean(sub)
+	if filepath.IsAbs(sub) || sub == "." || sub == ".." || strings.HasPrefix(sub, "../") {
+		return "", gcp.UserErrorf("%s must be a relative path within the dependencies layer, got %q", env.PipTarget, os.Getenv(env.PipTarget))
+	}
+	return filepath.Join(l.Root, sub), nil
+}
+
+// RecordDependencies records the packages installed in dir of layer l, if requested for the build report or the
+// dependency count check.
+func RecordDependencies(ctx *gcp.Context, l *layers.Layer, dir string) {
+	if !ctx.DependenciesRequested() {
+		return
+	}
+	result, err := ctx.ExecWithErr(PipCommand(ctx, "freeze", "--path", dir))
+	if err != nil {
+		ctx.Warnf("Failed to list installed packages, skipping dependencies in build report: %v", err)
+		return
+	}
+	ctx.RecordDependencies(filepath.Base(l.Root), parseFreeze(result.Stdout))
+}
+
+// parseFreeze returns the packages pinned to a version in the output of `pip freeze`.
+func parseFreeze(out string) []gcp.Dependency {
+	var deps []gcp.Dependency
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "==", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		deps = append(deps, gcp.Dependency{Name: parts[0], Version: parts[1]})
+	}
+	return deps
+}
+
 // CheckCache checks whether cached dependencies exist and match.
 func CheckCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool, *Metadata, error) {
 	currentPythonVersion := Version(ctx)
@@ -61,7 +322,7 @@ func CheckCache(ctx *gcp.Context, l *layers.Layer, opts ...cache.Option) (bool,
 	// Perform install, skipping if the dependency hash matches existing metadata.
 	ctx.Debugf("Current dependency hash: %q", currentDependencyHash)
 	ctx.Debugf("  Cache dependency hash: %q", meta.DependencyHash)
-	if currentDependencyHash == meta.DependencyHash && !expired {
+	if currentDependencyHash == meta.DependencyHash && !expired && !ctx.ClearCacheRequested() {
 		ctx.Logf("Dependencies cache hit, skipping installation.")
 		return true, &meta, nil
 	}
@@ -0,0 +1,245 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+func TestParseFreeze(t *testing.T) {
+	out := "click==7.1.2\nFlask==1.1.2\n-e git+https://github.com/org/repo@abc#egg=repo\n\n"
+	want := []gcp.Dependency{{Name: "click", Version: "7.1.2"}, {Name: "Flask", Version: "1.1.2"}}
+
+	if got := parseFreeze(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFreeze(%q) = %v, want %v", out, got, want)
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	testCases := []struct {
+		name  string
+		dirs  []string
+		files []string
+		env   string
+		want  string
+	}{
+		{
+			name: "no wheelhouse",
+		},
+		{
+			name: "wheels dir",
+			dirs: []string{"wheels"},
+			want: "wheels",
+		},
+		{
+			name:  "wheels file",
+			files: []string{"wheels"},
+		},
+		{
+			name: "env overrides wheels dir",
+			dirs: []string{"wheels"},
+			env:  "vendor/wheels",
+			want: "vendor/wheels",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "python")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for _, d := range tc.dirs {
+				if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+					t.Fatalf("creating %s: %v", d, err)
+				}
+			}
+			for _, f := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatalf("writing %s: %v", f, err)
+				}
+			}
+			if tc.env != "" {
+				os.Setenv(env.PipFindLinks, tc.env)
+				defer os.Unsetenv(env.PipFindLinks)
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			if got := FindLinks(ctx); got != tc.want {
+				t.Errorf("FindLinks() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInstallTarget(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "layer root",
+			want: "/layers/pip",
+		},
+		{
+			name: "subdirectory",
+			env:  "app",
+			want: "/layers/pip/app",
+		},
+		{
+			name: "nested subdirectory",
+			env:  "deps/app/",
+			want: "/layers/pip/deps/app",
+		},
+		{
+			name:    "absolute",
+			env:     "/app",
+			wantErr: true,
+		},
+		{
+			name:    "outside layer",
+			env:     "app/../../other",
+			wantErr: true,
+		},
+		{
+			name:    "layer itself",
+			env:     "./",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != "" {
+				os.Setenv(env.PipTarget, tc.env)
+				defer os.Unsetenv(env.PipTarget)
+			}
+
+			got, err := InstallTarget(&layers.Layer{Root: "/layers/pip"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("InstallTarget() got error %v, want error? %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("InstallTarget() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithFindLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wheels")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"flask-1.1.2-py2.py3-none-any.whl", "click-7.1.2-py2.py3-none-any.whl"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	got, err := WithFindLinks(dir)()
+	if err != nil {
+		t.Fatalf("WithFindLinks(%q) got error: %v", dir, err)
+	}
+	want := []string{dir, "click-7.1.2-py2.py3-none-any.whl", "flask-1.1.2-py2.py3-none-any.whl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WithFindLinks(%q) = %v, want %v", dir, got, want)
+	}
+
+	if got, err := WithFindLinks("")(); err != nil || got != nil {
+		t.Errorf(`WithFindLinks("") = %v, %v, want nil, nil`, got, err)
+	}
+}
+
+func TestVirtualenvDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "venvs")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{".venv/pyvenv.cfg", "env/pyvenv.cfg", "src/main.py", "nested/venv/pyvenv.cfg"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating dir for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	got, err := VirtualenvDirs(dir)
+	if err != nil {
+		t.Fatalf("VirtualenvDirs() got error: %v", err)
+	}
+	if want := []string{".venv", "env"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VirtualenvDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestParallelFlags(t *testing.T) {
+	testCases := []struct {
+		version string
+		want    []string
+	}{
+		{version: "20.2.4", want: []string{"--use-feature=fast-deps"}},
+		{version: "21.0", want: []string{"--use-feature=fast-deps"}},
+		{version: "20.1.1"},
+		{version: "9.0.1"},
+		{version: "unknown"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			if got := parallelFlags(tc.version); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parallelFlags(%q) = %v, want %v", tc.version, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPipParallelFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pip-parallel-")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pip := filepath.Join(dir, "pip")
+	if err := ioutil.WriteFile(pip, []byte("#!/bin/sh\necho 'pip 20.2.4 from /usr/lib/python3/dist-packages/pip (python 3.8)'\n"), 0755); err != nil {
+		t.Fatalf("Writing fake pip: %v", err)
+	}
+	os.Setenv(env.PipBin, pip)
+	defer os.Unsetenv(env.PipBin)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+
+	if got := pipParallelFlags(ctx); got != nil {
+		t.Errorf("pipParallelFlags() without %s = %v, want nil", env.PipParallel, got)
+	}
+
+	os.Setenv(env.PipParallel, "true")
+	defer os.Unsetenv(env.PipParallel)
+	if got, want := pipParallelFlags(ctx), []string{"--use-feature=fast-deps"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pipParallelFlags() = %v, want %v", got, want)
+	}
+}
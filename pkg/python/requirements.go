@@ -0,0 +1,250 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// reqNameRegexp matches the package name at the start of a requirement specifier, see PEP 508.
+	reqNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+	// eggNameRegexp matches the package name of a URL or editable requirement.
+	eggNameRegexp = regexp.MustCompile(`#egg=([A-Za-z0-9][A-Za-z0-9._-]*)`)
+	// nameSeparatorRegexp matches the runs of separators that are equivalent in package names, see PEP 503.
+	nameSeparatorRegexp = regexp.MustCompile(`[-_.]+`)
+	// includeRegexp matches a line that includes another requirements file.
+	includeRegexp = regexp.MustCompile(`^(-r|--requirement)(\s+|=)(\S+)$`)
+	// filePathOptionRegexp matches an option whose relative path pip resolves relative to the requirements file.
+	filePathOptionRegexp = regexp.MustCompile(`^(-c|--constraint|-f|--find-links)(\s+|=)(\S+)$`)
+)
+
+// nativePackages are the normalized names of packages with native extensions that publish no wheels for Linux, so
+// that pip compiles them from source.
+var nativePackages = map[string]bool{
+	"dlib":        true,
+	"mysqlclient": true,
+	"psycopg2":    true,
+	"pycrypto":    true,
+	"python-ldap": true,
+	"uwsgi":       true,
+}
+
+// requirementSet is a list of requirements lines that are replaced by later lines with the same key.
+type requirementSet struct {
+	lines []string
+	index map[string]int
+	// exclude holds the cleaned paths of the included files to leave out.
+	exclude map[string]bool
+	// inline keeps every line, rather than replacing lines with the same key.
+	inline bool
+	// dir is the directory that the merged file is written to, to which the paths of options that pip resolves relative
+	// to the requirements file are rewritten. Paths are kept unchanged if it is empty.
+	dir string
+}
+
+func (s *requirementSet) add(key, line string) {
+	if s.inline {
+		s.lines = append(s.lines, line)
+		return
+	}
+	if i, ok := s.index[key]; ok {
+		s.lines[i] = line
+		return
+	}
+	s.index[key] = len(s.lines)
+	s.lines = append(s.lines, line)
+}
+
+// MergeRequirements merges the requirements files into the contents of a single requirements file, which installs
+// the same packages as installing each file in order with `pip install -r`. When a package is required by more than
+// one file, the last requirement wins, at the position of the first one. Requirements with different environment
+// markers are kept separately. Files included with `-r` are merged in place, and other options are kept once.
+func MergeRequirements(files ...string) (string, error) {
+	return MergeRequirementsExcluding(nil, files...)
+}
+
+// MergeRequirementsExcluding is like MergeRequirements, but leaves out the requirements files in exclude when they are
+// included with `-r`. Paths in exclude are relative to the working directory, like files.
+func MergeRequirementsExcluding(exclude []string, files ...string) (string, error) {
+	return newRequirementSet(exclude).merge(files...)
+}
+
+// InlineRequirementsExcluding returns the contents of the requirements file with the files it includes with `-r`
+// inlined, leaving out those in exclude. Unlike MergeRequirements, every line is kept, so that pip reports duplicate
+// and conflicting requirements as it would for file. The paths of `-c` and `--find-links` options are rewritten for the
+// contents to be written to the directory of file, as pip resolves them relative to the file that contains them.
+func InlineRequirementsExcluding(exclude []string, file string) (string, error) {
+	s := newRequirementSet(exclude)
+	s.inline = true
+	s.dir = filepath.Dir(file)
+	return s.merge(file)
+}
+
+// newRequirementSet returns an empty requirementSet that leaves out the included files in exclude.
+func newRequirementSet(exclude []string) *requirementSet {
+	s := &requirementSet{index: map[string]int{}, exclude: map[string]bool{}}
+	for _, e := range exclude {
+		s.exclude[filepath.Clean(e)] = true
+	}
+	return s
+}
+
+// merge adds the requirements files in order and returns the contents of the merged file.
+func (s *requirementSet) merge(files ...string) (string, error) {
+	for _, f := range files {
+		if err := s.addFile(f, map[string]bool{}); err != nil {
+			return "", err
+		}
+	}
+	if len(s.lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(s.lines, "\n") + "\n", nil
+}
+
+// addFile adds the requirements in file and the files it includes. seen holds the files being merged, to detect
+// cyclic includes.
+func (s *requirementSet) addFile(file string, seen map[string]bool) error {
+	file = filepath.Clean(file)
+	if seen[file] {
+		return fmt.Errorf("requirements file %s includes itself", file)
+	}
+	seen[file] = true
+	defer delete(seen, file)
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading requirements file: %w", err)
+	}
+	for _, line := range requirementLines(string(content)) {
+		if m := includeRegexp.FindStringSubmatch(line); m != nil {
+			inc := m[3]
+			if !filepath.IsAbs(inc) {
+				// pip resolves included files relative to the including file.
+				inc = filepath.Join(filepath.Dir(file), inc)
+			}
+			if s.exclude[filepath.Clean(inc)] {
+				continue
+			}
+			if err := s.addFile(inc, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.dir != "" {
+			rewritten, err := s.rewritePath(line, filepath.Dir(file))
+			if err != nil {
+				return err
+			}
+			line = rewritten
+		}
+		s.add(requirementKey(line), line)
+	}
+	return nil
+}
+
+// rewritePath rewrites the relative path of an option that pip resolves relative to the requirements file in fileDir,
+// so that it resolves to the same path relative to s.dir. Other lines are returned unchanged.
+func (s *requirementSet) rewritePath(line, fileDir string) (string, error) {
+	m := filePathOptionRegexp.FindStringSubmatch(line)
+	if m == nil || filepath.IsAbs(m[3]) || strings.Contains(m[3], "://") {
+		return line, nil
+	}
+	rel, err := filepath.Rel(s.dir, filepath.Join(fileDir, m[3]))
+	if err != nil {
+		return "", fmt.Errorf("rewriting %q: %v", line, err)
+	}
+	return m[1] + m[2] + rel, nil
+}
+
+// requirementLines returns the non-empty lines of a requirements file, with continuations joined and comments
+// removed.
+func requirementLines(content string) []string {
+	var lines []string
+	var cur string
+	for _, raw := range strings.Split(content, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if strings.HasSuffix(raw, `\`) {
+			cur += strings.TrimSuffix(raw, `\`)
+			continue
+		}
+		line := cur + raw
+		cur = ""
+		// A comment starts with # at the start of a line or after whitespace.
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, "\t#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if line := strings.Join(strings.Fields(cur), " "); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// requirementKey returns the key that identifies line among merged requirements: the normalized package name and
+// environment marker of a requirement, or the line itself for options and requirements without a name.
+func requirementKey(line string) string {
+	if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "-e") && !strings.HasPrefix(line, "--editable") {
+		return line
+	}
+	var name string
+	if m := eggNameRegexp.FindStringSubmatch(line); m != nil {
+		name = m[1]
+	} else if u := strings.Index(line, "://"); u < 0 || strings.Contains(line[:u], "@") {
+		// A URL is only named in the `name @ url` form.
+		name = reqNameRegexp.FindString(line)
+	}
+	if name == "" {
+		return line
+	}
+	key := strings.ToLower(nameSeparatorRegexp.ReplaceAllString(name, "-"))
+	if i := strings.Index(line, ";"); i >= 0 {
+		key += ";" + strings.Join(strings.Fields(line[i+1:]), "")
+	}
+	return key
+}
+
+// NativeRequirements returns the names of the packages required by the requirements file, including the files it
+// includes, that are compiled from source with a C compiler, in the order they are required.
+func NativeRequirements(file string) ([]string, error) {
+	merged, err := MergeRequirements(file)
+	if err != nil {
+		return nil, err
+	}
+	var native []string
+	seen := make(map[string]bool)
+	for _, line := range requirementLines(merged) {
+		name := strings.SplitN(requirementKey(line), ";", 2)[0]
+		if nativePackages[name] && !seen[name] {
+			seen[name] = true
+			native = append(native, name)
+		}
+	}
+	return native, nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRequirements(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		merge []string
+		want  string
+	}{
+		{
+			name: "later wins",
+			files: map[string]string{
+				"a.txt": "flask==1.1.2\nrequests>=2.0  # HTTP\n",
+				"b.txt": "# Overrides.\nFlask==2.0.1\ngunicorn\n",
+			},
+			merge: []string{"a.txt", "b.txt"},
+			want:  "Flask==2.0.1\nrequests>=2.0\ngunicorn\n",
+		},
+		{
+			name: "normalized names",
+			files: map[string]string{
+				"a.txt": "google_cloud.storage==1.0\n",
+				"b.txt": "Google-Cloud-Storage==2.0\n",
+			},
+			merge: []string{"a.txt", "b.txt"},
+			want:  "Google-Cloud-Storage==2.0\n",
+		},
+		{
+			name: "markers kept separately",
+			files: map[string]string{
+				"a.txt": "numpy==1.19.5; python_version < \"3.7\"\nnumpy==1.21.0; python_version >= \"3.7\"\n",
+				"b.txt": "numpy==1.21.2; python_version >= \"3.7\"\n",
+			},
+			merge: []string{"a.txt", "b.txt"},
+			want:  "numpy==1.19.5; python_version < \"3.7\"\nnumpy==1.21.2; python_version >= \"3.7\"\n",
+		},
+		{
+			name: "urls and options",
+			files: map[string]string{
+				"a.txt": "--extra-index-url https://example.com/simple\nmylib @ https://example.com/mylib-1.0.tar.gz\n-e git+https://example.com/repo.git#egg=tool\n",
+				"b.txt": "--extra-index-url https://example.com/simple\nmylib==2.0\ntool==1.0\n",
+			},
+			merge: []string{"a.txt", "b.txt"},
+			want:  "--extra-index-url https://example.com/simple\nmylib==2.0\ntool==1.0\n",
+		},
+		{
+			name: "includes and continuations",
+			files: map[string]string{
+				"requirements.txt":     "-r sub/base.txt\nflask==2.0.1 \\\n    --hash=sha256:abc\n",
+				"sub/base.txt":         "flask==1.0\n--requirement=common.txt\n",
+				"sub/common.txt":       "six==1.15.0\n",
+				"requirements-dev.txt": "six==1.16.0\n",
+			},
+			merge: []string{"requirements.txt", "requirements-dev.txt"},
+			want:  "flask==2.0.1 --hash=sha256:abc\nsix==1.16.0\n",
+		},
+		{
+			name:  "empty",
+			files: map[string]string{"a.txt": "# Nothing.\n\n"},
+			merge: []string{"a.txt"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "test-merge-requirements-")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range tc.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir for %s: %v", name, err)
+				}
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+			var files []string
+			for _, f := range tc.merge {
+				files = append(files, filepath.Join(dir, f))
+			}
+
+			got, err := MergeRequirements(files...)
+			if err != nil {
+				t.Fatalf("MergeRequirements() got error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("MergeRequirements() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeRequirementsExcluding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-merge-requirements-excluding-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"requirements.txt":     "-r requirements-dev.txt\n-r sub/base.txt\nflask==2.0.1\n",
+		"requirements-dev.txt": "pytest==6.2.4\n",
+		"sub/base.txt":         "-r test.txt\nsix==1.15.0\n",
+		"sub/test.txt":         "mock==4.0.3\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		exclude []string
+		want    string
+	}{
+		{
+			name: "nothing excluded",
+			want: "pytest==6.2.4\nmock==4.0.3\nsix==1.15.0\nflask==2.0.1\n",
+		},
+		{
+			name:    "top-level include excluded",
+			exclude: []string{"requirements-dev.txt"},
+			want:    "mock==4.0.3\nsix==1.15.0\nflask==2.0.1\n",
+		},
+		{
+			name:    "nested include excluded",
+			exclude: []string{"requirements-dev.txt", "./sub/test.txt"},
+			want:    "six==1.15.0\nflask==2.0.1\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var exclude []string
+			for _, e := range tc.exclude {
+				exclude = append(exclude, filepath.Join(dir, e))
+			}
+
+			got, err := MergeRequirementsExcluding(exclude, filepath.Join(dir, "requirements.txt"))
+			if err != nil {
+				t.Fatalf("MergeRequirementsExcluding() got error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("MergeRequirementsExcluding() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInlineRequirementsExcluding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-inline-requirements-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"requirements.txt":     "-r requirements-dev.txt\n-r sub/base.txt\n-c constraints.txt\nflask==2.0.1\n",
+		"requirements-dev.txt": "pytest==6.2.4\n",
+		"sub/base.txt":         "-c base-constraints.txt\n--find-links ./wheels\n-f https://example.com/wheels\nflask==1.1.2\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	got, err := InlineRequirementsExcluding([]string{filepath.Join(dir, "requirements-dev.txt")}, filepath.Join(dir, "requirements.txt"))
+	if err != nil {
+		t.Fatalf("InlineRequirementsExcluding() got error: %v", err)
+	}
+	// Paths in sub/base.txt are rewritten relative to the top-level file, and the conflicting flask requirements are
+	// both kept for pip to report.
+	want := "-c sub/base-constraints.txt\n--find-links sub/wheels\n-f https://example.com/wheels\nflask==1.1.2\n-c constraints.txt\nflask==2.0.1\n"
+	if got != want {
+		t.Errorf("InlineRequirementsExcluding() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeRequirementsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-merge-requirements-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cyclic := filepath.Join(dir, "cyclic.txt")
+	if err := ioutil.WriteFile(cyclic, []byte("flask\n-r cyclic.txt\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", cyclic, err)
+	}
+
+	for _, f := range []string{cyclic, filepath.Join(dir, "missing.txt")} {
+		if _, err := MergeRequirements(f); err == nil {
+			t.Errorf("MergeRequirements(%q) got nil error, want error", f)
+		}
+	}
+}
+
+func TestNativeRequirements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-native-requirements-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"requirements.txt": "flask==1.1.2\nPsycoPG2>=2.8 ; python_version >= '3.6'\n-r db.txt\npsycopg2-binary\n",
+		"db.txt":           "mysqlclient  # Needs libmysqlclient-dev.\npsycopg2\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	got, err := NativeRequirements(filepath.Join(dir, "requirements.txt"))
+	if err != nil {
+		t.Fatalf("NativeRequirements() got error: %v", err)
+	}
+	want := []string{"psycopg2", "mysqlclient"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NativeRequirements() got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+const pyprojectFile = "pyproject.toml"
+
+// pyproject represents the parts of pyproject.toml that are relevant to the build.
+type pyproject struct {
+	Project struct {
+		RequiresPython string `toml:"requires-python"`
+	} `toml:"project"`
+}
+
+// RequiresPython returns the requires-python specifier declared in pyproject.toml, or an empty string if there is none.
+func RequiresPython(ctx *gcp.Context) (string, error) {
+	path := filepath.Join(ctx.ApplicationRoot(), pyprojectFile)
+	if !ctx.FileExists(path) {
+		return "", nil
+	}
+	var p pyproject
+	if _, err := toml.DecodeFile(path, &p); err != nil {
+		return "", gcp.UserErrorf("parsing %s: %v", pyprojectFile, err)
+	}
+	return strings.TrimSpace(p.Project.RequiresPython), nil
+}
+
+// CheckRequiresPython returns a user error if version does not satisfy the requires-python specifier declared in
+// pyproject.toml. If GOOGLE_REQUIRES_PYTHON_LENIENT is set, a warning is emitted instead.
+func CheckRequiresPython(ctx *gcp.Context, version string) error {
+	spec, err := RequiresPython(ctx)
+	if err != nil || spec == "" {
+		return err
+	}
+	release, err := parseRelease(version)
+	if err != nil {
+		return gcp.UserErrorf("unable to check Python %s against requires-python %q in %s: %v. Specify a final release such as 3.9.1 with %s or .python-version.", version, spec, pyprojectFile, err, env.RuntimeVersion)
+	}
+	ok, err := satisfies(version, release, spec)
+	if err != nil {
+		return gcp.UserErrorf("invalid requires-python %q in %s: %v", spec, pyprojectFile, err)
+	}
+	if ok {
+		return nil
+	}
+	lenient, err := env.IsPresentAndTrue(env.RequiresPythonLenient)
+	if err != nil {
+		ctx.Warnf("%s env var must be parseable to a bool: %v", env.RequiresPythonLenient, err)
+	}
+	if lenient {
+		ctx.Warnf("Python %s does not satisfy requires-python %q in %s.", version, spec, pyprojectFile)
+		return nil
+	}
+	return gcp.UserErrorf("Python %s does not satisfy requires-python %q in %s. Specify a compatible version with %s or .python-version, or set %s=true to continue anyway.", version, spec, pyprojectFile, env.RuntimeVersion, env.RequiresPythonLenient)
+}
+
+// satisfies returns true if version, whose release segments are release, matches every clause of the
+// comma-separated PEP 440 specifier spec. Errors are those of spec.
+func satisfies(version string, release []int, spec string) (bool, error) {
+	for _, clause := range strings.Split(spec, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		op := strings.TrimRightFunc(clause, func(r rune) bool { return r != '=' && r != '<' && r != '>' && r != '!' && r != '~' })
+		want := strings.TrimSpace(clause[len(op):])
+		ok, err := matchClause(version, release, op, want)
+		if err != nil {
+			return false, fmt.Errorf("clause %q: %v", clause, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchClause returns true if version, whose release segments are v, matches the single specifier clause with
+// operator op and version want.
+func matchClause(version string, v []int, op, want string) (bool, error) {
+	if op == "===" {
+		// Arbitrary equality compares versions as strings.
+		return strings.TrimSpace(version) == want, nil
+	}
+	wildcard := strings.HasSuffix(want, ".*")
+	if wildcard && op != "==" && op != "!=" {
+		return false, fmt.Errorf("wildcard is only allowed with == and !=")
+	}
+	w, err := parseRelease(strings.TrimSuffix(want, ".*"))
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "==":
+		if wildcard {
+			return hasPrefix(v, w), nil
+		}
+		return compareRelease(v, w) == 0, nil
+	case "!=":
+		if wildcard {
+			return !hasPrefix(v, w), nil
+		}
+		return compareRelease(v, w) != 0, nil
+	case ">=":
+		return compareRelease(v, w) >= 0, nil
+	case "<=":
+		return compareRelease(v, w) <= 0, nil
+	case ">":
+		return compareRelease(v, w) > 0, nil
+	case "<":
+		return compareRelease(v, w) < 0, nil
+	case "~=":
+		// ~=3.8.1 is equivalent to >=3.8.1, ==3.8.*.
+		if len(w) < 2 {
+			return false, fmt.Errorf("~= requires at least two release segments")
+		}
+		return compareRelease(v, w) >= 0 && hasPrefix(v, w[:len(w)-1]), nil
+	}
+	return false, fmt.Errorf("unsupported operator %q", op)
+}
+
+// parseRelease parses the numeric release segments of a version such as 3.8.5.
+func parseRelease(version string) ([]int, error) {
+	var release []int
+	for _, s := range strings.Split(strings.TrimSpace(version), ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		release = append(release, n)
+	}
+	return release, nil
+}
+
+// compareRelease compares two releases, padding the shorter one with zeros.
+func compareRelease(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// hasPrefix returns true if the release v starts with the segments of prefix, padding v with zeros.
+func hasPrefix(v, prefix []int) bool {
+	for i, p := range prefix {
+		var x int
+		if i < len(v) {
+			x = v[i]
+		}
+		if x != p {
+			return false
+		}
+	}
+	return true
+}
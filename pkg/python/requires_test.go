@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestSatisfies(t *testing.T) {
+	testCases := []struct {
+		version string
+		spec    string
+		want    bool
+		wantErr bool
+	}{
+		{version: "3.8.5", spec: ">=3.7", want: true},
+		{version: "3.8.5", spec: ">=3.9", want: false},
+		{version: "3.8.5", spec: ">=3.7, <3.9", want: true},
+		{version: "3.9.0", spec: ">=3.7,<3.9", want: false},
+		{version: "3.8.5", spec: "==3.8.*", want: true},
+		{version: "3.9.1", spec: "==3.8.*", want: false},
+		{version: "3.8.5", spec: "!=3.8.*", want: false},
+		{version: "3.8.0", spec: "==3.8", want: true},
+		{version: "3.8.5", spec: "~=3.8", want: true},
+		{version: "4.0.0", spec: "~=3.8", want: false},
+		{version: "3.8.5", spec: "~=3.8.1", want: true},
+		{version: "3.9.0", spec: "~=3.8.1", want: false},
+		{version: "3.8.5", spec: ">3.8", want: true},
+		{version: "3.8.5", spec: "<=3.8", want: false},
+		{version: "3.8.5", spec: "===3.8.5", want: true},
+		{version: "3.8.0", spec: "===3.8", want: false},
+		{version: "3.8.5", spec: "~=3", wantErr: true},
+		{version: "3.8.5", spec: ">=3.*", wantErr: true},
+		{version: "3.8.5", spec: "3.8", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.version+" "+tc.spec, func(t *testing.T) {
+			release, err := parseRelease(tc.version)
+			if err != nil {
+				t.Fatalf("parseRelease(%q) got error: %v", tc.version, err)
+			}
+			got, err := satisfies(tc.version, release, tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("satisfies(%q, %q) got error %v, want error? %t", tc.version, tc.spec, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("satisfies(%q, %q) = %t, want %t", tc.version, tc.spec, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckRequiresPython(t *testing.T) {
+	testCases := []struct {
+		name      string
+		pyproject string
+		version   string
+		lenient   bool
+		wantErr   string
+	}{
+		{
+			name: "no pyproject.toml",
+		},
+		{
+			name:      "no requires-python",
+			pyproject: "[project]\nname = \"app\"\n",
+		},
+		{
+			name:      "compatible",
+			pyproject: "[project]\nrequires-python = \">=3.7\"\n",
+		},
+		{
+			name:      "incompatible",
+			pyproject: "[project]\nrequires-python = \">=3.9\"\n",
+			wantErr:   "does not satisfy",
+		},
+		{
+			name:      "incompatible lenient",
+			pyproject: "[project]\nrequires-python = \">=3.9\"\n",
+			lenient:   true,
+		},
+		{
+			name:      "invalid toml",
+			pyproject: "[project\n",
+			wantErr:   "parsing pyproject.toml",
+		},
+		{
+			name:      "invalid requires-python",
+			pyproject: "[project]\nrequires-python = \"3.9\"\n",
+			wantErr:   "invalid requires-python",
+		},
+		{
+			name:      "pre-release Python version",
+			pyproject: "[project]\nrequires-python = \">=3.7\"\n",
+			version:   "3.9.0rc1",
+			wantErr:   "unable to check Python 3.9.0rc1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "python")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if tc.pyproject != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, pyprojectFile), []byte(tc.pyproject), 0644); err != nil {
+					t.Fatalf("writing %s: %v", pyprojectFile, err)
+				}
+			}
+			if tc.lenient {
+				os.Setenv(env.RequiresPythonLenient, "true")
+				defer os.Unsetenv(env.RequiresPythonLenient)
+			}
+
+			version := tc.version
+			if version == "" {
+				version = "3.8.5"
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			err = CheckRequiresPython(ctx, version)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckRequiresPython() got error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("CheckRequiresPython() got error %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
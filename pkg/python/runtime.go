@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/version"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+const (
+	pythonURL = "https://storage.googleapis.com/gcp-buildpacks/python/python-%s.tar.gz"
+	// pythonPlatformURL is the location of a platform-specific Python archive, keyed by version, OS and architecture.
+	pythonPlatformURL = "https://storage.googleapis.com/gcp-buildpacks/python/python-%s-%s-%s.tar.gz"
+	// pythonListURL lists the names of the Python archives of a minor version, using the Cloud Storage JSON API.
+	pythonListURL = "https://storage.googleapis.com/storage/v1/b/gcp-buildpacks/o?fields=items(name)&prefix=python/python-%s."
+)
+
+// archiveVersionRegexp matches the full version in the object name of a Python archive, with or without a platform
+// suffix, e.g. "3.8.6" in python/python-3.8.6-linux-amd64.tar.gz.
+var archiveVersionRegexp = regexp.MustCompile(`^python/python-(\d+\.\d+\.\d+)(-[^/]*)?\.tar\.gz$`)
+
+// versionMetadata represents metadata stored for a layer that a Python version is installed in.
+type versionMetadata struct {
+	Version string `toml:"version"`
+}
+
+// InstallRuntime downloads Python version for the current platform and extracts it into dir. A version that has not
+// been published is reported as a user error.
+func InstallRuntime(ctx *gcp.Context, version, dir string) error {
+	archiveURL, err := ctx.FindArtifactURL(runtimeURLs(version, ctx.Platform())...)
+	if err != nil {
+		return gcp.UserErrorf("Runtime version %s does not exist: %v. You can specify the version with %s.", version, err, env.RuntimeVersion)
+	}
+	tmp := ctx.TempDir("", "python")
+	defer ctx.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "python.tar.gz")
+	if err := ctx.Download(archiveURL, archive); err != nil {
+		return gcp.DownloadErrorf(err, "downloading Python v%s", version)
+	}
+	ctx.Exec([]string{"tar", "xzf", archive, "--directory", dir})
+	return nil
+}
+
+// LatestPatchVersion returns the latest published release of the given major and minor Python version, for example
+// 3.8.6 for 3.8. A minor version without releases is reported as a user error.
+func LatestPatchVersion(ctx *gcp.Context, minor string) (string, error) {
+	listURL := fmt.Sprintf(pythonListURL, minor)
+	listing, err := ctx.DownloadString(listURL)
+	if err != nil {
+		return "", gcp.DownloadErrorf(err, "listing Python %s releases", minor)
+	}
+	v, err := latestArchiveVersion([]byte(listing))
+	if err != nil {
+		return "", gcp.InternalErrorf("parsing Python releases from %s: %v", listURL, err)
+	}
+	if v == "" {
+		return "", gcp.UserErrorf("Runtime version %s does not exist. You can specify the version with %s.", minor, env.RuntimeVersion)
+	}
+	return v, nil
+}
+
+// latestArchiveVersion returns the latest version among the Python archives in a Cloud Storage object listing, or an
+// empty string if it has none.
+func latestArchiveVersion(listing []byte) (string, error) {
+	var objects struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(listing, &objects); err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, item := range objects.Items {
+		m := archiveVersionRegexp.FindStringSubmatch(item.Name)
+		if m == nil {
+			continue
+		}
+		if latest == "" {
+			latest = m[1]
+			continue
+		}
+		if c, err := version.Compare(m[1], latest); err == nil && c > 0 {
+			latest = m[1]
+		}
+	}
+	return latest, nil
+}
+
+// InstallVersion installs Python version into a build-only layer named after it, reusing it if the version is already
+// cached, and returns the path of its interpreter. Unlike the runtime installed by the python/runtime buildpack, it is
+// not added to PATH or the launch image, so that several versions can be installed side by side, for example to test
+// an application against each of them.
+func InstallVersion(ctx *gcp.Context, version string) (string, error) {
+	name := "python-" + version
+	l := ctx.Layer(name)
+	python := filepath.Join(l.Root, "bin", "python3")
+
+	var meta versionMetadata
+	ctx.ReadMetadata(l, &meta)
+	if meta.Version == version && !ctx.ClearCacheRequested() {
+		ctx.CacheHit(name)
+		return python, nil
+	}
+	ctx.CacheMiss(name)
+	ctx.ClearLayer(l)
+
+	ctx.Logf("Installing Python v%s in %s", version, l.Root)
+	if err := InstallRuntime(ctx, version, l.Root); err != nil {
+		return "", err
+	}
+	meta.Version = version
+	ctx.WriteMetadata(l, meta, layers.Build, layers.Cache)
+	return python, nil
+}
+
+// runtimeURLs returns the candidate archive URLs for the given version and platform, most specific first.
+// Archives published before multi-arch support carry no platform suffix and are only built for linux/amd64.
+func runtimeURLs(version string, p gcp.Platform) []string {
+	urls := []string{fmt.Sprintf(pythonPlatformURL, version, p.OS, p.Arch)}
+	if p.OS == "linux" && p.Arch == "amd64" {
+		urls = append(urls, fmt.Sprintf(pythonURL, version))
+	}
+	return urls
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestRuntimeURLs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		platform gcp.Platform
+		want     []string
+	}{
+		{
+			name:     "linux amd64 falls back to legacy archive",
+			platform: gcp.Platform{OS: "linux", Arch: "amd64"},
+			want: []string{
+				"https://storage.googleapis.com/gcp-buildpacks/python/python-3.8.0-linux-amd64.tar.gz",
+				"https://storage.googleapis.com/gcp-buildpacks/python/python-3.8.0.tar.gz",
+			},
+		},
+		{
+			name:     "linux arm64",
+			platform: gcp.Platform{OS: "linux", Arch: "arm64"},
+			want: []string{
+				"https://storage.googleapis.com/gcp-buildpacks/python/python-3.8.0-linux-arm64.tar.gz",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := runtimeURLs("3.8.0", tc.platform)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("runtimeURLs(3.8.0, %s) = %v, want %v", tc.platform, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLatestArchiveVersion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		listing string
+		want    string
+	}{
+		{
+			name: "latest patch",
+			listing: `{"items": [
+				{"name": "python/python-3.8.9.tar.gz"},
+				{"name": "python/python-3.8.10-linux-amd64.tar.gz"},
+				{"name": "python/python-3.8.2.tar.gz"}
+			]}`,
+			want: "3.8.10",
+		},
+		{
+			name:    "ignores other objects",
+			listing: `{"items": [{"name": "python/python-3.8.6.tar.gz"}, {"name": "python/python-3.8.7.tar.gz.sha256"}]}`,
+			want:    "3.8.6",
+		},
+		{
+			name:    "no archives",
+			listing: `{}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := latestArchiveVersion([]byte(tc.listing))
+			if err != nil {
+				t.Fatalf("latestArchiveVersion() got unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("latestArchiveVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLatestPatchVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	ctx.SetDownloader(gcp.FakeDownloader{
+		fmt.Sprintf(pythonListURL, "3.8"): []byte(`{"items": [{"name": "python/python-3.8.5.tar.gz"}, {"name": "python/python-3.8.6.tar.gz"}]}`),
+		fmt.Sprintf(pythonListURL, "3.1"): []byte(`{}`),
+	})
+
+	got, err := LatestPatchVersion(ctx, "3.8")
+	if err != nil {
+		t.Fatalf("LatestPatchVersion(3.8) got unexpected error: %v", err)
+	}
+	if got != "3.8.6" {
+		t.Errorf("LatestPatchVersion(3.8) = %q, want %q", got, "3.8.6")
+	}
+
+	if _, err := LatestPatchVersion(ctx, "3.1"); err == nil {
+		t.Error("LatestPatchVersion(3.1) got nil error, want error")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+// WheelCacheDir returns the directory in layer l that wheels built from source distributions are cached in for the
+// current Python version and platform, creating it and removing those of other versions and platforms. Unlike pip's
+// own wheel cache, the directory survives the dependency layers being cleared on a cache miss.
+func WheelCacheDir(ctx *gcp.Context, l *layers.Layer) string {
+	p := ctx.Platform()
+	key := fmt.Sprintf("%s-%s-%s", strings.Join(strings.Fields(strings.ToLower(Version(ctx))), "-"), p.OS, p.Arch)
+	// Wheels built for another interpreter cannot be installed, so the layer is recreated keeping only this one's.
+	ctx.ClearLayerExcept(l, key)
+	dir := filepath.Join(l.Root, key)
+	ctx.MkdirAll(dir, 0755)
+	return dir
+}
+
+// SaveBuiltWheels copies the wheels that pip built from source distributions, which it stores in the wheels
+// directory of pipCache, into dir so that they can be installed with `--find-links` by later builds.
+func SaveBuiltWheels(ctx *gcp.Context, pipCache, dir string) {
+	wheels, err := builtWheels(filepath.Join(pipCache, "wheels"))
+	if err != nil {
+		ctx.Warnf("Failed to find built wheels, skipping wheel cache: %v", err)
+		return
+	}
+	for _, w := range wheels {
+		dst := filepath.Join(dir, filepath.Base(w))
+		if ctx.FileExists(dst) {
+			continue
+		}
+		ctx.Debugf("Caching built wheel %s.", filepath.Base(w))
+		ctx.Exec([]string{"cp", w, dst}, gcp.WithUserTimingAttribution)
+	}
+}
+
+// FindLinksEnv returns the PIP_FIND_LINKS env var that makes pip install dependencies from the wheels cached in dir,
+// as well as from the locations the user set in PIP_FIND_LINKS, if any.
+func FindLinksEnv(dir string) string {
+	if user := strings.TrimSpace(os.Getenv("PIP_FIND_LINKS")); user != "" {
+		return "PIP_FIND_LINKS=" + dir + " " + user
+	}
+	return "PIP_FIND_LINKS=" + dir
+}
+
+// PruneWheels removes the wheels in dir that are not installed in target, such as those of dependencies that were
+// removed or upgraded, so that the cache does not grow across builds. Nothing is removed if no installed distribution
+// is found in target.
+func PruneWheels(ctx *gcp.Context, dir, target string) {
+	installed := map[string]bool{}
+	for _, d := range ctx.Glob(filepath.Join(target, "*.dist-info")) {
+		name := strings.TrimSuffix(filepath.Base(d), ".dist-info")
+		// Versions do not contain dashes, but the names of distributions installed by older tools may.
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			installed[distributionKey(name[:i], name[i+1:])] = true
+		}
+	}
+	if len(installed) == 0 {
+		ctx.Debugf("No installed distributions found in %s, keeping cached wheels.", target)
+		return
+	}
+	for _, w := range ctx.Glob(filepath.Join(dir, "*.whl")) {
+		// Wheel file names start with the escaped name and the version of the distribution, separated by dashes.
+		parts := strings.SplitN(filepath.Base(w), "-", 3)
+		if len(parts) == 3 && installed[distributionKey(parts[0], parts[1])] {
+			continue
+		}
+		ctx.Debugf("Removing cached wheel %s, which is no longer installed.", filepath.Base(w))
+		ctx.RemoveAll(w)
+	}
+}
+
+// distributionKey returns a key identifying the distribution name at version, with the name normalized as in PEP 503.
+func distributionKey(name, version string) string {
+	return strings.ToLower(nameSeparatorRegexp.ReplaceAllString(name, "-")) + " " + version
+}
+
+// builtWheels returns the paths of the wheel files in dir and its subdirectories.
+func builtWheels(dir string) ([]string, error) {
+	var wheels []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".whl") {
+			wheels = append(wheels, path)
+		}
+		return nil
+	})
+	return wheels, err
+}
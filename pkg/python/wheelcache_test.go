@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+	"github.com/buildpack/libbuildpack/layers"
+)
+
+func TestSaveBuiltWheels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pipCache := filepath.Join(dir, "pipcache")
+	files := []string{
+		"wheels/1a/2b/numpy-1.19.1-cp38-cp38-linux_x86_64.whl",
+		"wheels/3c/4d/cryptography-3.0-cp38-cp38-linux_x86_64.whl",
+		"wheels/3c/4d/pip-wheel-metadata.json",
+		"http/5e/6f/downloaded",
+	}
+	for _, f := range files {
+		path := filepath.Join(pipCache, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+	wheels := filepath.Join(dir, "wheels")
+	if err := os.MkdirAll(wheels, 0755); err != nil {
+		t.Fatalf("creating %s: %v", wheels, err)
+	}
+
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	SaveBuiltWheels(ctx, pipCache, wheels)
+
+	got, err := filepath.Glob(filepath.Join(wheels, "*"))
+	if err != nil {
+		t.Fatalf("globbing %s: %v", wheels, err)
+	}
+	want := []string{
+		filepath.Join(wheels, "cryptography-3.0-cp38-cp38-linux_x86_64.whl"),
+		filepath.Join(wheels, "numpy-1.19.1-cp38-cp38-linux_x86_64.whl"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SaveBuiltWheels() saved %v, want %v", got, want)
+	}
+}
+
+func TestSaveBuiltWheelsNoCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	SaveBuiltWheels(ctx, filepath.Join(dir, "missing"), dir)
+
+	if got, err := filepath.Glob(filepath.Join(dir, "*")); err != nil || len(got) != 0 {
+		t.Errorf("SaveBuiltWheels() with missing pip cache saved %v (err: %v), want nothing", got, err)
+	}
+}
+
+func TestPruneWheels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wheels := filepath.Join(dir, "wheels")
+	target := filepath.Join(dir, "target")
+	files := []string{
+		"wheels/numpy-1.19.1-cp38-cp38-linux_x86_64.whl",
+		"wheels/numpy-1.18.0-cp38-cp38-linux_x86_64.whl",
+		"wheels/zope.interface-5.1.0-cp38-cp38-linux_x86_64.whl",
+		"wheels/cryptography-3.0-cp38-cp38-linux_x86_64.whl",
+		"target/numpy-1.19.1.dist-info/METADATA",
+		"target/zope.interface-5.1.0.dist-info/METADATA",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	PruneWheels(ctx, wheels, target)
+
+	got, err := filepath.Glob(filepath.Join(wheels, "*"))
+	if err != nil {
+		t.Fatalf("globbing %s: %v", wheels, err)
+	}
+	want := []string{
+		filepath.Join(wheels, "numpy-1.19.1-cp38-cp38-linux_x86_64.whl"),
+		filepath.Join(wheels, "zope.interface-5.1.0-cp38-cp38-linux_x86_64.whl"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PruneWheels() kept %v, want %v", got, want)
+	}
+}
+
+func TestFindLinksEnv(t *testing.T) {
+	if got, want := FindLinksEnv("/layers/wheels"), "PIP_FIND_LINKS=/layers/wheels"; got != want {
+		t.Errorf("FindLinksEnv() = %q, want %q", got, want)
+	}
+	os.Setenv("PIP_FIND_LINKS", "https://example.com/wheels /vendor")
+	defer os.Unsetenv("PIP_FIND_LINKS")
+	if got, want := FindLinksEnv("/layers/wheels"), "PIP_FIND_LINKS=/layers/wheels https://example.com/wheels /vendor"; got != want {
+		t.Errorf("FindLinksEnv() with user PIP_FIND_LINKS = %q, want %q", got, want)
+	}
+}
+
+func TestWheelCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "python")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	l := &layers.Layer{Root: filepath.Join(dir, "pipwheels")}
+	ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+	wheels := WheelCacheDir(ctx, l)
+	kept := filepath.Join(wheels, "numpy-1.19.1-cp38-cp38-linux_x86_64.whl")
+	stale := filepath.Join(l.Root, "python-2.7.18-linux-amd64", "numpy-1.16.6-cp27-cp27mu-linux_x86_64.whl")
+	for _, f := range []string{kept, stale} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(f), err)
+		}
+		if err := ioutil.WriteFile(f, nil, 0644); err != nil {
+			t.Fatalf("writing %s: %v", f, err)
+		}
+	}
+
+	if got := WheelCacheDir(ctx, l); got != wheels {
+		t.Errorf("WheelCacheDir() = %q, want %q", got, wheels)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("WheelCacheDir() removed %s, want it kept: %v", kept, err)
+	}
+	if _, err := os.Stat(filepath.Dir(stale)); !os.IsNotExist(err) {
+		t.Errorf("WheelCacheDir() kept %s, want it removed", filepath.Dir(stale))
+	}
+}
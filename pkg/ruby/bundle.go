@@ -0,0 +1,34 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruby
+
+import (
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+// defaultWithout are the groups excluded from production installs unless GOOGLE_BUNDLE_WITHOUT is set.
+var defaultWithout = []string{"development", "test"}
+
+// BundleWithout returns the Gemfile groups to exclude from a production install: the groups set in
+// GOOGLE_BUNDLE_WITHOUT if it is set, even to an empty string, or otherwise development and test.
+func BundleWithout() []string {
+	if v, ok := os.LookupEnv(env.BundleWithout); ok {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' || r == ':' })
+	}
+	return append([]string(nil), defaultWithout...)
+}
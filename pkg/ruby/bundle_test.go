@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruby
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+)
+
+func TestBundleWithout(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  *string
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"development", "test"},
+		},
+		{
+			name: "env overrides",
+			env:  stringPtr("development, ci"),
+			want: []string{"development", "ci"},
+		},
+		{
+			name: "empty env installs all groups",
+			env:  stringPtr(""),
+			want: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != nil {
+				os.Setenv(env.BundleWithout, *tc.env)
+				defer os.Unsetenv(env.BundleWithout)
+			}
+
+			if got := BundleWithout(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("BundleWithout() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
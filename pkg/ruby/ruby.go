@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ruby contains Ruby buildpack library code.
+package ruby
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+const (
+	// versionFile is the file used by Ruby version managers such as rbenv and rvm.
+	versionFile = ".ruby-version"
+)
+
+var (
+	// rubyDirectiveRegexp matches the version in a Gemfile `ruby "x.y.z"` directive.
+	rubyDirectiveRegexp = regexp.MustCompile(`(?m)^\s*ruby\s*\(?\s*["']([^"']+)["']`)
+)
+
+// versionSource is a requested version and where it was specified.
+type versionSource struct {
+	source  string
+	version string
+}
+
+// RequestedVersion returns the Ruby version requested by the application, or an empty string if none is requested.
+// The version is read from .ruby-version, the ruby directive of the Gemfile (or gems.rb), and GOOGLE_RUNTIME_VERSION,
+// in priority order. A warning is emitted for each source that requests a different version than the one returned.
+func RequestedVersion(ctx *gcp.Context) (string, error) {
+	var sources []versionSource
+
+	path := filepath.Join(ctx.ApplicationRoot(), versionFile)
+	if ctx.FileExists(path) {
+		v := normalizeVersion(string(ctx.ReadFileNormalized(path)))
+		if v == "" {
+			return "", gcp.UserErrorf("%s exists but does not specify a version", versionFile)
+		}
+		sources = append(sources, versionSource{source: versionFile, version: v})
+	}
+
+	for _, gemfile := range []string{"Gemfile", "gems.rb"} {
+		path := filepath.Join(ctx.ApplicationRoot(), gemfile)
+		if !ctx.FileExists(path) {
+			continue
+		}
+		if m := rubyDirectiveRegexp.FindStringSubmatch(string(ctx.ReadFileNormalized(path))); m != nil {
+			sources = append(sources, versionSource{source: gemfile, version: normalizeVersion(m[1])})
+		}
+		break
+	}
+
+	if v := normalizeVersion(os.Getenv(env.RuntimeVersion)); v != "" {
+		sources = append(sources, versionSource{source: env.RuntimeVersion, version: v})
+	}
+
+	if len(sources) == 0 {
+		return "", nil
+	}
+	want := sources[0]
+	for _, s := range sources[1:] {
+		if s.version != want.version {
+			ctx.Warnf("Ruby version %s requested by %s conflicts with version %s requested by %s, using %s.", s.version, s.source, want.version, want.source, want.version)
+		}
+	}
+	ctx.Logf("Using Ruby version from %s: %s", want.source, want.version)
+	return want.version, nil
+}
+
+// normalizeVersion strips whitespace, an exact-match operator, and the `ruby-` prefix used by version managers.
+func normalizeVersion(v string) string {
+	v = strings.TrimSpace(v)
+	v = strings.TrimSpace(strings.TrimPrefix(v, "="))
+	return strings.TrimPrefix(v, "ruby-")
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruby
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestRequestedVersion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     string
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "ruby-version takes precedence",
+			env:   "2.5.8",
+			files: map[string]string{".ruby-version": "2.7.1\n", "Gemfile": "source 'https://rubygems.org'\nruby '2.6.6'\n"},
+			want:  "2.7.1",
+		},
+		{
+			name:  "ruby-version with prefix",
+			files: map[string]string{".ruby-version": "ruby-2.7.1\r\n"},
+			want:  "2.7.1",
+		},
+		{
+			name:  "gemfile before env var",
+			env:   "2.5.8",
+			files: map[string]string{"Gemfile": "source 'https://rubygems.org'\nruby \"2.6.6\"\ngem 'rails'\n"},
+			want:  "2.6.6",
+		},
+		{
+			name:  "gems.rb",
+			files: map[string]string{"gems.rb": "ruby(\"2.6.6\")\n"},
+			want:  "2.6.6",
+		},
+		{
+			name:  "gemfile without directive",
+			env:   "2.5.8",
+			files: map[string]string{"Gemfile": "gem 'rails'\n"},
+			want:  "2.5.8",
+		},
+		{
+			name: "env var",
+			env:  " 2.5.8 ",
+			want: "2.5.8",
+		},
+		{
+			name:    "empty ruby-version",
+			files:   map[string]string{".ruby-version": "\n"},
+			wantErr: true,
+		},
+		{
+			name: "no source",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "ruby-version-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, contents := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+					t.Fatalf("writing %s: %v", name, err)
+				}
+			}
+			if tc.env != "" {
+				os.Setenv(env.RuntimeVersion, tc.env)
+				defer os.Unsetenv(env.RuntimeVersion)
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			got, err := RequestedVersion(ctx)
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("RequestedVersion() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("RequestedVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
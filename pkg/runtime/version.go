@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/appyaml"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+const (
+	// toolVersionsFile is the asdf version file, which lists one tool and its versions per line.
+	toolVersionsFile = ".tool-versions"
+)
+
+// runtimeHintRegexp matches the version embedded in an App Engine runtime name: a single-digit major version followed
+// by the minor version, e.g. "39" in python39.
+var runtimeHintRegexp = regexp.MustCompile(`^(\d)(\d+)$`)
+
+// VersionResolver resolves a runtime version from a single source.
+type VersionResolver interface {
+	// ResolveVersion returns the version specified by the source, or an empty string if the source does not specify one.
+	ResolveVersion(ctx *gcp.Context) (string, error)
+}
+
+// EnvVar resolves the version from the named environment variable.
+type EnvVar string
+
+// ResolveVersion implements VersionResolver.
+func (e EnvVar) ResolveVersion(ctx *gcp.Context) (string, error) {
+	v := strings.TrimSpace(os.Getenv(string(e)))
+	if v != "" {
+		ctx.Logf("Using runtime version from %s: %s", e, v)
+	}
+	return v, nil
+}
+
+// File resolves the version from the contents of the named file in the application root.
+// A file that exists but is empty is a user error.
+type File string
+
+// ResolveVersion implements VersionResolver.
+func (f File) ResolveVersion(ctx *gcp.Context) (string, error) {
+	path := filepath.Join(ctx.ApplicationRoot(), string(f))
+	if !ctx.FileExists(path) {
+		return "", nil
+	}
+	v := strings.TrimSpace(string(ctx.ReadFileNormalized(path)))
+	if v == "" {
+		return "", gcp.UserErrorf("%s exists but does not specify a version", f)
+	}
+	ctx.Logf("Using runtime version from %s: %s", f, v)
+	return v, nil
+}
+
+// ToolVersions resolves the version of the named tool from the .tool-versions file in the application root.
+// When several versions are listed for the tool, the first is used.
+type ToolVersions string
+
+// ResolveVersion implements VersionResolver.
+func (t ToolVersions) ResolveVersion(ctx *gcp.Context) (string, error) {
+	path := filepath.Join(ctx.ApplicationRoot(), toolVersionsFile)
+	if !ctx.FileExists(path) {
+		return "", nil
+	}
+	for _, line := range strings.Split(string(ctx.ReadFileNormalized(path)), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != string(t) {
+			continue
+		}
+		ctx.Logf("Using runtime version from %s: %s", toolVersionsFile, fields[1])
+		return fields[1], nil
+	}
+	return "", nil
+}
+
+// AppYAMLRuntime resolves the major and minor version embedded in the runtime field of app.yaml when it names the
+// given runtime, for example 3.9 for `runtime: python39` and AppYAMLRuntime{Name: "python", Major: "3"}. It resolves no
+// version if app.yaml does not exist or cannot be parsed, names another runtime, names a runtime without a version, or
+// names a major version other than Major, such as the legacy python27 runtime.
+type AppYAMLRuntime struct {
+	// Name is the runtime name, such as python.
+	Name string
+	// Major is the only major version the runtime supports.
+	Major string
+}
+
+// ResolveVersion implements VersionResolver.
+func (a AppYAMLRuntime) ResolveVersion(ctx *gcp.Context) (string, error) {
+	path := appyaml.Path(ctx.ApplicationRoot())
+	if !ctx.FileExists(path) {
+		return "", nil
+	}
+	rt, err := appyaml.Runtime(path)
+	if err != nil {
+		// app.yaml is only read as a hint, App Engine reports problems with the file itself.
+		ctx.WarnfForTarget(gcp.TargetAppEngine, "Ignoring the runtime field of %s: %v", filepath.Base(path), err)
+		return "", nil
+	}
+	if !strings.HasPrefix(rt, a.Name) {
+		return "", nil
+	}
+	m := runtimeHintRegexp.FindStringSubmatch(strings.TrimPrefix(rt, a.Name))
+	if m == nil {
+		return "", nil
+	}
+	if m[1] != a.Major {
+		ctx.Debugf("Ignoring unsupported runtime %s in %s", rt, filepath.Base(path))
+		return "", nil
+	}
+	v := m[1] + "." + m[2]
+	ctx.Logf("Found runtime version in %s: %s (%s)", filepath.Base(path), v, rt)
+	return v, nil
+}
+
+// Network resolves the latest version by fetching the given URL, which must respond with a bare version string.
+type Network string
+
+// ResolveVersion implements VersionResolver.
+func (n Network) ResolveVersion(ctx *gcp.Context) (string, error) {
+	body, err := ctx.DownloadString(string(n))
+	if err != nil {
+		return "", gcp.DownloadErrorf(err, "fetching latest version from %s", n)
+	}
+	v := strings.TrimSpace(body)
+	if v != "" {
+		ctx.Logf("Using latest runtime version: %s", v)
+	}
+	return v, nil
+}
+
+// Chain resolves the version from the first of its resolvers to specify one, in order.
+type Chain []VersionResolver
+
+// ResolveVersion implements VersionResolver.
+func (c Chain) ResolveVersion(ctx *gcp.Context) (string, error) {
+	for _, r := range c {
+		v, err := r.ResolveVersion(ctx)
+		if err != nil || v != "" {
+			return v, err
+		}
+	}
+	return "", nil
+}
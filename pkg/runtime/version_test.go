@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestChainResolveVersion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     string
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "env var takes precedence",
+			env:   "3.8.1",
+			files: map[string]string{".python-version": "3.7.0", ".tool-versions": "python 3.6.0"},
+			want:  "3.8.1",
+		},
+		{
+			name:  "file before tool versions",
+			files: map[string]string{".python-version": "3.7.0\n", ".tool-versions": "python 3.6.0"},
+			want:  "3.7.0",
+		},
+		{
+			name:  "crlf file",
+			files: map[string]string{".python-version": "3.7.0\r\n"},
+			want:  "3.7.0",
+		},
+		{
+			name:  "crlf tool versions",
+			files: map[string]string{".tool-versions": "nodejs 12.0.0\r\npython 3.6.0\r\n"},
+			want:  "3.6.0",
+		},
+		{
+			name:  "tool versions",
+			files: map[string]string{".tool-versions": "# comment\nnodejs 12.0.0\npython 3.6.0 3.5.0\n"},
+			want:  "3.6.0",
+		},
+		{
+			name:  "tool versions without tool",
+			files: map[string]string{".tool-versions": "nodejs 12.0.0\n"},
+			want:  "",
+		},
+		{
+			name:    "empty file",
+			files:   map[string]string{".python-version": " \n"},
+			wantErr: true,
+		},
+		{
+			name: "no source",
+			want: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "version-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, contents := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+					t.Fatalf("writing %s: %v", name, err)
+				}
+			}
+			const envName = "TEST_RUNTIME_VERSION"
+			if tc.env != "" {
+				os.Setenv(envName, tc.env)
+				defer os.Unsetenv(envName)
+			}
+
+			ctx := gcp.NewContextForTests(buildpack.Info{}, dir)
+			chain := Chain{EnvVar(envName), File(".python-version"), ToolVersions("python")}
+			got, err := chain.ResolveVersion(ctx)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ResolveVersion() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAppYAMLRuntimeResolveVersion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		appYAML string
+		want    string
+	}{
+		{name: "python39", appYAML: "runtime: python39\n", want: "3.9"},
+		{name: "python310", appYAML: "runtime: python310\n", want: "3.10"},
+		{name: "unsupported major version", appYAML: "runtime: python27\n"},
+		{name: "malformed app.yaml", appYAML: "runtime: [python39\n"},
+		{name: "flexible runtime without version", appYAML: "runtime: python\nenv: flex\n"},
+		{name: "other runtime", appYAML: "runtime: nodejs14\n"},
+		{name: "no runtime", appYAML: "service: default\n"},
+		{name: "no app.yaml"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "version-")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if tc.appYAML != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(tc.appYAML), 0644); err != nil {
+					t.Fatalf("writing app.yaml: %v", err)
+				}
+			}
+
+			got, err := AppYAMLRuntime{Name: "python", Major: "3"}.ResolveVersion(gcp.NewContextForTests(buildpack.Info{}, dir))
+			if err != nil {
+				t.Fatalf("ResolveVersion() got error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package usercommand implements buildpacks that run a user-provided shell command as a build step.
+package usercommand
+
+import (
+	"os"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// Command is a build step that runs the shell command set in an env var.
+type Command struct {
+	// Env is the env var that sets the command, such as GOOGLE_VERIFY_COMMAND.
+	Env string
+	// Action describes the step in the log line announcing the command, such as "Verifying the build with".
+	Action string
+}
+
+// DetectFn opts in if the env var of the command is set and not empty.
+func (c Command) DetectFn(ctx *gcp.Context) error {
+	if os.Getenv(c.Env) == "" {
+		ctx.OptOut("%s not set", c.Env)
+	}
+	return nil
+}
+
+// BuildFn runs the command with bash.
+func (c Command) BuildFn(ctx *gcp.Context) error {
+	cmd := os.Getenv(c.Env)
+	ctx.Logf("%s %s: %s", c.Action, c.Env, cmd)
+	// A failing command fails the build with the tail of its output.
+	ctx.Exec([]string{"bash", "-c", cmd}, gcp.WithUserAttribution, gcp.WithCombinedTail)
+	return nil
+}
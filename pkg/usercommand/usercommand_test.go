@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usercommand
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+	"github.com/buildpack/libbuildpack/buildpack"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name string
+		cmd  string
+		env  []string
+		want int
+	}{
+		{
+			name: "verify command set",
+			cmd:  env.VerifyCommand,
+			env:  []string{"GOOGLE_VERIFY_COMMAND=node -e \"require('./index.js')\""},
+			want: 0,
+		},
+		{
+			name: "verify command empty",
+			cmd:  env.VerifyCommand,
+			env:  []string{"GOOGLE_VERIFY_COMMAND="},
+			want: 100,
+		},
+		{
+			name: "verify command not set",
+			cmd:  env.VerifyCommand,
+			want: 100,
+		},
+		{
+			name: "prebuild command set",
+			cmd:  env.PrebuildCommand,
+			env:  []string{"GOOGLE_PREBUILD_COMMAND=npm run generate"},
+			want: 0,
+		},
+		{
+			name: "prebuild command empty",
+			cmd:  env.PrebuildCommand,
+			env:  []string{"GOOGLE_PREBUILD_COMMAND="},
+			want: 100,
+		},
+		{
+			name: "other command set",
+			cmd:  env.PrebuildCommand,
+			env:  []string{"GOOGLE_VERIFY_COMMAND=npm test"},
+			want: 100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Command{Env: tc.cmd, Action: "Running"}
+			gcp.TestDetect(t, c.DetectFn, tc.name, map[string]string{"index.js": ""}, tc.env, tc.want)
+		})
+	}
+}
+
+func TestBuildFn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usercommand-")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ran := filepath.Join(dir, "ran")
+	os.Setenv(env.PrebuildCommand, "touch "+ran)
+	defer os.Unsetenv(env.PrebuildCommand)
+
+	c := Command{Env: env.PrebuildCommand, Action: "Running"}
+	if err := c.BuildFn(gcp.NewContextForTests(buildpack.Info{}, dir)); err != nil {
+		t.Fatalf("BuildFn() got error: %v", err)
+	}
+	if _, err := os.Stat(ran); err != nil {
+		t.Errorf("command did not run: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version contains helpers to compare semantic versions.
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+var (
+	// versionRegexp matches full and partial versions, optionally prefixed with "v" and followed by a pre-release,
+	// e.g. "1", "v1.14", "3.8.2", "1.15beta1", "1.2.3-rc.1+build".
+	versionRegexp = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:[-.]?([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+	// operatorRegexp matches the comparison operator prefix of a range term, e.g. ">=" in ">=1.14".
+	operatorRegexp = regexp.MustCompile(`^[<>=!]*`)
+)
+
+// Parse parses a full or partial version string. Missing minor and patch components default to 0.
+func Parse(v string) (semver.Version, error) {
+	match := versionRegexp.FindStringSubmatch(strings.TrimSpace(v))
+	if match == nil {
+		return semver.Version{}, fmt.Errorf("invalid version %q", v)
+	}
+	normalized := fmt.Sprintf("%s.%s.%s", match[1], orZero(match[2]), orZero(match[3]))
+	if match[4] != "" {
+		normalized += "-" + match[4]
+	}
+	if match[5] != "" {
+		normalized += "+" + match[5]
+	}
+	return semver.Parse(normalized)
+}
+
+// Compare returns -1, 0, or 1 if a is less than, equal to, or greater than b, or an error if either cannot be parsed.
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// Satisfies returns true if v is within the given constraint, e.g. ">=3.8", "<1.14.0", or ">=1.0 <2.0 || >=3.0", or an
+// error if either v or constraint cannot be parsed.
+func Satisfies(v, constraint string) (bool, error) {
+	version, err := Parse(v)
+	if err != nil {
+		return false, err
+	}
+	r, err := parseRange(constraint)
+	if err != nil {
+		return false, fmt.Errorf("invalid version constraint %q: %v", constraint, err)
+	}
+	return r(version), nil
+}
+
+// parseRange parses a semver range, accepting partial versions in each term.
+func parseRange(constraint string) (semver.Range, error) {
+	var terms []string
+	for _, term := range strings.Fields(constraint) {
+		if term == "||" {
+			terms = append(terms, term)
+			continue
+		}
+		op := operatorRegexp.FindString(term)
+		v, err := Parse(strings.TrimPrefix(term, op))
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, op+v.String())
+	}
+	return semver.ParseRange(strings.Join(terms, " "))
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
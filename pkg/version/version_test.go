@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		v       string
+		want    string
+		wantErr bool
+	}{
+		{v: "1.2.3", want: "1.2.3"},
+		{v: "v1.2.3", want: "1.2.3"},
+		{v: "1.14", want: "1.14.0"},
+		{v: "3", want: "3.0.0"},
+		{v: " 3.8.2\n", want: "3.8.2"},
+		{v: "1.15beta1", want: "1.15.0-beta1"},
+		{v: "1.2.3-rc.1", want: "1.2.3-rc.1"},
+		{v: "1.2.3+build.5", want: "1.2.3+build.5"},
+		{v: "", wantErr: true},
+		{v: "python", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.v, func(t *testing.T) {
+			got, err := Parse(tc.v)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %q, want error", tc.v, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) got unexpected error: %v", tc.v, err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("Parse(%q) = %q, want %q", tc.v, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "3.7", b: "3.8", want: -1},
+		{a: "3.8", b: "3.8.0", want: 0},
+		{a: "3.10", b: "3.9", want: 1},
+		{a: "1.15beta1", b: "1.15", want: -1},
+		{a: "1.15rc1", b: "1.15beta2", want: 1},
+		{a: "v2", b: "1.99.99", want: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			got, err := Compare(tc.a, tc.b)
+			if err != nil {
+				t.Fatalf("Compare(%q, %q) got unexpected error: %v", tc.a, tc.b, err)
+			}
+			if got != tc.want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompareError(t *testing.T) {
+	for _, tc := range [][2]string{{"abc", "abd"}, {"1.0", "abc"}, {"abc", "1.0"}} {
+		if got, err := Compare(tc[0], tc[1]); err == nil {
+			t.Errorf("Compare(%q, %q) = %d, want error", tc[0], tc[1], got)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	testCases := []struct {
+		v          string
+		constraint string
+		want       bool
+	}{
+		{v: "1.13", constraint: "<1.14.0", want: true},
+		{v: "1.14", constraint: "<1.14.0", want: false},
+		{v: "3.8.2", constraint: ">=3.8", want: true},
+		{v: "3.7", constraint: ">=3.8", want: false},
+		{v: "1.5", constraint: ">=1.0 <2.0 || >=3.0", want: true},
+		{v: "2.5", constraint: ">=1.0 <2.0 || >=3.0", want: false},
+		{v: "3.1", constraint: ">=1.0 <2.0 || >=3.0", want: true},
+		{v: "1.15beta1", constraint: ">=1.15", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.v+" "+tc.constraint, func(t *testing.T) {
+			got, err := Satisfies(tc.v, tc.constraint)
+			if err != nil {
+				t.Fatalf("Satisfies(%q, %q) got unexpected error: %v", tc.v, tc.constraint, err)
+			}
+			if got != tc.want {
+				t.Errorf("Satisfies(%q, %q) = %t, want %t", tc.v, tc.constraint, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSatisfiesError(t *testing.T) {
+	for _, tc := range [][2]string{{"invalid", ">=1.0"}, {"1.0", ">=invalid"}} {
+		if got, err := Satisfies(tc[0], tc[1]); err == nil {
+			t.Errorf("Satisfies(%q, %q) = %t, want error", tc[0], tc[1], got)
+		}
+	}
+}